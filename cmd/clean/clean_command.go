@@ -12,6 +12,8 @@ import (
 
 var (
 	dryRun                 bool
+	recursive              bool
+	olderThan              time.Duration
 	eligibleForCleaningAge time.Duration
 )
 
@@ -24,9 +26,22 @@ var Command = &cli.Command{
 		&cli.BoolFlag{
 			Name:        "dry-run",
 			Value:       false,
-			Usage:       "Dry run.",
+			Usage:       "Print the files that would be deleted without deleting them.",
 			Destination: &dryRun,
 		},
+		&cli.BoolFlag{
+			Name:        "recursive",
+			Value:       true,
+			Usage:       "Scan the subdirectories.",
+			Aliases:     []string{"r"},
+			Destination: &recursive,
+		},
+		&cli.DurationFlag{
+			Name:        "older-than",
+			Value:       0,
+			Usage:       "Minimum age of the .ts files to be deleted. 0 disables the check.",
+			Destination: &olderThan,
+		},
 		&cli.DurationFlag{
 			Name:        "eligible-for-cleaning-age",
 			Value:       48 * time.Hour,
@@ -44,6 +59,8 @@ var Command = &cli.Command{
 
 		opts := []cleaner.Option{
 			cleaner.WithEligibleAge(eligibleForCleaningAge),
+			cleaner.WithRecursive(recursive),
+			cleaner.WithOlderThan(olderThan),
 		}
 
 		if dryRun {
@@ -14,8 +14,9 @@ import (
 )
 
 var (
-	extractAudio bool
-	outputFormat string
+	extractAudio   bool
+	outputFormat   string
+	chapterMarkers bool
 )
 
 // Command is the command for concating multiple files to another container.
@@ -38,6 +39,12 @@ var Command = &cli.Command{
 			Aliases:     []string{"x"},
 			Destination: &extractAudio,
 		},
+		&cli.BoolFlag{
+			Name:        "chapter-markers",
+			Value:       false,
+			Usage:       "Add a chapter at the start of each file.",
+			Destination: &chapterMarkers,
+		},
 	},
 	Action: func(cCtx *cli.Context) error {
 		ctx := cCtx.Context
@@ -53,6 +60,11 @@ var Command = &cli.Command{
 			}
 		}
 
+		var opts []concat.Option
+		if chapterMarkers {
+			opts = append(opts, concat.WithChapterMarkers())
+		}
+
 		fnameMuxed := prepareFile(files[0], strings.ToLower(outputFormat))
 		fnameAudio := prepareFile(files[0], "m4a")
 
@@ -60,7 +72,7 @@ var Command = &cli.Command{
 			Str("output", fnameMuxed).
 			Strs("input", files).
 			Msg("concat and remuxing streams...")
-		if err := concat.Do(ctx, fnameMuxed, files); err != nil {
+		if err := concat.Do(ctx, fnameMuxed, files, opts...); err != nil {
 			log.Err(err).
 				Str("output", fnameMuxed).
 				Strs("input", files).
@@ -68,7 +80,7 @@ var Command = &cli.Command{
 		}
 		if extractAudio {
 			log.Error().Str("output", fnameAudio).Strs("input", files).Msg("extrating audio...")
-			if err := concat.Do(ctx, fnameAudio, files, concat.WithAudioOnly()); err != nil {
+			if err := concat.Do(ctx, fnameAudio, files, append(opts, concat.WithAudioOnly())...); err != nil {
 				log.Err(err).
 					Str("output", fnameAudio).
 					Strs("input", files).
@@ -0,0 +1,58 @@
+# Prometheus alerting rules for withny-dl.
+#
+# Generated by `withny-dl generate-alerts`.
+groups:
+  - name: withny-dl
+    rules:
+      - alert: WithnyDLChannelStuckIdle
+        expr: {{ prom .Names.WatcherState }}{state="IDLE"} == 1
+        for: 30m
+        labels:
+          severity: info
+        annotations:
+          summary: 'Channel {{ "{{ $labels.channel_id }}" }} has been idle for more than 30 minutes'
+          description: 'The watcher of {{ "{{ $labels.channel_id }}" }} has been waiting for a stream for more than 30 minutes.'
+
+      - alert: WithnyDLDownloadErrorRateHigh
+        expr: |
+          sum(rate({{ prom .Names.DownloadsErrors }}_total[15m]))
+            / sum(rate({{ prom .Names.DownloadsRuns }}_total[15m])) > 0.05
+        for: 5m
+        labels:
+          severity: warning
+        annotations:
+          summary: 'Download error rate is above 5%'
+          description: 'The download error rate has been above 5% over the last 15 minutes (current value: {{ "{{ $value | humanizePercentage }}" }}).'
+
+      - alert: WithnyDLPostProcessingError
+        expr: increase({{ prom .Names.PostProcessingErrors }}_total[1h]) > 0
+        labels:
+          severity: warning
+        annotations:
+          summary: 'Post-processing failed for {{ "{{ $labels.channel_id }}" }}'
+          description: 'At least one post-processing step (remux, audio extraction or concat) of {{ "{{ $labels.channel_id }}" }} failed in the last hour.'
+
+      - alert: WithnyDLTokenRefreshFailed
+        expr: increase({{ prom .Names.AuthLoginFailures }}_total[15m]) > 0
+        labels:
+          severity: critical
+        annotations:
+          summary: 'Failed to refresh the withny token'
+          description: 'withny-dl failed to login or refresh its token in the last 15 minutes. Check the credentials.'
+
+      - alert: WithnyDLDiskSpaceLow
+        expr: {{ prom .Names.DiskAvailable }}_bytes < {{ .MinFreeDiskBytes }}
+        for: 5m
+        labels:
+          severity: critical
+        annotations:
+          summary: 'Disk space is running low'
+          description: 'The output filesystem has {{ "{{ $value | humanize1024 }}" }}B left, which is below the threshold of {{ .MinFreeDiskBytes }} bytes.'
+
+      - alert: WithnyDLUpdateAvailable
+        expr: {{ prom .Names.VersionUpdateAvailable }} == 1
+        labels:
+          severity: info
+        annotations:
+          summary: 'A new version of withny-dl is available'
+          description: 'A new release of withny-dl has been published. See https://github.com/Darkness4/withny-dl/releases.'
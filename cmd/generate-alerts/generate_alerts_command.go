@@ -0,0 +1,87 @@
+// Package generatealerts provides a command to generate Prometheus alerting rules.
+package generatealerts
+
+import (
+	_ "embed"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/Darkness4/withny-dl/telemetry/metrics"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+//go:embed alerts.yaml.tpl
+var alertsTemplate string
+
+var (
+	output           string
+	minFreeDiskBytes uint64
+)
+
+// Command is the command for generating Prometheus alerting rules.
+var Command = &cli.Command{
+	Name:  "generate-alerts",
+	Usage: "Generate a Prometheus alerting rules file.",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "output",
+			Value:       "alerts.yaml",
+			Usage:       "Output file path. Use '-' for stdout.",
+			Aliases:     []string{"o"},
+			Destination: &output,
+		},
+		&cli.Uint64Flag{
+			Name:        "min-free-disk-bytes",
+			Value:       10 * 1024 * 1024 * 1024,
+			Usage:       "Threshold of available bytes under which the disk space alert fires.",
+			Destination: &minFreeDiskBytes,
+		},
+	},
+	Action: func(_ *cli.Context) error {
+		var w io.Writer = os.Stdout
+		if output != "-" {
+			f, err := os.Create(output)
+			if err != nil {
+				log.Err(err).Str("output", output).Msg("failed to create file")
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		if err := Render(w, minFreeDiskBytes); err != nil {
+			log.Err(err).Msg("failed to render alerts")
+			return err
+		}
+		if output != "-" {
+			log.Info().Str("output", output).Msg("alerts generated")
+		}
+		return nil
+	},
+}
+
+// Render renders the alerting rules with the metric names of the metrics package.
+func Render(w io.Writer, minFreeDiskBytes uint64) error {
+	tmpl, err := template.New("alerts").Funcs(template.FuncMap{
+		"prom": promName,
+	}).Parse(alertsTemplate)
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, struct {
+		Names            map[string]string
+		MinFreeDiskBytes uint64
+	}{
+		Names:            metrics.Names,
+		MinFreeDiskBytes: minFreeDiskBytes,
+	})
+}
+
+// promName converts an OpenTelemetry instrument name to its Prometheus name (without suffixes).
+func promName(name string) string {
+	return strings.ReplaceAll(name, ".", "_")
+}
@@ -0,0 +1,40 @@
+package generatealerts_test
+
+import (
+	"bytes"
+	"testing"
+
+	generatealerts "github.com/Darkness4/withny-dl/cmd/generate-alerts"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestRender(t *testing.T) {
+	// Act
+	var buf bytes.Buffer
+	err := generatealerts.Render(&buf, 1024)
+
+	// Assert
+	require.NoError(t, err)
+	var rules struct {
+		Groups []struct {
+			Name  string `yaml:"name"`
+			Rules []struct {
+				Alert       string            `yaml:"alert"`
+				Expr        string            `yaml:"expr"`
+				Annotations map[string]string `yaml:"annotations"`
+			} `yaml:"rules"`
+		} `yaml:"groups"`
+	}
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &rules))
+	require.Len(t, rules.Groups, 1)
+	require.Len(t, rules.Groups[0].Rules, 6)
+	for _, rule := range rules.Groups[0].Rules {
+		require.NotEmpty(t, rule.Expr, rule.Alert)
+		require.NotEmpty(t, rule.Annotations["summary"], rule.Alert)
+		require.NotEmpty(t, rule.Annotations["description"], rule.Alert)
+	}
+	require.Contains(t, buf.String(), `watcher_state{state="IDLE"} == 1`)
+	require.Contains(t, buf.String(), `disk_available_bytes < 1024`)
+	require.Contains(t, buf.String(), `{{ $labels.channel_id }}`)
+}
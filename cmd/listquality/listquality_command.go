@@ -0,0 +1,93 @@
+// Package listquality provide a command for listing the available qualities of a live stream.
+package listquality
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Darkness4/withny-dl/utils/secret"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	credentialsFile   string
+	credentialsSource string
+)
+
+// Command is the command for listing the available qualities of a live stream.
+var Command = &cli.Command{
+	Name:      "list-quality",
+	Usage:     "Print the available playlists of a live stream and exit.",
+	ArgsUsage: "<channel ID>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "credentials-file",
+			Usage:       "Path to the file containing the credentials.",
+			Value:       "credentials.yaml",
+			EnvVars:     []string{"CREDENTIALS_FILE"},
+			Destination: &credentialsFile,
+		},
+		&cli.StringFlag{
+			Name:        "credentials-source",
+			Usage:       "Source of the credentials: file or keyring.",
+			Value:       "file",
+			EnvVars:     []string{"CREDENTIALS_SOURCE"},
+			Destination: &credentialsSource,
+		},
+	},
+	Action: func(cCtx *cli.Context) error {
+		ctx, cancel := context.WithCancel(cCtx.Context)
+		defer cancel()
+
+		// Trap cleanup
+		cleanChan := make(chan os.Signal, 1)
+		signal.Notify(cleanChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-cleanChan
+			cancel()
+		}()
+
+		channelID := cCtx.Args().First()
+		if channelID == "" {
+			return errors.New("missing channel ID")
+		}
+
+		jar, err := cookiejar.New(&cookiejar.Options{})
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to create cookie jar")
+		}
+		hclient := &http.Client{Jar: jar, Timeout: time.Minute}
+
+		var reader api.CredentialsReader
+		switch credentialsSource {
+		case "file":
+			reader = secret.NewReader(credentialsFile)
+		case "keyring":
+			reader = secret.NewKeyringReader()
+		default:
+			return fmt.Errorf("unknown credentials source: %s", credentialsSource)
+		}
+
+		client := api.NewClient(hclient, reader, secret.NewTmpCache())
+		if err := client.Login(ctx); err != nil {
+			log.Err(err).Msg("failed to login to withny")
+			return err
+		}
+
+		playlists, err := client.GetChannelPlaylists(ctx, channelID)
+		if err != nil {
+			log.Err(err).Str("channelID", channelID).Msg("failed to fetch playlists")
+			return err
+		}
+		return api.WritePlaylistTable(os.Stdout, playlists)
+	},
+}
@@ -17,10 +17,19 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
+var storeKeyring bool
+
 // Command is the command for logging in and testing the login.
 var Command = &cli.Command{
 	Name:  "login-test",
 	Usage: "Test the login.",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "store-keyring",
+			Usage:       "Store the credentials in the OS keyring after a successful login.",
+			Destination: &storeKeyring,
+		},
+	},
 	Action: func(cCtx *cli.Context) error {
 		ctx, cancel := context.WithCancel(cCtx.Context)
 
@@ -51,12 +60,13 @@ var Command = &cli.Command{
 			return err
 		}
 
+		cache := secret.NewTmpCache()
 		client := api.NewClient(hclient, &secret.Static{
 			SavedCredentials: api.SavedCredentials{
 				Username: username,
 				Password: password,
 			},
-		}, secret.NewTmpCache())
+		}, cache)
 		if err := client.Login(ctx); err != nil {
 			log.Err(err).
 				Msg("failed to login to withny")
@@ -64,6 +74,22 @@ var Command = &cli.Command{
 		}
 
 		log.Info().Msg("Login successful")
+
+		if storeKeyring {
+			creds := api.SavedCredentials{
+				Username: username,
+				Password: password,
+			}
+			if cached, err := cache.Get(); err == nil {
+				creds.Token = cached.Token
+				creds.RefreshToken = cached.RefreshToken
+			}
+			if err := secret.NewKeyringReader().Write(creds); err != nil {
+				log.Err(err).Msg("failed to store the credentials in the keyring")
+				return err
+			}
+			log.Info().Str("service", secret.KeyringService).Msg("credentials stored in the keyring")
+		}
 		return nil
 	},
 }
@@ -16,6 +16,8 @@ import (
 var (
 	extractAudio bool
 	outputFormat string
+	videoCodec   string
+	audioCodec   string
 )
 
 // Command is the command for remuxing a mpegts to another container.
@@ -38,6 +40,18 @@ var Command = &cli.Command{
 			Aliases:     []string{"x"},
 			Destination: &extractAudio,
 		},
+		&cli.StringFlag{
+			Name:        "video-codec",
+			Value:       remux.CodecCopy,
+			Usage:       "Video codec of the output, e.g. libx265. Any codec other than copy re-encodes with ffmpeg.",
+			Destination: &videoCodec,
+		},
+		&cli.StringFlag{
+			Name:        "audio-codec",
+			Value:       remux.CodecCopy,
+			Usage:       "Audio codec of the output, e.g. libopus. Any codec other than copy re-encodes with ffmpeg.",
+			Destination: &audioCodec,
+		},
 	},
 	Action: func(cCtx *cli.Context) error {
 		ctx := cCtx.Context
@@ -55,7 +69,13 @@ var Command = &cli.Command{
 		fnameAudio := prepareFile(file, "m4a")
 
 		log.Info().Str("output", fnameMuxed).Str("input", file).Msg("remuxing stream...")
-		if err := remux.Do(ctx, fnameMuxed, file); err != nil {
+		if err := remux.Do(
+			ctx,
+			fnameMuxed,
+			file,
+			remux.WithVideoCodec(videoCodec),
+			remux.WithAudioCodec(audioCodec),
+		); err != nil {
 			log.Err(err).
 				Str("output", fnameMuxed).
 				Str("input", file).
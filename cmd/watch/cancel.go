@@ -0,0 +1,30 @@
+package watch
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Darkness4/withny-dl/state"
+	"github.com/rs/zerolog/log"
+)
+
+// HandleCancel cancels the ongoing download of the channel "{channelID}".
+//
+// It responds 404 if the channel is not downloading.
+func HandleCancel(s *state.State) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		channelID := r.PathValue("channelID")
+		if !s.CancelChannel(channelID) {
+			http.Error(w, "channel is not downloading", http.StatusNotFound)
+			return
+		}
+		log.Info().Str("channelID", channelID).Msg("download canceled by user")
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct {
+			Cancelled bool `json:"cancelled"`
+		}{Cancelled: true}); err != nil {
+			log.Err(err).Msg("failed to write response")
+		}
+	}
+}
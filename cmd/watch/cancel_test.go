@@ -0,0 +1,121 @@
+package watch_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/cmd/watch"
+	"github.com/Darkness4/withny-dl/state"
+	"github.com/Darkness4/withny-dl/utils/secret"
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCancel(t *testing.T) {
+	// Arrange
+	stream := api.GetStreamsResponseElement{
+		UUID:            "stream",
+		Title:           "stream",
+		StreamingMethod: "HLS",
+	}
+	stream.Cast.AgencySecret.ChannelName = "cancel"
+	var playbackURLRequests, mediaPlaylistRequests atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/streams/with-rooms":
+			_ = json.NewEncoder(w).Encode(api.GetStreamsResponse{stream})
+		case r.URL.Path == "/api/user":
+			_, _ = w.Write([]byte(`{"username":"cancel"}`))
+		case strings.HasSuffix(r.URL.Path, "/playback-url"):
+			playbackURLRequests.Add(1)
+			_ = json.NewEncoder(w).Encode(server.URL + "/master.m3u8")
+		case r.URL.Path == "/master.m3u8":
+			fmt.Fprintf(w, `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,VIDEO="720p30",FRAME-RATE=30.000
+%s/media.m3u8
+`, server.URL)
+		case r.URL.Path == "/media.m3u8":
+			// A live stream without any fragment yet.
+			mediaPlaylistRequests.Add(1)
+			_, _ = w.Write([]byte("#EXTM3U\n#EXT-X-TARGETDURATION:1\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		secret.NewFileCache(filepath.Join(t.TempDir(), "credentials")),
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+	params := withny.DefaultParams.Clone()
+	params.OutFormat = filepath.Join(t.TempDir(), "{{ .Title }}.{{ .Ext }}")
+	params.WaitPollInterval = 10 * time.Millisecond
+	params.WaitPollJitter = 0
+	// Avoid the default post-processing, which requires FFmpeg.
+	params.PostProcessingPipeline = []string{withny.PostProcessingStepExtractSubtitles}
+	watcher := withny.NewChannelWatcher(api.NewClientPool(client), params, "cancel")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- watcher.Watch(ctx)
+	}()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /channels/{channelID}/cancel", watch.HandleCancel(&state.DefaultState))
+	cancelServer := httptest.NewServer(mux)
+	defer cancelServer.Close()
+	require.Eventually(t, func() bool {
+		return mediaPlaylistRequests.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Act
+	resp, err := cancelServer.Client().Post(cancelServer.URL+"/channels/cancel/cancel", "", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Assert
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body map[string]bool
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, map[string]bool{"cancelled": true}, body)
+	require.Eventually(t, func() bool {
+		return state.DefaultState.GetChannelState("cancel") == state.DownloadStateCanceled
+	}, 5*time.Second, 10*time.Millisecond)
+	// The canceled stream is not downloaded again by the next polls.
+	time.Sleep(100 * time.Millisecond)
+	require.EqualValues(t, 1, playbackURLRequests.Load())
+	require.Equal(t, state.DownloadStateCanceled, state.DefaultState.GetChannelState("cancel"))
+	cancel()
+	<-done
+}
+
+func TestHandleCancelNotDownloading(t *testing.T) {
+	// Arrange
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /channels/{channelID}/cancel", watch.HandleCancel(s))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Act
+	resp, err := server.Client().Post(server.URL+"/channels/channel/cancel", "", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Assert
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,55 @@
+package watch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Darkness4/withny-dl/state"
+	"github.com/rs/zerolog/log"
+)
+
+// HandleEvents streams the state events as server-sent events.
+//
+// Each event is sent as "data: <json>\n\n" until the client disconnects.
+func HandleEvents(emitter *state.StateEmitter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		events := emitter.Subscribe()
+		defer emitter.Unsubscribe(events)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		// Comment line, so that the client knows it is subscribed.
+		if _, err := fmt.Fprint(w, ": connected\n\n"); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Err(err).Msg("failed to marshal state event")
+					continue
+				}
+				if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+					return
+				}
+				flusher.Flush()
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package watch_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/cmd/watch"
+	"github.com/Darkness4/withny-dl/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleEvents(t *testing.T) {
+	// Arrange
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+		Emitter:  state.NewStateEmitter(),
+	}
+	server := httptest.NewServer(watch.HandleEvents(s.Emitter))
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, ": connected\n", line)
+
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			if strings.HasPrefix(line, "data: ") {
+				lines <- strings.TrimPrefix(strings.TrimSpace(line), "data: ")
+			}
+		}
+	}()
+
+	// Act
+	s.SetChannelState("channel", state.DownloadStateDownloading)
+
+	// Assert
+	select {
+	case data := <-lines:
+		var event state.StateEvent
+		require.NoError(t, json.Unmarshal([]byte(data), &event))
+		require.Equal(t, "channel", event.Channel)
+		require.Equal(t, state.DownloadStateDownloading, event.State)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("no event received within 100ms")
+	}
+}
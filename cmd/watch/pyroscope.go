@@ -0,0 +1,50 @@
+package watch
+
+import (
+	"github.com/grafana/pyroscope-go"
+	"github.com/rs/zerolog/log"
+)
+
+// PyroscopeConfig configures the push of the profiles to Pyroscope.
+type PyroscopeConfig struct {
+	Enabled       bool
+	ServerAddress string
+	AppName       string
+}
+
+// PyroscopeStartFunc starts a Pyroscope profiler, like pyroscope.Start.
+type PyroscopeStartFunc func(pyroscope.Config) (*pyroscope.Profiler, error)
+
+// StartPyroscope starts pushing the profiles to Pyroscope, if enabled.
+//
+// The returned function stops the profiler. Nothing is started, and no
+// connection is made, when the profiling is disabled.
+func StartPyroscope(cfg PyroscopeConfig, start PyroscopeStartFunc) (stop func(), err error) {
+	if !cfg.Enabled {
+		return func() {}, nil
+	}
+	profiler, err := start(pyroscope.Config{
+		ApplicationName: cfg.AppName,
+		ServerAddress:   cfg.ServerAddress,
+		ProfileTypes: []pyroscope.ProfileType{
+			pyroscope.ProfileCPU,
+			pyroscope.ProfileAllocObjects,
+			pyroscope.ProfileAllocSpace,
+			pyroscope.ProfileInuseObjects,
+			pyroscope.ProfileInuseSpace,
+			pyroscope.ProfileGoroutines,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Info().
+		Str("serverAddress", cfg.ServerAddress).
+		Str("appName", cfg.AppName).
+		Msg("pushing profiles to pyroscope")
+	return func() {
+		if err := profiler.Stop(); err != nil {
+			log.Err(err).Msg("failed to stop pyroscope profiler")
+		}
+	}, nil
+}
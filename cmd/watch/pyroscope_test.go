@@ -0,0 +1,53 @@
+package watch_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/cmd/watch"
+	"github.com/grafana/pyroscope-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartPyroscopeDisabled(t *testing.T) {
+	// Arrange
+	called := false
+	start := func(pyroscope.Config) (*pyroscope.Profiler, error) {
+		called = true
+		return nil, nil
+	}
+
+	// Act
+	stop, err := watch.StartPyroscope(watch.PyroscopeConfig{
+		Enabled:       false,
+		ServerAddress: "http://localhost:4040",
+		AppName:       "withny-dl",
+	}, start)
+
+	// Assert
+	require.NoError(t, err)
+	require.False(t, called, "pyroscope must not be started when disabled")
+	stop()
+}
+
+func TestStartPyroscopeEnabled(t *testing.T) {
+	// Arrange
+	var got pyroscope.Config
+	errStart := errors.New("unreachable")
+	start := func(cfg pyroscope.Config) (*pyroscope.Profiler, error) {
+		got = cfg
+		return nil, errStart
+	}
+
+	// Act
+	_, err := watch.StartPyroscope(watch.PyroscopeConfig{
+		Enabled:       true,
+		ServerAddress: "http://pyroscope:4040",
+		AppName:       "withny-dl",
+	}, start)
+
+	// Assert
+	require.ErrorIs(t, err, errStart)
+	require.Equal(t, "http://pyroscope:4040", got.ServerAddress)
+	require.Equal(t, "withny-dl", got.ApplicationName)
+}
@@ -6,10 +6,12 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -25,15 +27,19 @@ import (
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/trace/noop"
+	"golang.org/x/sync/semaphore"
 
+	"github.com/Darkness4/withny-dl/history"
 	"github.com/Darkness4/withny-dl/notify"
 	"github.com/Darkness4/withny-dl/notify/notifier"
 	"github.com/Darkness4/withny-dl/state"
 	"github.com/Darkness4/withny-dl/telemetry"
+	"github.com/Darkness4/withny-dl/telemetry/metrics"
 	"github.com/Darkness4/withny-dl/utils/secret"
 	"github.com/Darkness4/withny-dl/withny"
 	"github.com/Darkness4/withny-dl/withny/api"
 	"github.com/Darkness4/withny-dl/withny/cleaner"
+	"github.com/grafana/pyroscope-go"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
 )
@@ -46,6 +52,17 @@ var (
 	pprofListenAddress     string
 	enableTracesExporting  bool
 	enableMetricsExporting bool
+	historyPath            string
+	baseURL                string
+	encryptionKey          string
+	configCheck            bool
+	tokenRefreshMargin     time.Duration
+	pyroscopeConfig        PyroscopeConfig
+	stateDBPath            string
+	credentialsSource      string
+
+	gracefulShutdownTimeout     time.Duration
+	gracefulShutdownHardTimeout time.Duration
 )
 
 // Command is the command for watching multiple live withny streams.
@@ -60,6 +77,11 @@ var Command = &cli.Command{
 			Usage:       `Config file path. (required)`,
 			Destination: &configPath,
 		},
+		&cli.BoolFlag{
+			Name:        "config-check",
+			Usage:       "Check the config file and exit. Exits with code 1 if the config is invalid.",
+			Destination: &configCheck,
+		},
 		&cli.StringFlag{
 			Name:        "pprof.listen-address",
 			Value:       ":3000",
@@ -67,6 +89,27 @@ var Command = &cli.Command{
 			Usage:       "The address to listen on for pprof.",
 			EnvVars:     []string{"PPROF_LISTEN_ADDRESS"},
 		},
+		&cli.BoolFlag{
+			Name:        "pyroscope.enabled",
+			Usage:       "Enable the push of the profiles to Pyroscope.",
+			Value:       false,
+			Destination: &pyroscopeConfig.Enabled,
+			EnvVars:     []string{"PYROSCOPE_ENABLED"},
+		},
+		&cli.StringFlag{
+			Name:        "pyroscope.server-address",
+			Usage:       "The address of the Pyroscope server.",
+			Value:       "http://localhost:4040",
+			Destination: &pyroscopeConfig.ServerAddress,
+			EnvVars:     []string{"PYROSCOPE_SERVER_ADDRESS"},
+		},
+		&cli.StringFlag{
+			Name:        "pyroscope.app-name",
+			Usage:       "The application name of the profiles pushed to Pyroscope.",
+			Value:       "withny-dl",
+			Destination: &pyroscopeConfig.AppName,
+			EnvVars:     []string{"PYROSCOPE_APP_NAME"},
+		},
 		&cli.BoolFlag{
 			Name:        "traces.export",
 			Usage:       "Enable traces push. (To configure the exporter, set the OTEL_EXPORTER_OTLP_ENDPOINT environment variable, see https://opentelemetry.io/docs/languages/sdk-configuration/otlp-exporter/)",
@@ -81,8 +124,73 @@ var Command = &cli.Command{
 			Destination: &enableMetricsExporting,
 			EnvVars:     []string{"OTEL_EXPORTER_OTLP_METRICS_ENABLED"},
 		},
+		&cli.StringFlag{
+			Name:        "history.path",
+			Usage:       "Path of the download history (JSON Lines). The history is served as an RSS feed at /rss. Empty value disables the history.",
+			Destination: &historyPath,
+			EnvVars:     []string{"HISTORY_PATH"},
+		},
+		&cli.StringFlag{
+			Name:        "state-db",
+			Usage:       "Path of the SQLite database persisting the state of the channels across restarts. Empty value keeps the state in memory only.",
+			Destination: &stateDBPath,
+			EnvVars:     []string{"STATE_DB"},
+		},
+		&cli.StringFlag{
+			Name:        "base-url",
+			Usage:       "Base URL of the media server serving the downloaded files. Used by the RSS feed.",
+			Value:       "http://localhost:8080",
+			Destination: &baseURL,
+			EnvVars:     []string{"BASE_URL"},
+		},
+		&cli.StringFlag{
+			Name:        "secret.encryption-key",
+			Usage:       "Key used to encrypt the cached credentials. Empty value uses a hard-coded key. Existing caches are re-encrypted on read.",
+			Destination: &encryptionKey,
+			EnvVars:     []string{"WITHNY_ENCRYPTION_KEY"},
+		},
+		&cli.StringFlag{
+			Name:        "credentials-source",
+			Usage:       "Source of the credentials: file or keyring. The keyring replaces the credentials files of the config.",
+			Value:       credentialsSourceFile,
+			Destination: &credentialsSource,
+			EnvVars:     []string{"CREDENTIALS_SOURCE"},
+		},
+		&cli.DurationFlag{
+			Name:        "token-refresh-margin",
+			Usage:       "Refresh the withny token this long before it expires.",
+			Value:       api.DefaultTokenRefreshMargin,
+			Destination: &tokenRefreshMargin,
+			EnvVars:     []string{"TOKEN_REFRESH_MARGIN"},
+		},
+		&cli.DurationFlag{
+			Name:        "graceful-shutdown-timeout",
+			Usage:       "Time given to the HTTP server to finish the ongoing requests on shutdown.",
+			Value:       10 * time.Second,
+			Destination: &gracefulShutdownTimeout,
+			EnvVars:     []string{"GRACEFUL_SHUTDOWN_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "graceful-shutdown-hard-timeout",
+			Usage:       "Time given to the ongoing requests to return after being canceled, when the graceful shutdown timed out.",
+			Value:       3 * time.Second,
+			Destination: &gracefulShutdownHardTimeout,
+			EnvVars:     []string{"GRACEFUL_SHUTDOWN_HARD_TIMEOUT"},
+		},
 	},
 	Action: func(cCtx *cli.Context) error {
+		if credentialsSource != credentialsSourceFile && credentialsSource != credentialsSourceKeyring {
+			return fmt.Errorf("unknown credentials source: %s", credentialsSource)
+		}
+
+		if configCheck {
+			if _, err := loadConfig(configPath); err != nil {
+				return cli.Exit(fmt.Sprintf("config check failed: %s: %s", configPath, err), 1)
+			}
+			fmt.Fprintf(cCtx.App.Writer, "config check succeeded: %s\n", configPath)
+			return nil
+		}
+
 		ctx, cancel := context.WithCancel(cCtx.Context)
 
 		// Trap cleanup
@@ -131,9 +239,35 @@ var Command = &cli.Command{
 			}
 		}()
 
+		stopPyroscope, err := StartPyroscope(pyroscopeConfig, pyroscope.Start)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to start pyroscope profiler")
+		}
+		defer stopPyroscope()
+
+		history.DefaultHistory.SetPath(historyPath)
+
+		if stateDBPath != "" {
+			store, err := state.NewSQLiteStateStore(stateDBPath)
+			if err != nil {
+				log.Fatal().Err(err).Str("path", stateDBPath).Msg("failed to open state database")
+			}
+			defer store.Close()
+			if err := state.DefaultState.UseStore(store); err != nil {
+				log.Fatal().Err(err).Str("path", stateDBPath).Msg("failed to load state")
+			}
+		}
+
 		configChan := make(chan *Config)
 		go ObserveConfig(ctx, configPath, configChan)
 
+		ongoingCtx, stopOngoing := context.WithCancel(context.Background())
+		srv := &http.Server{
+			Addr: pprofListenAddress,
+			BaseContext: func(net.Listener) context.Context {
+				return ongoingCtx
+			},
+		}
 		go func() {
 			http.HandleFunc("/", func(w http.ResponseWriter, _ *http.Request) {
 				s := state.DefaultState.ReadState()
@@ -145,20 +279,79 @@ var Command = &cli.Command{
 					return
 				}
 			})
+			http.HandleFunc("/rss", handleRSS)
+			http.HandleFunc("GET /events", HandleEvents(state.DefaultState.Emitter))
+			http.HandleFunc(
+				"POST /channels/{channelID}/cancel",
+				HandleCancel(&state.DefaultState),
+			)
 			http.Handle("/metrics", promhttp.Handler())
 			log.Info().Str("listenAddress", pprofListenAddress).Msg("listening")
-			if err := http.ListenAndServe(pprofListenAddress, nil); err != nil {
+			if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				log.Fatal().Err(err).Msg("fail to serve http")
 			}
-			log.Fatal().Msg("http server stopped")
+			log.Info().Msg("http server stopped")
 		}()
 
-		return ConfigReloader(ctx, configChan, func(ctx context.Context, config *Config) {
+		err = ConfigReloader(ctx, configChan, func(ctx context.Context, config *Config) {
 			handleConfig(ctx, cCtx.App.Version, config)
 		})
+		if err := ShutdownServer(
+			srv,
+			stopOngoing,
+			gracefulShutdownTimeout,
+			gracefulShutdownHardTimeout,
+		); err != nil {
+			log.Err(err).Msg("failed to shutdown http server gracefully")
+		}
+		return err
 	},
 }
 
+// Shutdowner is a server which can be shut down gracefully, like http.Server.
+type Shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// ShutdownServer shuts down the server, waiting at most timeout for the ongoing requests.
+//
+// If the ongoing requests did not finish in time, they are canceled with
+// stopOngoing and are given hardTimeout to return.
+func ShutdownServer(
+	srv Shutdowner,
+	stopOngoing context.CancelFunc,
+	timeout time.Duration,
+	hardTimeout time.Duration,
+) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	stopOngoing()
+	if err != nil {
+		log.Warn().Err(err).Msg("ongoing requests did not finish in time, canceling them")
+		time.Sleep(hardTimeout)
+	}
+	return err
+}
+
+func handleRSS(w http.ResponseWriter, r *http.Request) {
+	if !history.DefaultHistory.Enabled() {
+		http.Error(w, "download history is disabled", http.StatusNotFound)
+		return
+	}
+	entries, err := history.DefaultHistory.Read()
+	if err != nil {
+		log.Err(err).Msg("failed to read download history")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	feed := history.NewRSS(entries, baseURL, r.URL.Query().Get("channel"))
+	if err := history.WriteRSS(w, feed); err != nil {
+		log.Err(err).Msg("failed to write rss feed")
+	}
+}
+
 func handleConfig(ctx context.Context, version string, config *Config) {
 	jar, err := cookiejar.New(&cookiejar.Options{})
 	if err != nil {
@@ -171,41 +364,114 @@ func handleConfig(ctx context.Context, version string, config *Config) {
 	hclient := &http.Client{
 		Jar:     jar,
 		Timeout: time.Minute,
+		// Shared by the logins, the playlists and the HLS downloads.
 		Transport: otelhttp.NewTransport(
-			http.DefaultTransport,
+			api.NewPooledTransport(api.DefaultMaxIdleConns, api.DefaultMaxIdleConnsPerHost),
 			otelhttp.WithTracerProvider(noop.NewTracerProvider()),
 		),
 	}
 
-	if config.CredentialsFile == "" {
+	// credentialsFiles names the credentials of each client in the logs.
+	var credentialsFiles []string
+	var readers []api.CredentialsReader
+	switch credentialsSource {
+	case credentialsSourceKeyring:
+		credentialsFiles = []string{credentialsSourceKeyring}
+		readers = []api.CredentialsReader{secret.NewKeyringReader()}
+	default:
+		credentialsFiles = config.CredentialsFiles
+		if config.CredentialsFile != "" {
+			credentialsFiles = append([]string{config.CredentialsFile}, credentialsFiles...)
+		}
+		for _, credentialsFile := range credentialsFiles {
+			readers = append(readers, secret.NewReader(credentialsFile))
+		}
+	}
+	if len(readers) == 0 {
 		log.Fatal().Msg("no credentials file configured")
 	}
-	client := api.NewClient(hclient, secret.NewReader(config.CredentialsFile), secret.NewTmpCache())
+	clients := make([]*api.Client, 0, len(readers))
+	for i, reader := range readers {
+		credentialsFile := credentialsFiles[i]
+		cache := secret.NewTmpCache()
+		if i > 0 {
+			cache = secret.NewFileCache(
+				filepath.Join(os.TempDir(), fmt.Sprintf("withny-dl.%d.json", i)),
+			)
+		}
+		cache.Secret = encryptionKey
+		client := api.NewClient(
+			hclient,
+			reader,
+			cache,
+			api.WithExtraHeaders(config.ExtraHeaders),
+			api.WithLoginCircuitBreaker(
+				*config.LoginCircuitBreaker.FailureThreshold,
+				config.LoginCircuitBreaker.OpenDuration,
+			),
+			api.WithTokenRefreshMargin(tokenRefreshMargin),
+			api.WithRequestLogging(),
+		)
+		clients = append(clients, client)
 
-	go func() {
-		if err := client.LoginLoop(ctx); err != nil {
-			if errors.Is(err, context.Canceled) {
-				log.Info().Msg("abort login")
-				return
-			}
+		go func() {
+			for {
+				err := client.LoginLoop(ctx)
+				if err == nil {
+					return
+				}
+				if errors.Is(err, context.Canceled) {
+					log.Info().Msg("abort login")
+					return
+				}
+				if !errors.Is(err, api.ErrCircuitOpen) {
+					log.Fatal().Err(err).Str("credentialsFile", credentialsFile).Msg("failed to login")
+				}
 
-			log.Fatal().Err(err).Msg("failed to login")
-		}
-	}()
+				handleCircuitOpen(ctx, config, credentialsFile, err)
+				select {
+				case <-ctx.Done():
+					log.Info().Msg("abort login")
+					return
+				case <-time.After(client.CircuitOpenDuration()):
+				}
+			}
+		}()
+	}
+	pool := api.NewClientPool(clients...)
 
 	if config.Notifier.Enabled {
-		notifier.Notifier = notify.NewFormatedNotifier(
-			notify.NewShoutrrr(
+		var notifiers notify.MultiNotifier
+		if len(config.Notifier.URLs) > 0 {
+			notifiers = append(notifiers, notify.NewShoutrrr(
 				config.Notifier.URLs,
 				notify.IncludeTitleInMessage(config.Notifier.IncludeTitleInMessage),
 				notify.NoPriority(config.Notifier.NoPriority),
-			),
+			))
+			log.Info().Msg("using shoutrrr")
+		}
+		if config.Notifier.Discord.WebhookURL != "" {
+			notifiers = append(notifiers, notify.NewDiscordNotifier(
+				config.Notifier.Discord.WebhookURL,
+				notify.WithMentionRoleID(config.Notifier.Discord.MentionRoleID),
+			))
+			log.Info().Msg("using discord")
+		}
+		if config.Notifier.Telegram.BotToken != "" && config.Notifier.Telegram.ChatID != "" {
+			notifiers = append(notifiers, notify.NewTelegramNotifier(
+				config.Notifier.Telegram.BotToken,
+				config.Notifier.Telegram.ChatID,
+				notify.WithTelegramMarkdownV2(config.Notifier.Telegram.MarkdownV2),
+			))
+			log.Info().Msg("using telegram")
+		}
+		if len(notifiers) == 0 {
+			log.Warn().Msg("notifier enabled but there is no URLs, Discord webhook nor Telegram bot")
+		}
+		notifier.Notifier = notify.NewFormatedNotifier(
+			notifiers,
 			config.Notifier.NotificationFormats,
 		)
-		log.Info().Msg("using shoutrrr")
-		if len(config.Notifier.URLs) == 0 {
-			log.Warn().Msg("using shoutrrr but there is no URLs")
-		}
 	} else {
 		log.Info().Msg("no notifier configured")
 	}
@@ -227,13 +493,23 @@ func handleConfig(ctx context.Context, version string, config *Config) {
 	}()
 
 	// Check new version
-	go checkVersion(ctx, client.Client, version)
+	go checkVersion(ctx, hclient, version)
+
+	// Shared by the post-processing of all the channels.
+	var postProcessingSem *semaphore.Weighted
+	if config.MaxConcurrentPostProcessing > 0 {
+		postProcessingSem = semaphore.NewWeighted(int64(config.MaxConcurrentPostProcessing))
+	}
 
 	var wg sync.WaitGroup
-	wg.Add(len(config.Channels))
-	for channel, overrideParams := range config.Channels {
-		channelParams := params.Clone()
-		overrideParams.Override(channelParams)
+	channels := config.ChannelIDs()
+	wg.Add(len(channels))
+	for _, channel := range channels {
+		channelParams := config.ChannelParams(channel)
+		if err := channelParams.Compile(); err != nil {
+			// Already checked by ValidateConfig.
+			log.Err(err).Str("channel", channel).Msg("invalid params, title filters are ignored")
+		}
 
 		// Scan for intermediates .ts used for concatenation
 		if !channelParams.KeepIntermediates && channelParams.Concat &&
@@ -252,7 +528,13 @@ func handleConfig(ctx context.Context, version string, config *Config) {
 
 		go func(channelID string, params *withny.Params) {
 			defer wg.Done()
-			withny.NewChannelWatcher(client, params, channelID).Watch(ctx)
+			watcher := withny.NewChannelWatcher(pool, params, channelID)
+			watcher.PostProcessingSemaphore = postProcessingSem
+			err := watcher.Watch(ctx)
+			if errors.Is(err, withny.ErrWaitTimeout) {
+				log.Warn().Str("channelID", channelID).Msg("channel watcher stopped: no stream went live in time")
+				return
+			}
 
 			select {
 			case <-ctx.Done():
@@ -269,6 +551,22 @@ func handleConfig(ctx context.Context, version string, config *Config) {
 	wg.Wait()
 }
 
+// handleCircuitOpen notifies the user that the logins are suspended and
+// reports the error in the state of every channel.
+func handleCircuitOpen(ctx context.Context, config *Config, credentialsFile string, err error) {
+	log.Error().
+		Err(err).
+		Str("credentialsFile", credentialsFile).
+		Stringer("retryIn", config.LoginCircuitBreaker.OpenDuration).
+		Msg("too many login failures, logins are suspended")
+	if err := notifier.NotifyLoginFailed(ctx, err); err != nil {
+		log.Err(err).Msg("notify failed")
+	}
+	for _, channel := range config.ChannelIDs() {
+		state.DefaultState.SetChannelError(channel, err)
+	}
+}
+
 func checkVersion(ctx context.Context, client *http.Client, version string) {
 	if strings.Contains(version, "-") { // Version containing a hyphen is a development version.
 		log.Warn().Str("version", version).Msg("development version, skipping version check")
@@ -309,6 +607,7 @@ func checkVersion(ctx context.Context, client *http.Client, version string) {
 	}
 
 	if data.TagName != version {
+		metrics.Version.UpdateAvailable.Record(ctx, 1)
 		log.Warn().Str("latest", data.TagName).Str("current", version).Msg("new version available")
 		if err := notifier.NotifyUpdateAvailable(ctx, data.TagName); err != nil {
 			log.Err(err).Msg("notify failed")
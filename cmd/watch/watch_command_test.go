@@ -0,0 +1,106 @@
+package watch_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/cmd/watch"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli/v2"
+)
+
+type fakeServer struct {
+	deadline time.Time
+	block    bool
+}
+
+func (s *fakeServer) Shutdown(ctx context.Context) error {
+	s.deadline, _ = ctx.Deadline()
+	if s.block {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func TestShutdownServer(t *testing.T) {
+	// Arrange
+	srv := &fakeServer{}
+	stopped := false
+	timeout := 42 * time.Second
+	start := time.Now()
+
+	// Act
+	err := watch.ShutdownServer(srv, func() { stopped = true }, timeout, time.Hour)
+
+	// Assert
+	require.NoError(t, err)
+	require.True(t, stopped)
+	require.WithinDuration(t, start.Add(timeout), srv.deadline, time.Second)
+}
+
+func TestShutdownServerTimeout(t *testing.T) {
+	// Arrange
+	srv := &fakeServer{block: true}
+	stopped := false
+	timeout := 10 * time.Millisecond
+	hardTimeout := 20 * time.Millisecond
+	start := time.Now()
+
+	// Act
+	err := watch.ShutdownServer(srv, func() { stopped = true }, timeout, hardTimeout)
+
+	// Assert
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.True(t, stopped)
+	require.GreaterOrEqual(t, time.Since(start), timeout+hardTimeout)
+}
+
+func runConfigCheck(t *testing.T, config string) (exitCode int, stdout string, stderr string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(config), 0o600))
+
+	var outBuf, errBuf bytes.Buffer
+	exitCode = 0
+	oldExiter, oldErrWriter := cli.OsExiter, cli.ErrWriter
+	cli.OsExiter = func(code int) { exitCode = code }
+	cli.ErrWriter = &errBuf
+	defer func() { cli.OsExiter, cli.ErrWriter = oldExiter, oldErrWriter }()
+	app := &cli.App{
+		Writer:   &outBuf,
+		Commands: []*cli.Command{watch.Command},
+	}
+
+	_ = app.Run([]string{"withny-dl", "watch", "--config", path, "--config-check"})
+	return exitCode, outBuf.String(), errBuf.String()
+}
+
+func TestConfigCheck(t *testing.T) {
+	// Act
+	code, stdout, _ := runConfigCheck(t, `credentialsFile: credentials.yaml
+defaultParams:
+  outFormat: '{{ .ChannelID }}.{{ .Ext }}'
+`)
+
+	// Assert
+	require.Equal(t, 0, code)
+	require.Contains(t, stdout, "config check succeeded")
+}
+
+func TestConfigCheckInvalidOutFormat(t *testing.T) {
+	// Act
+	code, _, stderr := runConfigCheck(t, `credentialsFile: credentials.yaml
+defaultParams:
+  outFormat: '{{ .ChannelID'
+`)
+
+	// Assert
+	require.Equal(t, 1, code)
+	require.Contains(t, stderr, "config check failed")
+	require.Contains(t, stderr, "invalid outFormat")
+}
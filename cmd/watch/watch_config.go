@@ -2,12 +2,19 @@ package watch
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/Darkness4/withny-dl/notify"
-	"github.com/Darkness4/withny-dl/utils/channel"
+	"github.com/Darkness4/withny-dl/utils/ptr"
 	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
 	"github.com/fsnotify/fsnotify"
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
@@ -15,20 +22,89 @@ import (
 
 // Config is the configuration for the watch command.
 type Config struct {
-	Notifier           NotifierConfig                   `yaml:"notifier,omitempty"`
-	RateLimitAvoidance RateLimitAvoidance               `yaml:"rateLimitAvoidance,omitempty"`
-	CredentialsFile    string                           `yaml:"credentialsFile,omitempty"`
-	DefaultParams      withny.OptionalParams            `yaml:"defaultParams,omitempty"`
-	Channels           map[string]withny.OptionalParams `yaml:"channels,omitempty"`
+	Notifier                    NotifierConfig                   `yaml:"notifier,omitempty"`
+	RateLimitAvoidance          RateLimitAvoidance               `yaml:"rateLimitAvoidance,omitempty"`
+	LoginCircuitBreaker         LoginCircuitBreaker              `yaml:"loginCircuitBreaker,omitempty"`
+	MaxConcurrentPostProcessing int                              `yaml:"maxConcurrentPostProcessing,omitempty"`
+	CredentialsFile             string                           `yaml:"credentialsFile,omitempty"`
+	CredentialsFiles            []string                         `yaml:"credentialsFiles,omitempty"`
+	ExtraHeaders                map[string]string                `yaml:"extraHeaders,omitempty"`
+	DefaultParams               withny.OptionalParams            `yaml:"defaultParams,omitempty"`
+	ChannelGroups               map[string]ChannelGroupConfig    `yaml:"channelGroups,omitempty"`
+	Channels                    map[string]withny.OptionalParams `yaml:"channels,omitempty"`
+}
+
+// ChannelGroupConfig is a set of params shared by multiple channels.
+type ChannelGroupConfig struct {
+	Params   withny.OptionalParams `yaml:"params,omitempty"`
+	Channels []string              `yaml:"channels,omitempty"`
+}
+
+// ChannelIDs returns the sorted IDs of the watched channels.
+//
+// The channels listed in the channel groups are watched too.
+func (c *Config) ChannelIDs() []string {
+	ids := make([]string, 0, len(c.Channels))
+	for id := range c.Channels {
+		ids = append(ids, id)
+	}
+	for _, group := range c.ChannelGroups {
+		ids = append(ids, group.Channels...)
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// ChannelParams returns the params of a channel.
+//
+// The params are applied in this order, the last one taking precedence:
+// withny.DefaultParams, defaultParams, the params of the channel groups
+// containing the channel (sorted by group name), then the params of the
+// channel.
+func (c *Config) ChannelParams(channelID string) *withny.Params {
+	params := withny.DefaultParams.Clone()
+	c.DefaultParams.Override(params)
+
+	groups := make([]string, 0, len(c.ChannelGroups))
+	for name := range c.ChannelGroups {
+		groups = append(groups, name)
+	}
+	slices.Sort(groups)
+	for _, name := range groups {
+		group := c.ChannelGroups[name]
+		if slices.Contains(group.Channels, channelID) {
+			group.Params.Override(params)
+		}
+	}
+
+	if overrideParams, ok := c.Channels[channelID]; ok {
+		overrideParams.Override(params)
+	}
+	return params
 }
 
 // NotifierConfig is the configuration for the notifier.
 type NotifierConfig struct {
-	Enabled                    bool     `yaml:"enabled,omitempty"`
-	IncludeTitleInMessage      bool     `yaml:"includeTitleInMessage,omitempty"`
-	NoPriority                 bool     `yaml:"noPriority,omitempty"`
-	URLs                       []string `yaml:"urls,omitempty"`
-	notify.NotificationFormats `         yaml:"notificationFormats,omitempty"`
+	Enabled                    bool                   `yaml:"enabled,omitempty"`
+	IncludeTitleInMessage      bool                   `yaml:"includeTitleInMessage,omitempty"`
+	NoPriority                 bool                   `yaml:"noPriority,omitempty"`
+	URLs                       []string               `yaml:"urls,omitempty"`
+	Discord                    DiscordConfig          `yaml:"discord,omitempty"`
+	Telegram                   TelegramNotifierConfig `yaml:"telegram,omitempty"`
+	notify.NotificationFormats `                       yaml:"notificationFormats,omitempty"`
+}
+
+// DiscordConfig is the configuration for the Discord notifier.
+type DiscordConfig struct {
+	WebhookURL    string `yaml:"webhookURL,omitempty"`
+	MentionRoleID string `yaml:"mentionRoleID,omitempty"`
+}
+
+// TelegramNotifierConfig is the configuration for the Telegram notifier.
+type TelegramNotifierConfig struct {
+	BotToken   string `yaml:"botToken,omitempty"`
+	ChatID     string `yaml:"chatID,omitempty"`
+	MarkdownV2 bool   `yaml:"markdownV2,omitempty"`
 }
 
 // RateLimitAvoidance is the configuration for the rate limit avoidance.
@@ -36,10 +112,170 @@ type RateLimitAvoidance struct {
 	PollingPacing time.Duration `yaml:"pollingPacing,omitempty"`
 }
 
+// LoginCircuitBreaker is the configuration for the login circuit breaker.
+type LoginCircuitBreaker struct {
+	FailureThreshold *int          `yaml:"failureThreshold,omitempty"`
+	OpenDuration     time.Duration `yaml:"openDuration,omitempty"`
+}
+
 func applyDefaults(config *Config) {
 	if config.RateLimitAvoidance.PollingPacing == 0 {
 		config.RateLimitAvoidance.PollingPacing = 500 * time.Millisecond
 	}
+	if config.LoginCircuitBreaker.FailureThreshold == nil {
+		config.LoginCircuitBreaker.FailureThreshold = ptr.Ref(api.DefaultLoginFailureThreshold)
+	}
+	if config.LoginCircuitBreaker.OpenDuration == 0 {
+		config.LoginCircuitBreaker.OpenDuration = api.DefaultCircuitOpenDuration
+	}
+}
+
+// Sources of the credentials, see the credentials-source flag.
+const (
+	credentialsSourceFile    = "file"
+	credentialsSourceKeyring = "keyring"
+)
+
+// maxChannelKeyLength is the maximum length of a channel key.
+const maxChannelKeyLength = 50
+
+// ValidateConfig checks the configuration for mistakes.
+func ValidateConfig(config *Config) error {
+	keys := config.ChannelIDs()
+
+	var errs []error
+	if config.CredentialsFile == "" && len(config.CredentialsFiles) == 0 &&
+		credentialsSource != credentialsSourceKeyring {
+		errs = append(errs, errors.New("no credentials file configured"))
+	}
+	for i, credentialsFile := range config.CredentialsFiles {
+		if strings.TrimSpace(credentialsFile) == "" {
+			errs = append(errs, fmt.Errorf("credentialsFiles[%d] is empty", i))
+		}
+	}
+	if t := config.LoginCircuitBreaker.FailureThreshold; t != nil && *t < 0 {
+		errs = append(
+			errs,
+			fmt.Errorf("loginCircuitBreaker.failureThreshold must not be negative, got %d", *t),
+		)
+	}
+	if config.MaxConcurrentPostProcessing < 0 {
+		errs = append(
+			errs,
+			fmt.Errorf(
+				"maxConcurrentPostProcessing must not be negative, got %d",
+				config.MaxConcurrentPostProcessing,
+			),
+		)
+	}
+	for _, key := range keys {
+		switch {
+		case strings.TrimSpace(key) == "":
+			errs = append(
+				errs,
+				fmt.Errorf("channel key '%s' is empty; did you forget to add the channel ID?", key),
+			)
+		case len(key) > maxChannelKeyLength:
+			errs = append(
+				errs,
+				fmt.Errorf(
+					"channel key '%s' is too long (%d > %d characters)",
+					key,
+					len(key),
+					maxChannelKeyLength,
+				),
+			)
+		}
+	}
+
+	params := withny.DefaultParams.Clone()
+	config.DefaultParams.Override(params)
+	if err := validateParams(params); err != nil {
+		errs = append(errs, fmt.Errorf("defaultParams: %w", err))
+	}
+	for _, key := range keys {
+		channelParams := config.ChannelParams(key)
+		if err := validateParams(channelParams); err != nil {
+			errs = append(errs, fmt.Errorf("channel '%s': %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validateParams(params *withny.Params) error {
+	var errs []error
+	if err := params.Compile(); err != nil {
+		errs = append(errs, err)
+	}
+	if params.WaitPollInterval <= 0 {
+		errs = append(
+			errs,
+			fmt.Errorf("waitPollInterval must be positive, got %s", params.WaitPollInterval),
+		)
+	}
+	if _, err := template.New("gotpl").Parse(params.OutFormat); err != nil {
+		errs = append(errs, fmt.Errorf("invalid outFormat: %w", err))
+	}
+	if err := withny.ValidatePostProcessingPipeline(params.PostProcessingPipeline); err != nil {
+		errs = append(errs, err)
+	}
+	if err := withny.ValidateChatFormat(params.ChatFormat); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+var envVarRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// interpolateEnv replaces the ${VAR} and $VAR occurrences with the value of
+// the environment variable.
+//
+// References to unset variables are kept as-is, which preserves the variables
+// meant for the shell, like $WITHNY_OUTPUT_FILE in the postCommand.
+func interpolateEnv(s string) string {
+	return envVarRegexp.ReplaceAllStringFunc(s, func(match string) string {
+		sub := envVarRegexp.FindStringSubmatch(match)
+		name := sub[1]
+		if name == "" {
+			name = sub[2]
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+		return match
+	})
+}
+
+// rawConfigKeys are the keys which values are not interpolated: the shell
+// commands expand the variables themselves.
+var rawConfigKeys = []string{"preCommand", "postCommand"}
+
+// interpolateEnvNode interpolates the environment variables in every scalar
+// (keys and values) of the YAML document, except the values of rawConfigKeys.
+func interpolateEnvNode(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		value := interpolateEnv(node.Value)
+		if value != node.Value {
+			node.Value = value
+			if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) == 0 {
+				// Resolve the tag again, so that "${PORT}" can become an int.
+				node.Tag = ""
+			}
+		}
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			interpolateEnvNode(key)
+			if !slices.Contains(rawConfigKeys, key.Value) {
+				interpolateEnvNode(value)
+			}
+		}
+		return
+	}
+	for _, child := range node.Content {
+		interpolateEnvNode(child)
+	}
 }
 
 func loadConfig(filename string) (*Config, error) {
@@ -49,11 +285,19 @@ func loadConfig(filename string) (*Config, error) {
 	}
 	defer file.Close()
 
+	var node yaml.Node
+	if err := yaml.NewDecoder(file).Decode(&node); err != nil {
+		return nil, err
+	}
+	interpolateEnvNode(&node)
 	config := &Config{}
-	if err := yaml.NewDecoder(file).Decode(&config); err != nil {
+	if err := node.Decode(config); err != nil {
 		return nil, err
 	}
 	applyDefaults(config)
+	if err := ValidateConfig(config); err != nil {
+		return nil, err
+	}
 	return config, err
 }
 
@@ -94,8 +338,6 @@ func ObserveConfig(ctx context.Context, filename string, configChan chan<- *Conf
 		log.Panic().Err(err).Msg("failed to add config to config reloader")
 	}
 
-	debouncedEvents := channel.Debounce(watcher.Events, time.Second)
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -108,7 +350,7 @@ func ObserveConfig(ctx context.Context, filename string, configChan chan<- *Conf
 				continue
 			}
 
-		case _, ok := <-debouncedEvents:
+		case _, ok := <-watcher.Events:
 			if !ok {
 				log.Error().Msg("watcher channel closed")
 				return
@@ -141,6 +383,12 @@ func loadConfigOnModification(
 	}
 
 	if !stat.ModTime().Equal(lastModTime) {
+		// Editors may write the file in multiple flushes.
+		stat, err = waitForStableFile(ctx, filename)
+		if err != nil {
+			log.Error().Str("file", filename).Err(err).Msg("failed to wait for the file to be written")
+			return lastModTime, err
+		}
 		lastModTime = stat.ModTime()
 		log.Info().Msg("new config detected")
 
@@ -162,6 +410,47 @@ func loadConfigOnModification(
 	return lastModTime, nil
 }
 
+const (
+	// configStablePollInterval is the interval between the stats of a config file being written.
+	configStablePollInterval = 100 * time.Millisecond
+	// configStableDuration is the duration without modification after which
+	// a config file is considered written.
+	configStableDuration = 500 * time.Millisecond
+)
+
+// waitForStableFile waits until the modification time and the size of the
+// file have not changed for configStableDuration.
+func waitForStableFile(ctx context.Context, filename string) (os.FileInfo, error) {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	stableSince := time.Now()
+
+	ticker := time.NewTicker(configStablePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+
+		next, err := os.Stat(filename)
+		if err != nil {
+			return nil, err
+		}
+		if !next.ModTime().Equal(stat.ModTime()) || next.Size() != stat.Size() {
+			stat = next
+			stableSince = time.Now()
+			continue
+		}
+		if time.Since(stableSince) >= configStableDuration {
+			return stat, nil
+		}
+	}
+}
+
 // ConfigReloader reloads the config when a new one is detected.
 func ConfigReloader(
 	ctx context.Context,
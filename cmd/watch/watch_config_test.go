@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/Darkness4/withny-dl/cmd/watch"
+	"github.com/Darkness4/withny-dl/utils/ptr"
+	"github.com/Darkness4/withny-dl/withny"
 	"github.com/stretchr/testify/require"
 )
 
@@ -25,7 +29,8 @@ func TestConfigReloaderTwoConfigs(t *testing.T) {
 
 	// Create a temporary config file and write some data to it
 	configFile := filepath.Join(tempDir, "config.yaml")
-	err = os.WriteFile(configFile, []byte(`channels:
+	err = os.WriteFile(configFile, []byte(`credentialsFile: credentials.yaml
+channels:
   '40740626':
     labels:
       EnglishName: Komae Nadeshiko
@@ -65,7 +70,8 @@ func TestConfigReloaderTwoConfigs(t *testing.T) {
 
 	// Write a new config file with different data
 	time.Sleep(time.Second)
-	err = os.WriteFile(configFile, []byte(`channels:
+	err = os.WriteFile(configFile, []byte(`credentialsFile: credentials.yaml
+channels:
   '40740626':
     labels:
       EnglishName: Komae Nadeshiko
@@ -101,7 +107,8 @@ func TestConfigReloaderCancellation(t *testing.T) {
 
 	// Create a temporary config file and write some data to it
 	configFile := filepath.Join(tempDir, "config.yaml")
-	err = os.WriteFile(configFile, []byte(`channels:
+	err = os.WriteFile(configFile, []byte(`credentialsFile: credentials.yaml
+channels:
   '40740626':
     labels:
       EnglishName: Komae Nadeshiko
@@ -151,3 +158,326 @@ func TestConfigReloaderCancellation(t *testing.T) {
 	// Wait for the configReloader function to exit
 	wg.Wait()
 }
+
+func TestValidateConfig(t *testing.T) {
+	tt := []struct {
+		name     string
+		channels []string
+		params   withny.OptionalParams
+		errMsg   string
+	}{
+		{
+			name:     "valid",
+			channels: []string{"channel"},
+		},
+		{
+			name:     "empty key",
+			channels: []string{""},
+			errMsg:   "channel key '' is empty; did you forget to add the channel ID?",
+		},
+		{
+			name:     "whitespace key",
+			channels: []string{"  "},
+			errMsg:   "channel key '  ' is empty; did you forget to add the channel ID?",
+		},
+		{
+			name:     "too long key",
+			channels: []string{strings.Repeat("a", 51)},
+			errMsg: fmt.Sprintf(
+				"channel key '%s' is too long (51 > 50 characters)",
+				strings.Repeat("a", 51),
+			),
+		},
+		{
+			name:     "invalid title filter",
+			channels: []string{"channel"},
+			params: withny.OptionalParams{
+				TitleFilter: ptr.Ref("(karaoke"),
+			},
+			errMsg: "channel 'channel': invalid titleFilter: error parsing regexp: missing closing ): `(karaoke`",
+		},
+		{
+			name:     "unknown post-processing step",
+			channels: []string{"channel"},
+			params: withny.OptionalParams{
+				PostProcessingPipeline: []string{"verify", "transcode"},
+			},
+			errMsg: "channel 'channel': unknown post-processing step 'transcode'",
+		},
+		{
+			name:     "invalid out format",
+			channels: []string{"channel"},
+			params: withny.OptionalParams{
+				OutFormat: ptr.Ref("{{ .ChannelID"),
+			},
+			errMsg: "channel 'channel': invalid outFormat: template: gotpl:1: unclosed action",
+		},
+		{
+			name:     "non-positive wait poll interval",
+			channels: []string{"channel"},
+			params: withny.OptionalParams{
+				WaitPollInterval: ptr.Ref(time.Duration(0)),
+			},
+			errMsg: "channel 'channel': waitPollInterval must be positive, got 0s",
+		},
+		{
+			name:     "unknown chat format",
+			channels: []string{"channel"},
+			params: withny.OptionalParams{
+				ChatFormat: ptr.Ref("xml"),
+			},
+			errMsg: "channel 'channel': unknown chat format 'xml', expected 'json' or 'jsonl'",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			config := &watch.Config{
+				CredentialsFile: "credentials.yaml",
+				Channels:        make(map[string]withny.OptionalParams),
+			}
+			for _, channel := range tc.channels {
+				config.Channels[channel] = tc.params
+			}
+
+			// Act
+			err := watch.ValidateConfig(config)
+
+			// Assert
+			if tc.errMsg == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.errMsg)
+			}
+		})
+	}
+}
+
+func TestConfigChannelParams(t *testing.T) {
+	// Arrange
+	config := &watch.Config{
+		DefaultParams: withny.OptionalParams{
+			OutFormat:         ptr.Ref("default"),
+			KeepIntermediates: ptr.Ref(true),
+		},
+		ChannelGroups: map[string]watch.ChannelGroupConfig{
+			"a": {
+				Params: withny.OptionalParams{
+					OutFormat:    ptr.Ref("group a"),
+					ExtractAudio: ptr.Ref(true),
+				},
+				Channels: []string{"alice", "bob"},
+			},
+			"b": {
+				Params: withny.OptionalParams{
+					OutFormat: ptr.Ref("group b"),
+				},
+				Channels: []string{"bob", "carol"},
+			},
+		},
+		Channels: map[string]withny.OptionalParams{
+			"alice": {},
+			"carol": {
+				OutFormat: ptr.Ref("carol"),
+			},
+		},
+	}
+
+	// Act
+	ids := config.ChannelIDs()
+	alice := config.ChannelParams("alice")
+	bob := config.ChannelParams("bob")
+	carol := config.ChannelParams("carol")
+
+	// Assert
+	require.Equal(t, []string{"alice", "bob", "carol"}, ids)
+	require.Equal(t, "group a", alice.OutFormat)
+	require.True(t, alice.ExtractAudio)
+	require.True(t, alice.KeepIntermediates)
+	require.Equal(t, "group b", bob.OutFormat)
+	require.True(t, bob.ExtractAudio)
+	require.True(t, bob.KeepIntermediates)
+	require.Equal(t, "carol", carol.OutFormat)
+	require.False(t, carol.ExtractAudio)
+	require.True(t, carol.KeepIntermediates)
+}
+
+func TestValidateConfigCredentials(t *testing.T) {
+	tt := []struct {
+		name   string
+		config watch.Config
+		errMsg string
+	}{
+		{
+			name:   "credentials file",
+			config: watch.Config{CredentialsFile: "credentials.yaml"},
+		},
+		{
+			name:   "credentials files",
+			config: watch.Config{CredentialsFiles: []string{"a.yaml", "b.yaml"}},
+		},
+		{
+			name:   "no credentials file",
+			errMsg: "no credentials file configured",
+		},
+		{
+			name:   "empty credentials file",
+			config: watch.Config{CredentialsFiles: []string{"a.yaml", " "}},
+			errMsg: "credentialsFiles[1] is empty",
+		},
+		{
+			name: "negative login failure threshold",
+			config: watch.Config{
+				CredentialsFile: "credentials.yaml",
+				LoginCircuitBreaker: watch.LoginCircuitBreaker{
+					FailureThreshold: ptr.Ref(-1),
+				},
+			},
+			errMsg: "loginCircuitBreaker.failureThreshold must not be negative, got -1",
+		},
+		{
+			name: "negative max concurrent post-processing",
+			config: watch.Config{
+				CredentialsFile:             "credentials.yaml",
+				MaxConcurrentPostProcessing: -1,
+			},
+			errMsg: "maxConcurrentPostProcessing must not be negative, got -1",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Act
+			err := watch.ValidateConfig(&tc.config)
+
+			// Assert
+			if tc.errMsg == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.errMsg)
+			}
+		})
+	}
+}
+
+func TestConfigReloaderInvalidConfig(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configFile, []byte(`credentialsFile: credentials.yaml
+channels:
+  '40740626': {}
+`), 0644)
+	require.NoError(t, err)
+	configChan := make(chan *watch.Config)
+	go watch.ObserveConfig(ctx, configFile, configChan)
+
+	var handleConfigCallCount atomic.Int32
+	readyChan := make(chan struct{}, 2)
+	handleConfigMock := func(ctx context.Context, _ *watch.Config) {
+		handleConfigCallCount.Add(1)
+		readyChan <- struct{}{}
+		<-ctx.Done()
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- watch.ConfigReloader(ctx, configChan, handleConfigMock)
+	}()
+	<-readyChan
+
+	// Act
+	time.Sleep(time.Second)
+	err = os.WriteFile(configFile, []byte(`credentialsFile: credentials.yaml
+defaultParams:
+  outFormat: '{{ .ChannelID'
+channels:
+  '40740626': {}
+`), 0644)
+	require.NoError(t, err)
+	time.Sleep(3 * time.Second)
+
+	// Assert
+	require.Equal(t, int32(1), handleConfigCallCount.Load())
+	cancel()
+	require.ErrorIs(t, <-errChan, context.Canceled)
+}
+
+func TestObserveConfigInterpolateEnv(t *testing.T) {
+	// Arrange
+	t.Setenv("WITHNY_CREDS_FILE", "/secrets/credentials.yaml")
+	t.Setenv("WITHNY_PACKET_LOSS", "42")
+	t.Setenv("WITHNY_CHANNEL", "channel")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configFile, []byte(`credentialsFile: ${WITHNY_CREDS_FILE}
+defaultParams:
+  packetLossMax: ${WITHNY_PACKET_LOSS}
+  postCommand: 'rclone copy "$WITHNY_UNSET_VARIABLE" remote:$WITHNY_CHANNEL/'
+channels:
+  $WITHNY_CHANNEL: {}
+`), 0644)
+	require.NoError(t, err)
+	configChan := make(chan *watch.Config, 1)
+
+	// Act
+	go watch.ObserveConfig(ctx, configFile, configChan)
+
+	// Assert
+	select {
+	case config := <-configChan:
+		require.Equal(t, "/secrets/credentials.yaml", config.CredentialsFile)
+		require.Equal(t, 42, *config.DefaultParams.PacketLossMax)
+		require.Equal(
+			t,
+			`rclone copy "$WITHNY_UNSET_VARIABLE" remote:$WITHNY_CHANNEL/`,
+			*config.DefaultParams.PostCommand,
+			"the shell commands must not be interpolated",
+		)
+		require.Contains(t, config.Channels, "channel")
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "config was not loaded")
+	}
+}
+
+func TestObserveConfigWaitsForStableFile(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(configFile, []byte(`credentialsFile: credentials.yaml
+channels:
+  'a': {}
+`), 0644)
+	require.NoError(t, err)
+	configChan := make(chan *watch.Config, 10)
+	go watch.ObserveConfig(ctx, configFile, configChan)
+	select {
+	case <-configChan:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "initial config was not loaded")
+	}
+
+	// Act
+	// A single save written in multiple flushes, each one being a valid config.
+	f, err := os.OpenFile(configFile, os.O_WRONLY|os.O_TRUNC, 0o644)
+	require.NoError(t, err)
+	for _, chunk := range []string{
+		"credentialsFile: credentials.yaml\nchannels:\n  'a': {}\n",
+		"  'b': {}\n",
+		"  'c': {}\n",
+	} {
+		_, err := f.WriteString(chunk)
+		require.NoError(t, err)
+		time.Sleep(200 * time.Millisecond)
+	}
+	require.NoError(t, f.Close())
+	time.Sleep(3 * time.Second)
+
+	// Assert
+	require.Len(t, configChan, 1)
+	config := <-configChan
+	require.Equal(t, []string{"a", "b", "c"}, config.ChannelIDs())
+}
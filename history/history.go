@@ -0,0 +1,106 @@
+// Package history records the finished downloads.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is a finished download.
+type Entry struct {
+	StreamID    string            `json:"streamId"`
+	ChannelID   string            `json:"channelId"`
+	ChannelName string            `json:"channelName"`
+	Title       string            `json:"title"`
+	Description string            `json:"description,omitempty"`
+	StartedAt   time.Time         `json:"startedAt"`
+	FinishedAt  time.Time         `json:"finishedAt"`
+	File        string            `json:"file"`
+	Size        int64             `json:"size"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// History is an append-only JSON Lines file of finished downloads.
+type History struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// New creates a history stored at path.
+//
+// An empty path disables the history.
+func New(path string) *History {
+	return &History{path: path}
+}
+
+// DefaultHistory is the default history. It is disabled until SetPath is called.
+var DefaultHistory = New("")
+
+// SetPath changes the path of the history. An empty path disables the history.
+func (h *History) SetPath(path string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.path = path
+}
+
+// Enabled returns true if the history is stored.
+func (h *History) Enabled() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.path != ""
+}
+
+// Append records an entry.
+func (h *History) Append(entry Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(entry)
+}
+
+// Read returns all the entries, from the oldest to the newest.
+func (h *History) Read() ([]Entry, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return entries, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,59 @@
+package history_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/history"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	// Arrange
+	h := history.New(filepath.Join(t.TempDir(), "history.jsonl"))
+	entries := []history.Entry{
+		{
+			StreamID:   "uuid1",
+			ChannelID:  "channel1",
+			Title:      "title1",
+			StartedAt:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			FinishedAt: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC),
+			File:       "out/title1.mp4",
+			Size:       42,
+		},
+		{
+			StreamID:   "uuid2",
+			ChannelID:  "channel2",
+			Title:      "title2",
+			StartedAt:  time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			FinishedAt: time.Date(2024, 1, 2, 1, 0, 0, 0, time.UTC),
+			File:       "out/title2.mp4",
+		},
+	}
+
+	// Act
+	for _, entry := range entries {
+		require.NoError(t, h.Append(entry))
+	}
+	actual, err := h.Read()
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, entries, actual)
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	// Arrange
+	h := history.New("")
+
+	// Act
+	err := h.Append(history.Entry{StreamID: "uuid"})
+	entries, readErr := h.Read()
+
+	// Assert
+	require.NoError(t, err)
+	require.NoError(t, readErr)
+	require.Empty(t, entries)
+	require.False(t, h.Enabled())
+}
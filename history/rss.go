@@ -0,0 +1,123 @@
+package history
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RSS is the root of an RSS 2.0 document.
+type RSS struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel RSSChannel `xml:"channel"`
+}
+
+// RSSChannel is the channel of an RSS 2.0 document.
+type RSSChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []RSSItem `xml:"item"`
+}
+
+// RSSItem is an item of an RSS 2.0 channel.
+type RSSItem struct {
+	Title       string       `xml:"title"`
+	Description string       `xml:"description"`
+	PubDate     string       `xml:"pubDate"`
+	Enclosure   RSSEnclosure `xml:"enclosure"`
+	GUID        RSSGUID      `xml:"guid"`
+}
+
+// RSSEnclosure is a media attached to an RSS item.
+type RSSEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// RSSGUID is the unique identifier of an RSS item.
+type RSSGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// NewRSS builds an RSS feed from the entries, from the newest to the oldest.
+//
+// The enclosure URLs are the files relative to baseURL. If channelID is not
+// empty, only the entries of this channel are kept.
+func NewRSS(entries []Entry, baseURL string, channelID string) RSS {
+	title := "withny-dl"
+	if channelID != "" {
+		title += " - " + channelID
+	}
+	feed := RSS{
+		Version: "2.0",
+		Channel: RSSChannel{
+			Title:       title,
+			Link:        baseURL,
+			Description: "Streams downloaded by withny-dl.",
+			Items:       make([]RSSItem, 0, len(entries)),
+		},
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if channelID != "" && entry.ChannelID != channelID {
+			continue
+		}
+		feed.Channel.Items = append(feed.Channel.Items, RSSItem{
+			Title:       entry.Title,
+			Description: entry.Description,
+			PubDate:     entry.StartedAt.Format(time.RFC1123Z),
+			Enclosure: RSSEnclosure{
+				URL:    fileURL(baseURL, entry.File),
+				Length: entry.Size,
+				Type:   mediaType(entry.File),
+			},
+			GUID: RSSGUID{Value: entry.StreamID},
+		})
+	}
+	return feed
+}
+
+// WriteRSS writes the RSS feed as XML.
+func WriteRSS(w io.Writer, feed RSS) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(feed)
+}
+
+func fileURL(baseURL string, file string) string {
+	segments := strings.Split(filepath.ToSlash(filepath.Clean(file)), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(path.Join(segments...), "/")
+}
+
+func mediaType(file string) string {
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".mp4":
+		return "video/mp4"
+	case ".mkv":
+		return "video/x-matroska"
+	case ".ts":
+		return "video/mp2t"
+	case ".m4a":
+		return "audio/mp4"
+	default:
+		if t := mime.TypeByExtension(ext); t != "" {
+			return t
+		}
+		return "application/octet-stream"
+	}
+}
@@ -0,0 +1,92 @@
+package history_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/history"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRSS(t *testing.T) {
+	// Arrange
+	entries := []history.Entry{
+		{
+			StreamID:  "uuid1",
+			ChannelID: "channel1",
+			Title:     "title1",
+			StartedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			File:      "out/channel1/my stream.mp4",
+			Size:      42,
+		},
+		{
+			StreamID:  "uuid2",
+			ChannelID: "channel2",
+			Title:     "title2",
+			StartedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+			File:      "out/channel2/title2.ts",
+		},
+		{
+			StreamID:  "uuid3",
+			ChannelID: "channel1",
+			Title:     "title3",
+			StartedAt: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+			File:      "out/channel1/title3.mp4",
+		},
+	}
+
+	// Act
+	feed := history.NewRSS(entries, "https://media.example.com/", "channel1")
+
+	// Assert
+	require.Equal(t, "2.0", feed.Version)
+	require.Equal(t, []history.RSSItem{
+		{
+			Title:   "title3",
+			PubDate: "Wed, 03 Jan 2024 00:00:00 +0000",
+			Enclosure: history.RSSEnclosure{
+				URL:  "https://media.example.com/out/channel1/title3.mp4",
+				Type: "video/mp4",
+			},
+			GUID: history.RSSGUID{Value: "uuid3"},
+		},
+		{
+			Title:   "title1",
+			PubDate: "Mon, 01 Jan 2024 00:00:00 +0000",
+			Enclosure: history.RSSEnclosure{
+				URL:    "https://media.example.com/out/channel1/my%20stream.mp4",
+				Length: 42,
+				Type:   "video/mp4",
+			},
+			GUID: history.RSSGUID{Value: "uuid1"},
+		},
+	}, feed.Channel.Items)
+}
+
+func TestWriteRSS(t *testing.T) {
+	// Arrange
+	feed := history.NewRSS([]history.Entry{
+		{
+			StreamID:  "uuid1",
+			ChannelID: "channel1",
+			Title:     "title1",
+			StartedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			File:      "title1.mp4",
+		},
+	}, "https://media.example.com", "")
+	var sb strings.Builder
+
+	// Act
+	err := history.WriteRSS(&sb, feed)
+
+	// Assert
+	require.NoError(t, err)
+	require.Contains(t, sb.String(), `<rss version="2.0">`)
+	require.Contains(
+		t,
+		sb.String(),
+		`<enclosure url="https://media.example.com/title1.mp4" length="0" type="video/mp4"></enclosure>`,
+	)
+	require.Contains(t, sb.String(), `<guid isPermaLink="false">uuid1</guid>`)
+}
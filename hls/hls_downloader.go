@@ -3,13 +3,21 @@ package hls
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net/http"
 	"net/url"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -17,6 +25,8 @@ import (
 	"github.com/Darkness4/withny-dl/withny/api"
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
 )
 
 const tracerName = "hls"
@@ -27,8 +37,62 @@ var (
 	ErrHLSForbidden = errors.New("hls download stopped with forbidden error")
 	// ErrStreamEnded is returned when the HLS stream has ended.
 	ErrStreamEnded = errors.New("stream ended")
+	// ErrEncryptedStream is returned when the HLS segments are encrypted.
+	//
+	// The returned error is an EncryptedStreamError.
+	ErrEncryptedStream = errors.New("hls stream is encrypted")
+	// ErrFragmentTooLarge is returned when a fragment exceeds the maximum size.
+	//
+	// The returned error is a FragmentTooLargeError.
+	ErrFragmentTooLarge = errors.New("hls fragment is too large")
 )
 
+// EncryptedStreamError is returned when the HLS segments are encrypted, which is not supported.
+type EncryptedStreamError struct {
+	Method string
+}
+
+// Error returns the error message.
+func (e EncryptedStreamError) Error() string {
+	return fmt.Sprintf("%s: method=%s", ErrEncryptedStream, e.Method)
+}
+
+// Unwrap returns ErrEncryptedStream.
+func (e EncryptedStreamError) Unwrap() error {
+	return ErrEncryptedStream
+}
+
+// FragmentTooLargeError is returned when a fragment exceeds the maximum size.
+type FragmentTooLargeError struct {
+	// ContentLength is the announced size of the fragment, or -1 if the size
+	// was exceeded while reading a response without Content-Length.
+	//
+	// In both cases, nothing of the fragment is written.
+	ContentLength int64
+	Max           int64
+}
+
+// Error returns the error message.
+func (e FragmentTooLargeError) Error() string {
+	return fmt.Sprintf("%s: content-length=%d, max=%d", ErrFragmentTooLarge, e.ContentLength, e.Max)
+}
+
+// Unwrap returns ErrFragmentTooLarge.
+func (e FragmentTooLargeError) Unwrap() error {
+	return ErrFragmentTooLarge
+}
+
+// parseKeyMethod returns the METHOD attribute of an EXT-X-KEY tag.
+func parseKeyMethod(line string) string {
+	attrs := strings.TrimPrefix(line, "#EXT-X-KEY:")
+	for _, attr := range strings.Split(attrs, ",") {
+		if method, ok := strings.CutPrefix(strings.TrimSpace(attr), "METHOD="); ok {
+			return method
+		}
+	}
+	return ""
+}
+
 // Downloader is used to download HLS streams.
 type Downloader struct {
 	*api.Client
@@ -39,25 +103,203 @@ type Downloader struct {
 	// ready is used to notify that the downloader is running.
 	// This is to avoid stressing the users with warning logs.
 	ready bool
+
+	// fragmentIndex receives the NDJSON index of the fragments.
+	fragmentIndex io.Writer
+	// idleTimeout is the maximum duration without new fragments before
+	// considering the stream ended.
+	idleTimeout time.Duration
+	// fragmentConcurrency is the number of fragments downloaded in parallel.
+	fragmentConcurrency int
+	// targetDuration is the EXT-X-TARGETDURATION of the last fetched manifest.
+	targetDuration time.Duration
+	// limiter caps the download speed. Nil means unlimited.
+	limiter *rate.Limiter
+	// maxFragmentSize is the maximum size of a fragment. 0 means unlimited.
+	maxFragmentSize int64
+	// lastETag is the ETag of the last fetched manifest.
+	lastETag string
+	// lastModified is the Last-Modified date of the last fetched manifest.
+	lastModified time.Time
+	// lastFragments are the fragments of the last fetched manifest, reused
+	// when the manifest is not modified.
+	lastFragments []Fragment
+	// fragmentWriter, if not nil, receives the fragments instead of the writer given to Read.
+	fragmentWriter FragmentWriter
+	// createdAt is the creation time of the Downloader.
+	createdAt time.Time
+	// onFirstFragment is called once, when the first fragment is written.
+	onFirstFragment   func(time.Duration)
+	firstFragmentOnce sync.Once
+
+	processedFragments atomic.Int64
+	skippedFragments   atomic.Int64
+	bytesWritten       atomic.Int64
+	errors             atomic.Int64
+	lastFragmentAt     atomic.Int64
+}
+
+// Stats are the statistics of a download.
+type Stats struct {
+	ProcessedFragments int64     `json:"processedFragments"`
+	SkippedFragments   int64     `json:"skippedFragments"`
+	BytesWritten       int64     `json:"bytesWritten"`
+	Errors             int64     `json:"errors"`
+	LastFragmentAt     time.Time `json:"lastFragmentAt,omitempty"`
+}
+
+// Stats returns the statistics of the download.
+func (hls *Downloader) Stats() Stats {
+	stats := Stats{
+		ProcessedFragments: hls.processedFragments.Load(),
+		SkippedFragments:   hls.skippedFragments.Load(),
+		BytesWritten:       hls.bytesWritten.Load(),
+		Errors:             hls.errors.Load(),
+	}
+	if last := hls.lastFragmentAt.Load(); last != 0 {
+		stats.LastFragmentAt = time.Unix(0, last)
+	}
+	return stats
 }
 
+// Option is an option for the Downloader.
+type Option func(*Options)
+
+// Options are the options for the Downloader.
+type Options struct {
+	fragmentIndex       io.Writer
+	idleTimeout         time.Duration
+	fragmentConcurrency int
+	bandwidthLimit      int64
+	maxFragmentSize     int64
+	onFirstFragment     func(time.Duration)
+	fragmentWriter      FragmentWriter
+}
+
+// DefaultIdleTimeout is the default maximum duration without new fragments.
+const DefaultIdleTimeout = 5 * time.Minute
+
+// WithFragmentIndex writes an NDJSON index of the downloaded and skipped fragments.
+func WithFragmentIndex(w io.Writer) Option {
+	return func(o *Options) {
+		o.fragmentIndex = w
+	}
+}
+
+// WithIdleTimeout sets the maximum duration without new fragments before
+// considering the stream ended. (default: 5 minutes)
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.idleTimeout = d
+	}
+}
+
+// WithFragmentConcurrency sets the number of fragments downloaded in parallel.
+//
+// The fragments are still written in order. (default: 1)
+func WithFragmentConcurrency(n int) Option {
+	return func(o *Options) {
+		o.fragmentConcurrency = max(n, 1)
+	}
+}
+
+// WithBandwidthLimit caps the download speed in bytes per second.
+//
+// The limit is shared by the fragments downloaded in parallel. A value <= 0
+// disables the limit. (default: 0)
+func WithBandwidthLimit(bytesPerSecond int64) Option {
+	return func(o *Options) {
+		o.bandwidthLimit = bytesPerSecond
+	}
+}
+
+// WithMaxFragmentSize skips the fragments larger than bytes.
+//
+// A fragment announcing a larger Content-Length is skipped without being
+// downloaded. Without Content-Length, the fragment is buffered up to bytes and
+// skipped once it exceeds them. Skipped fragments are never written, even
+// partially, and do not count as packet losses. A value <= 0 disables the
+// limit. (default: 0)
+func WithMaxFragmentSize(bytes int64) Option {
+	return func(o *Options) {
+		o.maxFragmentSize = bytes
+	}
+}
+
+// WithFragmentWriter passes each fragment to fw instead of the writer given to Read.
+//
+// The fragments are passed in order, even with a fragment concurrency greater than 1.
+func WithFragmentWriter(fw FragmentWriter) Option {
+	return func(o *Options) {
+		o.fragmentWriter = fw
+	}
+}
+
+// WithFirstFragmentCallback calls fn once, when the first fragment is written.
+//
+// fn receives the time elapsed since the creation of the Downloader, which
+// includes the probe.
+func WithFirstFragmentCallback(fn func(time.Duration)) Option {
+	return func(o *Options) {
+		o.onFirstFragment = fn
+	}
+}
+
+func applyOptions(opts []Option) *Options {
+	o := &Options{
+		idleTimeout:         DefaultIdleTimeout,
+		fragmentConcurrency: 1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Logger overrides the level of the logs of the package.
+//
+// It is disabled by default, in which case the level of the logger passed to
+// NewDownloader is kept.
+var Logger = zerolog.Nop()
+
 // NewDownloader creates a new HLS downloader.
 func NewDownloader(
 	client *api.Client,
 	log *zerolog.Logger,
 	packetLossMax int,
 	url string,
+	opts ...Option,
 ) *Downloader {
-
+	o := applyOptions(opts)
+	if Logger.GetLevel() != zerolog.Disabled {
+		l := log.Level(Logger.GetLevel())
+		log = &l
+	}
+	var limiter *rate.Limiter
+	if o.bandwidthLimit > 0 {
+		limit := int(min(o.bandwidthLimit, math.MaxInt32))
+		limiter = rate.NewLimiter(rate.Limit(limit), limit)
+	}
 	return &Downloader{
-		Client:        client,
-		packetLossMax: packetLossMax,
-		url:           url,
-		log:           log,
+		Client:              client,
+		packetLossMax:       packetLossMax,
+		url:                 url,
+		log:                 log,
+		fragmentIndex:       o.fragmentIndex,
+		idleTimeout:         o.idleTimeout,
+		fragmentConcurrency: o.fragmentConcurrency,
+		limiter:             limiter,
+		maxFragmentSize:     max(o.maxFragmentSize, 0),
+		createdAt:           time.Now(),
+		onFirstFragment:     o.onFirstFragment,
+		fragmentWriter:      o.fragmentWriter,
 	}
 }
 
 // GetFragmentURLs fetches the fragment URLs from the HLS manifest.
+//
+// The manifest is fetched with a conditional GET. If it is not modified, the
+// fragments of the previous manifest are returned.
 func (hls *Downloader) GetFragmentURLs(ctx context.Context) ([]Fragment, error) {
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
@@ -71,6 +313,12 @@ func (hls *Downloader) GetFragmentURLs(ctx context.Context) ([]Fragment, error)
 	)
 	req.Header.Set("Referer", "https://www.withny.fun/")
 	req.Header.Set("Origin", "https://www.withny.fun")
+	if hls.lastETag != "" {
+		req.Header.Set("If-None-Match", hls.lastETag)
+	}
+	if !hls.lastModified.IsZero() {
+		req.Header.Set("If-Modified-Since", hls.lastModified.UTC().Format(http.TimeFormat))
+	}
 
 	resp, err := hls.Client.Do(req)
 	if err != nil {
@@ -79,6 +327,11 @@ func (hls *Downloader) GetFragmentURLs(ctx context.Context) ([]Fragment, error)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && hls.lastFragments != nil {
+		hls.log.Trace().Msg("manifest not modified")
+		return slices.Clone(hls.lastFragments), nil
+	}
+
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
 		url, _ := url.Parse(hls.url)
@@ -127,6 +380,26 @@ func (hls *Downloader) GetFragmentURLs(ctx context.Context) ([]Fragment, error)
 		line := strings.TrimSpace(scanner.Text())
 
 		switch {
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			if method := parseKeyMethod(line); method != "" && method != "NONE" {
+				hls.log.Error().
+					Str("method", method).
+					Msg("stream is encrypted, refusing to download ciphertext")
+				return []Fragment{}, EncryptedStreamError{Method: method}
+			}
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			value := strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:")
+			d, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				hls.log.Warn().
+					Err(err).
+					Str("value", value).
+					Msg("failed to parse target duration, ignoring")
+				continue
+			}
+			hls.targetDuration = time.Duration(d * float64(time.Second))
+		case line == "#EXT-X-DISCONTINUITY":
+			currentFragment.Discontinuity = true
 		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME"):
 			ts := strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:")
 			t, err := time.Parse(time.RFC3339, ts)
@@ -148,18 +421,24 @@ func (hls *Downloader) GetFragmentURLs(ctx context.Context) ([]Fragment, error)
 			}
 			currentFragment.URL = line
 			fragments = append(fragments, Fragment{
-				URL:  currentFragment.URL,
-				Time: currentFragment.Time,
+				URL:           currentFragment.URL,
+				Time:          currentFragment.Time,
+				Discontinuity: currentFragment.Discontinuity,
 			})
+			currentFragment.Discontinuity = false
 			exists[line] = true
 		}
 	}
 
+	hls.lastETag = resp.Header.Get("ETag")
+	hls.lastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	hls.lastFragments = fragments
+
 	if !hls.ready {
 		hls.ready = true
 		hls.log.Info().Msg("downloading")
 	}
-	return fragments, nil
+	return slices.Clone(fragments), nil
 }
 
 // fillQueue continuously fetches fragments url until stream end
@@ -185,6 +464,7 @@ func (hls *Downloader) fillQueue(
 	defer ticker.Stop()
 
 	errorCount := 0
+	seq := 0
 
 	for {
 		select {
@@ -212,10 +492,13 @@ func (hls *Downloader) fillQueue(
 					Int("error.max", hls.packetLossMax).
 					Msg("GetFragmentURLs failed, retrying")
 				metrics.Downloads.Errors.Add(ctx, 1)
+				hls.errors.Add(1)
 
 				// Ignore the error if tolerated
 				if errorCount <= hls.packetLossMax {
-					time.Sleep(time.Second)
+					if err := sleepContext(ctx, time.Second); err != nil {
+						return err
+					}
 					continue
 				}
 			}
@@ -260,26 +543,66 @@ func (hls *Downloader) fillQueue(
 			if useTimeBasedSorting {
 				lastFragmentTime = f.Time
 			}
-			fragChan <- f
+			f.Seq = seq
+			seq++
+			if f.Discontinuity {
+				hls.log.Warn().
+					Int("seq", f.Seq).
+					Str("url", f.URL).
+					Time("time", f.Time).
+					Msg("discontinuity detected, timestamps may jump")
+				metrics.Downloads.Discontinuities.Add(ctx, 1)
+			}
+			select {
+			case fragChan <- f:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 		}
 
 		// fillQueue will also exit here if the stream has ended (and do not send any fragment)
-		if time.Since(lastFragmentReceivedTimestamp) > 5*time.Minute {
+		if time.Since(lastFragmentReceivedTimestamp) > hls.idleTimeout {
 			hls.log.Warn().
 				Time("lastTime", lastFragmentReceivedTimestamp).
 				Msg("timeout receiving new fragments, abort")
 			return io.EOF
 		}
 
-		time.Sleep(time.Second)
+		if err := sleepContext(ctx, hls.pollInterval()); err != nil {
+			return err
+		}
 	}
 }
 
+// sleepContext sleeps for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// pollInterval returns the duration to wait between two manifest fetches.
+//
+// It is half of the target duration, or 1 second if the target duration is unknown.
+func (hls *Downloader) pollInterval() time.Duration {
+	if hls.targetDuration <= 0 {
+		return time.Second
+	}
+	return hls.targetDuration / 2
+}
+
+// download downloads the fragment and passes its content to fw.
+//
+// It returns the number of bytes read from the response.
 func (hls *Downloader) download(
 	ctx context.Context,
-	w io.Writer,
-	url string,
-) error {
+	fw FragmentWriter,
+	frag Fragment,
+) (int64, error) {
+	url := frag.URL
 	ctx, cancel := context.WithTimeout(ctx, 20*time.Second)
 	defer cancel()
 	req, err := hls.NewAuthRequestWithContext(ctx, "GET", url, nil)
@@ -291,7 +614,7 @@ func (hls *Downloader) download(
 	resp, err := hls.Client.Do(req)
 	if err != nil {
 		hls.log.Err(err).Msg("failed to download fragment")
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
 
@@ -306,25 +629,150 @@ func (hls *Downloader) download(
 
 		if resp.StatusCode == 403 {
 			metrics.Downloads.Errors.Add(ctx, 1)
-			return ErrHLSForbidden
+			return 0, ErrHLSForbidden
 		}
 
 		metrics.Downloads.Errors.Add(ctx, 1)
-		return fmt.Errorf(
+		return 0, fmt.Errorf(
 			"http error: url=%s, status=%d, method=GET",
 			url,
 			resp.StatusCode,
 		)
 	}
 
-	_, err = io.Copy(w, resp.Body)
+	if hls.maxFragmentSize > 0 && resp.ContentLength > hls.maxFragmentSize {
+		return 0, FragmentTooLargeError{
+			ContentLength: resp.ContentLength,
+			Max:           hls.maxFragmentSize,
+		}
+	}
+
+	body := &countingReader{r: resp.Body}
+	var r io.Reader = body
+	if hls.limiter != nil {
+		r = &rateLimitedReader{ctx: ctx, r: r, limiter: hls.limiter}
+	}
+	if hls.maxFragmentSize > 0 && resp.ContentLength < 0 {
+		// Without Content-Length, the fragment is buffered so that a fragment
+		// exceeding the limit is dropped whole instead of being truncated.
+		data, err := io.ReadAll(io.LimitReader(r, hls.maxFragmentSize+1))
+		if err != nil {
+			return body.n, err
+		}
+		if int64(len(data)) > hls.maxFragmentSize {
+			return 0, FragmentTooLargeError{ContentLength: -1, Max: hls.maxFragmentSize}
+		}
+		r = bytes.NewReader(data)
+	}
+	if err := fw.WriteFragment(frag, r); err != nil {
+		return body.n, err
+	}
+	return body.n, nil
+}
+
+// FragmentWriter receives the content of the downloaded fragments.
+type FragmentWriter interface {
+	// WriteFragment consumes the content of the fragment.
+	//
+	// r must not be used after WriteFragment returns.
+	WriteFragment(frag Fragment, r io.Reader) error
+}
+
+// defaultFragmentWriter appends the fragments to a writer.
+type defaultFragmentWriter struct {
+	w io.Writer
+}
+
+// WriteFragment copies the content of the fragment to the writer.
+func (fw defaultFragmentWriter) WriteFragment(_ Fragment, r io.Reader) error {
+	_, err := io.Copy(fw.w, r)
 	return err
 }
 
+// fragmentWriterOf returns the fragment writer of the downloader, which
+// defaults to appending the fragments to w.
+func (hls *Downloader) fragmentWriterOf(w io.Writer) FragmentWriter {
+	if hls.fragmentWriter != nil {
+		return hls.fragmentWriter
+	}
+	return defaultFragmentWriter{w: w}
+}
+
+// countingReader counts the bytes read.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read reads from the underlying reader and counts the bytes.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// rateLimitedReader waits for the limiter after each read.
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+// Read reads at most the burst of the limiter, then waits for as many tokens
+// as bytes read.
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	p = p[:min(len(p), r.limiter.Burst())]
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if err := r.limiter.WaitN(r.ctx, n); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
 // Fragment represents a fragment of the HLS stream.
 type Fragment struct {
+	// Seq is the sequence number of the fragment, set by the queue.
+	Seq  int
 	URL  string
 	Time time.Time
+	// Discontinuity is true if the fragment follows an EXT-X-DISCONTINUITY tag.
+	Discontinuity bool
+}
+
+// FragmentIndexEntry is an entry of the fragment index.
+type FragmentIndexEntry struct {
+	Seq        int        `json:"seq"`
+	URL        string     `json:"url"`
+	Time       time.Time  `json:"time"`
+	ReceivedAt *time.Time `json:"received_at,omitempty"`
+	Skipped    bool       `json:"skipped"`
+}
+
+// writeFragmentIndex appends the fragment to the fragment index, if enabled.
+func (hls *Downloader) writeFragmentIndex(frag Fragment, skipped bool) {
+	if hls.fragmentIndex == nil {
+		return
+	}
+	entry := FragmentIndexEntry{
+		Seq:     frag.Seq,
+		URL:     frag.URL,
+		Time:    frag.Time,
+		Skipped: skipped,
+	}
+	if !skipped {
+		now := time.Now()
+		entry.ReceivedAt = &now
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		hls.log.Err(err).Msg("failed to marshal fragment index entry")
+		return
+	}
+	if _, err := hls.fragmentIndex.Write(append(b, '\n')); err != nil {
+		hls.log.Err(err).Msg("failed to write fragment index entry")
+	}
 }
 
 // Read reads the HLS stream and sends the data to the writer.
@@ -334,6 +782,12 @@ type Fragment struct {
 //  1. A goroutine will continuously fetch the fragment URLs and send them to the urlsChan.
 //  2. The main thread will download the fragments and write them to the writer.
 //
+// If the fragment concurrency is greater than 1, the fragments are downloaded
+// by a pool of workers and the main thread writes them in order.
+//
+// If a FragmentWriter is set with WithFragmentWriter, the fragments are passed
+// to it and writer is unused.
+//
 // The function will return when the context is canceled or when the stream ends.
 func (hls *Downloader) Read(
 	ctx context.Context,
@@ -344,68 +798,187 @@ func (hls *Downloader) Read(
 	defer span.End()
 
 	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	errChan := make(chan error) // Blocking channel is used to wait for fillQueue to finish.
-	defer close(errChan)
-
+	errChan := make(chan error, 1)
 	fragChan := make(chan Fragment, 10)
-	defer close(fragChan)
 
 	go func() {
 		err := hls.fillQueue(ctx, fragChan)
 		errChan <- err
+		// fillQueue is the only sender.
+		close(fragChan)
 	}()
 
-	errorCount := 0
+	if hls.fragmentConcurrency > 1 {
+		return hls.readConcurrently(ctx, cancel, writer, fragChan, errChan)
+	}
 
+	fw := hls.fragmentWriterOf(writer)
+	r := fragmentReader{Downloader: hls, cancel: cancel}
 	for {
 		select {
-		case frag := <-fragChan:
-			err := hls.download(ctx, writer, frag.URL)
-			if err != nil {
-				if errors.Is(err, context.Canceled) {
-					hls.log.Info().Msg("skip fragment download because of context canceled")
-					continue // Continue to wait for fillQueue to finish
-				}
-				hls.log.Err(err).Msg("failed to download fragment")
-				span.RecordError(err)
-				if err == ErrHLSForbidden {
-					hls.log.Err(err).Msg("stream was interrupted")
-					cancel()
-					continue // Continue to wait for fillQueue to finish
-				}
-				errorCount++
-				hls.log.Error().
-					Int("error.count", errorCount).
-					Int("error.max", hls.packetLossMax).
-					Err(err).
-					Msg("a packet failed to be downloaded, skipping")
-				metrics.Downloads.Errors.Add(ctx, 1)
-				if errorCount <= hls.packetLossMax {
-					continue
-				}
-				cancel()
-				continue // Continue to wait for fillQueue to finish
+		case frag, ok := <-fragChan:
+			if !ok {
+				// Wait for fillQueue to send its error.
+				fragChan = nil
+				continue
 			}
+			n, err := hls.download(ctx, fw, frag)
+			r.handle(ctx, fragmentResult{frag: frag, n: n, err: err})
 
 		// fillQueue will exit here if the stream has ended or context is canceled.
 		case err := <-errChan:
-			defer cancel()
-			if err == nil {
-				hls.log.Panic().Msg("didn't expect a nil error")
+			return hls.exit(err)
+		}
+	}
+}
+
+// readConcurrently downloads the fragments with a pool of workers and writes
+// them in order.
+func (hls *Downloader) readConcurrently(
+	ctx context.Context,
+	cancel context.CancelFunc,
+	writer io.Writer,
+	fragChan <-chan Fragment,
+	errChan <-chan error,
+) error {
+	results := make(chan fragmentResult, hls.fragmentConcurrency)
+	var wg sync.WaitGroup
+	for range hls.fragmentConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for frag := range fragChan {
+				var buf bytes.Buffer
+				n, err := hls.download(ctx, defaultFragmentWriter{w: &buf}, frag)
+				if err != nil {
+					// Partial fragments are not written.
+					results <- fragmentResult{frag: frag, err: err}
+					continue
+				}
+				results <- fragmentResult{frag: frag, data: buf.Bytes(), n: n}
 			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
-			if err == io.EOF {
-				hls.log.Info().Msg("hls downloader exited with success")
-			} else if errors.Is(err, context.Canceled) {
-				hls.log.Info().Msg("hls downloader canceled")
-			} else {
-				hls.log.Err(err).Msg("hls downloader exited with error")
+	// Reorder buffer, indexed by the sequence number of the fragments.
+	pending := make(map[int]fragmentResult)
+	next := 0
+	fw := hls.fragmentWriterOf(writer)
+	r := fragmentReader{Downloader: hls, cancel: cancel}
+	for res := range results {
+		pending[res.frag.Seq] = res
+		for {
+			res, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if res.err == nil {
+				if err := fw.WriteFragment(res.frag, bytes.NewReader(res.data)); err != nil {
+					res.n, res.err = 0, err
+				}
 			}
+			r.handle(ctx, res)
+		}
+	}
 
-			return err
+	// The workers exit once fillQueue has exited.
+	return hls.exit(<-errChan)
+}
+
+// fragmentResult is the result of a fragment download.
+type fragmentResult struct {
+	frag Fragment
+	// data is the content of the fragment, if it has been downloaded in a buffer.
+	data []byte
+	n    int64
+	err  error
+}
+
+// fragmentReader handles the downloaded fragments.
+type fragmentReader struct {
+	*Downloader
+	cancel     context.CancelFunc
+	errorCount int
+}
+
+// handle updates the statistics and stops the download if too many packets are lost.
+func (r *fragmentReader) handle(ctx context.Context, res fragmentResult) {
+	span := trace.SpanFromContext(ctx)
+	r.bytesWritten.Add(res.n)
+	metrics.Downloads.Bytes.Add(ctx, res.n)
+	if err := res.err; err != nil {
+		if errors.Is(err, context.Canceled) {
+			r.log.Info().Msg("skip fragment download because of context canceled")
+			return // Continue to wait for fillQueue to finish
+		}
+		span.RecordError(err)
+		var tooLarge FragmentTooLargeError
+		if errors.As(err, &tooLarge) {
+			// The fragment is dropped on purpose, this is not a packet loss.
+			r.log.Warn().
+				Err(err).
+				Str("url", res.frag.URL).
+				Msg("fragment is too large, skipping")
+			metrics.Downloads.Errors.Add(ctx, 1)
+			r.errors.Add(1)
+			r.skippedFragments.Add(1)
+			r.writeFragmentIndex(res.frag, true)
+			return // Continue to wait for fillQueue to finish
 		}
+		r.log.Err(err).Msg("failed to download fragment")
+		if err == ErrHLSForbidden {
+			r.log.Err(err).Msg("stream was interrupted")
+			r.cancel()
+			return // Continue to wait for fillQueue to finish
+		}
+		r.errorCount++
+		r.log.Error().
+			Int("error.count", r.errorCount).
+			Int("error.max", r.packetLossMax).
+			Err(err).
+			Msg("a packet failed to be downloaded, skipping")
+		metrics.Downloads.Errors.Add(ctx, 1)
+		r.errors.Add(1)
+		r.skippedFragments.Add(1)
+		r.writeFragmentIndex(res.frag, true)
+		if r.errorCount > r.packetLossMax {
+			r.cancel()
+		}
+		return // Continue to wait for fillQueue to finish
 	}
+	r.processedFragments.Add(1)
+	r.lastFragmentAt.Store(time.Now().UnixNano())
+	r.writeFragmentIndex(res.frag, false)
+	if r.onFirstFragment != nil {
+		r.firstFragmentOnce.Do(func() {
+			r.onFirstFragment(time.Since(r.createdAt))
+		})
+	}
+}
+
+// exit logs the exit reason of fillQueue.
+func (hls *Downloader) exit(err error) error {
+	if err == nil {
+		hls.log.Panic().Msg("didn't expect a nil error")
+	}
+
+	if err == io.EOF {
+		hls.log.Info().Msg("hls downloader exited with success")
+	} else if errors.Is(err, context.Canceled) {
+		hls.log.Info().Msg("hls downloader canceled")
+	} else {
+		hls.log.Err(err).Msg("hls downloader exited with error")
+	}
+
+	return err
 }
 
 // Probe checks if the stream is ready to be downloaded.
@@ -127,12 +127,12 @@ func (suite *DownloaderIntegrationTestSuite) TestRead() {
 	time.Sleep(10 * time.Second)
 	cancel()
 
-	for {
-		select {
-		case err := <-errChan:
-			suite.Require().Error(err, context.Canceled.Error())
-			return
-		}
+	// The downloader must stop without waiting for the next poll.
+	select {
+	case err := <-errChan:
+		suite.Require().ErrorIs(err, context.Canceled)
+	case <-time.After(time.Second):
+		suite.Fail("the download did not stop after the cancellation")
 	}
 }
 
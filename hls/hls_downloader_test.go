@@ -1,9 +1,14 @@
 package hls
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -12,12 +17,23 @@ import (
 	"github.com/Darkness4/withny-dl/utils/secret"
 	"github.com/Darkness4/withny-dl/withny/api"
 	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
 //go:embed fixtures/playlist.txt
 var fixture1 []byte
 
+// withSeq returns a copy of the fragments with the sequence numbers set by the queue.
+func withSeq(frags []Fragment) []Fragment {
+	out := make([]Fragment, len(frags))
+	for i, f := range frags {
+		f.Seq = i
+		out[i] = f
+	}
+	return out
+}
+
 func timeMustParse(value string) time.Time {
 	t, err := time.Parse(time.RFC3339, value)
 	if err != nil {
@@ -301,6 +317,8 @@ func (suite *DownloaderTestSuite) TestGetFragmentURLs() {
 	// Assert 1
 	suite.NoError(err)
 	suite.Equal(expectedFragments, urls1)
+	suite.Equal(2*time.Second, suite.impl.targetDuration)
+	suite.Equal(time.Second, suite.impl.pollInterval())
 
 	// Act 2
 	urls2, err := suite.impl.GetFragmentURLs(context.Background())
@@ -337,7 +355,46 @@ loop:
 	// Assert
 	err := <-errChan
 	suite.Error(context.Canceled, err)
-	suite.Equal(combinedExpectedFragments, frags)
+	suite.Equal(withSeq(combinedExpectedFragments), frags)
+}
+
+func (suite *DownloaderTestSuite) TestFillQueueIdleTimeout() {
+	// Arrange
+	server := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+			_, _ = res.Write(fixture1)
+		}),
+	)
+	defer server.Close()
+	impl := NewDownloader(
+		api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+		&log.Logger,
+		10,
+		server.URL,
+		WithIdleTimeout(100*time.Millisecond),
+	)
+	fragChan := make(chan Fragment)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	errChan := make(chan error, 1)
+
+	// Act
+	go func() {
+		errChan <- impl.fillQueue(ctx, fragChan)
+	}()
+
+	var err error
+loop:
+	for {
+		select {
+		case <-fragChan:
+		case err = <-errChan:
+			break loop
+		}
+	}
+
+	// Assert
+	suite.ErrorIs(err, io.EOF)
 }
 
 func (suite *DownloaderTestSuite) AfterTest(_, _ string) {
@@ -414,14 +471,684 @@ loop:
 	// Assert
 	err := <-errChan
 	suite.Error(context.Canceled, err)
-	suite.Equal(combinedExpectedFragmentsNoTS, frags)
+	suite.Equal(withSeq(combinedExpectedFragmentsNoTS), frags)
 }
 
 func (suite *DownloaderTestSuiteNoTS) AfterTest(_, _ string) {
 	suite.server.Close()
 }
 
+func TestPollInterval(t *testing.T) {
+	tests := []struct {
+		name           string
+		targetDuration time.Duration
+		expected       time.Duration
+	}{
+		{
+			name:     "no target duration",
+			expected: time.Second,
+		},
+		{
+			name:           "half of the target duration",
+			targetDuration: 10 * time.Second,
+			expected:       5 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			impl := &Downloader{targetDuration: tt.targetDuration}
+			require.Equal(t, tt.expected, impl.pollInterval())
+		})
+	}
+}
+
+func TestReadFragmentConcurrency(t *testing.T) {
+	const nFragments = 8
+	var expected bytes.Buffer
+	for i := range nFragments {
+		expected.WriteString(strings.Repeat(fmt.Sprintf("fragment-%d;", i), 1000))
+	}
+
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			// Arrange
+			playlistCount := 0
+			var server *httptest.Server
+			server = httptest.NewTLSServer(
+				http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					if req.URL.Path == "/playlist.m3u8" {
+						playlistCount++
+						if playlistCount > 1 {
+							http.NotFound(res, req)
+							return
+						}
+						start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+						for i := range nFragments {
+							fmt.Fprintf(
+								res,
+								"#EXT-X-PROGRAM-DATE-TIME:%s\n%s/%d.ts\n",
+								start.Add(time.Duration(i)*time.Second).Format(time.RFC3339),
+								server.URL,
+								i,
+							)
+						}
+						return
+					}
+					var i int
+					if _, err := fmt.Sscanf(req.URL.Path, "/%d.ts", &i); err != nil {
+						http.NotFound(res, req)
+						return
+					}
+					// The first fragments are the slowest to be downloaded.
+					time.Sleep(time.Duration(nFragments-i) * 10 * time.Millisecond)
+					_, _ = res.Write([]byte(strings.Repeat(fmt.Sprintf("fragment-%d;", i), 1000)))
+				}),
+			)
+			defer server.Close()
+			impl := NewDownloader(
+				api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+				&log.Logger,
+				10,
+				server.URL+"/playlist.m3u8",
+				WithFragmentConcurrency(concurrency),
+			)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var out bytes.Buffer
+
+			// Act
+			err := impl.Read(ctx, &out)
+
+			// Assert
+			require.ErrorIs(t, err, io.EOF)
+			require.Equal(t, expected.String(), out.String())
+			require.Equal(t, int64(nFragments), impl.Stats().ProcessedFragments)
+			require.Equal(t, int64(expected.Len()), impl.Stats().BytesWritten)
+		})
+	}
+}
+
+func TestReadStats(t *testing.T) {
+	// Arrange
+	fragments := []string{"first", "", "third fragment"}
+	playlistCount := 0
+	var server *httptest.Server
+	server = httptest.NewTLSServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/playlist.m3u8" {
+				playlistCount++
+				if playlistCount > 1 {
+					http.NotFound(res, req)
+					return
+				}
+				for i := range fragments {
+					fmt.Fprintf(res, "%s/%d.ts\n", server.URL, i)
+				}
+				return
+			}
+			var i int
+			if _, err := fmt.Sscanf(req.URL.Path, "/%d.ts", &i); err != nil {
+				http.NotFound(res, req)
+				return
+			}
+			if fragments[i] == "" {
+				http.Error(res, "fragment unavailable", http.StatusInternalServerError)
+				return
+			}
+			_, _ = res.Write([]byte(fragments[i]))
+		}),
+	)
+	defer server.Close()
+	impl := NewDownloader(
+		api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+		&log.Logger,
+		10,
+		server.URL+"/playlist.m3u8",
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+
+	// Act
+	err := impl.Read(ctx, &out)
+
+	// Assert
+	require.ErrorIs(t, err, io.EOF)
+	stats := impl.Stats()
+	require.Equal(t, int64(len("first")+len("third fragment")), stats.BytesWritten)
+	require.Equal(t, int64(out.Len()), stats.BytesWritten)
+	require.Equal(t, int64(2), stats.ProcessedFragments)
+	require.Equal(t, int64(1), stats.SkippedFragments)
+	require.Equal(t, int64(1), stats.Errors)
+}
+
+func TestGetFragmentURLsEncrypted(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		method string
+	}{
+		{
+			name:   "AES-128",
+			key:    `#EXT-X-KEY:METHOD=AES-128,URI="https://example.com/key",IV=0x00000000000000000000000000000001`,
+			method: "AES-128",
+		},
+		{
+			name:   "SAMPLE-AES",
+			key:    `#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key"`,
+			method: "SAMPLE-AES",
+		},
+		{
+			name: "NONE",
+			key:  `#EXT-X-KEY:METHOD=NONE`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := httptest.NewServer(
+				http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+					fmt.Fprintf(
+						res,
+						"#EXTM3U\n#EXT-X-TARGETDURATION:2\n%s\n#EXTINF:2.000,\nhttps://example.com/0.ts\n",
+						tt.key,
+					)
+				}),
+			)
+			defer server.Close()
+			impl := NewDownloader(
+				api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+				&log.Logger,
+				10,
+				server.URL,
+			)
+
+			// Act
+			frags, err := impl.GetFragmentURLs(context.Background())
+
+			// Assert
+			if tt.method == "" {
+				require.NoError(t, err)
+				require.Len(t, frags, 1)
+				return
+			}
+			require.ErrorIs(t, err, ErrEncryptedStream)
+			var encErr EncryptedStreamError
+			require.ErrorAs(t, err, &encErr)
+			require.Equal(t, tt.method, encErr.Method)
+			require.Empty(t, frags)
+		})
+	}
+}
+
+func TestGetFragmentURLsDiscontinuity(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+			fmt.Fprint(res, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:10
+#EXTINF:2.000,
+https://example.com/10.ts
+#EXTINF:2.000,
+https://example.com/11.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:2.000,
+https://example.com/12.ts
+#EXTINF:2.000,
+https://example.com/13.ts
+`)
+		}),
+	)
+	defer server.Close()
+	impl := NewDownloader(
+		api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+		&log.Logger,
+		10,
+		server.URL,
+	)
+
+	// Act
+	frags, err := impl.GetFragmentURLs(context.Background())
+
+	// Assert
+	require.NoError(t, err)
+	require.Len(t, frags, 4)
+	discontinuities := make([]bool, 0, len(frags))
+	for _, f := range frags {
+		discontinuities = append(discontinuities, f.Discontinuity)
+	}
+	require.Equal(t, []bool{false, false, true, false}, discontinuities)
+	require.Equal(t, "https://example.com/12.ts", frags[2].URL)
+}
+
 func TestDownloaderTestSuite(t *testing.T) {
 	suite.Run(t, &DownloaderTestSuite{})
 	suite.Run(t, &DownloaderTestSuiteNoTS{})
 }
+
+func TestReadMaxFragmentSize(t *testing.T) {
+	// Arrange
+	fragments := []string{"first", "inflated", "third"}
+	playlistCount := 0
+	var server *httptest.Server
+	server = httptest.NewTLSServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/playlist.m3u8" {
+				playlistCount++
+				if playlistCount > 1 {
+					http.NotFound(res, req)
+					return
+				}
+				for i := range fragments {
+					fmt.Fprintf(res, "%s/%d.ts\n", server.URL, i)
+				}
+				return
+			}
+			var i int
+			if _, err := fmt.Sscanf(req.URL.Path, "/%d.ts", &i); err != nil {
+				http.NotFound(res, req)
+				return
+			}
+			if fragments[i] == "inflated" {
+				res.Header().Set("Content-Length", "100000000")
+			}
+			_, _ = res.Write([]byte(fragments[i]))
+		}),
+	)
+	defer server.Close()
+	impl := NewDownloader(
+		api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+		&log.Logger,
+		// Any packet loss would cancel the download.
+		0,
+		server.URL+"/playlist.m3u8",
+		WithMaxFragmentSize(1024),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+
+	// Act
+	err := impl.Read(ctx, &out)
+
+	// Assert
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, "firstthird", out.String())
+	stats := impl.Stats()
+	require.Equal(t, int64(2), stats.ProcessedFragments)
+	require.Equal(t, int64(1), stats.SkippedFragments)
+	require.Equal(t, int64(1), stats.Errors)
+}
+
+func TestDownloadMaxFragmentSizeWithoutContentLength(t *testing.T) {
+	// Arrange
+	body := bytes.Repeat([]byte("a"), 4096)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+			// Flushing before writing the body removes the Content-Length.
+			res.(http.Flusher).Flush()
+			_, _ = res.Write(body)
+		}),
+	)
+	defer server.Close()
+	client := api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache())
+	impl := NewDownloader(client, &log.Logger, 10, server.URL, WithMaxFragmentSize(1024))
+	var buf bytes.Buffer
+
+	// Act
+	n, err := impl.download(context.Background(), defaultFragmentWriter{w: &buf}, Fragment{URL: server.URL})
+
+	// Assert
+	require.ErrorIs(t, err, ErrFragmentTooLarge)
+	require.Equal(t, FragmentTooLargeError{ContentLength: -1, Max: 1024}, err)
+	require.Zero(t, n)
+	require.Zero(t, buf.Len(), "the fragment must not be truncated")
+}
+
+func TestReadMaxFragmentSizeWithoutContentLength(t *testing.T) {
+	for _, concurrency := range []int{1, 3} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			// Arrange
+			fragments := []string{"first", strings.Repeat("a", 4096), "third"}
+			var playlistCount atomic.Int32
+			var server *httptest.Server
+			server = httptest.NewTLSServer(
+				http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					if req.URL.Path == "/playlist.m3u8" {
+						if playlistCount.Add(1) > 1 {
+							http.NotFound(res, req)
+							return
+						}
+						for i := range fragments {
+							fmt.Fprintf(res, "%s/%d.ts\n", server.URL, i)
+						}
+						return
+					}
+					var i int
+					if _, err := fmt.Sscanf(req.URL.Path, "/%d.ts", &i); err != nil {
+						http.NotFound(res, req)
+						return
+					}
+					// Flushing before writing the body removes the Content-Length.
+					res.(http.Flusher).Flush()
+					_, _ = res.Write([]byte(fragments[i]))
+				}),
+			)
+			defer server.Close()
+			impl := NewDownloader(
+				api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+				&log.Logger,
+				// Any packet loss would cancel the download.
+				0,
+				server.URL+"/playlist.m3u8",
+				WithMaxFragmentSize(1024),
+				WithFragmentConcurrency(concurrency),
+			)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var out bytes.Buffer
+
+			// Act
+			err := impl.Read(ctx, &out)
+
+			// Assert
+			require.ErrorIs(t, err, io.EOF)
+			require.Equal(t, "firstthird", out.String())
+			stats := impl.Stats()
+			require.Equal(t, int64(2), stats.ProcessedFragments)
+			require.Equal(t, int64(1), stats.SkippedFragments)
+		})
+	}
+}
+
+func TestDownloadBandwidthLimit(t *testing.T) {
+	// Arrange
+	body := bytes.Repeat([]byte("a"), 25*1024)
+	server := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, _ *http.Request) {
+			_, _ = res.Write(body)
+		}),
+	)
+	defer server.Close()
+	client := api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache())
+	unlimited := NewDownloader(client, &log.Logger, 10, server.URL)
+	limited := NewDownloader(client, &log.Logger, 10, server.URL, WithBandwidthLimit(10*1024))
+
+	// Act
+	start := time.Now()
+	var unlimitedBuf bytes.Buffer
+	unlimitedN, unlimitedErr := unlimited.download(
+		context.Background(),
+		defaultFragmentWriter{w: &unlimitedBuf},
+		Fragment{URL: server.URL},
+	)
+	unlimitedElapsed := time.Since(start)
+
+	start = time.Now()
+	var limitedBuf bytes.Buffer
+	limitedN, limitedErr := limited.download(
+		context.Background(),
+		defaultFragmentWriter{w: &limitedBuf},
+		Fragment{URL: server.URL},
+	)
+	limitedElapsed := time.Since(start)
+
+	// Assert
+	require.NoError(t, unlimitedErr)
+	require.NoError(t, limitedErr)
+	require.EqualValues(t, len(body), unlimitedN)
+	require.EqualValues(t, len(body), limitedN)
+	require.Equal(t, body, limitedBuf.Bytes())
+	// The first 10 KiB are served by the burst, the remaining 15 KiB take ~1.5s.
+	require.Greater(t, limitedElapsed, time.Second)
+	require.Greater(t, limitedElapsed, 10*unlimitedElapsed)
+}
+
+func TestFillQueueNotModified(t *testing.T) {
+	// Arrange
+	var requests, notModified atomic.Int32
+	server := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			requests.Add(1)
+			if req.Header.Get("If-None-Match") == `"v1"` {
+				notModified.Add(1)
+				res.WriteHeader(http.StatusNotModified)
+				return
+			}
+			res.Header().Set("ETag", `"v1"`)
+			fmt.Fprint(res, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXTINF:2.000,
+https://example.com/10.ts
+#EXTINF:2.000,
+https://example.com/11.ts
+`)
+		}),
+	)
+	defer server.Close()
+	impl := NewDownloader(
+		api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+		&log.Logger,
+		10,
+		server.URL,
+		WithIdleTimeout(3*time.Second),
+	)
+	fragChan := make(chan Fragment, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Act
+	err := impl.fillQueue(ctx, fragChan)
+	close(fragChan)
+
+	// Assert
+	require.ErrorIs(t, err, io.EOF)
+	urls := make([]string, 0, 2)
+	for f := range fragChan {
+		urls = append(urls, f.URL)
+	}
+	require.Equal(t, []string{"https://example.com/10.ts", "https://example.com/11.ts"}, urls)
+	require.Greater(t, requests.Load(), int32(1))
+	require.Equal(t, requests.Load()-1, notModified.Load())
+}
+
+func TestFillQueueCanceledWhilePolling(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(res, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:20
+#EXTINF:20.000,
+https://example.com/10.ts
+`)
+		}),
+	)
+	defer server.Close()
+	impl := NewDownloader(
+		api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+		&log.Logger,
+		10,
+		server.URL,
+	)
+	fragChan := make(chan Fragment, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Act
+	// The poll interval is 10s, the queue must stop as soon as it is canceled.
+	go func() {
+		<-fragChan
+		cancel()
+	}()
+	start := time.Now()
+	err := impl.fillQueue(ctx, fragChan)
+
+	// Assert
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestFillQueueCanceledWhileSending(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			fmt.Fprint(res, `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:2
+#EXTINF:2.000,
+https://example.com/10.ts
+`)
+		}),
+	)
+	defer server.Close()
+	impl := NewDownloader(
+		api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+		&log.Logger,
+		10,
+		server.URL,
+	)
+	// Nobody receives the fragments.
+	fragChan := make(chan Fragment)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// Act
+	err := impl.fillQueue(ctx, fragChan)
+
+	// Assert
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestReadFirstFragmentCallback(t *testing.T) {
+	// Arrange
+	fragments := []string{"", "second", "third"}
+	playlistCount := 0
+	var server *httptest.Server
+	server = httptest.NewTLSServer(
+		http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/playlist.m3u8" {
+				playlistCount++
+				if playlistCount > 1 {
+					http.NotFound(res, req)
+					return
+				}
+				for i := range fragments {
+					fmt.Fprintf(res, "%s/%d.ts\n", server.URL, i)
+				}
+				return
+			}
+			var i int
+			if _, err := fmt.Sscanf(req.URL.Path, "/%d.ts", &i); err != nil {
+				http.NotFound(res, req)
+				return
+			}
+			if fragments[i] == "" {
+				http.Error(res, "fragment unavailable", http.StatusInternalServerError)
+				return
+			}
+			_, _ = res.Write([]byte(fragments[i]))
+		}),
+	)
+	defer server.Close()
+	var calls []time.Duration
+	impl := NewDownloader(
+		api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+		&log.Logger,
+		10,
+		server.URL+"/playlist.m3u8",
+		WithFirstFragmentCallback(func(d time.Duration) {
+			calls = append(calls, d)
+		}),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var out bytes.Buffer
+
+	// Act
+	err := impl.Read(ctx, &out)
+
+	// Assert
+	require.ErrorIs(t, err, io.EOF)
+	require.Len(t, calls, 1)
+	require.GreaterOrEqual(t, calls[0], time.Duration(0))
+}
+
+type recordingFragmentWriter struct {
+	urls   []string
+	bodies []string
+}
+
+func (fw *recordingFragmentWriter) WriteFragment(frag Fragment, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	fw.urls = append(fw.urls, frag.URL)
+	fw.bodies = append(fw.bodies, string(b))
+	return nil
+}
+
+func TestReadFragmentWriter(t *testing.T) {
+	for _, concurrency := range []int{1, 3} {
+		t.Run(fmt.Sprintf("concurrency %d", concurrency), func(t *testing.T) {
+			// Arrange
+			fragments := []string{"first", "second", "third"}
+			playlistCount := 0
+			var server *httptest.Server
+			server = httptest.NewTLSServer(
+				http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+					if req.URL.Path == "/playlist.m3u8" {
+						playlistCount++
+						if playlistCount > 1 {
+							http.NotFound(res, req)
+							return
+						}
+						for i := range fragments {
+							fmt.Fprintf(res, "%s/%d.ts\n", server.URL, i)
+						}
+						return
+					}
+					var i int
+					if _, err := fmt.Sscanf(req.URL.Path, "/%d.ts", &i); err != nil {
+						http.NotFound(res, req)
+						return
+					}
+					_, _ = res.Write([]byte(fragments[i]))
+				}),
+			)
+			defer server.Close()
+			fw := &recordingFragmentWriter{}
+			impl := NewDownloader(
+				api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache()),
+				&log.Logger,
+				10,
+				server.URL+"/playlist.m3u8",
+				WithFragmentWriter(fw),
+				WithFragmentConcurrency(concurrency),
+			)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			var out bytes.Buffer
+
+			// Act
+			err := impl.Read(ctx, &out)
+
+			// Assert
+			require.ErrorIs(t, err, io.EOF)
+			require.Equal(t, []string{
+				server.URL + "/0.ts",
+				server.URL + "/1.ts",
+				server.URL + "/2.ts",
+			}, fw.urls)
+			require.Equal(t, fragments, fw.bodies)
+			require.Zero(t, out.Len())
+			require.Equal(t, int64(len("first")+len("second")+len("third")), impl.Stats().BytesWritten)
+		})
+	}
+}
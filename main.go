@@ -2,13 +2,19 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"github.com/Darkness4/withny-dl/cmd/clean"
 	"github.com/Darkness4/withny-dl/cmd/concat"
+	generatealerts "github.com/Darkness4/withny-dl/cmd/generate-alerts"
+	"github.com/Darkness4/withny-dl/cmd/listquality"
 	"github.com/Darkness4/withny-dl/cmd/logintest"
 	"github.com/Darkness4/withny-dl/cmd/remux"
 	"github.com/Darkness4/withny-dl/cmd/watch"
+	"github.com/Darkness4/withny-dl/hls"
+	"github.com/Darkness4/withny-dl/withny/api"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
@@ -63,6 +69,14 @@ var app = &cli.App{
 				return nil
 			},
 		},
+		&cli.StringSliceFlag{
+			Name:    "log-level-override",
+			Usage:   "Override the log level of a package (PACKAGE=LEVEL). Packages: api, hls.",
+			EnvVars: []string{"LOG_LEVEL_OVERRIDE"},
+			Action: func(_ *cli.Context, overrides []string) error {
+				return applyLogLevelOverrides(overrides)
+			},
+		},
 	},
 	Commands: []*cli.Command{
 		watch.Command,
@@ -70,9 +84,45 @@ var app = &cli.App{
 		concat.Command,
 		clean.Command,
 		logintest.Command,
+		listquality.Command,
+		generatealerts.Command,
 	},
 }
 
+// packageLoggers are the package loggers which level can be overridden.
+var packageLoggers = map[string]*zerolog.Logger{
+	"api": &api.Logger,
+	"hls": &hls.Logger,
+}
+
+// applyLogLevelOverrides parses the PACKAGE=LEVEL overrides and sets the
+// package loggers accordingly.
+func applyLogLevelOverrides(overrides []string) error {
+	globalLevel := log.Logger.GetLevel()
+	for _, override := range overrides {
+		pkg, lvl, ok := strings.Cut(override, "=")
+		if !ok {
+			return fmt.Errorf("invalid log level override '%s', expected PACKAGE=LEVEL", override)
+		}
+		logger, ok := packageLoggers[strings.TrimSpace(pkg)]
+		if !ok {
+			return fmt.Errorf("unknown package '%s' in log level override", pkg)
+		}
+		level, err := zerolog.ParseLevel(strings.TrimSpace(lvl))
+		if err != nil {
+			return fmt.Errorf("invalid level in log level override '%s': %w", override, err)
+		}
+		*logger = log.Logger.Level(level)
+		if level < globalLevel {
+			globalLevel = level
+		}
+	}
+	// The global level filters every logger, so it must allow the most verbose
+	// package level. The default logger keeps its own level.
+	zerolog.SetGlobalLevel(globalLevel)
+	return nil
+}
+
 func main() {
 	log.Logger = log.Logger.With().Caller().Logger()
 	if err := app.Run(os.Args); err != nil {
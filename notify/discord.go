@@ -0,0 +1,195 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	discordColorDefault = 0x5865f2
+	discordColorGreen   = 0x57f287
+	discordColorRed     = 0xed4245
+	discordColorYellow  = 0xfee75c
+)
+
+// DiscordOptions is the options for the Discord notifier.
+type DiscordOptions struct {
+	mentionRoleID string
+	client        *http.Client
+}
+
+// DiscordOption is the option for the Discord notifier.
+type DiscordOption func(*DiscordOptions)
+
+// WithMentionRoleID mentions the role in every notification.
+func WithMentionRoleID(roleID string) DiscordOption {
+	return func(o *DiscordOptions) {
+		o.mentionRoleID = roleID
+	}
+}
+
+// WithDiscordHTTPClient sets the HTTP client used to call the webhook.
+func WithDiscordHTTPClient(client *http.Client) DiscordOption {
+	return func(o *DiscordOptions) {
+		o.client = client
+	}
+}
+
+func applyDiscordOptions(opts []DiscordOption) *DiscordOptions {
+	o := &DiscordOptions{
+		client: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// DiscordNotifier is the notifier for Discord webhooks.
+//
+// Notifications are sent as embeds, color-coded by event.
+type DiscordNotifier struct {
+	webhookURL string
+	opts       *DiscordOptions
+}
+
+// NewDiscordNotifier creates a new Discord notifier.
+func NewDiscordNotifier(webhookURL string, opts ...DiscordOption) *DiscordNotifier {
+	return &DiscordNotifier{
+		webhookURL: webhookURL,
+		opts:       applyDiscordOptions(opts),
+	}
+}
+
+// DiscordWebhookPayload is the body of a Discord webhook execution.
+type DiscordWebhookPayload struct {
+	Content         string                  `json:"content,omitempty"`
+	Embeds          []DiscordEmbed          `json:"embeds"`
+	AllowedMentions *DiscordAllowedMentions `json:"allowed_mentions,omitempty"`
+}
+
+// DiscordAllowedMentions restricts the mentions of a Discord message.
+type DiscordAllowedMentions struct {
+	Roles []string `json:"roles"`
+}
+
+// DiscordEmbed is a Discord embed.
+type DiscordEmbed struct {
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	Color       int                    `json:"color"`
+	Timestamp   string                 `json:"timestamp,omitempty"`
+	Thumbnail   *DiscordEmbedThumbnail `json:"thumbnail,omitempty"`
+	Fields      []DiscordEmbedField    `json:"fields,omitempty"`
+}
+
+// DiscordEmbedThumbnail is the thumbnail of a Discord embed.
+type DiscordEmbedThumbnail struct {
+	URL string `json:"url"`
+}
+
+// DiscordEmbedField is a field of a Discord embed.
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// Notify sends a notification to the Discord webhook.
+func (n *DiscordNotifier) Notify(
+	ctx context.Context,
+	title string,
+	message string,
+	priority int,
+) error {
+	return n.NotifyEvent(ctx, Event{}, title, message, priority)
+}
+
+// NotifyEvent sends a notification to the Discord webhook.
+//
+// The channel ID and the thumbnail of the event are added to the embed.
+func (n *DiscordNotifier) NotifyEvent(
+	ctx context.Context,
+	event Event,
+	title string,
+	message string,
+	_ int,
+) error {
+	payload := n.payload(event, title, message, time.Now())
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.opts.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("discord webhook failed: %s, body: %s", resp.Status, b)
+	}
+	return nil
+}
+
+func (n *DiscordNotifier) payload(event Event, title, message string, now time.Time) DiscordWebhookPayload {
+	if event.Time.IsZero() {
+		event.Time = now
+	}
+	timestamp := event.Time.UTC().Format(time.RFC3339)
+	embed := DiscordEmbed{
+		Title:       fmt.Sprintf("withny-dl: %s", title),
+		Description: message,
+		Color:       discordColor(event.Kind),
+		Timestamp:   timestamp,
+	}
+	if event.ChannelID != "" {
+		embed.Fields = append(embed.Fields, DiscordEmbedField{
+			Name:   "Channel ID",
+			Value:  event.ChannelID,
+			Inline: true,
+		})
+	}
+	embed.Fields = append(embed.Fields, DiscordEmbedField{
+		Name:   "Timestamp",
+		Value:  timestamp,
+		Inline: true,
+	})
+	if t, ok := event.MetaData.(Thumbnailer); ok && t.ThumbnailURL() != "" {
+		embed.Thumbnail = &DiscordEmbedThumbnail{URL: t.ThumbnailURL()}
+	}
+
+	payload := DiscordWebhookPayload{
+		Embeds: []DiscordEmbed{embed},
+		// Never ping anyone unless asked.
+		AllowedMentions: &DiscordAllowedMentions{Roles: []string{}},
+	}
+	if n.opts.mentionRoleID != "" {
+		payload.Content = fmt.Sprintf("<@&%s>", n.opts.mentionRoleID)
+		payload.AllowedMentions.Roles = []string{n.opts.mentionRoleID}
+	}
+	return payload
+}
+
+func discordColor(kind EventKind) int {
+	switch kind {
+	case EventDownloading, EventFinished:
+		return discordColorGreen
+	case EventError, EventLoginFailed, EventPanicked:
+		return discordColorRed
+	case EventQualityDowngrade, EventCanceled:
+		return discordColorYellow
+	default:
+		return discordColorDefault
+	}
+}
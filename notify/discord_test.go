@@ -0,0 +1,79 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/notify"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscordNotifier(t *testing.T) {
+	// Arrange
+	payloads := make(chan notify.DiscordWebhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload notify.DiscordWebhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		payloads <- payload
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	n := notify.NewFormatedNotifier(
+		notify.NewDiscordNotifier(server.URL, notify.WithMentionRoleID("1234")),
+		notify.DefaultNotificationFormats,
+	)
+
+	// Act
+	err := n.NotifyDownloading(context.Background(), "channel", nil, api.MetaData{
+		Stream: api.GetStreamsResponseElement{
+			Title:        "my stream",
+			ThumbnailURL: "https://example.com/thumb.jpg",
+		},
+	})
+
+	// Assert
+	require.NoError(t, err)
+	payload := <-payloads
+	require.Equal(t, "<@&1234>", payload.Content)
+	require.Equal(t, []string{"1234"}, payload.AllowedMentions.Roles)
+	require.Len(t, payload.Embeds, 1)
+	embed := payload.Embeds[0]
+	require.Contains(t, embed.Title, "withny-dl: ")
+	require.Equal(t, 0x57f287, embed.Color)
+	require.NotNil(t, embed.Thumbnail)
+	require.Equal(t, "https://example.com/thumb.jpg", embed.Thumbnail.URL)
+	require.Len(t, embed.Fields, 2)
+	require.Equal(t, "Channel ID", embed.Fields[0].Name)
+	require.Equal(t, "channel", embed.Fields[0].Value)
+	require.Equal(t, "Timestamp", embed.Fields[1].Name)
+	require.Equal(t, embed.Timestamp, embed.Fields[1].Value)
+}
+
+func TestDiscordNotifierError(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "invalid webhook", http.StatusNotFound)
+	}))
+	defer server.Close()
+	n := notify.NewDiscordNotifier(server.URL)
+
+	// Act
+	err := n.NotifyEvent(
+		context.Background(),
+		notify.Event{Kind: notify.EventError, ChannelID: "channel"},
+		"error",
+		"boom",
+		10,
+	)
+
+	// Assert
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "404")
+}
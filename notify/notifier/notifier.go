@@ -53,6 +53,17 @@ func NotifyDownloading(
 	return Notifier.NotifyDownloading(ctx, channelID, labels, metadata)
 }
 
+// NotifyQualityDowngrade notifies the user that the stream is downloaded in a lower quality than requested.
+func NotifyQualityDowngrade(
+	ctx context.Context,
+	channelID string,
+	requestedQuality string,
+	actualQuality string,
+	labels map[string]string,
+) error {
+	return Notifier.NotifyQualityDowngrade(ctx, channelID, requestedQuality, actualQuality, labels)
+}
+
 // NotifyPostProcessing notifies the user that the program is post processing the stream.
 func NotifyPostProcessing(
 	ctx context.Context,
@@ -64,13 +75,16 @@ func NotifyPostProcessing(
 }
 
 // NotifyFinished notifies the user that the program has finished downloading the stream.
+//
+// recording describes the recorded file. Its fields are zero if unknown.
 func NotifyFinished(
 	ctx context.Context,
 	channelID string,
 	labels map[string]string,
 	metadata any,
+	recording notify.Recording,
 ) error {
-	return Notifier.NotifyFinished(ctx, channelID, labels, metadata)
+	return Notifier.NotifyFinished(ctx, channelID, labels, metadata, recording)
 }
 
 // NotifyError notifies the user that the program has encountered an error.
@@ -0,0 +1,69 @@
+package notifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/notify"
+	"github.com/Darkness4/withny-dl/utils/ptr"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	title   string
+	message string
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, title string, message string, _ int) error {
+	n.title = title
+	n.message = message
+	return nil
+}
+
+func TestNotifyFinished(t *testing.T) {
+	tests := []struct {
+		name      string
+		recording notify.Recording
+		expected  string
+	}{
+		{
+			name: "probed",
+			recording: notify.Recording{
+				Duration:      2*time.Hour + 15*time.Minute,
+				FileSizeBytes: 4200000000,
+			},
+			expected: "Downloaded 2h15m0s, 4200000000 bytes",
+		},
+		{
+			name:     "probe and stat failed",
+			expected: "Downloaded 0s, 0 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			base := &recordingNotifier{}
+			formats := notify.DefaultNotificationFormats
+			formats.Finished = notify.NotificationFormat{
+				Enabled: ptr.Ref(true),
+				Title:   "{{ .ChannelID }} stream ended",
+				Message: "Downloaded {{ .RecordingDuration }}, {{ .FileSizeBytes }} bytes",
+			}
+			oldNotifier := Notifier
+			defer func() {
+				Notifier = oldNotifier
+			}()
+			Notifier = notify.NewFormatedNotifier(base, formats)
+
+			// Act
+			err := NotifyFinished(context.Background(), "channel", nil, nil, tt.recording)
+
+			// Assert
+			require.NoError(t, err)
+			require.Equal(t, "channel stream ended", base.title)
+			require.Equal(t, tt.expected, base.message)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/containrrr/shoutrrr"
 	"github.com/containrrr/shoutrrr/pkg/router"
@@ -22,6 +23,105 @@ type BaseNotifier interface {
 	) error
 }
 
+// EventKind is the kind of event which triggered a notification.
+type EventKind string
+
+// Event kinds, named after the notification formats.
+const (
+	EventConfigReloaded   EventKind = "configReloaded"
+	EventLoginFailed      EventKind = "loginFailed"
+	EventPanicked         EventKind = "panicked"
+	EventIdle             EventKind = "idle"
+	EventPreparingFiles   EventKind = "preparingFiles"
+	EventDownloading      EventKind = "downloading"
+	EventQualityDowngrade EventKind = "qualityDowngrade"
+	EventPostProcessing   EventKind = "postProcessing"
+	EventFinished         EventKind = "finished"
+	EventError            EventKind = "error"
+	EventCanceled         EventKind = "canceled"
+	EventUpdateAvailable  EventKind = "updateAvailable"
+)
+
+// Event is the context of a notification.
+type Event struct {
+	Kind      EventKind
+	ChannelID string
+	MetaData  any
+	Time      time.Time
+}
+
+// EventNotifier is a notifier which uses the context of the event.
+type EventNotifier interface {
+	BaseNotifier
+	NotifyEvent(
+		ctx context.Context,
+		event Event,
+		title string,
+		message string,
+		priority int,
+	) error
+}
+
+// Thumbnailer is implemented by the metadata exposing a thumbnail.
+type Thumbnailer interface {
+	ThumbnailURL() string
+}
+
+// ThumbnailFiler is implemented by the metadata exposing a written thumbnail.
+type ThumbnailFiler interface {
+	ThumbnailPath() string
+}
+
+// MultiNotifier sends the notifications to multiple notifiers.
+type MultiNotifier []BaseNotifier
+
+// Notify sends a notification to every notifier.
+func (n MultiNotifier) Notify(
+	ctx context.Context,
+	title string,
+	message string,
+	priority int,
+) error {
+	errs := []error{}
+	for _, notifier := range n {
+		if err := notifier.Notify(ctx, title, message, priority); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyEvent sends a notification to every notifier, with the event if supported.
+func (n MultiNotifier) NotifyEvent(
+	ctx context.Context,
+	event Event,
+	title string,
+	message string,
+	priority int,
+) error {
+	errs := []error{}
+	for _, notifier := range n {
+		if err := notifyEvent(ctx, notifier, event, title, message, priority); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func notifyEvent(
+	ctx context.Context,
+	notifier BaseNotifier,
+	event Event,
+	title string,
+	message string,
+	priority int,
+) error {
+	if en, ok := notifier.(EventNotifier); ok {
+		return en.NotifyEvent(ctx, event, title, message, priority)
+	}
+	return notifier.Notify(ctx, title, message, priority)
+}
+
 // DummyNotifier is the notifier which prints in the logs.
 type DummyNotifier struct{}
 
@@ -4,23 +4,25 @@ import (
 	"context"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/Darkness4/withny-dl/utils/ptr"
 )
 
 // NotificationFormats is a collection of formats for notifications.
 type NotificationFormats struct {
-	ConfigReloaded  NotificationFormat `yaml:"configReloaded,omitempty"`
-	LoginFailed     NotificationFormat `yaml:"loginFailed,omitempty"`
-	Panicked        NotificationFormat `yaml:"panicked,omitempty"`
-	Idle            NotificationFormat `yaml:"idle,omitempty"`
-	PreparingFiles  NotificationFormat `yaml:"preparingFiles,omitempty"`
-	Downloading     NotificationFormat `yaml:"downloading,omitempty"`
-	PostProcessing  NotificationFormat `yaml:"postProcessing,omitempty"`
-	Finished        NotificationFormat `yaml:"finished,omitempty"`
-	Error           NotificationFormat `yaml:"error,omitempty"`
-	Canceled        NotificationFormat `yaml:"canceled,omitempty"`
-	UpdateAvailable NotificationFormat `yaml:"updateAvailable,omitempty"`
+	ConfigReloaded   NotificationFormat `yaml:"configReloaded,omitempty"`
+	LoginFailed      NotificationFormat `yaml:"loginFailed,omitempty"`
+	Panicked         NotificationFormat `yaml:"panicked,omitempty"`
+	Idle             NotificationFormat `yaml:"idle,omitempty"`
+	PreparingFiles   NotificationFormat `yaml:"preparingFiles,omitempty"`
+	Downloading      NotificationFormat `yaml:"downloading,omitempty"`
+	QualityDowngrade NotificationFormat `yaml:"qualityDowngrade,omitempty"`
+	PostProcessing   NotificationFormat `yaml:"postProcessing,omitempty"`
+	Finished         NotificationFormat `yaml:"finished,omitempty"`
+	Error            NotificationFormat `yaml:"error,omitempty"`
+	Canceled         NotificationFormat `yaml:"canceled,omitempty"`
+	UpdateAvailable  NotificationFormat `yaml:"updateAvailable,omitempty"`
 }
 
 // NotificationFormat is a format for a notification.
@@ -33,17 +35,18 @@ type NotificationFormat struct {
 
 // NotificationTemplates is a collection of templates for notifications.
 type NotificationTemplates struct {
-	ConfigReloaded  NotificationTemplate
-	LoginFailed     NotificationTemplate
-	Panicked        NotificationTemplate
-	Idle            NotificationTemplate
-	PreparingFiles  NotificationTemplate
-	Downloading     NotificationTemplate
-	PostProcessing  NotificationTemplate
-	Finished        NotificationTemplate
-	Error           NotificationTemplate
-	Canceled        NotificationTemplate
-	UpdateAvailable NotificationTemplate
+	ConfigReloaded   NotificationTemplate
+	LoginFailed      NotificationTemplate
+	Panicked         NotificationTemplate
+	Idle             NotificationTemplate
+	PreparingFiles   NotificationTemplate
+	Downloading      NotificationTemplate
+	QualityDowngrade NotificationTemplate
+	PostProcessing   NotificationTemplate
+	Finished         NotificationTemplate
+	Error            NotificationTemplate
+	Canceled         NotificationTemplate
+	UpdateAvailable  NotificationTemplate
 }
 
 // NotificationTemplate is a template for a notification.
@@ -86,6 +89,12 @@ var DefaultNotificationFormats = NotificationFormats{
 		Message:  "{{ .MetaData.Stream.Title }}",
 		Priority: 7,
 	},
+	QualityDowngrade: NotificationFormat{
+		Enabled:  ptr.Ref(true),
+		Title:    "{{ .ChannelID }} is downloaded in a lower quality",
+		Message:  "requested: {{ .RequestedQuality }}, actual: {{ .ActualQuality }}",
+		Priority: 7,
+	},
 	PostProcessing: NotificationFormat{
 		Enabled:  ptr.Ref(false),
 		Title:    "post-processing {{ .ChannelID }}",
@@ -142,6 +151,7 @@ func applyNotificationFormatsDefault(newFormat NotificationFormats) Notification
 	formats.Idle.applyNotificationFormatDefault(newFormat.Idle)
 	formats.PreparingFiles.applyNotificationFormatDefault(newFormat.PreparingFiles)
 	formats.Downloading.applyNotificationFormatDefault(newFormat.Downloading)
+	formats.QualityDowngrade.applyNotificationFormatDefault(newFormat.QualityDowngrade)
 	formats.PostProcessing.applyNotificationFormatDefault(newFormat.PostProcessing)
 	formats.Finished.applyNotificationFormatDefault(newFormat.Finished)
 	formats.Error.applyNotificationFormatDefault(newFormat.Error)
@@ -159,17 +169,18 @@ func initializeTemplate(format NotificationFormat) NotificationTemplate {
 
 func initializeTemplates(formats NotificationFormats) NotificationTemplates {
 	return NotificationTemplates{
-		ConfigReloaded:  initializeTemplate(formats.ConfigReloaded),
-		LoginFailed:     initializeTemplate(formats.LoginFailed),
-		Panicked:        initializeTemplate(formats.Panicked),
-		Idle:            initializeTemplate(formats.Idle),
-		PreparingFiles:  initializeTemplate(formats.PreparingFiles),
-		Downloading:     initializeTemplate(formats.Downloading),
-		PostProcessing:  initializeTemplate(formats.PostProcessing),
-		Finished:        initializeTemplate(formats.Finished),
-		Error:           initializeTemplate(formats.Error),
-		Canceled:        initializeTemplate(formats.Canceled),
-		UpdateAvailable: initializeTemplate(formats.UpdateAvailable),
+		ConfigReloaded:   initializeTemplate(formats.ConfigReloaded),
+		LoginFailed:      initializeTemplate(formats.LoginFailed),
+		Panicked:         initializeTemplate(formats.Panicked),
+		Idle:             initializeTemplate(formats.Idle),
+		PreparingFiles:   initializeTemplate(formats.PreparingFiles),
+		Downloading:      initializeTemplate(formats.Downloading),
+		QualityDowngrade: initializeTemplate(formats.QualityDowngrade),
+		PostProcessing:   initializeTemplate(formats.PostProcessing),
+		Finished:         initializeTemplate(formats.Finished),
+		Error:            initializeTemplate(formats.Error),
+		Canceled:         initializeTemplate(formats.Canceled),
+		UpdateAvailable:  initializeTemplate(formats.UpdateAvailable),
 	}
 }
 
@@ -190,6 +201,18 @@ func NewFormatedNotifier(notifier BaseNotifier, formats NotificationFormats) *Fo
 	}
 }
 
+// notify sends the notification with the event if the notifier supports it.
+func (n *FormatedNotifier) notify(
+	ctx context.Context,
+	event Event,
+	title string,
+	message string,
+	priority int,
+) error {
+	event.Time = time.Now()
+	return notifyEvent(ctx, n.BaseNotifier, event, title, message, priority)
+}
+
 // NotifyDownloading sends a notification that the download is starting.
 func (n *FormatedNotifier) NotifyDownloading(
 	ctx context.Context,
@@ -232,14 +255,79 @@ func (n *FormatedNotifier) NotifyDownloading(
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind:      EventDownloading,
+			ChannelID: channelID,
+			MetaData:  metadata,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.Downloading.Priority,
 	)
 }
 
+// NotifyQualityDowngrade sends a notification that the stream is downloaded in a lower
+// quality than requested.
+func (n *FormatedNotifier) NotifyQualityDowngrade(
+	ctx context.Context,
+	channelID string,
+	requestedQuality string,
+	actualQuality string,
+	labels map[string]string,
+) error {
+	if n.NotificationFormats.QualityDowngrade.Enabled == nil ||
+		(n.NotificationFormats.QualityDowngrade.Enabled != nil &&
+			!(*n.NotificationFormats.QualityDowngrade.Enabled)) {
+		return nil
+	}
+	var titleSB strings.Builder
+	var messageSB strings.Builder
+	if err := n.NotificationTemplates.QualityDowngrade.TitleTemplate.Execute(
+		&titleSB,
+		struct {
+			ChannelID        string
+			RequestedQuality string
+			ActualQuality    string
+			Labels           map[string]string
+		}{
+			ChannelID:        channelID,
+			RequestedQuality: requestedQuality,
+			ActualQuality:    actualQuality,
+			Labels:           labels,
+		},
+	); err != nil {
+		return err
+	}
+	if err := n.NotificationTemplates.QualityDowngrade.MessageTemplate.Execute(
+		&messageSB,
+		struct {
+			ChannelID        string
+			RequestedQuality string
+			ActualQuality    string
+			Labels           map[string]string
+		}{
+			ChannelID:        channelID,
+			RequestedQuality: requestedQuality,
+			ActualQuality:    actualQuality,
+			Labels:           labels,
+		},
+	); err != nil {
+		return err
+	}
+	return n.notify(
+		ctx,
+		Event{
+			Kind:      EventQualityDowngrade,
+			ChannelID: channelID,
+		},
+		titleSB.String(),
+		messageSB.String(),
+		n.NotificationFormats.QualityDowngrade.Priority,
+	)
+}
+
 // NotifyError sends a notification that the download encountered an error.
 func (n *FormatedNotifier) NotifyError(
 	ctx context.Context,
@@ -282,20 +370,33 @@ func (n *FormatedNotifier) NotifyError(
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind:      EventError,
+			ChannelID: channelID,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.Error.Priority,
 	)
 }
 
+// Recording describes the recorded file of a finished download.
+type Recording struct {
+	// Duration is the duration of the recording.
+	Duration time.Duration
+	// FileSizeBytes is the size of the recorded file.
+	FileSizeBytes int64
+}
+
 // NotifyFinished sends a notification that the download is finished.
 func (n *FormatedNotifier) NotifyFinished(
 	ctx context.Context,
 	channelID string,
 	labels map[string]string,
 	metadata any,
+	recording Recording,
 ) error {
 	if n.NotificationFormats.Finished.Enabled == nil ||
 		(n.NotificationFormats.Finished.Enabled != nil &&
@@ -304,36 +405,38 @@ func (n *FormatedNotifier) NotifyFinished(
 	}
 	var titleSB strings.Builder
 	var messageSB strings.Builder
+	data := struct {
+		ChannelID         string
+		MetaData          any
+		Labels            map[string]string
+		RecordingDuration time.Duration
+		FileSizeBytes     int64
+	}{
+		ChannelID:         channelID,
+		MetaData:          metadata,
+		Labels:            labels,
+		RecordingDuration: recording.Duration,
+		FileSizeBytes:     recording.FileSizeBytes,
+	}
 	if err := n.NotificationTemplates.Finished.TitleTemplate.Execute(
 		&titleSB,
-		struct {
-			ChannelID string
-			MetaData  any
-			Labels    map[string]string
-		}{
-			ChannelID: channelID,
-			MetaData:  metadata,
-			Labels:    labels,
-		},
+		data,
 	); err != nil {
 		return err
 	}
 	if err := n.NotificationTemplates.Finished.MessageTemplate.Execute(
 		&messageSB,
-		struct {
-			ChannelID string
-			MetaData  any
-			Labels    map[string]string
-		}{
-			ChannelID: channelID,
-			MetaData:  metadata,
-			Labels:    labels,
-		},
+		data,
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind:      EventFinished,
+			ChannelID: channelID,
+			MetaData:  metadata,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.Finished.Priority,
@@ -361,8 +464,11 @@ func (n *FormatedNotifier) NotifyConfigReloaded(ctx context.Context) error {
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind: EventConfigReloaded,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.ConfigReloaded.Priority,
@@ -406,8 +512,12 @@ func (n *FormatedNotifier) NotifyIdle(
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind:      EventIdle,
+			ChannelID: channelID,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.Idle.Priority,
@@ -443,8 +553,11 @@ func (n *FormatedNotifier) NotifyLoginFailed(ctx context.Context, capture error)
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind: EventLoginFailed,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.LoginFailed.Priority,
@@ -480,8 +593,11 @@ func (n *FormatedNotifier) NotifyPanicked(ctx context.Context, capture any) erro
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind: EventPanicked,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.Panicked.Priority,
@@ -530,8 +646,13 @@ func (n *FormatedNotifier) NotifyPreparingFiles(
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind:      EventPreparingFiles,
+			ChannelID: channelID,
+			MetaData:  metadata,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.PreparingFiles.Priority,
@@ -580,8 +701,13 @@ func (n *FormatedNotifier) NotifyPostProcessing(
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind:      EventPostProcessing,
+			ChannelID: channelID,
+			MetaData:  metadata,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.PostProcessing.Priority,
@@ -626,8 +752,12 @@ func (n *FormatedNotifier) NotifyCanceled(
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind:      EventCanceled,
+			ChannelID: channelID,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.Canceled.Priority,
@@ -666,8 +796,11 @@ func (n *FormatedNotifier) NotifyUpdateAvailable(
 	); err != nil {
 		return err
 	}
-	return n.Notify(
+	return n.notify(
 		ctx,
+		Event{
+			Kind: EventUpdateAvailable,
+		},
 		titleSB.String(),
 		messageSB.String(),
 		n.NotificationFormats.UpdateAvailable.Priority,
@@ -0,0 +1,229 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultTelegramAPIURL is the base URL of the Telegram Bot API.
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+// TelegramParseModeMarkdownV2 is the MarkdownV2 parse mode of the Telegram Bot API.
+const TelegramParseModeMarkdownV2 = "MarkdownV2"
+
+// TelegramOptions is the options for the Telegram notifier.
+type TelegramOptions struct {
+	apiURL     string
+	markdownV2 bool
+	client     *http.Client
+}
+
+// TelegramOption is the option for the Telegram notifier.
+type TelegramOption func(*TelegramOptions)
+
+// WithTelegramAPIURL sets the base URL of the Telegram Bot API.
+func WithTelegramAPIURL(apiURL string) TelegramOption {
+	return func(o *TelegramOptions) {
+		o.apiURL = strings.TrimSuffix(apiURL, "/")
+	}
+}
+
+// WithTelegramMarkdownV2 sends the messages with parse_mode=MarkdownV2.
+//
+// The title is shown in bold. The title and the message are escaped.
+func WithTelegramMarkdownV2(enabled bool) TelegramOption {
+	return func(o *TelegramOptions) {
+		o.markdownV2 = enabled
+	}
+}
+
+// WithTelegramHTTPClient sets the HTTP client used to call the Bot API.
+func WithTelegramHTTPClient(client *http.Client) TelegramOption {
+	return func(o *TelegramOptions) {
+		o.client = client
+	}
+}
+
+func applyTelegramOptions(opts []TelegramOption) *TelegramOptions {
+	o := &TelegramOptions{
+		apiURL: DefaultTelegramAPIURL,
+		client: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// TelegramNotifier is the notifier for Telegram bots.
+//
+// Notifications are sent with sendMessage. If the metadata of the event
+// exposes a written thumbnail, it is uploaded with sendPhoto instead.
+type TelegramNotifier struct {
+	botToken string
+	chatID   string
+	opts     *TelegramOptions
+}
+
+// NewTelegramNotifier creates a new Telegram notifier.
+func NewTelegramNotifier(botToken string, chatID string, opts ...TelegramOption) *TelegramNotifier {
+	return &TelegramNotifier{
+		botToken: botToken,
+		chatID:   chatID,
+		opts:     applyTelegramOptions(opts),
+	}
+}
+
+// TelegramSendMessagePayload is the body of a sendMessage call.
+type TelegramSendMessagePayload struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+// Notify sends a notification to the Telegram chat.
+func (n *TelegramNotifier) Notify(
+	ctx context.Context,
+	title string,
+	message string,
+	priority int,
+) error {
+	return n.NotifyEvent(ctx, Event{}, title, message, priority)
+}
+
+// NotifyEvent sends a notification to the Telegram chat.
+//
+// The written thumbnail of the event is sent as a photo, with the
+// notification as caption.
+func (n *TelegramNotifier) NotifyEvent(
+	ctx context.Context,
+	event Event,
+	title string,
+	message string,
+	_ int,
+) error {
+	text := n.text(title, message)
+	if t, ok := event.MetaData.(ThumbnailFiler); ok && t.ThumbnailPath() != "" {
+		if _, err := os.Stat(t.ThumbnailPath()); err == nil {
+			return n.sendPhoto(ctx, t.ThumbnailPath(), text)
+		}
+	}
+	return n.sendMessage(ctx, text)
+}
+
+func (n *TelegramNotifier) text(title, message string) string {
+	title = fmt.Sprintf("withny-dl: %s", title)
+	if n.opts.markdownV2 {
+		title = "*" + escapeTelegramMarkdownV2(title) + "*"
+		message = escapeTelegramMarkdownV2(message)
+	}
+	if message == "" {
+		return title
+	}
+	return title + "\n" + message
+}
+
+func (n *TelegramNotifier) parseMode() string {
+	if n.opts.markdownV2 {
+		return TelegramParseModeMarkdownV2
+	}
+	return ""
+}
+
+func (n *TelegramNotifier) sendMessage(ctx context.Context, text string) error {
+	body, err := json.Marshal(TelegramSendMessagePayload{
+		ChatID:    n.chatID,
+		Text:      text,
+		ParseMode: n.parseMode(),
+	})
+	if err != nil {
+		return err
+	}
+	return n.call(ctx, "sendMessage", "application/json", bytes.NewReader(body))
+}
+
+func (n *TelegramNotifier) sendPhoto(ctx context.Context, photo string, caption string) error {
+	f, err := os.Open(photo)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.WriteField("chat_id", n.chatID); err != nil {
+		return err
+	}
+	if err := mw.WriteField("caption", caption); err != nil {
+		return err
+	}
+	if parseMode := n.parseMode(); parseMode != "" {
+		if err := mw.WriteField("parse_mode", parseMode); err != nil {
+			return err
+		}
+	}
+	part, err := mw.CreateFormFile("photo", filepath.Base(photo))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+	return n.call(ctx, "sendPhoto", mw.FormDataContentType(), &body)
+}
+
+func (n *TelegramNotifier) call(
+	ctx context.Context,
+	method string,
+	contentType string,
+	body io.Reader,
+) error {
+	u := fmt.Sprintf("%s/bot%s/%s", n.opts.apiURL, n.botToken, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := n.opts.client.Do(req)
+	if err != nil {
+		// The URL contains the bot token.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = fmt.Sprintf("%s/bot<redacted>/%s", n.opts.apiURL, method)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("telegram %s failed: %s, body: %s", method, resp.Status, b)
+	}
+	return nil
+}
+
+// telegramMarkdownV2Replacer escapes the reserved characters of MarkdownV2.
+var telegramMarkdownV2Replacer = func() *strings.Replacer {
+	const reserved = "\\_*[]()~`>#+-=|{}.!"
+	oldnew := make([]string, 0, 2*len(reserved))
+	for _, c := range reserved {
+		oldnew = append(oldnew, string(c), "\\"+string(c))
+	}
+	return strings.NewReplacer(oldnew...)
+}()
+
+func escapeTelegramMarkdownV2(s string) string {
+	return telegramMarkdownV2Replacer.Replace(s)
+}
@@ -0,0 +1,136 @@
+package notify_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/notify"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelegramNotifierSendMessage(t *testing.T) {
+	// Arrange
+	paths := make(chan string, 1)
+	payloads := make(chan notify.TelegramSendMessagePayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload notify.TelegramSendMessagePayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		paths <- r.URL.Path
+		payloads <- payload
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+	n := notify.NewTelegramNotifier(
+		"123:token",
+		"-10042",
+		notify.WithTelegramAPIURL(server.URL),
+		notify.WithTelegramMarkdownV2(true),
+	)
+
+	// Act
+	err := n.NotifyEvent(
+		context.Background(),
+		notify.Event{Kind: notify.EventDownloading, ChannelID: "my_channel"},
+		"my_channel is streaming",
+		"Stream: hello (world).",
+		7,
+	)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, "/bot123:token/sendMessage", <-paths)
+	require.Equal(t, notify.TelegramSendMessagePayload{
+		ChatID:    "-10042",
+		Text:      "*withny\\-dl: my\\_channel is streaming*\nStream: hello \\(world\\)\\.",
+		ParseMode: "MarkdownV2",
+	}, <-payloads)
+}
+
+func TestTelegramNotifierSendPhoto(t *testing.T) {
+	// Arrange
+	thumbnail := filepath.Join(t.TempDir(), "thumb.avif")
+	require.NoError(t, os.WriteFile(thumbnail, []byte("image"), 0o644))
+	type request struct {
+		path      string
+		chatID    string
+		caption   string
+		parseMode string
+		filename  string
+		photo     string
+	}
+	requests := make(chan request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, header, err := r.FormFile("photo")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		photo, _ := io.ReadAll(f)
+		requests <- request{
+			path:      r.URL.Path,
+			chatID:    r.FormValue("chat_id"),
+			caption:   r.FormValue("caption"),
+			parseMode: r.FormValue("parse_mode"),
+			filename:  header.Filename,
+			photo:     string(photo),
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+	n := notify.NewTelegramNotifier("123:token", "42", notify.WithTelegramAPIURL(server.URL))
+
+	// Act
+	err := n.NotifyEvent(
+		context.Background(),
+		notify.Event{
+			Kind:      notify.EventDownloading,
+			ChannelID: "channel",
+			MetaData:  api.MetaData{ThumbnailFile: thumbnail},
+		},
+		"channel is streaming",
+		"",
+		7,
+	)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, request{
+		path:     "/bot123:token/sendPhoto",
+		chatID:   "42",
+		caption:  "withny-dl: channel is streaming",
+		filename: "thumb.avif",
+		photo:    "image",
+	}, <-requests)
+}
+
+func TestTelegramNotifierError(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"ok":false,"description":"Unauthorized"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	n := notify.NewTelegramNotifier("123:token", "42", notify.WithTelegramAPIURL(server.URL))
+
+	// Act
+	err := n.Notify(context.Background(), "error", "boom", 10)
+
+	// Assert
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401")
+	require.Contains(t, err.Error(), "Unauthorized")
+}
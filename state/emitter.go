@@ -0,0 +1,68 @@
+package state
+
+import (
+	"sync"
+	"time"
+)
+
+// stateEventBufferSize is the number of events buffered per subscriber.
+const stateEventBufferSize = 16
+
+// StateEvent is a change of the state of a channel.
+type StateEvent struct {
+	Channel   string            `json:"channel"`
+	State     DownloadState     `json:"state"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// StateEmitter broadcasts the state events to its subscribers.
+type StateEmitter struct {
+	subscribers map[<-chan StateEvent]chan StateEvent
+
+	mu sync.Mutex
+}
+
+// NewStateEmitter creates a new StateEmitter.
+func NewStateEmitter() *StateEmitter {
+	return &StateEmitter{
+		subscribers: make(map[<-chan StateEvent]chan StateEvent),
+	}
+}
+
+// Subscribe returns a channel receiving the published events.
+//
+// The channel must be released with Unsubscribe.
+func (e *StateEmitter) Subscribe() <-chan StateEvent {
+	ch := make(chan StateEvent, stateEventBufferSize)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subscribers[ch] = ch
+	return ch
+}
+
+// Unsubscribe stops sending events to the channel and closes it.
+func (e *StateEmitter) Unsubscribe(sub <-chan StateEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ch, ok := e.subscribers[sub]; ok {
+		delete(e.subscribers, sub)
+		close(ch)
+	}
+}
+
+// Publish sends the event to every subscriber.
+//
+// Publish never blocks: the event is dropped for the subscribers which are
+// too slow to consume their events.
+func (e *StateEmitter) Publish(event StateEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, ch := range e.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package state
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	// Register the pure Go sqlite driver.
+	_ "modernc.org/sqlite"
+)
+
+const createChannelStatesTable = `CREATE TABLE IF NOT EXISTS channel_states (
+	channel_id TEXT PRIMARY KEY,
+	state TEXT NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	extra_json TEXT
+)`
+
+// SQLiteStateStore persists the channel states in a SQLite database.
+type SQLiteStateStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStateStore opens the SQLite database at path, creating it if needed.
+func NewSQLiteStateStore(path string) (*SQLiteStateStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite does not support concurrent writers.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(createChannelStatesTable); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLiteStateStore{db: db}, nil
+}
+
+// Save stores the state of the channel, replacing the previous one.
+func (s *SQLiteStateStore) Save(name string, cs ChannelState, updatedAt time.Time) error {
+	var extra []byte
+	if cs.Extra != nil {
+		var err error
+		if extra, err = json.Marshal(cs.Extra); err != nil {
+			return err
+		}
+	}
+	_, err := s.db.Exec(
+		`INSERT OR REPLACE INTO channel_states(channel_id, state, updated_at, extra_json) VALUES (?, ?, ?, ?)`,
+		name,
+		cs.DownloadState.String(),
+		updatedAt.UTC(),
+		string(extra),
+	)
+	return err
+}
+
+// Load returns the last stored state of each channel.
+func (s *SQLiteStateStore) Load() (map[string]*ChannelState, error) {
+	rows, err := s.db.Query(`SELECT channel_id, state, extra_json FROM channel_states`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	channels := make(map[string]*ChannelState)
+	for rows.Next() {
+		var name, state string
+		var extra sql.NullString
+		if err := rows.Scan(&name, &state, &extra); err != nil {
+			return nil, err
+		}
+		cs := &ChannelState{
+			DownloadState: DownloadStateFromString(state),
+			Errors:        make([]DownloadError, 0),
+		}
+		if extra.String != "" {
+			if err := json.Unmarshal([]byte(extra.String), &cs.Extra); err != nil {
+				return nil, err
+			}
+		}
+		channels[name] = cs
+	}
+	return channels, rows.Err()
+}
+
+// Close closes the database.
+func (s *SQLiteStateStore) Close() error {
+	return s.db.Close()
+}
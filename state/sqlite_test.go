@@ -0,0 +1,97 @@
+package state_test
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/state"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStateStore(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "state.db")
+	store, err := state.NewSQLiteStateStore(path)
+	require.NoError(t, err)
+	s := &state.State{Channels: make(map[string]*state.ChannelState)}
+	require.NoError(t, s.UseStore(store))
+
+	// Act
+	s.SetChannelState("channel", state.DownloadStateDownloading)
+	s.SetChannelState(
+		"channel",
+		state.DownloadStateFinished,
+		state.WithExtra(map[string]interface{}{"title": "stream"}),
+	)
+	s.SetChannelState("other", state.DownloadStateIdle)
+	require.NoError(t, store.Close())
+
+	// Simulate a restart.
+	store, err = state.NewSQLiteStateStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	restarted := &state.State{Channels: make(map[string]*state.ChannelState)}
+	err = restarted.UseStore(store)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, state.DownloadStateFinished, restarted.GetChannelState("channel"))
+	require.Equal(t, "stream", restarted.Channels["channel"].Extra["title"])
+	require.Equal(t, state.DownloadStateIdle, restarted.GetChannelState("other"))
+}
+
+func TestSQLiteStateStoreEmpty(t *testing.T) {
+	// Arrange
+	store, err := state.NewSQLiteStateStore(filepath.Join(t.TempDir(), "state.db"))
+	require.NoError(t, err)
+	defer store.Close()
+	s := &state.State{Channels: make(map[string]*state.ChannelState)}
+
+	// Act
+	err = s.UseStore(store)
+
+	// Assert
+	require.NoError(t, err)
+	require.Empty(t, s.Channels)
+}
+
+func TestSQLiteStateStoreConcurrentUpdates(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "state.db")
+	store, err := state.NewSQLiteStateStore(path)
+	require.NoError(t, err)
+	s := &state.State{Channels: make(map[string]*state.ChannelState)}
+	require.NoError(t, s.UseStore(store))
+	states := []state.DownloadState{
+		state.DownloadStateIdle,
+		state.DownloadStateDownloading,
+		state.DownloadStatePostProcessing,
+		state.DownloadStateFinished,
+	}
+
+	// Act
+	var wg sync.WaitGroup
+	for i := range 40 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.SetChannelState("channel", states[i%len(states)])
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, store.Close())
+
+	// Assert
+	store, err = state.NewSQLiteStateStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+	restarted := &state.State{Channels: make(map[string]*state.ChannelState)}
+	require.NoError(t, restarted.UseStore(store))
+	require.Equal(
+		t,
+		s.GetChannelState("channel"),
+		restarted.GetChannelState("channel"),
+		"the store must end with the last in-memory state",
+	)
+}
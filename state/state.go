@@ -6,13 +6,30 @@ import (
 	"encoding/json"
 	"sync"
 	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 // State represents the state of the program.
 type State struct {
 	Channels map[string]*ChannelState `json:"channels"`
+	// Emitter, if not nil, receives an event on each state change.
+	Emitter *StateEmitter `json:"-"`
 
 	mu sync.RWMutex
+	// store, if not nil, persists each state change.
+	store Store
+	// cancels are the cancel functions of the ongoing downloads, indexed by channel.
+	cancels  map[string]map[uint64]context.CancelFunc
+	cancelID uint64
+}
+
+// Store persists the channel states across restarts.
+type Store interface {
+	// Save stores the state of the channel, replacing the previous one.
+	Save(name string, cs ChannelState, updatedAt time.Time) error
+	// Load returns the last stored state of each channel.
+	Load() (map[string]*ChannelState, error)
 }
 
 // ChannelState represents the state of a channel.
@@ -111,6 +128,7 @@ var (
 	// DefaultState is the default state.
 	DefaultState = State{
 		Channels: make(map[string]*ChannelState),
+		Emitter:  NewStateEmitter(),
 	}
 )
 
@@ -157,7 +175,6 @@ func (s *State) SetChannelState(
 		opt(o)
 	}
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	if _, ok := s.Channels[name]; !ok {
 		s.Channels[name] = &ChannelState{
 			Errors: make([]DownloadError, 0),
@@ -167,6 +184,42 @@ func (s *State) SetChannelState(
 	s.Channels[name].Extra = o.extra
 	s.Channels[name].Labels = o.labels
 	setStateMetrics(context.Background(), name, state, o.labels)
+	now := time.Now().UTC()
+	// Saved under the lock, so that the store receives the changes in order.
+	if s.store != nil {
+		if err := s.store.Save(name, *s.Channels[name], now); err != nil {
+			log.Err(err).Str("channelID", name).Msg("failed to persist channel state")
+		}
+	}
+	s.mu.Unlock()
+
+	s.publish(StateEvent{
+		Channel:   name,
+		State:     state,
+		Labels:    o.labels,
+		Timestamp: now,
+	})
+}
+
+// UseStore loads the channel states from the store, and persists each state
+// change in it.
+//
+// The in-memory state stays the source of truth, the store is only written
+// through.
+func (s *State) UseStore(store Store) error {
+	channels, err := store.Load()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, cs := range channels {
+		if _, ok := s.Channels[name]; !ok {
+			s.Channels[name] = cs
+		}
+	}
+	s.store = store
+	return nil
 }
 
 // SetChannelError sets an error for a channel.
@@ -175,8 +228,8 @@ func (s *State) SetChannelError(name string, err error) {
 		return
 	}
 
+	now := time.Now().UTC()
 	s.mu.Lock()
-	defer s.mu.Unlock()
 	if _, ok := s.Channels[name]; !ok {
 		s.Channels[name] = &ChannelState{
 			Errors: make([]DownloadError, 0),
@@ -184,9 +237,69 @@ func (s *State) SetChannelError(name string, err error) {
 	}
 
 	s.Channels[name].Errors = append(s.Channels[name].Errors, DownloadError{
-		Timestamp: time.Now().UTC().String(),
+		Timestamp: now.String(),
 		Error:     err.Error(),
 	})
+	event := StateEvent{
+		Channel:   name,
+		State:     s.Channels[name].DownloadState,
+		Labels:    s.Channels[name].Labels,
+		Error:     err.Error(),
+		Timestamp: now,
+	}
+	s.mu.Unlock()
+
+	s.publish(event)
+}
+
+// publish sends the event to the emitter, if any.
+func (s *State) publish(event StateEvent) {
+	if s.Emitter != nil {
+		s.Emitter.Publish(event)
+	}
+}
+
+// RegisterCancelFunc registers the cancel function of a download of the channel.
+//
+// The returned function unregisters it and must be called when the download ends.
+func (s *State) RegisterCancelFunc(name string, cancel context.CancelFunc) (unregister func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancels == nil {
+		s.cancels = make(map[string]map[uint64]context.CancelFunc)
+	}
+	if s.cancels[name] == nil {
+		s.cancels[name] = make(map[uint64]context.CancelFunc)
+	}
+	s.cancelID++
+	id := s.cancelID
+	s.cancels[name][id] = cancel
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.cancels[name], id)
+		if len(s.cancels[name]) == 0 {
+			delete(s.cancels, name)
+		}
+	}
+}
+
+// CancelChannel cancels the ongoing downloads of the channel.
+//
+// It returns false if the channel has no ongoing download.
+func (s *State) CancelChannel(name string) bool {
+	s.mu.RLock()
+	cancels := make([]context.CancelFunc, 0, len(s.cancels[name]))
+	for _, cancel := range s.cancels[name] {
+		cancels = append(cancels, cancel)
+	}
+	s.mu.RUnlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+	return len(cancels) > 0
 }
 
 // ReadState returns the current state.
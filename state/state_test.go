@@ -1,6 +1,7 @@
 package state_test
 
 import (
+	"context"
 	"errors"
 	"testing"
 
@@ -44,3 +45,53 @@ func TestSetChannelError(t *testing.T) {
 	require.Equal(t, "error1", state.ReadState().Channels["test"].Errors[0].Error)
 	require.Equal(t, "error2", state.ReadState().Channels["test"].Errors[1].Error)
 }
+
+func TestCancelChannel(t *testing.T) {
+	// Arrange
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+	}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	unregister1 := s.RegisterCancelFunc("test", cancel1)
+	_ = s.RegisterCancelFunc("test", cancel2)
+	unregister1()
+
+	// Act
+	cancelled := s.CancelChannel("test")
+
+	// Assert
+	require.True(t, cancelled)
+	require.NoError(t, ctx1.Err())
+	require.ErrorIs(t, ctx2.Err(), context.Canceled)
+	require.False(t, s.CancelChannel("other"))
+}
+
+func TestStateEmitter(t *testing.T) {
+	// Arrange
+	emitter := state.NewStateEmitter()
+	s := &state.State{
+		Channels: make(map[string]*state.ChannelState),
+		Emitter:  emitter,
+	}
+	events := emitter.Subscribe()
+
+	// Act
+	s.SetChannelState("test", state.DownloadStateDownloading)
+	s.SetChannelError("test", errors.New("error1"))
+	emitter.Unsubscribe(events)
+	s.SetChannelState("test", state.DownloadStateFinished)
+
+	// Assert
+	event := <-events
+	require.Equal(t, "test", event.Channel)
+	require.Equal(t, state.DownloadStateDownloading, event.State)
+	require.Empty(t, event.Error)
+	event = <-events
+	require.Equal(t, state.DownloadStateDownloading, event.State)
+	require.Equal(t, "error1", event.Error)
+	_, ok := <-events
+	require.False(t, ok)
+}
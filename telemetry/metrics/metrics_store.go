@@ -10,6 +10,36 @@ import (
 
 const meterName = "github.com/Darkness4/withny-dl"
 
+// Names maps the metrics to their OpenTelemetry instrument names.
+//
+// The Prometheus exporter replaces the dots with underscores and appends the
+// unit and the "_total" suffixes when needed.
+var Names = map[string]string{
+	"DownloadsInitTime":            "downloads.init.time",
+	"DownloadsCompletionTime":      "downloads.time_to_complete",
+	"DownloadsTimeToFirstFragment": "downloads.time_to_first_fragment",
+	"DownloadsErrors":              "downloads.errors",
+	"DownloadsRuns":                "downloads.runs",
+	"DownloadsInsufficientDisk":    "downloads.insufficient_disk",
+	"DownloadsBytes":               "downloads.bytes",
+	"DownloadsDiscontinuities":     "downloads.discontinuities",
+	"ConcatCompletionTime":         "concat.completion.time",
+	"ConcatErrors":                 "concat.errors",
+	"ConcatRuns":                   "concat.runs",
+	"PostProcessingCompletionTime": "post_processing.completion.time",
+	"PostProcessingErrors":         "post_processing.errors",
+	"PostProcessingRuns":           "post_processing.runs",
+	"WatcherState":                 "watcher.state",
+	"WatcherConsecutiveFailures":   "watcher.consecutive_failures",
+	"CleanerFilesRemoved":          "cleaner.files_removed",
+	"CleanerErrors":                "cleaner.errors",
+	"CleanerRuns":                  "cleaner.runs",
+	"CleanerCleanTime":             "cleaner.clean.time",
+	"AuthLoginFailures":            "auth.login_failures",
+	"DiskAvailable":                "disk.available",
+	"VersionUpdateAvailable":       "version.update_available",
+}
+
 var (
 	// Downloads metrics
 	Downloads struct {
@@ -17,10 +47,19 @@ var (
 		InitTime metric.Float64Histogram
 		// CompletionTime is the time taken to complete a download.
 		CompletionTime metric.Float64Histogram
+		// TimeToFirstFragment is the time taken from the probe of the stream to
+		// the first written fragment.
+		TimeToFirstFragment metric.Float64Histogram
 		// Errors is the number of errors during downloads.
 		Errors metric.Int64Counter
 		// Runs is the number of downloads.
 		Runs metric.Int64Counter
+		// InsufficientDisk is the number of downloads aborted because of a lack of disk space.
+		InsufficientDisk metric.Int64Counter
+		// Bytes is the number of bytes written by the downloads.
+		Bytes metric.Int64Counter
+		// Discontinuities is the number of EXT-X-DISCONTINUITY fragments received.
+		Discontinuities metric.Int64Counter
 	}
 
 	// Concat metrics
@@ -47,6 +86,8 @@ var (
 	Watcher struct {
 		// State is the current state of the watcher.
 		State metric.Int64Gauge
+		// ConsecutiveFailures is the number of failed polls since the last successful poll.
+		ConsecutiveFailures metric.Int64UpDownCounter
 	}
 
 	// Cleaner metrics
@@ -60,6 +101,24 @@ var (
 		// CleanTime is the time taken to clean.
 		CleanTime metric.Float64Histogram
 	}
+
+	// Auth metrics
+	Auth struct {
+		// LoginFailures is the number of failed logins and token refreshes.
+		LoginFailures metric.Int64Counter
+	}
+
+	// Disk metrics
+	Disk struct {
+		// Available is the number of bytes available on the output filesystem.
+		Available metric.Int64Gauge
+	}
+
+	// Version metrics
+	Version struct {
+		// UpdateAvailable is 1 when a new version is available, 0 otherwise.
+		UpdateAvailable metric.Int64Gauge
+	}
 )
 
 func init() {
@@ -68,7 +127,7 @@ func init() {
 
 	var err error
 	Downloads.InitTime, err = meter.Float64Histogram(
-		"downloads.init.time",
+		Names["DownloadsInitTime"],
 		metric.WithDescription("Time taken to initiate a download"),
 		metric.WithUnit("s"),
 	)
@@ -76,15 +135,23 @@ func init() {
 		panic(err)
 	}
 	Downloads.CompletionTime, err = meter.Float64Histogram(
-		"downloads.time_to_complete",
+		Names["DownloadsCompletionTime"],
 		metric.WithDescription("Time taken to complete a download"),
 		metric.WithUnit("s"),
 	)
 	if err != nil {
 		panic(err)
 	}
+	Downloads.TimeToFirstFragment, err = meter.Float64Histogram(
+		Names["DownloadsTimeToFirstFragment"],
+		metric.WithDescription("Time taken from the probe of the stream to the first written fragment"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		panic(err)
+	}
 	Downloads.Errors, err = meter.Int64Counter(
-		"downloads.errors",
+		Names["DownloadsErrors"],
 		metric.WithDescription("Number of errors during downloads"),
 	)
 	if err != nil {
@@ -92,17 +159,42 @@ func init() {
 	}
 	Downloads.Errors.Add(context.Background(), 0)
 	Downloads.Runs, err = meter.Int64Counter(
-		"downloads.runs",
+		Names["DownloadsRuns"],
 		metric.WithDescription("Number of downloads"),
 	)
 	if err != nil {
 		panic(err)
 	}
 	Downloads.Runs.Add(context.Background(), 0)
+	Downloads.InsufficientDisk, err = meter.Int64Counter(
+		Names["DownloadsInsufficientDisk"],
+		metric.WithDescription("Number of downloads aborted because of a lack of disk space"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	Downloads.InsufficientDisk.Add(context.Background(), 0)
+	Downloads.Bytes, err = meter.Int64Counter(
+		Names["DownloadsBytes"],
+		metric.WithDescription("Number of bytes written by the downloads"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	Downloads.Bytes.Add(context.Background(), 0)
+	Downloads.Discontinuities, err = meter.Int64Counter(
+		Names["DownloadsDiscontinuities"],
+		metric.WithDescription("Number of EXT-X-DISCONTINUITY fragments received"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	Downloads.Discontinuities.Add(context.Background(), 0)
 
 	// Concat
 	Concat.CompletionTime, err = meter.Float64Histogram(
-		"concat.completion.time",
+		Names["ConcatCompletionTime"],
 		metric.WithDescription("Time taken to complete a concat"),
 		metric.WithUnit("s"),
 	)
@@ -110,7 +202,7 @@ func init() {
 		panic(err)
 	}
 	Concat.Errors, err = meter.Int64Counter(
-		"concat.errors",
+		Names["ConcatErrors"],
 		metric.WithDescription("Accumulated failed runs of concats"),
 	)
 	if err != nil {
@@ -118,7 +210,7 @@ func init() {
 	}
 	Concat.Errors.Add(context.Background(), 0)
 	Concat.Runs, err = meter.Int64Counter(
-		"concat.runs",
+		Names["ConcatRuns"],
 		metric.WithDescription("Number of concats"),
 	)
 	if err != nil {
@@ -128,7 +220,7 @@ func init() {
 
 	// PostProcessing
 	PostProcessing.CompletionTime, err = meter.Float64Histogram(
-		"post_processing.completion.time",
+		Names["PostProcessingCompletionTime"],
 		metric.WithDescription("Time taken to complete a post process"),
 		metric.WithUnit("s"),
 	)
@@ -136,7 +228,7 @@ func init() {
 		panic(err)
 	}
 	PostProcessing.Errors, err = meter.Int64Counter(
-		"post_processing.errors",
+		Names["PostProcessingErrors"],
 		metric.WithDescription("Accumulated failed runs of post processes"),
 	)
 	if err != nil {
@@ -144,7 +236,7 @@ func init() {
 	}
 	PostProcessing.Errors.Add(context.Background(), 0)
 	PostProcessing.Runs, err = meter.Int64Counter(
-		"post_processing.runs",
+		Names["PostProcessingRuns"],
 		metric.WithDescription("Number of post processes"),
 	)
 	if err != nil {
@@ -154,16 +246,24 @@ func init() {
 
 	// States
 	Watcher.State, err = meter.Int64Gauge(
-		"watcher.state",
+		Names["WatcherState"],
 		metric.WithDescription("Current state of the watcher"),
 	)
 	if err != nil {
 		panic(err)
 	}
+	Watcher.ConsecutiveFailures, err = meter.Int64UpDownCounter(
+		Names["WatcherConsecutiveFailures"],
+		metric.WithDescription("Number of failed polls since the last successful poll, which back off the poll interval"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	Watcher.ConsecutiveFailures.Add(context.Background(), 0)
 
 	// Cleaner
 	Cleaner.FilesRemoved, err = meter.Int64Counter(
-		"cleaner.files_removed",
+		Names["CleanerFilesRemoved"],
 		metric.WithDescription("Number of files removed"),
 	)
 	if err != nil {
@@ -171,7 +271,7 @@ func init() {
 	}
 	Cleaner.FilesRemoved.Add(context.Background(), 0)
 	Cleaner.Errors, err = meter.Int64Counter(
-		"cleaner.errors",
+		Names["CleanerErrors"],
 		metric.WithDescription("Number of errors during cleaning"),
 	)
 	if err != nil {
@@ -179,7 +279,7 @@ func init() {
 	}
 	Cleaner.Errors.Add(context.Background(), 0)
 	Cleaner.Runs, err = meter.Int64Counter(
-		"cleaner.runs",
+		Names["CleanerRuns"],
 		metric.WithDescription("Number of cleaning runs"),
 	)
 	if err != nil {
@@ -187,11 +287,41 @@ func init() {
 	}
 	Cleaner.Runs.Add(context.Background(), 0)
 	Cleaner.CleanTime, err = meter.Float64Histogram(
-		"cleaner.clean.time",
+		Names["CleanerCleanTime"],
 		metric.WithDescription("Time taken to clean"),
 		metric.WithUnit("ms"),
 	)
 	if err != nil {
 		panic(err)
 	}
+
+	// Auth
+	Auth.LoginFailures, err = meter.Int64Counter(
+		Names["AuthLoginFailures"],
+		metric.WithDescription("Number of failed logins and token refreshes"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	Auth.LoginFailures.Add(context.Background(), 0)
+
+	// Disk
+	Disk.Available, err = meter.Int64Gauge(
+		Names["DiskAvailable"],
+		metric.WithDescription("Number of bytes available on the output filesystem"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	// Version
+	Version.UpdateAvailable, err = meter.Int64Gauge(
+		Names["VersionUpdateAvailable"],
+		metric.WithDescription("Whether a new version is available"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	Version.UpdateAvailable.Record(context.Background(), 0)
 }
@@ -0,0 +1,51 @@
+package secret
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// DefaultLockTimeout is the default duration to wait for the lock of the
+// credentials file.
+const DefaultLockTimeout = 5 * time.Second
+
+// lockPollInterval is the interval between two attempts to acquire a lock.
+const lockPollInterval = 10 * time.Millisecond
+
+// ErrLockTimeout is returned when the lock of the credentials file cannot be
+// acquired in time.
+var ErrLockTimeout = errors.New("timed out waiting for the file lock")
+
+// lockFile acquires an advisory lock on the lock file associated to path.
+//
+// The lock is shared unless exclusive is set. The lock file is kept next to
+// path, as the credentials file itself is replaced on write. It is never
+// removed, so that every process locks the same inode.
+func lockFile(path string, exclusive bool, timeout time.Duration) (unlock func() error, err error) {
+	file, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := tryLockFile(file, exclusive)
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			_ = file.Close()
+			return nil, ErrLockTimeout
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	return func() error {
+		return errors.Join(unlockFile(file), file.Close())
+	}, nil
+}
@@ -0,0 +1,66 @@
+package secret_test
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/utils/secret"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCacheConcurrentWriters(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	const writes = 50
+	written := make(map[string]bool)
+	for w := range 2 {
+		for i := range writes {
+			written[fmt.Sprintf("token-%d-%d", w, i)] = true
+		}
+	}
+
+	// Act
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*writes)
+	for w := range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each writer has its own cache, like two processes.
+			cache := secret.NewFileCache(path)
+			cache.Secret = "secret"
+			for i := range writes {
+				token := fmt.Sprintf("token-%d-%d", w, i)
+				if err := cache.Set(api.Credentials{
+					LoginResponse: api.LoginResponse{Token: token, RefreshToken: token},
+				}); err != nil {
+					errs <- err
+				}
+				creds, err := cache.Get()
+				if err != nil {
+					errs <- err
+					continue
+				}
+				if !written[creds.Token] || creds.Token != creds.RefreshToken {
+					errs <- errors.New("corrupted credentials: " + creds.Token)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	// Assert
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	cache := secret.NewFileCache(path)
+	cache.Secret = "secret"
+	creds, err := cache.Get()
+	require.NoError(t, err)
+	require.True(t, written[creds.Token])
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package secret
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockedBytes is the number of bytes locked, the whole file.
+const lockedBytes = ^uint32(0)
+
+func tryLockFile(file *os.File, exclusive bool) (bool, error) {
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if exclusive {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	err := windows.LockFileEx(
+		windows.Handle(file.Fd()),
+		flags,
+		0,
+		lockedBytes,
+		lockedBytes,
+		new(windows.Overlapped),
+	)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockFile(file *os.File) error {
+	return windows.UnlockFileEx(
+		windows.Handle(file.Fd()),
+		0,
+		lockedBytes,
+		lockedBytes,
+		new(windows.Overlapped),
+	)
+}
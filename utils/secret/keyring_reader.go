@@ -0,0 +1,80 @@
+package secret
+
+import (
+	"errors"
+
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/zalando/go-keyring"
+)
+
+// KeyringService is the service name of the credentials in the OS keyring.
+const KeyringService = "withny-dl"
+
+// Keyring account keys of the credentials.
+const (
+	KeyringUsername     = "username"
+	KeyringPassword     = "password"
+	KeyringToken        = "token"
+	KeyringRefreshToken = "refreshToken"
+)
+
+var _ api.CredentialsReader = (*KeyringReader)(nil)
+
+// KeyringReader is a secret reader from the OS keyring.
+type KeyringReader struct {
+	Service string
+}
+
+// NewKeyringReader creates a new secret reader from the OS keyring.
+func NewKeyringReader() *KeyringReader {
+	return &KeyringReader{
+		Service: KeyringService,
+	}
+}
+
+// Read reads the credentials from the keyring.
+//
+// Missing keys are left empty.
+func (s *KeyringReader) Read() (api.SavedCredentials, error) {
+	var creds api.SavedCredentials
+	for key, dst := range map[string]*string{
+		KeyringUsername:     &creds.Username,
+		KeyringPassword:     &creds.Password,
+		KeyringToken:        &creds.Token,
+		KeyringRefreshToken: &creds.RefreshToken,
+	} {
+		value, err := keyring.Get(s.Service, key)
+		if errors.Is(err, keyring.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return api.SavedCredentials{}, err
+		}
+		*dst = value
+	}
+	return creds, nil
+}
+
+// Write stores the credentials in the keyring.
+//
+// Empty fields are deleted from the keyring.
+func (s *KeyringReader) Write(creds api.SavedCredentials) error {
+	for key, value := range map[string]string{
+		KeyringUsername:     creds.Username,
+		KeyringPassword:     creds.Password,
+		KeyringToken:        creds.Token,
+		KeyringRefreshToken: creds.RefreshToken,
+	} {
+		if value == "" {
+			if err := keyring.Delete(s.Service, key); err != nil &&
+				!errors.Is(err, keyring.ErrNotFound) {
+				return err
+			}
+			continue
+		}
+		if err := keyring.Set(s.Service, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package secret_test
+
+import (
+	"testing"
+
+	"github.com/Darkness4/withny-dl/utils/secret"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+)
+
+func TestKeyringReader(t *testing.T) {
+	// Arrange
+	keyring.MockInit()
+	reader := secret.NewKeyringReader()
+	err := reader.Write(api.SavedCredentials{
+		Username: "user",
+		Password: "password",
+		Token:    "token",
+	})
+	require.NoError(t, err)
+
+	// Act
+	creds, err := reader.Read()
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, api.SavedCredentials{
+		Username: "user",
+		Password: "password",
+		Token:    "token",
+	}, creds)
+}
+
+func TestKeyringReaderWriteDeletesEmptyFields(t *testing.T) {
+	// Arrange
+	keyring.MockInit()
+	reader := secret.NewKeyringReader()
+	err := reader.Write(api.SavedCredentials{
+		Username:     "user",
+		Password:     "password",
+		Token:        "token",
+		RefreshToken: "refreshToken",
+	})
+	require.NoError(t, err)
+
+	// Act
+	err = reader.Write(api.SavedCredentials{
+		Username: "user",
+		Token:    "newToken",
+	})
+
+	// Assert
+	require.NoError(t, err)
+	creds, err := reader.Read()
+	require.NoError(t, err)
+	require.Equal(t, api.SavedCredentials{
+		Username: "user",
+		Token:    "newToken",
+	}, creds)
+}
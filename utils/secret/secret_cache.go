@@ -4,10 +4,13 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/Darkness4/withny-dl/withny/api"
 )
@@ -19,6 +22,8 @@ var (
 	hardcodedSecret = []byte(
 		"withny-dl-secret-key-0123456789a",
 	)
+
+	errFileNotExist = errors.New("file does not exist")
 )
 
 // EncryptWriter implements io.Writer interface and writes encrypted data.
@@ -96,6 +101,32 @@ func (dr *DecryptReader) Read(p []byte) (n int, err error) {
 // FileCache is a secret cache that reads from a file.
 type FileCache struct {
 	FilePath string
+	// Secret is the user-defined key used to encrypt the credentials.
+	//
+	// If empty, a hard-coded key is used. Files encrypted with the hard-coded
+	// key are transparently re-encrypted with the Secret when read.
+	Secret string
+	// LockTimeout is the maximum duration to wait for the lock of the file,
+	// which is shared with the other processes. (default: DefaultLockTimeout)
+	LockTimeout time.Duration
+}
+
+// lock acquires the advisory lock of the file.
+func (f *FileCache) lock(exclusive bool) (unlock func() error, err error) {
+	timeout := f.LockTimeout
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	return lockFile(f.FilePath, exclusive, timeout)
+}
+
+// key returns the AES-256 key used to encrypt the credentials.
+func (f *FileCache) key() []byte {
+	if f.Secret == "" {
+		return hardcodedSecret
+	}
+	key := sha256.Sum256([]byte(f.Secret))
+	return key[:]
 }
 
 // NewFileCache creates a new file cache.
@@ -113,19 +144,61 @@ func NewTmpCache() *FileCache {
 }
 
 // Get reads the credentials from a file.
+//
+// If the file cannot be decrypted with the Secret, the hard-coded key is tried
+// and the credentials are re-encrypted with the Secret.
 func (f *FileCache) Get() (api.Credentials, error) {
+	creds, legacy, err := f.get()
+	if err != nil || !legacy {
+		return creds, err
+	}
+	if err := f.Set(creds); err != nil {
+		return creds, err
+	}
+	return creds, nil
+}
+
+// get reads the credentials under a shared lock.
+//
+// legacy is set if the credentials were encrypted with the hard-coded key
+// instead of the Secret.
+func (f *FileCache) get() (creds api.Credentials, legacy bool, err error) {
+	unlock, err := f.lock(false)
+	if err != nil {
+		return creds, false, err
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	creds, err = f.read(f.key())
+	if err == nil || f.Secret == "" || errors.Is(err, errFileNotExist) {
+		return creds, false, err
+	}
+
+	creds, legacyErr := f.read(hardcodedSecret)
+	if legacyErr != nil {
+		return creds, false, err
+	}
+	return creds, true, nil
+}
+
+// read decrypts the credentials file with the given key.
+func (f *FileCache) read(key []byte) (api.Credentials, error) {
 	var creds api.Credentials
 
 	file, err := os.Open(f.FilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return creds, errors.New("file does not exist")
+			return creds, errFileNotExist
 		}
 		return creds, err
 	}
 	defer file.Close()
 
-	decryptReader, err := NewDecryptReader(file, hardcodedSecret)
+	decryptReader, err := NewDecryptReader(file, key)
 	if err != nil {
 		return creds, err
 	}
@@ -138,23 +211,60 @@ func (f *FileCache) Get() (api.Credentials, error) {
 }
 
 // Set writes the credentials to a file.
-func (f *FileCache) Set(creds api.Credentials) error {
-	file, err := os.OpenFile(f.FilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+//
+// The credentials are written to a temporary file which is then renamed, so
+// that the file is never partially written.
+func (f *FileCache) Set(creds api.Credentials) (err error) {
+	unlock, err := f.lock(true)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
+	file, err := os.CreateTemp(filepath.Dir(f.FilePath), filepath.Base(f.FilePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}
+	}()
 
 	// Encrypt the JSON data and write it to the writer
-	encryptWriter, err := NewEncryptWriter(file, hardcodedSecret)
+	encryptWriter, err := NewEncryptWriter(file, f.key())
 	if err != nil {
 		return err
 	}
 
-	return json.NewEncoder(encryptWriter).Encode(creds)
+	if err := json.NewEncoder(encryptWriter).Encode(creds); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), f.FilePath)
 }
 
 // Invalidate removes the credentials file.
-func (f *FileCache) Invalidate() error {
+func (f *FileCache) Invalidate() (err error) {
+	unlock, err := f.lock(true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := unlock(); err == nil {
+			err = unlockErr
+		}
+	}()
+
 	return os.Remove(f.FilePath)
 }
@@ -0,0 +1,141 @@
+package secret_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/utils/secret"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCache(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	cache := secret.NewFileCache(filepath.Join(dir, "credentials.json"))
+	creds := api.Credentials{
+		LoginResponse: api.LoginResponse{
+			Token:        "token",
+			RefreshToken: "refresh",
+		},
+	}
+
+	// Act
+	errSet := cache.Set(creds)
+	got, errGet := cache.Get()
+
+	// Assert
+	require.NoError(t, errSet)
+	require.NoError(t, errGet)
+	require.Equal(t, creds, got)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "the temporary file must be renamed")
+	require.Equal(t, "credentials.json", entries[0].Name())
+	require.Equal(t, "credentials.json.lock", entries[1].Name())
+}
+
+func TestFileCacheInterruptedWrite(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	path := filepath.Join(dir, "credentials.json")
+	cache := secret.NewFileCache(path)
+	creds := api.Credentials{
+		LoginResponse: api.LoginResponse{
+			Token:        "token",
+			RefreshToken: "refresh",
+		},
+	}
+	require.NoError(t, cache.Set(creds))
+	// Simulate a crash in the middle of a write.
+	require.NoError(t, os.WriteFile(path+".123.tmp", nil, 0o600))
+
+	// Act
+	got, err := cache.Get()
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, creds, got)
+}
+
+func TestFileCacheEmptyFile(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+	cache := secret.NewFileCache(path)
+
+	// Act
+	_, err := cache.Get()
+
+	// Assert
+	require.Error(t, err)
+}
+
+func TestFileCacheSecret(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	cache := secret.NewFileCache(path)
+	cache.Secret = "my secret"
+	creds := api.Credentials{
+		LoginResponse: api.LoginResponse{
+			Token:        "token",
+			RefreshToken: "refresh",
+		},
+	}
+
+	// Act
+	errSet := cache.Set(creds)
+	got, errGet := cache.Get()
+	_, errDefault := secret.NewFileCache(path).Get()
+
+	// Assert
+	require.NoError(t, errSet)
+	require.NoError(t, errGet)
+	require.Equal(t, creds, got)
+	require.Error(t, errDefault, "the file must not be readable with the hard-coded key")
+}
+
+func TestFileCacheSecretMigration(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	creds := api.Credentials{
+		LoginResponse: api.LoginResponse{
+			Token:        "token",
+			RefreshToken: "refresh",
+		},
+	}
+	require.NoError(t, secret.NewFileCache(path).Set(creds))
+	cache := secret.NewFileCache(path)
+	cache.Secret = "my secret"
+
+	// Act
+	got, err := cache.Get()
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, creds, got)
+	_, errDefault := secret.NewFileCache(path).Get()
+	require.Error(t, errDefault, "the file must be re-encrypted with the secret")
+	got, err = cache.Get()
+	require.NoError(t, err)
+	require.Equal(t, creds, got)
+}
+
+func TestFileCacheWrongSecret(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	writer := secret.NewFileCache(path)
+	writer.Secret = "my secret"
+	require.NoError(t, writer.Set(api.Credentials{
+		LoginResponse: api.LoginResponse{Token: "token"},
+	}))
+	cache := secret.NewFileCache(path)
+	cache.Secret = "another secret"
+
+	// Act
+	_, err := cache.Get()
+
+	// Assert
+	require.Error(t, err)
+}
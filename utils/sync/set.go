@@ -0,0 +1,58 @@
+// Package sync provides concurrency-safe data structures.
+package sync
+
+import "sync"
+
+// Set is a concurrency-safe set.
+//
+// The zero value is an empty set ready to use.
+type Set[K comparable] struct {
+	mu    sync.RWMutex
+	items map[K]struct{}
+}
+
+// Contains returns true if the key is in the set.
+func (s *Set[K]) Contains(key K) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.items[key]
+	return ok
+}
+
+// Set adds the key to the set.
+func (s *Set[K]) Set(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.items == nil {
+		s.items = make(map[K]struct{})
+	}
+	s.items[key] = struct{}{}
+}
+
+// Release removes the key from the set.
+func (s *Set[K]) Release(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, key)
+}
+
+// Len returns the number of keys in the set.
+func (s *Set[K]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items)
+}
+
+// Items returns a snapshot of the keys in the set, in no particular order.
+//
+// The returned slice is a copy: it contains the keys present at call time and
+// is not affected by later changes to the set.
+func (s *Set[K]) Items() []K {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	items := make([]K, 0, len(s.items))
+	for key := range s.items {
+		items = append(items, key)
+	}
+	return items
+}
@@ -0,0 +1,90 @@
+package sync_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	syncutils "github.com/Darkness4/withny-dl/utils/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet(t *testing.T) {
+	// Arrange
+	var set syncutils.Set[string]
+
+	// Act
+	set.Set("a")
+	set.Set("b")
+	set.Set("a")
+	set.Release("b")
+	set.Release("c")
+
+	// Assert
+	require.True(t, set.Contains("a"))
+	require.False(t, set.Contains("b"))
+	require.Equal(t, 1, set.Len())
+	require.Equal(t, []string{"a"}, set.Items())
+}
+
+func TestSetItemsSnapshot(t *testing.T) {
+	// Arrange
+	var set syncutils.Set[int]
+	set.Set(1)
+	set.Set(2)
+
+	// Act
+	items := set.Items()
+	set.Set(3)
+	set.Release(1)
+
+	// Assert
+	require.ElementsMatch(t, []int{1, 2}, items)
+	require.ElementsMatch(t, []int{2, 3}, set.Items())
+}
+
+func TestSetItemsConcurrent(t *testing.T) {
+	// Arrange
+	var set syncutils.Set[string]
+	const writers = 4
+	const n = 1000
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			for _, item := range set.Items() {
+				require.NotEmpty(t, item)
+			}
+		}
+	}()
+
+	// Act
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range n {
+				key := fmt.Sprintf("%d-%d", w, i)
+				set.Set(key)
+				if i%2 == 0 {
+					set.Release(key)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	// Assert
+	require.Len(t, set.Items(), writers*n/2)
+	require.Equal(t, writers*n/2, set.Len())
+}
@@ -1,5 +1,8 @@
 // Package try provides a set of functions to retry a function with a delay.
 //
+// The delays between the tries stop when the context is done, in which case
+// ctx.Err() is returned.
+//
 // nolint: ireturn
 package try
 
@@ -7,14 +10,49 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"runtime"
 	"time"
 
 	"github.com/rs/zerolog/log"
 )
 
+// RetryDelayer is an error that requests a specific delay before the next try.
+//
+// The exponential backoff functions sleep for RetryDelay() instead of the
+// current backoff when the error implements it.
+type RetryDelayer interface {
+	error
+	RetryDelay() time.Duration
+}
+
+// sleepContext is replaced in the tests.
+var sleepContext = defaultSleepContext
+
+// defaultSleepContext sleeps for d or until ctx is done.
+func defaultSleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryDelay returns the delay requested by the error, if any.
+func retryDelay(err error) (time.Duration, bool) {
+	var d RetryDelayer
+	if errors.As(err, &d) {
+		return d.RetryDelay(), true
+	}
+	return 0, false
+}
+
 // Do tries a function with a delay.
 func Do(
+	ctx context.Context,
 	tries int,
 	delay time.Duration,
 	fn func() error,
@@ -33,7 +71,9 @@ func Do(
 			Int("try", try).
 			Int("maxTries", tries).
 			Msg("try failed")
-		time.Sleep(delay)
+		if ctxErr := sleepContext(ctx, delay); ctxErr != nil {
+			return ctxErr
+		}
 	}
 	log.Warn().Err(err).Msg("failed all tries")
 	return err
@@ -41,28 +81,177 @@ func Do(
 
 // DoExponentialBackoff tries a function with exponential backoff.
 func DoExponentialBackoff(
+	ctx context.Context,
 	tries int,
 	delay time.Duration,
 	multiplier time.Duration,
 	maxBackoff time.Duration,
 	fn func() error,
+) (err error) {
+	return doExponentialBackoff(ctx, RetryConfig{
+		Tries:      tries,
+		Delay:      delay,
+		Multiplier: multiplier,
+		MaxBackoff: maxBackoff,
+	}, getCaller(), fn)
+}
+
+// RetryConfig configures DoExponentialBackoffWithConfig.
+type RetryConfig struct {
+	// Tries is the maximum number of tries.
+	Tries int
+	// Delay is the initial delay between two tries.
+	Delay time.Duration
+	// Multiplier multiplies the delay after each failed try.
+	Multiplier time.Duration
+	// MaxBackoff caps the delay.
+	MaxBackoff time.Duration
+	// OnRetry is called after each failed try with the index of the try and
+	// the delay before the next one.
+	//
+	// If nil, the failure is logged as a warning.
+	OnRetry func(attempt int, delay time.Duration, err error)
+}
+
+// DoExponentialBackoffWithConfig tries a function with exponential backoff.
+//
+// It behaves like DoExponentialBackoff, with a customizable retry callback.
+func DoExponentialBackoffWithConfig(
+	ctx context.Context,
+	cfg RetryConfig,
+	fn func() error,
+) error {
+	return doExponentialBackoff(ctx, cfg, getCaller(), fn)
+}
+
+func doExponentialBackoff(
+	ctx context.Context,
+	cfg RetryConfig,
+	caller string,
+	fn func() error,
+) (err error) {
+	if cfg.Tries <= 0 {
+		log.Panic().Int("tries", cfg.Tries).Msg("tries is 0 or negative")
+	}
+	onRetry := cfg.OnRetry
+	if onRetry == nil {
+		onRetry = func(attempt int, delay time.Duration, err error) {
+			log.Warn().
+				Str("parentCaller", caller).
+				Err(err).
+				Int("try", attempt).
+				Int("maxTries", cfg.Tries).
+				Stringer("backoff", delay).
+				Msg("try failed")
+		}
+	}
+	delay := cfg.Delay
+	for try := 0; try < cfg.Tries; try++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		if d, ok := retryDelay(err); ok {
+			onRetry(try, d, err)
+			if ctxErr := sleepContext(ctx, d); ctxErr != nil {
+				return ctxErr
+			}
+			continue
+		}
+		onRetry(try, delay, err)
+		if ctxErr := sleepContext(ctx, delay); ctxErr != nil {
+			return ctxErr
+		}
+		delay = delay * cfg.Multiplier
+		if delay > cfg.MaxBackoff {
+			delay = cfg.MaxBackoff
+		}
+	}
+	log.Warn().Err(err).Msg("failed all tries")
+	return err
+}
+
+// DoExponentialBackoffUntilContextDone tries a function with exponential
+// backoff until it succeeds or the context is done.
+//
+// It returns ctx.Err() when the context is done.
+func DoExponentialBackoffUntilContextDone(
+	ctx context.Context,
+	delay time.Duration,
+	maxBackoff time.Duration,
+	multiplier int,
+	fn func() error,
+) error {
+	for try := 0; ; try++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		backoff := delay
+		if d, ok := retryDelay(err); ok {
+			backoff = d
+		} else {
+			delay = min(delay*time.Duration(multiplier), maxBackoff)
+		}
+		log.Warn().
+			Str("parentCaller", getCaller()).
+			Err(err).
+			Int("try", try).
+			Stringer("backoff", backoff).
+			Msg("try failed")
+		if err := sleepContext(ctx, backoff); err != nil {
+			return err
+		}
+	}
+}
+
+// DoExponentialBackoffWithJitter tries a function with exponential backoff.
+//
+// Each delay is multiplied by a random factor in [1-jitter, 1+jitter] so that
+// concurrent callers do not retry at the same time. jitter must be in (0, 1].
+func DoExponentialBackoffWithJitter(
+	ctx context.Context,
+	tries int,
+	delay time.Duration,
+	multiplier time.Duration,
+	maxBackoff time.Duration,
+	jitter float64,
+	fn func() error,
 ) (err error) {
 	if tries <= 0 {
 		log.Panic().Int("tries", tries).Msg("tries is 0 or negative")
 	}
+	if jitter <= 0 || jitter > 1 {
+		log.Panic().Float64("jitter", jitter).Msg("jitter is not in (0, 1]")
+	}
 	for try := 0; try < tries; try++ {
 		err = fn()
 		if err == nil {
 			return nil
 		}
+		backoff := min(applyJitter(delay, jitter), maxBackoff)
 		log.Warn().
 			Str("parentCaller", getCaller()).
 			Err(err).
 			Int("try", try).
 			Int("maxTries", tries).
-			Stringer("backoff", delay).
+			Stringer("backoff", backoff).
 			Msg("try failed")
-		time.Sleep(delay)
+		if d, ok := retryDelay(err); ok {
+			if ctxErr := sleepContext(ctx, d); ctxErr != nil {
+				return ctxErr
+			}
+			continue
+		}
+		if ctxErr := sleepContext(ctx, backoff); ctxErr != nil {
+			return ctxErr
+		}
 		delay = delay * multiplier
 		if delay > maxBackoff {
 			delay = maxBackoff
@@ -72,10 +261,17 @@ func DoExponentialBackoff(
 	return err
 }
 
+// applyJitter multiplies the delay by a random factor in [1-jitter, 1+jitter].
+func applyJitter(delay time.Duration, jitter float64) time.Duration {
+	factor := 1 - jitter + 2*jitter*rand.Float64()
+	return time.Duration(float64(delay) * factor)
+}
+
 // DoWithResult tries a function and returns a result.
 //
 // To avoid any deadlock, the function will stop if the errors is context.Canceled.
 func DoWithResult[T any](
+	ctx context.Context,
 	tries int,
 	delay time.Duration,
 	fn func() (T, error),
@@ -92,7 +288,9 @@ func DoWithResult[T any](
 			return result, err
 		}
 		log.Warn().Str("parentCaller", getCaller()).Int("try", try).Err(err).Msg("try failed")
-		time.Sleep(delay)
+		if ctxErr := sleepContext(ctx, delay); ctxErr != nil {
+			return result, ctxErr
+		}
 	}
 	log.Warn().Err(err).Msg("failed all tries")
 	return result, err
@@ -102,6 +300,7 @@ func DoWithResult[T any](
 //
 // To avoid any deadlock, the function will stop if the errors is context.Canceled.
 func DoExponentialBackoffWithResult[T any](
+	ctx context.Context,
 	tries int,
 	delay time.Duration,
 	multiplier int,
@@ -127,7 +326,15 @@ func DoExponentialBackoffWithResult[T any](
 			Err(err).Msg(
 			"try failed",
 		)
-		time.Sleep(delay)
+		if d, ok := retryDelay(err); ok {
+			if ctxErr := sleepContext(ctx, d); ctxErr != nil {
+				return result, ctxErr
+			}
+			continue
+		}
+		if ctxErr := sleepContext(ctx, delay); ctxErr != nil {
+			return result, ctxErr
+		}
 		delay = delay * time.Duration(multiplier)
 		if delay > maxBackoff {
 			delay = maxBackoff
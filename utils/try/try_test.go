@@ -0,0 +1,230 @@
+package try
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoExponentialBackoffWithJitter(t *testing.T) {
+	// Arrange
+	var delays []time.Duration
+	sleepContext = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	defer func() { sleepContext = defaultSleepContext }()
+	maxBackoff := 5 * time.Second
+	errFailed := errors.New("failed")
+
+	// Act
+	err := DoExponentialBackoffWithJitter(
+		context.Background(),
+		20,
+		time.Second,
+		2,
+		maxBackoff,
+		0.5,
+		func() error {
+			return errFailed
+		},
+	)
+
+	// Assert
+	require.ErrorIs(t, err, errFailed)
+	require.Len(t, delays, 20)
+	identical := true
+	for _, d := range delays {
+		require.LessOrEqual(t, d, maxBackoff)
+		require.Positive(t, d)
+		if d != delays[0] {
+			identical = false
+		}
+	}
+	require.False(t, identical, "delays should not be all identical")
+	// The first delay is in [0.5s, 1.5s].
+	require.GreaterOrEqual(t, delays[0], 500*time.Millisecond)
+	require.LessOrEqual(t, delays[0], 1500*time.Millisecond)
+}
+
+func TestDoExponentialBackoffWithConfig(t *testing.T) {
+	// Arrange
+	var delays []time.Duration
+	sleepContext = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	defer func() { sleepContext = defaultSleepContext }()
+	type retry struct {
+		attempt int
+		delay   time.Duration
+		err     error
+	}
+	var retries []retry
+	errFailed := errors.New("failed")
+	calls := 0
+
+	// Act
+	err := DoExponentialBackoffWithConfig(context.Background(), RetryConfig{
+		Tries:      5,
+		Delay:      time.Second,
+		Multiplier: 2,
+		MaxBackoff: 5 * time.Second,
+		OnRetry: func(attempt int, delay time.Duration, err error) {
+			retries = append(retries, retry{attempt, delay, err})
+		},
+	}, func() error {
+		calls++
+		if calls == 5 {
+			return nil
+		}
+		return errFailed
+	})
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, []retry{
+		{0, time.Second, errFailed},
+		{1, 2 * time.Second, errFailed},
+		{2, 4 * time.Second, errFailed},
+		{3, 5 * time.Second, errFailed},
+	}, retries)
+	require.Equal(t, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+	}, delays)
+}
+
+func TestDoExponentialBackoffWithJitterInvalidJitter(t *testing.T) {
+	for _, jitter := range []float64{0, -0.1, 1.5} {
+		require.Panics(t, func() {
+			_ = DoExponentialBackoffWithJitter(context.Background(), 1, time.Second, 2, time.Second, jitter, func() error {
+				return nil
+			})
+		})
+	}
+}
+
+func TestDoExponentialBackoffUntilContextDone(t *testing.T) {
+	// Arrange
+	var delays []time.Duration
+	sleepContext = func(_ context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+	defer func() { sleepContext = defaultSleepContext }()
+	calls := 0
+
+	// Act
+	err := DoExponentialBackoffUntilContextDone(
+		context.Background(),
+		time.Second,
+		5*time.Second,
+		2,
+		func() error {
+			calls++
+			if calls < 6 {
+				return errors.New("failed")
+			}
+			return nil
+		},
+	)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, 6, calls)
+	require.Equal(t, []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	}, delays)
+}
+
+func TestDoExponentialBackoffUntilContextDoneCanceled(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	start := time.Now()
+
+	// Act
+	err := DoExponentialBackoffUntilContextDone(
+		ctx,
+		time.Hour,
+		time.Hour,
+		2,
+		func() error {
+			calls++
+			cancel()
+			return errors.New("failed")
+		},
+	)
+
+	// Assert
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, calls)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestDoExponentialBackoffUntilContextDoneCanceledWhileSleeping(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	calls := 0
+	start := time.Now()
+
+	// Act
+	err := DoExponentialBackoffUntilContextDone(
+		ctx,
+		time.Hour,
+		time.Hour,
+		2,
+		func() error {
+			calls++
+			return errors.New("failed")
+		},
+	)
+
+	// Assert
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, calls)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+type retryAfterError time.Duration
+
+func (e retryAfterError) Error() string { return "throttled" }
+
+func (e retryAfterError) RetryDelay() time.Duration { return time.Duration(e) }
+
+func TestDoExponentialBackoffWithResultRetryDelayCanceled(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	calls := 0
+	start := time.Now()
+
+	// Act
+	_, err := DoExponentialBackoffWithResult(
+		ctx,
+		5,
+		time.Millisecond,
+		2,
+		time.Millisecond,
+		func() (bool, error) {
+			calls++
+			return false, retryAfterError(time.Hour)
+		},
+	)
+
+	// Assert
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, calls)
+	require.Less(t, time.Since(start), time.Second)
+}
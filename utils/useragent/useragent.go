@@ -0,0 +1,61 @@
+// Package useragent provides browser user-agents to avoid being fingerprinted as a bot.
+package useragent
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/binary"
+	"math/big"
+	"os"
+)
+
+var ua = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:134.0) Gecko/20100101 Firefox/134.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:133.0) Gecko/20100101 Firefox/133.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:128.0) Gecko/20100101 Firefox/128.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.7; rv:134.0) Gecko/20100101 Firefox/134.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.7; rv:133.0) Gecko/20100101 Firefox/133.0",
+	"Mozilla/5.0 (X11; Linux x86_64; rv:134.0) Gecko/20100101 Firefox/134.0",
+	"Mozilla/5.0 (X11; Linux x86_64; rv:133.0) Gecko/20100101 Firefox/133.0",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:134.0) Gecko/20100101 Firefox/134.0",
+}
+
+// List returns a copy of the built-in user-agents.
+func List() []string {
+	out := make([]string, len(ua))
+	copy(out, ua)
+	return out
+}
+
+// Get returns a built-in user-agent selected deterministically from the hostname.
+func Get() string {
+	return FromList(ua)
+}
+
+// GetRandom returns a built-in user-agent selected uniformly at random.
+func GetRandom() string {
+	return RandomFromList(ua)
+}
+
+// FromList returns a user-agent of the list selected deterministically from the hostname.
+func FromList(uas []string) string {
+	if len(uas) == 0 {
+		return ""
+	}
+	hostname, _ := os.Hostname()
+	sum := md5.Sum([]byte(hostname))
+	idx := binary.BigEndian.Uint64(sum[:8]) % uint64(len(uas))
+	return uas[idx]
+}
+
+// RandomFromList returns a user-agent of the list selected uniformly at random.
+func RandomFromList(uas []string) string {
+	if len(uas) == 0 {
+		return ""
+	}
+	idx, err := rand.Int(rand.Reader, big.NewInt(int64(len(uas))))
+	if err != nil {
+		panic(err)
+	}
+	return uas[idx.Int64()]
+}
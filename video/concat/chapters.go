@@ -0,0 +1,87 @@
+package concat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Darkness4/withny-dl/video/probe"
+)
+
+// Chapter is a chapter of the concatenated output.
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+}
+
+// newChapters returns a chapter per input, placed at the position of the
+// input in the concatenated output.
+func newChapters(inputs []string, durations []time.Duration) []Chapter {
+	chapters := make([]Chapter, 0, len(inputs))
+	var start time.Duration
+	for idx, input := range inputs {
+		end := start + durations[idx]
+		chapters = append(chapters, Chapter{
+			Title: strings.TrimSuffix(filepath.Base(input), filepath.Ext(input)),
+			Start: start,
+			End:   end,
+		})
+		start = end
+	}
+	return chapters
+}
+
+// ffmetadataEscaper escapes the special characters of the ffmetadata format.
+var ffmetadataEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`=`, `\=`,
+	`;`, `\;`,
+	`#`, `\#`,
+	"\n", "\\\n",
+)
+
+// writeFFMetadata writes the chapters in the ffmetadata format.
+func writeFFMetadata(w io.Writer, chapters []Chapter) error {
+	bw := bufio.NewWriter(w)
+	_, _ = bw.WriteString(";FFMETADATA1\n")
+	for _, chapter := range chapters {
+		_, _ = fmt.Fprintf(
+			bw,
+			"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			chapter.Start.Milliseconds(),
+			chapter.End.Milliseconds(),
+			ffmetadataEscaper.Replace(chapter.Title),
+		)
+	}
+	return bw.Flush()
+}
+
+// writeChapterMarkers writes an ffmetadata file with a chapter per input next to the output.
+//
+// The caller must remove the file.
+func writeChapterMarkers(output string, inputs []string) (string, error) {
+	durations := make([]time.Duration, 0, len(inputs))
+	for _, input := range inputs {
+		d, err := probe.Duration(input)
+		if err != nil {
+			return "", fmt.Errorf("failed to probe duration of %s: %w", input, err)
+		}
+		durations = append(durations, d)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(output), filepath.Base(output)+".*.ffmetadata")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := writeFFMetadata(f, newChapters(inputs, durations)); err != nil {
+		_ = os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
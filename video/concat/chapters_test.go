@@ -0,0 +1,50 @@
+package concat
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFFMetadata(t *testing.T) {
+	// Arrange
+	inputs := []string{
+		"out/2024-01-10 210000 title.ts",
+		"out/2024-01-10 213000 title.1.ts",
+		"out/2024-01-10 220000 a=b;c#d.2.ts",
+	}
+	durations := []time.Duration{
+		30 * time.Minute,
+		29*time.Minute + 30*time.Second + 250*time.Millisecond,
+		10 * time.Second,
+	}
+	var buf bytes.Buffer
+
+	// Act
+	err := writeFFMetadata(&buf, newChapters(inputs, durations))
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, `;FFMETADATA1
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=0
+END=1800000
+title=2024-01-10 210000 title
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=1800000
+END=3570250
+title=2024-01-10 213000 title.1
+
+[CHAPTER]
+TIMEBASE=1/1000
+START=3570250
+END=3580250
+title=2024-01-10 220000 a\=b\;c\#d.2
+`, buf.String())
+}
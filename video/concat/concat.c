@@ -3,11 +3,16 @@
 
 #include "arena.h"
 #include <inttypes.h>
+#include <libavcodec/avcodec.h>
 #include <libavformat/avformat.h>
 #include <libavutil/avutil.h>
 #include <libavutil/log.h>
+#include <libavutil/mem.h>
+#include <libavutil/pixdesc.h>
+#include <stdarg.h>
 #include <stdint.h>
 #include <stdio.h>
+#include <string.h>
 
 #ifdef USE_STUB
 go_span goTraceProcessInputStart(go_ctx ctx, size_t index, char *input_file) {
@@ -17,6 +22,48 @@ go_span goTraceProcessInputStart(go_ctx ctx, size_t index, char *input_file) {
 void goTraceProcessInputEnd(go_span span) { return; }
 #endif
 
+// Buffer collecting the diagnostics of the running concat, per thread.
+static _Thread_local char *stderr_buf = NULL;
+static _Thread_local size_t stderr_buf_size = 0;
+
+static void append_stderr(const char *line) {
+  if (stderr_buf == NULL || stderr_buf_size == 0) {
+    return;
+  }
+  size_t len = strnlen(stderr_buf, stderr_buf_size);
+  if (len + 1 < stderr_buf_size) {
+    snprintf(stderr_buf + len, stderr_buf_size - len, "%s", line);
+  }
+}
+
+// Print a diagnostic to stderr and collect it in the stderr buffer.
+static void log_stderr(const char *fmt, ...) {
+  char line[1024];
+  va_list vl;
+
+  va_start(vl, fmt);
+  vsnprintf(line, sizeof(line), fmt, vl);
+  va_end(vl);
+
+  fputs(line, stderr);
+  append_stderr(line);
+}
+
+// libav log callback, also collecting the logs in the stderr buffer.
+static void log_callback(void *avcl, int level, const char *fmt, va_list vl) {
+  va_list vl2;
+  va_copy(vl2, vl);
+  av_log_default_callback(avcl, level, fmt, vl);
+  if (stderr_buf != NULL && level <= av_log_get_level()) {
+    char line[1024];
+    int print_prefix = 1;
+    av_log_format_line2(avcl, level, fmt, vl2, line, sizeof(line),
+                        &print_prefix);
+    append_stderr(line);
+  }
+  va_end(vl2);
+}
+
 void fix_ts(int64_t *dts_offset, int64_t **prev_dts, int64_t **prev_duration,
             size_t input_idx, AVPacket *pkt) {
   // Offset due to old offsets (concat or discontinuity)
@@ -36,11 +83,10 @@ void fix_ts(int64_t *dts_offset, int64_t **prev_dts, int64_t **prev_duration,
       delta += prev_duration[input_idx - 1][pkt->stream_index] > 0
                    ? prev_duration[input_idx - 1][pkt->stream_index]
                    : 1;
-      fprintf(stderr,
-              "input#%zu, stream #%d concatenation, last.dts=%" PRId64 ", "
-              "pkt.dts=%" PRId64 ", new offset=%" PRId64 "\n",
-              input_idx, pkt->stream_index,
-              prev_dts[input_idx - 1][pkt->stream_index], pkt->dts, delta);
+      log_stderr("input#%zu, stream #%d concatenation, last.dts=%" PRId64 ", "
+                 "pkt.dts=%" PRId64 ", new offset=%" PRId64 "\n",
+                 input_idx, pkt->stream_index,
+                 prev_dts[input_idx - 1][pkt->stream_index], pkt->dts, delta);
 
       // The previous dts is the last dts of the previous file.
       prev_dts[input_idx][pkt->stream_index] =
@@ -59,11 +105,10 @@ void fix_ts(int64_t *dts_offset, int64_t **prev_dts, int64_t **prev_duration,
                  ? prev_duration[input_idx][pkt->stream_index]
                  : 1;
 
-    fprintf(stderr,
-            "input#%zu, stream #%d discontinuity, last.dts=%" PRId64 ", "
-            "pkt.dts=%" PRId64 ", new offset=%" PRId64 "\n",
-            input_idx, pkt->stream_index,
-            prev_dts[input_idx][pkt->stream_index], pkt->dts, delta);
+    log_stderr("input#%zu, stream #%d discontinuity, last.dts=%" PRId64 ", "
+               "pkt.dts=%" PRId64 ", new offset=%" PRId64 "\n",
+               input_idx, pkt->stream_index,
+               prev_dts[input_idx][pkt->stream_index], pkt->dts, delta);
   }
 
   pkt->dts += delta;
@@ -77,19 +122,265 @@ void fix_ts(int64_t *dts_offset, int64_t **prev_dts, int64_t **prev_duration,
   pkt->pos = -1;
 }
 
+/**
+ * Copy the chapters of an ffmetadata file to the output.
+ *
+ * Must be called before writing the header.
+ */
+int copy_chapters(AVFormatContext *ofmt_ctx, const char *metadata_file) {
+  AVFormatContext *meta_ctx = NULL;
+  int ret;
+
+  if ((ret = avformat_open_input(&meta_ctx, metadata_file,
+                                 av_find_input_format("ffmetadata"), NULL)) <
+      0) {
+    log_stderr("Could not open metadata file '%s': %s\n", metadata_file,
+               av_err2str(ret));
+    return ret;
+  }
+
+  if (meta_ctx->nb_chapters == 0) {
+    goto end;
+  }
+
+  ofmt_ctx->chapters =
+      av_calloc(meta_ctx->nb_chapters, sizeof(*ofmt_ctx->chapters));
+  if (!ofmt_ctx->chapters) {
+    ret = AVERROR(ENOMEM);
+    goto end;
+  }
+
+  for (unsigned int i = 0; i < meta_ctx->nb_chapters; i++) {
+    AVChapter *in_ch = meta_ctx->chapters[i];
+    AVChapter *out_ch = av_mallocz(sizeof(*out_ch));
+    if (!out_ch) {
+      ret = AVERROR(ENOMEM);
+      goto end;
+    }
+
+    out_ch->id = in_ch->id;
+    out_ch->time_base = in_ch->time_base;
+    out_ch->start = in_ch->start;
+    out_ch->end = in_ch->end;
+    if ((ret = av_dict_copy(&out_ch->metadata, in_ch->metadata, 0)) < 0) {
+      av_dict_free(&out_ch->metadata);
+      av_free(out_ch);
+      goto end;
+    }
+
+    // Freed by avformat_free_context.
+    ofmt_ctx->chapters[ofmt_ctx->nb_chapters++] = out_ch;
+  }
+
+end:
+  avformat_close_input(&meta_ctx);
+  return ret;
+}
+
+/**
+ * Re-encode the picture in pkt as JPEG.
+ *
+ * Containers only accept JPEG, PNG and BMP attached pictures. par is updated
+ * with the parameters of the JPEG picture.
+ */
+static int encode_cover_art_jpeg(AVCodecParameters *par, AVPacket *pkt) {
+  const AVCodec *decoder, *encoder;
+  AVCodecContext *dec_ctx = NULL;
+  AVCodecContext *enc_ctx = NULL;
+  AVFrame *frame = NULL;
+  int ret;
+
+  decoder = avcodec_find_decoder(par->codec_id);
+  if (!decoder) {
+    log_stderr("No decoder for the cover art (%s)\n",
+               avcodec_get_name(par->codec_id));
+    return AVERROR_DECODER_NOT_FOUND;
+  }
+  encoder = avcodec_find_encoder(AV_CODEC_ID_MJPEG);
+  if (!encoder) {
+    log_stderr("No JPEG encoder for the cover art\n");
+    return AVERROR_ENCODER_NOT_FOUND;
+  }
+
+  dec_ctx = avcodec_alloc_context3(decoder);
+  frame = av_frame_alloc();
+  if (!dec_ctx || !frame) {
+    ret = AVERROR(ENOMEM);
+    goto end;
+  }
+  if ((ret = avcodec_parameters_to_context(dec_ctx, par)) < 0) {
+    log_stderr("Failed to copy cover art decoder parameters: %s\n",
+               av_err2str(ret));
+    goto end;
+  }
+  if ((ret = avcodec_open2(dec_ctx, decoder, NULL)) < 0) {
+    log_stderr("Failed to open cover art decoder: %s\n", av_err2str(ret));
+    goto end;
+  }
+
+  // The picture is a single frame: send it, then flush the decoder.
+  if ((ret = avcodec_send_packet(dec_ctx, pkt)) < 0 ||
+      (ret = avcodec_send_packet(dec_ctx, NULL)) < 0 ||
+      (ret = avcodec_receive_frame(dec_ctx, frame)) < 0) {
+    log_stderr("Failed to decode cover art: %s\n", av_err2str(ret));
+    goto end;
+  }
+
+  enc_ctx = avcodec_alloc_context3(encoder);
+  if (!enc_ctx) {
+    ret = AVERROR(ENOMEM);
+    goto end;
+  }
+  enc_ctx->width = frame->width;
+  enc_ctx->height = frame->height;
+  enc_ctx->pix_fmt = frame->format;
+  enc_ctx->color_range = frame->color_range;
+  enc_ctx->time_base = (AVRational){1, 1};
+  // Decoded pictures are usually limited range YUV, which is not standard
+  // JPEG.
+  enc_ctx->strict_std_compliance = FF_COMPLIANCE_UNOFFICIAL;
+  if ((ret = avcodec_open2(enc_ctx, encoder, NULL)) < 0) {
+    log_stderr("Failed to open cover art encoder (%s): %s\n",
+               av_get_pix_fmt_name(frame->format), av_err2str(ret));
+    goto end;
+  }
+
+  av_packet_unref(pkt);
+  if ((ret = avcodec_send_frame(enc_ctx, frame)) < 0 ||
+      (ret = avcodec_send_frame(enc_ctx, NULL)) < 0 ||
+      (ret = avcodec_receive_packet(enc_ctx, pkt)) < 0) {
+    log_stderr("Failed to encode cover art: %s\n", av_err2str(ret));
+    goto end;
+  }
+
+  if ((ret = avcodec_parameters_from_context(par, enc_ctx)) < 0) {
+    log_stderr("Failed to copy cover art encoder parameters: %s\n",
+               av_err2str(ret));
+    av_packet_unref(pkt);
+    goto end;
+  }
+
+end:
+  av_frame_free(&frame);
+  avcodec_free_context(&dec_ctx);
+  avcodec_free_context(&enc_ctx);
+  return ret;
+}
+
+/**
+ * Add the cover art as an attached picture stream and read its packet.
+ *
+ * Pictures other than JPEG and PNG (e.g. AVIF) are re-encoded as JPEG.
+ *
+ * Must be called before writing the header. The packet must be written after
+ * the header.
+ */
+int add_cover_art(AVFormatContext *ofmt_ctx, const char *cover_file,
+                  AVPacket *cover_pkt) {
+  AVFormatContext *cover_ctx = NULL;
+  AVCodecParameters *par = NULL;
+  AVStream *out_stream;
+  int ret;
+
+  if ((ret = avformat_open_input(&cover_ctx, cover_file, NULL, NULL)) < 0) {
+    log_stderr("Could not open cover art '%s': %s\n", cover_file,
+               av_err2str(ret));
+    return ret;
+  }
+
+  if ((ret = avformat_find_stream_info(cover_ctx, NULL)) < 0) {
+    log_stderr("Failed to retrieve cover art information: %s\n",
+               av_err2str(ret));
+    goto end;
+  }
+
+  if (cover_ctx->nb_streams == 0 ||
+      cover_ctx->streams[0]->codecpar->codec_type != AVMEDIA_TYPE_VIDEO) {
+    log_stderr("Cover art '%s' is not a picture\n", cover_file);
+    ret = AVERROR_INVALIDDATA;
+    goto end;
+  }
+
+  if ((ret = av_read_frame(cover_ctx, cover_pkt)) < 0) {
+    log_stderr("Could not read cover art: %s\n", av_err2str(ret));
+    goto end;
+  }
+
+  par = avcodec_parameters_alloc();
+  if (!par) {
+    av_packet_unref(cover_pkt);
+    ret = AVERROR(ENOMEM);
+    goto end;
+  }
+  if ((ret = avcodec_parameters_copy(par, cover_ctx->streams[0]->codecpar)) <
+      0) {
+    log_stderr("Failed to copy cover art parameters: %s\n",
+               av_err2str(ret));
+    av_packet_unref(cover_pkt);
+    goto end;
+  }
+
+  if (par->codec_id != AV_CODEC_ID_MJPEG && par->codec_id != AV_CODEC_ID_PNG) {
+    log_stderr("Converting cover art (%s) to JPEG\n",
+               avcodec_get_name(par->codec_id));
+    if ((ret = encode_cover_art_jpeg(par, cover_pkt)) < 0) {
+      av_packet_unref(cover_pkt);
+      goto end;
+    }
+  }
+
+  out_stream = avformat_new_stream(ofmt_ctx, NULL);
+  if (!out_stream) {
+    log_stderr("Failed allocating cover art stream\n");
+    av_packet_unref(cover_pkt);
+    ret = AVERROR(ENOMEM);
+    goto end;
+  }
+  if ((ret = avcodec_parameters_copy(out_stream->codecpar, par)) < 0) {
+    log_stderr("Failed to copy cover art parameters: %s\n",
+               av_err2str(ret));
+    av_packet_unref(cover_pkt);
+    goto end;
+  }
+  out_stream->codecpar->codec_tag = 0;
+  out_stream->disposition = AV_DISPOSITION_ATTACHED_PIC;
+
+  cover_pkt->stream_index = out_stream->index;
+  cover_pkt->pts = 0;
+  cover_pkt->dts = 0;
+  cover_pkt->pos = -1;
+  cover_pkt->flags |= AV_PKT_FLAG_KEY;
+
+  log_stderr("Created cover art stream #%d\n", out_stream->index);
+
+end:
+  avcodec_parameters_free(&par);
+  avformat_close_input(&cover_ctx);
+  return ret;
+}
+
 int concat(void *ctx, const char *output_file, size_t input_files_count,
-           const char *input_files[], int audio_only) {
+           const char *input_files[], int audio_only,
+           const char *metadata_file, const char *cover_file,
+           char *err_buf, size_t err_buf_size) {
   av_log_set_level(AV_LOG_ERROR);
+  av_log_set_callback(log_callback);
 
   if (input_files_count == 0) {
     return 0;
   }
 
+  stderr_buf = err_buf;
+  stderr_buf_size = err_buf_size;
+  if (stderr_buf != NULL && stderr_buf_size > 0) {
+    stderr_buf[0] = '\0';
+  }
+
   Arena arena = {0};
 
   go_span span = NULL;
   AVFormatContext *ifmt_ctx = NULL, *ofmt_ctx = NULL;
-  AVPacket *pkt = NULL;
+  AVPacket *pkt = NULL, *cover_pkt = NULL;
   AVDictionary *opts = NULL;
 
   int64_t *dts_offset = NULL;
@@ -133,7 +424,7 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
 
   pkt = av_packet_alloc();
   if (!pkt) {
-    fprintf(stderr, "Could not allocate AVPacket\n");
+    log_stderr("Could not allocate AVPacket\n");
     ret = AVERROR(ENOMEM);
     goto end;
   }
@@ -141,7 +432,11 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
   // Open output file
   if ((ret = avformat_alloc_output_context2(&ofmt_ctx, NULL, NULL,
                                             output_file)) < 0) {
-    fprintf(stderr, "Could not create output context: %s\n", av_err2str(ret));
+    log_stderr("Could not create output context: %s\n", av_err2str(ret));
+    goto end;
+  }
+
+  if (metadata_file && (ret = copy_chapters(ofmt_ctx, metadata_file)) < 0) {
     goto end;
   }
 
@@ -152,16 +447,16 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
     int stream_index = 0;
 
     if ((ret = avformat_open_input(&ifmt_ctx, input_file, 0, 0)) < 0) {
-      fprintf(stderr, "Could not open input file '%s': %s, aborting...\n",
-              input_file, av_err2str(ret));
+      log_stderr("Could not open input file '%s': %s, aborting...\n",
+                 input_file, av_err2str(ret));
       goto end;
     }
 
     // Retrieve input stream information
     if ((ret = avformat_find_stream_info(ifmt_ctx, 0)) < 0) {
-      fprintf(stderr,
-              "Failed to retrieve input stream information: %s, aborting...\n",
-              av_err2str(ret));
+      log_stderr(
+          "Failed to retrieve input stream information: %s, aborting...\n",
+          av_err2str(ret));
       goto end;
     }
 
@@ -214,15 +509,15 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
 
       // Blacklist any no audio/video/sub streams
       if (audio_only > 0 && in_codecpar->codec_type != AVMEDIA_TYPE_AUDIO) {
-        fprintf(stderr, "Blacklisted stream #%u (%s)\n", i,
-                av_get_media_type_string(in_codecpar->codec_type));
+        log_stderr("Blacklisted stream #%u (%s)\n", i,
+                   av_get_media_type_string(in_codecpar->codec_type));
         stream_mapping[input_idx][i] = -1;
         continue;
       } else if (in_codecpar->codec_type != AVMEDIA_TYPE_AUDIO &&
                  in_codecpar->codec_type != AVMEDIA_TYPE_VIDEO &&
                  in_codecpar->codec_type != AVMEDIA_TYPE_SUBTITLE) {
-        fprintf(stderr, "Blacklisted stream #%u (%s)\n", i,
-                av_get_media_type_string(in_codecpar->codec_type));
+        log_stderr("Blacklisted stream #%u (%s)\n", i,
+                   av_get_media_type_string(in_codecpar->codec_type));
         stream_mapping[input_idx][i] = -1;
         continue;
       }
@@ -244,22 +539,23 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
       }
 
       const int out_stream_index = stream_mapping[input_idx][i];
-      fprintf(stderr, "Input %zu, mapping stream %d (%s) to output stream %d\n",
-              input_idx, i, av_get_media_type_string(in_codecpar->codec_type),
-              out_stream_index);
+      log_stderr("Input %zu, mapping stream %d (%s) to output stream %d\n",
+                 input_idx, i,
+                 av_get_media_type_string(in_codecpar->codec_type),
+                 out_stream_index);
 
       // Only create streams based on the first video.
       if (input_idx == 0) {
         out_stream = avformat_new_stream(ofmt_ctx, NULL);
         if (!out_stream) {
-          fprintf(stderr, "Failed allocating output stream\n");
+          log_stderr("Failed allocating output stream\n");
           ret = AVERROR_UNKNOWN;
           goto end;
         }
         ret = avcodec_parameters_copy(out_stream->codecpar, in_codecpar);
         if (ret < 0) {
-          fprintf(stderr, "Failed to copy codec parameters: %s\n",
-                  av_err2str(ret));
+          log_stderr("Failed to copy codec parameters: %s\n",
+                     av_err2str(ret));
           goto end;
         }
         out_stream->codecpar->codec_tag = 0;
@@ -269,8 +565,8 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
           out_stream->time_base = (AVRational){1, in_codecpar->sample_rate};
         }
 
-        fprintf(stderr, "Created output stream (%s)\n",
-                av_get_media_type_string(out_stream->codecpar->codec_type));
+        log_stderr("Created output stream (%s)\n",
+                   av_get_media_type_string(out_stream->codecpar->codec_type));
       }
 
       // Set to zero
@@ -280,28 +576,53 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
     }
 
     if (input_idx == 0) {
+      // The cover art is added after the mapped streams to keep the mapping.
+      if (cover_file) {
+        cover_pkt = av_packet_alloc();
+        if (!cover_pkt) {
+          log_stderr("Could not allocate AVPacket\n");
+          ret = AVERROR(ENOMEM);
+          goto end;
+        }
+        if (add_cover_art(ofmt_ctx, cover_file, cover_pkt) < 0) {
+          log_stderr("Failed to add cover art, skipping...\n");
+          av_packet_free(&cover_pkt);
+        }
+      }
+
       av_dump_format(ofmt_ctx, input_idx, output_file, 1);
 
       if (!(ofmt_ctx->oformat->flags & AVFMT_NOFILE)) {
         ret = avio_open(&ofmt_ctx->pb, output_file, AVIO_FLAG_WRITE);
         if (ret < 0) {
-          fprintf(stderr, "Could not open output file '%s': %s\n", output_file,
-                  av_err2str(ret));
+          log_stderr("Could not open output file '%s': %s\n", output_file,
+                     av_err2str(ret));
           goto end;
         }
       }
 
       // Set "faststart" option
       if ((ret = av_dict_set(&opts, "movflags", "faststart", 0)) < 0) {
-        fprintf(stderr, "Failed to set options: %s\n", av_err2str(ret));
+        log_stderr("Failed to set options: %s\n", av_err2str(ret));
         goto end;
       }
 
       if ((ret = avformat_write_header(ofmt_ctx, &opts)) < 0) {
-        fprintf(stderr, "Error writing output file header: %s\n",
-                av_err2str(ret));
+        log_stderr("Error writing output file header: %s\n",
+                   av_err2str(ret));
         goto end;
       }
+
+      // The cover art is written first, its timestamps are 0 in any time
+      // base.
+      if (cover_pkt) {
+        cover_pkt->duration = 0;
+        if ((ret = av_write_frame(ofmt_ctx, cover_pkt)) < 0) {
+          log_stderr("Error writing cover art: %s\n", av_err2str(ret));
+          goto end;
+        }
+        av_packet_unref(cover_pkt);
+      }
     }
 
     // Read packets from input file and write to output file
@@ -333,8 +654,8 @@ int concat(void *ctx, const char *output_file, size_t input_files_count,
        * its contents and resets pkt), so that no unreferencing is
        * necessary. This would be different if one used av_write_frame(). */
       if (ret < 0) {
-        fprintf(stderr, "Error writing packet to output file: %s\n",
-                av_err2str(ret));
+        log_stderr("Error writing packet to output file: %s\n",
+                   av_err2str(ret));
         break;
       }
     } // while packets.
@@ -350,6 +671,8 @@ end:
   // Cleanup
   if (pkt)
     av_packet_free(&pkt);
+  if (cover_pkt)
+    av_packet_free(&cover_pkt);
 
   if (ifmt_ctx) {
     goTraceProcessInputEnd(span);
@@ -366,12 +689,12 @@ end:
   if (opts)
     av_dict_free(&opts);
 
-  if (ret < 0) {
-    if (ret != AVERROR_EOF) {
-      fprintf(stderr, "Error occurred: %s\n", av_err2str(ret));
-    }
-    return ret;
+  if (ret < 0 && ret != AVERROR_EOF) {
+    log_stderr("Error occurred: %s\n", av_err2str(ret));
   }
 
-  return 0;
+  stderr_buf = NULL;
+  stderr_buf_size = 0;
+
+  return ret < 0 ? ret : 0;
 }
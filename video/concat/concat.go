@@ -12,10 +12,10 @@ package concat
 import "C"
 import (
 	"context"
-	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -54,13 +54,33 @@ func getFormatPriority(ext string) int {
 	return priority
 }
 
+// stderrBufferSize is the size of the buffer collecting the libav diagnostics.
+const stderrBufferSize = 16 * 1024
+
+// Error is an error returned by libav during the concatenation.
+type Error struct {
+	// Code is the libav error code.
+	Code int
+	// Message is the description of the error code.
+	Message string
+	// Stderr contains the diagnostics printed during the concatenation.
+	Stderr string
+}
+
+// Error returns the error message.
+func (e Error) Error() string {
+	return e.Message
+}
+
 // Option is a function that configures the concatenation.
 type Option func(*Options)
 
 // Options are the concatenation options.
 type Options struct {
-	audioOnly int
-	numbered  bool
+	audioOnly      int
+	numbered       bool
+	chapterMarkers bool
+	coverArt       string
 }
 
 // WithAudioOnly forces the concatenation on audio only.
@@ -81,6 +101,46 @@ func IgnoreExtension() Option {
 	}
 }
 
+// WithChapterMarkers adds a chapter at the start of each input.
+//
+// The chapters are named after the input files.
+func WithChapterMarkers() Option {
+	return func(o *Options) {
+		o.chapterMarkers = true
+	}
+}
+
+// WithCoverArt embeds the picture as the cover art of the output.
+//
+// JPEG and PNG pictures are embedded as is. AVIF pictures are re-encoded as
+// JPEG, which requires libavcodec with an AV1 decoder. Other pictures are ignored.
+func WithCoverArt(path string) Option {
+	return func(o *Options) {
+		o.coverArt = path
+	}
+}
+
+// supportedCoverArt are the MIME types of the pictures that can be embedded.
+var supportedCoverArt = []string{"image/jpeg", "image/png", "image/avif"}
+
+// coverArtContainers are the output extensions supporting attached pictures.
+var coverArtContainers = []string{".mp4", ".m4v", ".mov", ".mkv"}
+
+// CheckCoverArt returns an error if the picture cannot be embedded in the output.
+func CheckCoverArt(output string, path string) error {
+	if !slices.Contains(coverArtContainers, strings.ToLower(filepath.Ext(output))) {
+		return fmt.Errorf("unsupported cover art container: %s", filepath.Ext(output))
+	}
+	mtype, err := mimetype.DetectFile(path)
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(supportedCoverArt, mtype.Is) {
+		return fmt.Errorf("unsupported cover art format: %s", mtype)
+	}
+	return nil
+}
+
 func applyOptions(opts []Option) *Options {
 	o := &Options{}
 	for _, opt := range opts {
@@ -114,6 +174,8 @@ func Do(ctx context.Context, output string, inputs []string, opts ...Option) err
 	attrs = append(attrs, attribute.String("output", output))
 	attrs = append(attrs, attribute.Bool("audio_only", o.audioOnly == 1))
 	attrs = append(attrs, attribute.Bool("numbered", o.numbered))
+	attrs = append(attrs, attribute.Bool("chapter_markers", o.chapterMarkers))
+	attrs = append(attrs, attribute.String("cover_art", o.coverArt))
 
 	ctx, span := otel.Tracer(tracerName).
 		Start(ctx, "concat.Do", trace.WithAttributes(attrs...))
@@ -133,10 +195,37 @@ func Do(ctx context.Context, output string, inputs []string, opts ...Option) err
 
 	log.Info().Str("output", output).Strs("inputs", inputs).Any("options", o).Msg("concat")
 
+	// Chapters must be computed from the original inputs, before any remux.
+	var metadataFile string
+	if o.chapterMarkers {
+		f, err := writeChapterMarkers(output, validInputs)
+		if err != nil {
+			log.Err(err).Msg("failed to write chapter markers, skipping")
+		} else {
+			metadataFile = f
+			defer func() {
+				if err := os.Remove(f); err != nil {
+					log.Err(err).Str("file", f).Msg("failed to remove chapter markers")
+				}
+			}()
+		}
+	}
+
+	if o.coverArt != "" {
+		if o.audioOnly == 1 {
+			o.coverArt = ""
+		} else if err := CheckCoverArt(output, o.coverArt); err != nil {
+			log.Warn().Err(err).Str("file", o.coverArt).Msg("cannot embed cover art, skipping")
+			o.coverArt = ""
+		}
+	}
+
 	// If mixed formats (adts vs asc), we should remux the others first using intermediates or FIFO
 	if areFormatMixed(validInputs) {
 		log.Warn().Msg("mixed formats detected, using intermediates or FIFO to remux files first")
-		i, useFIFO, err := remuxMixedTS(ctx, validInputs, opts...)
+		// The cover art is only embedded in the final output.
+		intermediateOpts := append(slices.Clip(opts), WithCoverArt(""))
+		i, useFIFO, err := remuxMixedTS(ctx, validInputs, intermediateOpts...)
 		if err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
@@ -177,14 +266,33 @@ func Do(ctx context.Context, output string, inputs []string, opts ...Option) err
 	cOutput := C.CString(output)
 	defer C.free(unsafe.Pointer(cOutput))
 
-	if err := C.concat(ctxp, cOutput, C.size_t(len(validInputs)), (**C.char)(inputsC), C.int(o.audioOnly)); err != 0 {
+	var cMetadata *C.char
+	if metadataFile != "" {
+		cMetadata = C.CString(metadataFile)
+		defer C.free(unsafe.Pointer(cMetadata))
+	}
+
+	var cCoverArt *C.char
+	if o.coverArt != "" {
+		cCoverArt = C.CString(o.coverArt)
+		defer C.free(unsafe.Pointer(cCoverArt))
+	}
+
+	cStderr := (*C.char)(C.malloc(C.size_t(stderrBufferSize)))
+	defer C.free(unsafe.Pointer(cStderr))
+
+	if err := C.concat(ctxp, cOutput, C.size_t(len(validInputs)), (**C.char)(inputsC), C.int(o.audioOnly), cMetadata, cCoverArt, cStderr, C.size_t(stderrBufferSize)); err != 0 {
 		if err == C.AVERROR_EOF {
 			return nil
 		}
 		buf := make([]byte, C.AV_ERROR_MAX_STRING_SIZE)
 		C.av_make_error_string((*C.char)(unsafe.Pointer(&buf[0])), C.AV_ERROR_MAX_STRING_SIZE, err)
 
-		err := errors.New(string(buf))
+		err := Error{
+			Code:    int(err),
+			Message: strings.TrimRight(string(buf), "\x00"),
+			Stderr:  C.GoString(cStderr),
+		}
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		metrics.Concat.Errors.Add(ctx, 1)
@@ -38,10 +38,18 @@ extern void goTraceProcessInputEnd(go_span span);
  * @param input_files_count Number of files to be treated.
  * @param output_file The output file name.
  * @param audio_only Only extract audio.
+ * @param metadata_file An optional ffmetadata file from which the chapters are
+ * copied. Can be NULL.
+ * @param cover_file An optional picture embedded as the cover art. Can be NULL.
+ * @param err_buf An optional buffer receiving the diagnostics printed to
+ * stderr, as a NUL-terminated string. Can be NULL.
+ * @param err_buf_size The size of err_buf.
  *
  * @return 0 if the conversion was successful, a negative value on error.
  */
 int concat(void *ctx, const char *output_file, size_t input_files_count,
-           const char *input_files[], int audio_only);
+           const char *input_files[], int audio_only,
+           const char *metadata_file, const char *cover_file,
+           char *err_buf, size_t err_buf_size);
 
 #endif /* CONCAT_H */
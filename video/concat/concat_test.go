@@ -2,6 +2,13 @@ package concat
 
 import (
 	"context"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/Darkness4/withny-dl/video/probe"
@@ -110,3 +117,73 @@ func TestDo(t *testing.T) {
 	err = probe.Do([]string{"output.mp4"}, probe.WithQuiet())
 	require.NoError(t, err)
 }
+
+func writePicture(t *testing.T, name string, encode func(*os.File, image.Image) error) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, encode(f, image.NewRGBA(image.Rect(0, 0, 16, 16))))
+	return path
+}
+
+func encodeJPEG(f *os.File, img image.Image) error { return jpeg.Encode(f, img, nil) }
+
+func encodePNG(f *os.File, img image.Image) error { return png.Encode(f, img) }
+
+func TestCheckCoverArt(t *testing.T) {
+	jpegPath := writePicture(t, "thumb.avif", encodeJPEG)
+	pngPath := writePicture(t, "thumb.png", encodePNG)
+	avifPath := filepath.Join(t.TempDir(), "thumb.avif")
+	require.NoError(t, os.WriteFile(avifPath, []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf"), 0o600))
+	textPath := filepath.Join(t.TempDir(), "thumb.avif")
+	require.NoError(t, os.WriteFile(textPath, []byte("not a picture"), 0o600))
+
+	tests := []struct {
+		title   string
+		output  string
+		cover   string
+		isError bool
+	}{
+		{title: "jpeg in mp4", output: "out.mp4", cover: jpegPath},
+		{title: "png in mkv", output: "out.MKV", cover: pngPath},
+		{title: "avif in mp4", output: "out.mp4", cover: avifPath},
+		{title: "unsupported picture", output: "out.mp4", cover: textPath, isError: true},
+		{title: "unsupported container", output: "out.ts", cover: jpegPath, isError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			err := CheckCoverArt(tt.output, tt.cover)
+
+			if tt.isError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDoWithCoverArt(t *testing.T) {
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		t.Skip("ffprobe is not installed")
+	}
+	cover := writePicture(t, "thumb.avif", encodeJPEG)
+	output := filepath.Join(t.TempDir(), "output.mp4")
+
+	err = Do(context.Background(), output, []string{"input.mp4"}, WithCoverArt(cover))
+	require.NoError(t, err)
+
+	out, err := exec.Command(
+		ffprobe,
+		"-v", "error",
+		"-show_entries", "stream_disposition=attached_pic",
+		"-of", "csv=p=0",
+		output,
+	).Output()
+	require.NoError(t, err)
+	require.Contains(t, strings.Fields(string(out)), "1")
+}
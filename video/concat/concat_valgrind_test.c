@@ -4,6 +4,6 @@
 
 int main(int argc, char *argv[]) {
   const char *input_files[] = {"input.mp4"};
-  concat(NULL, "output.mp4", 1, input_files, 0);
+  concat(NULL, "output.mp4", 1, input_files, 0, NULL, NULL, NULL, 0);
   return 0;
 }
@@ -1,6 +1,7 @@
 #include "probe.h"
 
 #include <libavformat/avformat.h>
+#include <libavutil/avstring.h>
 #include <libavutil/avutil.h>
 #include <libavutil/log.h>
 #include <stdio.h>
@@ -137,3 +138,95 @@ end:
 
   return out;
 }
+
+struct probe_duration_ret probe_duration(const char *input_file) {
+  av_log_set_level(AV_LOG_ERROR);
+
+  AVFormatContext *ifmt_ctx = NULL;
+  struct probe_duration_ret out = {0, 0};
+
+  if ((out.err = avformat_open_input(&ifmt_ctx, input_file, 0, 0)) < 0) {
+    fprintf(stderr, "Could not open input file '%s': %s, skipping...\n",
+            input_file, av_err2str(out.err));
+    goto end;
+  }
+
+  // Retrieve input stream information
+  if ((out.err = avformat_find_stream_info(ifmt_ctx, 0)) < 0) {
+    fprintf(stderr,
+            "Failed to retrieve input stream information: %s, skipping...\n",
+            av_err2str(out.err));
+    goto end;
+  }
+
+  if (ifmt_ctx->duration != AV_NOPTS_VALUE) {
+    out.duration = ifmt_ctx->duration;
+  }
+
+end:
+  if (ifmt_ctx)
+    avformat_close_input(&ifmt_ctx);
+
+  if (out.err < 0) {
+    if (out.err != AVERROR_EOF) {
+      fprintf(stderr, "Error occurred: %s\n", av_err2str(out.err));
+    }
+    return out;
+  }
+
+  return out;
+}
+
+struct probe_info_ret probe_info(const char *input_file) {
+  av_log_set_level(AV_LOG_ERROR);
+
+  AVFormatContext *ifmt_ctx = NULL;
+  struct probe_info_ret out = {0};
+
+  if ((out.err = avformat_open_input(&ifmt_ctx, input_file, 0, 0)) < 0) {
+    fprintf(stderr, "Could not open input file '%s': %s, skipping...\n",
+            input_file, av_err2str(out.err));
+    goto end;
+  }
+
+  // Retrieve input stream information
+  if ((out.err = avformat_find_stream_info(ifmt_ctx, 0)) < 0) {
+    fprintf(stderr,
+            "Failed to retrieve input stream information: %s, skipping...\n",
+            av_err2str(out.err));
+    goto end;
+  }
+
+  if (ifmt_ctx->duration != AV_NOPTS_VALUE) {
+    out.duration = ifmt_ctx->duration;
+  }
+  if (ifmt_ctx->bit_rate > 0) {
+    out.bit_rate = ifmt_ctx->bit_rate;
+  }
+
+  for (unsigned int i = 0; i < ifmt_ctx->nb_streams; i++) {
+    AVCodecParameters *codecpar = ifmt_ctx->streams[i]->codecpar;
+    if (codecpar->codec_type == AVMEDIA_TYPE_VIDEO && !out.has_video) {
+      out.has_video = 1;
+      av_strlcpy(out.video_codec, avcodec_get_name(codecpar->codec_id),
+                 sizeof(out.video_codec));
+    } else if (codecpar->codec_type == AVMEDIA_TYPE_AUDIO &&
+               out.audio_codec[0] == '\0') {
+      av_strlcpy(out.audio_codec, avcodec_get_name(codecpar->codec_id),
+                 sizeof(out.audio_codec));
+    }
+  }
+
+end:
+  if (ifmt_ctx)
+    avformat_close_input(&ifmt_ctx);
+
+  if (out.err < 0) {
+    if (out.err != AVERROR_EOF) {
+      fprintf(stderr, "Error occurred: %s\n", av_err2str(out.err));
+    }
+    return out;
+  }
+
+  return out;
+}
@@ -14,6 +14,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 	"unsafe"
 
 	"go.opentelemetry.io/otel"
@@ -120,3 +121,61 @@ func IsMPEGTSOrAAC(input string) (bool, error) {
 	}
 	return s.is_mpegts_or_aac >= 1, nil
 }
+
+// Duration returns the duration of the input.
+func Duration(input string) (time.Duration, error) {
+	cInput := C.CString(input)
+	defer C.free(unsafe.Pointer(cInput))
+	s := C.probe_duration(cInput)
+	if s.err != 0 {
+		buf := make([]byte, C.AV_ERROR_MAX_STRING_SIZE)
+		C.av_make_error_string(
+			(*C.char)(unsafe.Pointer(&buf[0])),
+			C.AV_ERROR_MAX_STRING_SIZE,
+			s.err,
+		)
+
+		return 0, errors.New(string(buf))
+	}
+	// AV_TIME_BASE is in microseconds.
+	return time.Duration(s.duration) * time.Microsecond, nil
+}
+
+// ProbeResult describes the streams of a media file.
+type ProbeResult struct {
+	// Duration is the duration of the file.
+	Duration time.Duration
+	// VideoCodec is the codec name of the first video stream, empty if none.
+	VideoCodec string
+	// AudioCodec is the codec name of the first audio stream, empty if none.
+	AudioCodec string
+	// Bitrate is the total bitrate of the file in bit/s, 0 if unknown.
+	Bitrate int64
+	// HasVideo is true if the file contains a video stream.
+	HasVideo bool
+}
+
+// Info returns the duration, bitrate and codecs of the input.
+func Info(input string) (ProbeResult, error) {
+	cInput := C.CString(input)
+	defer C.free(unsafe.Pointer(cInput))
+	s := C.probe_info(cInput)
+	if s.err != 0 {
+		buf := make([]byte, C.AV_ERROR_MAX_STRING_SIZE)
+		C.av_make_error_string(
+			(*C.char)(unsafe.Pointer(&buf[0])),
+			C.AV_ERROR_MAX_STRING_SIZE,
+			s.err,
+		)
+
+		return ProbeResult{}, errors.New(string(buf))
+	}
+	return ProbeResult{
+		// AV_TIME_BASE is in microseconds.
+		Duration:   time.Duration(s.duration) * time.Microsecond,
+		VideoCodec: C.GoString(&s.video_codec[0]),
+		AudioCodec: C.GoString(&s.audio_codec[0]),
+		Bitrate:    int64(s.bit_rate),
+		HasVideo:   s.has_video >= 1,
+	}, nil
+}
@@ -2,6 +2,7 @@
 #define PROBE_H
 
 #include <stddef.h>
+#include <stdint.h>
 
 /**
  * Probe the video.
@@ -45,4 +46,44 @@ struct is_mpegts_or_aac_ret {
  */
 struct is_mpegts_or_aac_ret is_mpegts_or_aac(const char *input_file);
 
+struct probe_duration_ret {
+  /// Duration of the file in AV_TIME_BASE units.
+  int64_t duration;
+  /// Errors code.
+  int err;
+};
+
+/**
+ * Fetch the duration of a file.
+ *
+ * @param input_file The input file path.
+ *
+ * @return Returns a probe_duration_ret struct.
+ */
+struct probe_duration_ret probe_duration(const char *input_file);
+
+struct probe_info_ret {
+  /// Duration of the file in AV_TIME_BASE units.
+  int64_t duration;
+  /// Total bitrate of the file in bit/s, 0 if unknown.
+  int64_t bit_rate;
+  /// If the file contains a video stream, returns 1.
+  int has_video;
+  /// Name of the codec of the first video stream, empty if none.
+  char video_codec[32];
+  /// Name of the codec of the first audio stream, empty if none.
+  char audio_codec[32];
+  /// Errors code.
+  int err;
+};
+
+/**
+ * Fetch the duration, bitrate and codecs of a file.
+ *
+ * @param input_file The input file path.
+ *
+ * @return Returns a probe_info_ret struct.
+ */
+struct probe_info_ret probe_info(const char *input_file);
+
 #endif /* PROBE_H */
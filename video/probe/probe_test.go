@@ -58,3 +58,40 @@ func TestIsMPEGTSOrAAC(t *testing.T) {
 		})
 	}
 }
+
+func TestDuration(t *testing.T) {
+	for _, input := range []string{"input.ts", "input.mp4"} {
+		t.Run(input, func(t *testing.T) {
+			d, err := probe.Duration(input)
+			require.NoError(t, err)
+			require.Positive(t, d)
+		})
+	}
+}
+
+func TestInfo(t *testing.T) {
+	tests := []struct {
+		input      string
+		hasVideo   bool
+		videoCodec string
+		audioCodec string
+	}{
+		{"input.ts", true, "mpeg2video", "aac"},
+		{"input.aac", false, "", "aac"},
+		{"input.mp4", true, "h264", "aac"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			want, err := probe.Duration(tt.input)
+			require.NoError(t, err)
+
+			info, err := probe.Info(tt.input)
+			require.NoError(t, err)
+			require.InDelta(t, want.Seconds(), info.Duration.Seconds(), 1)
+			require.Equal(t, tt.hasVideo, info.HasVideo)
+			require.Equal(t, tt.videoCodec, info.VideoCodec)
+			require.Equal(t, tt.audioCodec, info.AudioCodec)
+		})
+	}
+}
@@ -2,25 +2,173 @@
 package remux
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"os/exec"
 
 	"github.com/Darkness4/withny-dl/video/concat"
+	"github.com/rs/zerolog/log"
 )
 
+// RemuxError is returned when libav or ffmpeg fails to remux the input.
+//
+// nolint: revive
+type RemuxError struct {
+	// ExitCode is the libav error code, or the exit code of ffmpeg.
+	ExitCode int
+	// Stderr contains the diagnostics printed by libav or ffmpeg.
+	Stderr string
+	// Err is the original error.
+	Err error
+}
+
+// Error returns the error message.
+func (e RemuxError) Error() string {
+	return fmt.Sprintf("remux failed with code %d: %s", e.ExitCode, e.Err)
+}
+
+// Unwrap returns the original error.
+func (e RemuxError) Unwrap() error {
+	return e.Err
+}
+
+// CodecCopy copies the packets of the stream without re-encoding.
+const CodecCopy = "copy"
+
 // Option is the option for remux.
-type Option concat.Option
+type Option func(*Options)
+
+// Options are the remux options.
+type Options struct {
+	concat     []concat.Option
+	audioOnly  bool
+	videoCodec string
+	audioCodec string
+	coverArt   string
+}
 
 // WithAudioOnly sets the remux to audio only.
 func WithAudioOnly() Option {
-	return Option(concat.WithAudioOnly())
+	return func(o *Options) {
+		o.audioOnly = true
+		o.concat = append(o.concat, concat.WithAudioOnly())
+	}
+}
+
+// WithCoverArt embeds the picture as the cover art of the output.
+//
+// JPEG and PNG pictures are embedded as is. AVIF pictures are re-encoded as
+// JPEG, or as PNG when the stream is re-encoded. Other pictures are ignored.
+func WithCoverArt(path string) Option {
+	return func(o *Options) {
+		o.coverArt = path
+		o.concat = append(o.concat, concat.WithCoverArt(path))
+	}
+}
+
+// WithVideoCodec sets the ffmpeg encoder of the video, e.g. libx265.
+//
+// Any codec other than "copy" re-encodes the stream with the ffmpeg executable.
+func WithVideoCodec(codec string) Option {
+	return func(o *Options) {
+		o.videoCodec = codec
+	}
+}
+
+// WithAudioCodec sets the ffmpeg encoder of the audio, e.g. libopus.
+//
+// Any codec other than "copy" re-encodes the stream with the ffmpeg executable.
+func WithAudioCodec(codec string) Option {
+	return func(o *Options) {
+		o.audioCodec = codec
+	}
+}
+
+func applyOptions(opts []Option) *Options {
+	o := &Options{
+		videoCodec: CodecCopy,
+		audioCodec: CodecCopy,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.videoCodec == "" {
+		o.videoCodec = CodecCopy
+	}
+	if o.audioCodec == "" {
+		o.audioCodec = CodecCopy
+	}
+	return o
+}
+
+// transcoding returns true if the stream must be re-encoded.
+func (o *Options) transcoding() bool {
+	return o.audioCodec != CodecCopy || (!o.audioOnly && o.videoCodec != CodecCopy)
 }
 
 // Do remuxes the input file to the output file.
+//
+// A libav or ffmpeg failure is returned as a RemuxError.
 func Do(ctx context.Context, output string, input string, opts ...Option) error {
-	o := make([]concat.Option, 0, len(opts))
-	for _, opt := range opts {
-		o = append(o, concat.Option(opt))
+	o := applyOptions(opts)
+	if o.transcoding() {
+		return transcode(ctx, output, input, o)
 	}
 
-	return concat.Do(ctx, output, []string{input}, o...)
+	err := concat.Do(ctx, output, []string{input}, o.concat...)
+	var concatErr concat.Error
+	if errors.As(err, &concatErr) {
+		return RemuxError{
+			ExitCode: concatErr.Code,
+			Stderr:   concatErr.Stderr,
+			Err:      err,
+		}
+	}
+	return err
+}
+
+// transcode re-encodes the input file to the output file with ffmpeg.
+func transcode(ctx context.Context, output string, input string, o *Options) error {
+	var stderr bytes.Buffer
+	cmd := transcodeCommand(ctx, output, input, o)
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return RemuxError{
+			ExitCode: exitErr.ExitCode(),
+			Stderr:   stderr.String(),
+			Err:      err,
+		}
+	}
+	return err
+}
+
+// transcodeCommand returns the ffmpeg command re-encoding the input file to the output file.
+func transcodeCommand(ctx context.Context, output string, input string, o *Options) *exec.Cmd {
+	args := []string{"-hide_banner", "-loglevel", "error", "-y", "-i", input}
+	coverArt := o.coverArt != "" && !o.audioOnly
+	if coverArt {
+		if err := concat.CheckCoverArt(output, o.coverArt); err != nil {
+			log.Warn().Err(err).Str("file", o.coverArt).Msg("cannot embed cover art, skipping")
+			coverArt = false
+		}
+	}
+	if coverArt {
+		// The cover art is mapped as the second video stream.
+		args = append(args, "-i", o.coverArt, "-map", "0:v:0", "-map", "0:a?", "-map", "1:v:0")
+	}
+	if o.audioOnly {
+		args = append(args, "-vn")
+	} else {
+		args = append(args, "-c:v", o.videoCodec)
+	}
+	if coverArt {
+		// PNG is lossless and accepts any decoded picture, unlike MJPEG with limited range YUV.
+		args = append(args, "-c:v:1", "png", "-disposition:v:1", "attached_pic")
+	}
+	args = append(args, "-c:a", o.audioCodec, output)
+	return exec.CommandContext(ctx, "ffmpeg", args...)
 }
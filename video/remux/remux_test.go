@@ -0,0 +1,28 @@
+package remux_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/video/remux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoInvalidInput(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.ts")
+	err := os.WriteFile(input, []byte("not a video"), 0o644)
+	require.NoError(t, err)
+
+	// Act
+	err = remux.Do(context.Background(), filepath.Join(dir, "output.mp4"), input)
+
+	// Assert
+	var remuxErr remux.RemuxError
+	require.ErrorAs(t, err, &remuxErr)
+	require.Negative(t, remuxErr.ExitCode)
+	require.NotEmpty(t, remuxErr.Stderr)
+}
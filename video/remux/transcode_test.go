@@ -0,0 +1,94 @@
+package remux
+
+import (
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscodeCommand(t *testing.T) {
+	cover := filepath.Join(t.TempDir(), "thumb.png")
+	f, err := os.Create(cover)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, image.NewRGBA(image.Rect(0, 0, 16, 16))))
+	require.NoError(t, f.Close())
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected []string
+	}{
+		{
+			name: "video and audio codecs",
+			opts: []Option{WithVideoCodec("libx265"), WithAudioCodec("libopus")},
+			expected: []string{
+				"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", "input.ts",
+				"-c:v", "libx265", "-c:a", "libopus", "output.mkv",
+			},
+		},
+		{
+			name: "video codec only",
+			opts: []Option{WithVideoCodec("libx265")},
+			expected: []string{
+				"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", "input.ts",
+				"-c:v", "libx265", "-c:a", "copy", "output.mkv",
+			},
+		},
+		{
+			name: "cover art",
+			opts: []Option{WithVideoCodec("libx265"), WithCoverArt(cover)},
+			expected: []string{
+				"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", "input.ts",
+				"-i", cover, "-map", "0:v:0", "-map", "0:a?", "-map", "1:v:0",
+				"-c:v", "libx265", "-c:v:1", "png", "-disposition:v:1", "attached_pic",
+				"-c:a", "copy", "output.mkv",
+			},
+		},
+		{
+			name: "audio only with cover art",
+			opts: []Option{WithAudioOnly(), WithAudioCodec("libopus"), WithCoverArt(cover)},
+			expected: []string{
+				"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", "input.ts",
+				"-vn", "-c:a", "libopus", "output.mkv",
+			},
+		},
+		{
+			name: "audio only",
+			opts: []Option{WithAudioOnly(), WithVideoCodec("libx265"), WithAudioCodec("libopus")},
+			expected: []string{
+				"ffmpeg", "-hide_banner", "-loglevel", "error", "-y", "-i", "input.ts",
+				"-vn", "-c:a", "libopus", "output.mkv",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			o := applyOptions(tt.opts)
+
+			// Act
+			cmd := transcodeCommand(context.Background(), "output.mkv", "input.ts", o)
+
+			// Assert
+			require.True(t, o.transcoding())
+			require.Equal(t, tt.expected, cmd.Args)
+		})
+	}
+}
+
+func TestTranscodingCopy(t *testing.T) {
+	// Arrange
+	o := applyOptions([]Option{WithVideoCodec(CodecCopy), WithAudioCodec("")})
+
+	// Act
+	transcoding := o.transcoding()
+
+	// Assert
+	require.False(t, transcoding)
+}
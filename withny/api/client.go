@@ -10,24 +10,48 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Darkness4/withny-dl/notify/notifier"
+	"github.com/Darkness4/withny-dl/telemetry/metrics"
 	"github.com/Darkness4/withny-dl/utils"
+	"github.com/Darkness4/withny-dl/utils/useragent"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/singleflight"
 )
 
+// DefaultBaseURL is the default base URL of the withny API.
+const DefaultBaseURL = "https://www.withny.fun/api"
+
 const (
-	apiURL              = "https://www.withny.fun/api"
-	loginURL            = apiURL + "/auth/login"
-	refreshURL          = apiURL + "/auth/token"
-	userURL             = apiURL + "/user"
-	streamsURL          = apiURL + "/streams"
-	streamsWithRoomsURL = apiURL + "/streams/with-rooms"
-	streamPlaybackURL   = streamsURL + "/%s/playback-url"
+	// DefaultLoginFailureThreshold is the default number of consecutive login
+	// failures after which the login circuit breaker opens.
+	DefaultLoginFailureThreshold = 3
+	// DefaultCircuitOpenDuration is the default duration during which the
+	// logins are refused once the login circuit breaker is open.
+	DefaultCircuitOpenDuration = time.Hour
+	// DefaultTokenRefreshMargin is the default duration before the token
+	// expiration at which the token is refreshed.
+	DefaultTokenRefreshMargin = 5 * time.Minute
+	// DefaultMaxIdleConns is the default number of idle connections kept by
+	// the pooled transport.
+	DefaultMaxIdleConns = 100
+	// DefaultMaxIdleConnsPerHost is the default number of idle connections
+	// kept per host by the pooled transport, enough for the concurrent
+	// fragment downloads.
+	DefaultMaxIdleConnsPerHost = 16
 )
 
+// ErrCircuitOpen is returned by Login when too many consecutive logins failed.
+//
+// Logins are refused until the circuit open duration elapsed.
+var ErrCircuitOpen = errors.New("login circuit breaker is open")
+
 // ServerError is an error given by the withny server.
 type ServerError struct {
 	Status int
@@ -50,6 +74,29 @@ func (e GetPlaybackURLError) Error() string {
 	return e.Err.Error()
 }
 
+// UnsupportedStreamingMethodError is when the stream is not delivered with a supported method.
+type UnsupportedStreamingMethodError struct {
+	Method string
+}
+
+// Error returns the error message.
+func (e UnsupportedStreamingMethodError) Error() string {
+	return fmt.Sprintf("unsupported streaming method: %s", e.Method)
+}
+
+// CheckStreamingMethod returns an UnsupportedStreamingMethodError if the
+// streaming method of the stream is not supported.
+//
+// An empty streaming method is assumed to be HLS.
+func CheckStreamingMethod(stream GetStreamsResponseElement) error {
+	switch strings.ToLower(stream.StreamingMethod) {
+	case "", "hls":
+		return nil
+	default:
+		return UnsupportedStreamingMethodError{Method: stream.StreamingMethod}
+	}
+}
+
 // ErrStreamNotFound is when no stream is found when looking for the playback URL.
 var ErrStreamNotFound = errors.New("stream not found")
 
@@ -63,6 +110,29 @@ func (e UnauthorizedError) Error() string {
 	return fmt.Sprintf("unauthorized: %s", e.Body)
 }
 
+// DefaultThrottleRetryDelay is the base delay used when a throttled response
+// does not have a Retry-After header. It is multiplied by the number of
+// consecutive throttled responses.
+const DefaultThrottleRetryDelay = 30 * time.Second
+
+// MaxRetryAfter caps the delay requested by a throttled response.
+const MaxRetryAfter = 5 * time.Minute
+
+// ThrottleError is when the server responded with 429 Too Many Requests.
+type ThrottleError struct {
+	RetryAfter time.Duration
+}
+
+// Error returns the error message.
+func (e ThrottleError) Error() string {
+	return fmt.Sprintf("throttled by server, retry after %s", e.RetryAfter)
+}
+
+// RetryDelay returns the delay before the next try.
+func (e ThrottleError) RetryDelay() time.Duration {
+	return e.RetryAfter
+}
+
 // Claims is the JWT claims for the withny API.
 type Claims struct {
 	jwt.RegisteredClaims
@@ -83,6 +153,8 @@ type SavedCredentials struct {
 	Password     string `yaml:"password"     json:"password"`
 	Token        string `yaml:"token"        json:"token"`
 	RefreshToken string `yaml:"refreshToken" json:"refreshToken"`
+	ClientID     string `yaml:"clientId"     json:"clientId"`
+	ClientSecret string `yaml:"clientSecret" json:"clientSecret"`
 }
 
 // CredentialsReader is an interface for reading saved credentials.
@@ -102,29 +174,329 @@ type Client struct {
 	*http.Client
 	credentialsReader CredentialsReader
 	credentialsCache  CredentialsCache
+
+	loginURL            string
+	refreshURL          string
+	userURL             string
+	streamsWithRoomsURL string
+	streamURL           string
+	streamPlaybackURL   string
+
+	userAgents      []string
+	randomUserAgent bool
+	userAgent       string
+	userAgentMu     sync.RWMutex
+
+	extraHeaders map[string]string
+	middlewares  []func(*http.Request)
+
+	throttleCount atomic.Int64
+
+	loginFailureThreshold int
+	circuitOpenDuration   time.Duration
+	breakerMu             sync.Mutex
+	loginFailures         int
+	circuitOpenedAt       time.Time
+
+	tokenRefreshMargin time.Duration
+
+	// playbackURLGroup deduplicates the concurrent playback URL requests.
+	playbackURLGroup singleflight.Group
+}
+
+// ClientOption is an option for the Client.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	baseURL         string
+	userAgents      []string
+	randomUserAgent bool
+	extraHeaders    map[string]string
+	middlewares     []func(*http.Request)
+	transport       http.RoundTripper
+	requestLogging  bool
+
+	loginFailureThreshold int
+	circuitOpenDuration   time.Duration
+
+	tokenRefreshMargin time.Duration
+}
+
+// WithBaseURL overrides the base URL of the withny API.
+//
+// This is useful to target a staging or self-hosted instance.
+func WithBaseURL(base string) ClientOption {
+	return func(o *clientOptions) {
+		o.baseURL = base
+	}
+}
+
+// WithRandomUserAgent selects a new random user-agent on every login and token refresh.
+func WithRandomUserAgent() ClientOption {
+	return func(o *clientOptions) {
+		o.randomUserAgent = true
+	}
+}
+
+// WithUserAgentList replaces the built-in list of user-agents.
+func WithUserAgentList(uas []string) ClientOption {
+	return func(o *clientOptions) {
+		o.userAgents = uas
+	}
+}
+
+// WithExtraHeaders sets additional headers on every authenticated request.
+//
+// This is useful for reverse proxy setups.
+func WithExtraHeaders(headers map[string]string) ClientOption {
+	return func(o *clientOptions) {
+		o.extraHeaders = headers
+	}
+}
+
+// WithRequestMiddleware registers a function called on every authenticated request.
+//
+// The middlewares are applied in registration order, after the standard headers
+// are set. This is useful to inject custom headers or to log the requests.
+func WithRequestMiddleware(mw func(*http.Request)) ClientOption {
+	return func(o *clientOptions) {
+		o.middlewares = append(o.middlewares, mw)
+	}
+}
+
+// WithHTTPTransport replaces the transport of the HTTP client.
+//
+// This is useful to inject a custom TLS configuration, dialer or proxy.
+func WithHTTPTransport(rt http.RoundTripper) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = rt
+	}
+}
+
+// WithConnectionPool replaces the transport of the HTTP client with a pooled
+// transport.
+//
+// Every request issued through the Client, including the ones of the HLS
+// downloader and the Scraper, then reuses the same idle connections. It
+// overrides WithHTTPTransport.
+func WithConnectionPool(maxIdleConns, maxIdleConnsPerHost int) ClientOption {
+	return func(o *clientOptions) {
+		o.transport = NewPooledTransport(maxIdleConns, maxIdleConnsPerHost)
+	}
+}
+
+// NewPooledTransport creates a transport keeping at most maxIdleConns idle
+// connections, and at most maxIdleConnsPerHost per host.
+func NewPooledTransport(maxIdleConns, maxIdleConnsPerHost int) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = maxIdleConns
+	t.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	return t
+}
+
+// WithRequestLogging wraps the transport of the Client with a
+// LoggingRoundTripper, unless it is already one.
+//
+// The option is ignored when the global log level is not the trace level.
+func WithRequestLogging() ClientOption {
+	return func(o *clientOptions) {
+		o.requestLogging = true
+	}
+}
+
+// WithLoginCircuitBreaker configures the login circuit breaker.
+//
+// After threshold consecutive login failures, logins are refused with
+// ErrCircuitOpen for openDuration. A single login is then allowed to probe the
+// auth endpoint. A threshold of 0 disables the circuit breaker.
+func WithLoginCircuitBreaker(threshold int, openDuration time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.loginFailureThreshold = threshold
+		o.circuitOpenDuration = openDuration
+	}
+}
+
+// WithTokenRefreshMargin sets how long before its expiration the token is
+// refreshed by LoginLoop.
+func WithTokenRefreshMargin(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.tokenRefreshMargin = d
+	}
+}
+
+func applyClientOptions(opts []ClientOption) *clientOptions {
+	o := &clientOptions{
+		baseURL:               DefaultBaseURL,
+		userAgents:            useragent.List(),
+		loginFailureThreshold: DefaultLoginFailureThreshold,
+		circuitOpenDuration:   DefaultCircuitOpenDuration,
+		tokenRefreshMargin:    DefaultTokenRefreshMargin,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
 }
 
 // SetCredentials sets the credentials for the client.
 func (c *Client) SetCredentials(creds Credentials) {
 	err := c.credentialsCache.Set(creds)
 	if err != nil {
-		log.Err(err).Msg("failed to cache credentials")
+		logger().Err(err).Msg("failed to cache credentials")
 	}
 }
 
 // NewClient creates a new withny API client.
-func NewClient(client *http.Client, reader CredentialsReader, cache CredentialsCache) *Client {
+func NewClient(
+	client *http.Client,
+	reader CredentialsReader,
+	cache CredentialsCache,
+	opts ...ClientOption,
+) *Client {
 	if reader == nil {
-		log.Warn().Msg("no user and password provided")
+		logger().Warn().Msg("no user and password provided")
 	}
 	if cache == nil {
-		log.Panic().Msg("no credentials cache provided")
+		logger().Panic().Msg("no credentials cache provided")
+	}
+	o := applyClientOptions(opts)
+	base := strings.TrimSuffix(o.baseURL, "/")
+	var userAgent string
+	if o.randomUserAgent {
+		userAgent = useragent.RandomFromList(o.userAgents)
+	}
+	if o.transport != nil {
+		// Copy the client to avoid mutating a client shared with other callers.
+		c := *client
+		c.Transport = o.transport
+		client = &c
+	}
+	if o.requestLogging && zerolog.GlobalLevel() == zerolog.TraceLevel {
+		if _, ok := client.Transport.(*LoggingRoundTripper); !ok {
+			c := *client
+			c.Transport = NewLoggingRoundTripper(c.Transport)
+			client = &c
+		}
 	}
 	return &Client{
-		Client:            client,
-		credentialsReader: reader,
-		credentialsCache:  cache,
+		Client:              client,
+		credentialsReader:   reader,
+		credentialsCache:    cache,
+		loginURL:            base + "/auth/login",
+		refreshURL:          base + "/auth/token",
+		userURL:             base + "/user",
+		streamsWithRoomsURL: base + "/streams/with-rooms",
+		streamURL:           base + "/streams/%s",
+		streamPlaybackURL:   base + "/streams/%s/playback-url",
+		userAgents:          o.userAgents,
+		randomUserAgent:     o.randomUserAgent,
+		userAgent:           userAgent,
+		extraHeaders:        o.extraHeaders,
+		middlewares:         o.middlewares,
+
+		loginFailureThreshold: o.loginFailureThreshold,
+		circuitOpenDuration:   o.circuitOpenDuration,
+
+		tokenRefreshMargin: o.tokenRefreshMargin,
+	}
+}
+
+// UserAgent returns the user-agent currently used by the client.
+func (c *Client) UserAgent() string {
+	c.userAgentMu.RLock()
+	defer c.userAgentMu.RUnlock()
+	return c.userAgent
+}
+
+// rotateUserAgent selects a new random user-agent if enabled.
+func (c *Client) rotateUserAgent() {
+	if !c.randomUserAgent {
+		return
+	}
+	c.userAgentMu.Lock()
+	defer c.userAgentMu.Unlock()
+	c.userAgent = useragent.RandomFromList(c.userAgents)
+}
+
+func (c *Client) setUserAgent(req *http.Request) {
+	if ua := c.UserAgent(); ua != "" {
+		req.Header.Set("User-Agent", ua)
+	}
+}
+
+// checkThrottle returns a ThrottleError if the response is a 429 Too Many Requests.
+func (c *Client) checkThrottle(res *http.Response) error {
+	if res.StatusCode != http.StatusTooManyRequests {
+		c.throttleCount.Store(0)
+		return nil
+	}
+	count := c.throttleCount.Add(1)
+	retryAfter := parseRetryAfter(res.Header.Get("Retry-After"))
+	if retryAfter <= 0 {
+		retryAfter = DefaultThrottleRetryDelay * time.Duration(count)
+	}
+	retryAfter = min(retryAfter, MaxRetryAfter)
+	logger().Warn().
+		Str("url", res.Request.URL.String()).
+		Stringer("retryAfter", retryAfter).
+		Int64("count", count).
+		Msg("throttled by server")
+	return ThrottleError{RetryAfter: retryAfter}
+}
+
+// statusErrorFunc returns the error of a response which is not a 200 OK, or
+// nil to fall back to the errors of handleHTTPError.
+type statusErrorFunc func(status int, body []byte) error
+
+// handleHTTPError returns an error if the response is not a 200 OK.
+//
+// A 429 Too Many Requests returns a ThrottleError, so that the caller retries
+// after the delay requested by the server. Otherwise, statusErr, if not nil,
+// can return a specific error. A 5xx returns a ServerError.
+func (c *Client) handleHTTPError(
+	res *http.Response,
+	log *zerolog.Logger,
+	statusErr statusErrorFunc,
+) error {
+	if err := c.checkThrottle(res); err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+	body, _ := io.ReadAll(res.Body)
+	if statusErr != nil {
+		if err := statusErr(res.StatusCode, body); err != nil {
+			return err
+		}
+	}
+	err := fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	log.Err(err).
+		Str("response", string(body)).
+		Int("status", res.StatusCode).
+		Msg("unexpected status code")
+	if res.StatusCode >= http.StatusInternalServerError {
+		return ServerError{
+			Status: res.StatusCode,
+			Body:   string(body),
+		}
+	}
+	return err
+}
+
+// parseRetryAfter parses a Retry-After header, either in seconds or as an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
 	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
 }
 
 // NewAuthRequestWithContext creates a new authenticated request with the given context.
@@ -135,35 +507,52 @@ func (c *Client) NewAuthRequestWithContext(
 ) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		log.Err(err).Msg("failed to create request")
+		logger().Err(err).Msg("failed to create request")
 		return nil, err
 	}
 	creds, err := c.credentialsCache.Get()
 	if err != nil {
-		log.Err(err).Msg("failed to get credentials")
+		logger().Err(err).Msg("failed to get credentials")
 	}
 	if creds.TokenType != "" {
 		req.Header.Set("Authorization", creds.TokenType+" "+creds.Token)
 	}
+	c.setUserAgent(req)
+	for k, v := range c.extraHeaders {
+		req.Header.Set(k, v)
+	}
+	for _, mw := range c.middlewares {
+		mw(req)
+	}
 	return req, nil
 }
 
 // Login will login to withny and store the credentials in the client.
+//
+// It returns ErrCircuitOpen if the login circuit breaker is open.
 func (c *Client) Login(ctx context.Context) (err error) {
+	if err := c.allowLogin(); err != nil {
+		return err
+	}
+	defer func() {
+		err = c.recordLogin(err)
+	}()
+	c.rotateUserAgent()
+
 	var creds Credentials
 	cachedCreds, err := c.credentialsCache.Get()
 	if err != nil {
-		log.Err(err).Msg("failed to get credentials")
+		logger().Err(err).Msg("failed to get credentials")
 	}
 
 	switch {
 	case cachedCreds.Token != "":
 		creds, err = c.LoginWithRefreshToken(ctx, cachedCreds.RefreshToken)
 		if err != nil {
-			log.Err(err).Msg("failed to refresh token from cache, will use provided credentials")
+			logger().Err(err).Msg("failed to refresh token from cache, will use provided credentials")
 			err = c.credentialsCache.Invalidate()
 			if err != nil {
-				log.Err(err).Msg("failed to invalidate cache")
+				logger().Err(err).Msg("failed to invalidate cache")
 			}
 			creds, err = c.loginWithReader(ctx)
 		}
@@ -171,23 +560,67 @@ func (c *Client) Login(ctx context.Context) (err error) {
 		creds, err = c.loginWithReader(ctx)
 	}
 	if err != nil {
-		log.Err(err).Msg("failed to login")
+		logger().Err(err).Msg("failed to login")
 		return err
 	}
 
 	if err := c.credentialsCache.Set(creds); err != nil {
-		log.Err(err).Msg("failed to cache credentials")
+		logger().Err(err).Msg("failed to cache credentials")
+	}
+	return nil
+}
+
+// allowLogin returns ErrCircuitOpen if the login circuit breaker is open.
+//
+// Once the open duration elapsed, a single login is allowed (half-open state).
+func (c *Client) allowLogin() error {
+	c.breakerMu.Lock()
+	defer c.breakerMu.Unlock()
+	if c.loginFailureThreshold <= 0 || c.loginFailures < c.loginFailureThreshold {
+		return nil
 	}
+	if time.Since(c.circuitOpenedAt) < c.circuitOpenDuration {
+		return ErrCircuitOpen
+	}
+	// Half-open: refuse the other logins while probing.
+	c.circuitOpenedAt = time.Now()
 	return nil
 }
 
+// recordLogin counts the consecutive login failures and opens the circuit
+// breaker once the threshold is reached.
+func (c *Client) recordLogin(err error) error {
+	c.breakerMu.Lock()
+	defer c.breakerMu.Unlock()
+	if err == nil {
+		c.loginFailures = 0
+		return nil
+	}
+	c.loginFailures++
+	if c.loginFailureThreshold <= 0 || c.loginFailures < c.loginFailureThreshold {
+		return err
+	}
+	c.circuitOpenedAt = time.Now()
+	logger().Error().
+		Int("failures", c.loginFailures).
+		Stringer("openDuration", c.circuitOpenDuration).
+		Msg("too many login failures, opening the login circuit breaker")
+	return fmt.Errorf("%w: %w", ErrCircuitOpen, err)
+}
+
+// CircuitOpenDuration returns the duration during which the logins are refused
+// once the login circuit breaker is open.
+func (c *Client) CircuitOpenDuration() time.Duration {
+	return c.circuitOpenDuration
+}
+
 func (c *Client) loginWithReader(ctx context.Context) (Credentials, error) {
 	if c.credentialsReader == nil {
 		return Credentials{}, fmt.Errorf("no credentials provided")
 	}
 	creds, err := c.credentialsReader.Read()
 	if err != nil {
-		log.Err(err).Msg("failed to read credentials")
+		logger().Err(err).Msg("failed to read credentials")
 		return Credentials{}, err
 	}
 	if creds.Username != "" {
@@ -203,16 +636,18 @@ func (c *Client) loginWithReader(ctx context.Context) (Credentials, error) {
 		}
 		err := c.credentialsCache.Set(newCredentials)
 		if err != nil {
-			log.Err(err).Msg("failed to cache credentials")
+			logger().Err(err).Msg("failed to cache credentials")
 		}
 		return c.LoginWithRefreshToken(ctx, creds.RefreshToken)
+	} else if creds.ClientID != "" && creds.ClientSecret != "" {
+		return c.LoginWithClientCredentials(ctx, creds.ClientID, creds.ClientSecret)
 	}
 	return Credentials{}, fmt.Errorf("no credentials provided")
 }
 
 // GetUser will fetch the user for the given channelID.
 func (c *Client) GetUser(ctx context.Context, channelID string) (GetUserResponse, error) {
-	u, err := url.Parse(userURL)
+	u, err := url.Parse(c.userURL)
 	if err != nil {
 		panic(err)
 	}
@@ -227,11 +662,11 @@ func (c *Client) GetUser(ctx context.Context, channelID string) (GetUserResponse
 		nil,
 	)
 	if err != nil {
-		log.Err(err).Msg("failed to create request")
+		logger().Err(err).Msg("failed to create request")
 		return GetUserResponse{}, err
 	}
 
-	log := log.With().
+	log := logger().With().
 		Str("method", "GET").
 		Stringer("url", u).
 		Str("channelID", channelID).
@@ -244,19 +679,7 @@ func (c *Client) GetUser(ctx context.Context, channelID string) (GetUserResponse
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		err := fmt.Errorf("unexpected status code: %d", res.StatusCode)
-		body, _ := io.ReadAll(res.Body)
-		log.Err(err).
-			Str("response", string(body)).
-			Int("status", res.StatusCode).
-			Msg("unexpected status code")
-		if res.StatusCode >= http.StatusInternalServerError {
-			return GetUserResponse{}, ServerError{
-				Status: res.StatusCode,
-				Body:   string(body),
-			}
-		}
+	if err := c.handleHTTPError(res, &log, nil); err != nil {
 		return GetUserResponse{}, err
 	}
 
@@ -267,7 +690,7 @@ func (c *Client) GetUser(ctx context.Context, channelID string) (GetUserResponse
 
 // GetStreams will fetch the streams for the given channelID.
 func (c *Client) GetStreams(ctx context.Context, channelID string) (GetStreamsResponse, error) {
-	u, err := url.Parse(streamsWithRoomsURL)
+	u, err := url.Parse(c.streamsWithRoomsURL)
 	if err != nil {
 		panic(err)
 	}
@@ -284,11 +707,11 @@ func (c *Client) GetStreams(ctx context.Context, channelID string) (GetStreamsRe
 		nil,
 	)
 	if err != nil {
-		log.Err(err).Msg("failed to create request")
+		logger().Err(err).Msg("failed to create request")
 		return GetStreamsResponse{}, err
 	}
 
-	log := log.With().
+	log := logger().With().
 		Str("method", "GET").
 		Stringer("url", u).
 		Str("channelID", channelID).
@@ -301,19 +724,7 @@ func (c *Client) GetStreams(ctx context.Context, channelID string) (GetStreamsRe
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(res.Body)
-		err := fmt.Errorf("unexpected status code: %d", res.StatusCode)
-		log.Err(err).
-			Str("response", string(body)).
-			Int("status", res.StatusCode).
-			Msg("unexpected status code")
-		if res.StatusCode >= http.StatusInternalServerError {
-			return GetStreamsResponse{}, ServerError{
-				Status: res.StatusCode,
-				Body:   string(body),
-			}
-		}
+	if err := c.handleHTTPError(res, &log, nil); err != nil {
 		return GetStreamsResponse{}, err
 	}
 
@@ -327,7 +738,7 @@ func (c *Client) LoginWithRefreshToken(
 	ctx context.Context,
 	refreshToken string,
 ) (Credentials, error) {
-	log.Info().Msg("refreshing token")
+	logger().Info().Msg("refreshing token")
 	buf := new(bytes.Buffer)
 	if err := json.NewEncoder(buf).Encode(map[string]string{
 		"refreshToken": refreshToken,
@@ -338,7 +749,7 @@ func (c *Client) LoginWithRefreshToken(
 	req, err := c.NewAuthRequestWithContext(
 		ctx,
 		http.MethodPost,
-		refreshURL,
+		c.refreshURL,
 		buf,
 	)
 	if err != nil {
@@ -346,9 +757,9 @@ func (c *Client) LoginWithRefreshToken(
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	log := log.With().
+	log := logger().With().
 		Str("method", "POST").
-		Str("url", refreshURL).
+		Str("url", c.refreshURL).
 		Logger()
 
 	res, err := c.Do(req)
@@ -358,27 +769,16 @@ func (c *Client) LoginWithRefreshToken(
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(res.Body)
-		if res.StatusCode == http.StatusUnauthorized {
-			log.Err(err).
+	if err := c.handleHTTPError(res, &log, func(status int, body []byte) error {
+		if status == http.StatusUnauthorized {
+			log.Error().
 				Str("response", string(body)).
-				Int("status", res.StatusCode).
+				Int("status", status).
 				Str("refreshToken", refreshToken).
 				Msg("unexpected status code (refresh token is already used?)")
 		}
-		err := fmt.Errorf("unexpected status code: %d", res.StatusCode)
-		log.Err(err).
-			Str("response", string(body)).
-			Int("status", res.StatusCode).
-			Str("refreshToken", refreshToken).
-			Msg("unexpected status code")
-		if res.StatusCode >= http.StatusInternalServerError {
-			return Credentials{}, ServerError{
-				Status: res.StatusCode,
-				Body:   string(body),
-			}
-		}
+		return nil
+	}); err != nil {
 		return Credentials{}, err
 	}
 
@@ -390,12 +790,80 @@ func (c *Client) LoginWithRefreshToken(
 	return lr, err
 }
 
+// LoginWithClientCredentials will login with the OAuth2 client credentials grant.
+func (c *Client) LoginWithClientCredentials(
+	ctx context.Context,
+	clientID, clientSecret string,
+) (Credentials, error) {
+	logger().Info().Str("clientID", clientID).Msg("logging in with client credentials")
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", clientID)
+	form.Set("client_secret", clientSecret)
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		c.refreshURL,
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		panic(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	c.setUserAgent(req)
+
+	log := logger().With().
+		Str("method", "POST").
+		Str("url", c.refreshURL).
+		Logger()
+
+	res, err := c.Do(req)
+	if err != nil {
+		log.Err(err).Msg("failed to login with client credentials")
+		return Credentials{}, err
+	}
+	defer res.Body.Close()
+
+	if err := c.handleHTTPError(res, &log, func(status int, body []byte) error {
+		if status == http.StatusUnauthorized {
+			return UnauthorizedError{Body: string(body)}
+		}
+		return nil
+	}); err != nil {
+		return Credentials{}, err
+	}
+
+	var tr struct {
+		AccessToken  string `json:"access_token"`
+		TokenType    string `json:"token_type"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := utils.JSONDecodeAndPrintOnError(res.Body, &tr); err != nil {
+		return Credentials{}, err
+	}
+	tokenType := tr.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+	lr := Credentials{
+		LoginResponse: LoginResponse{
+			Token:        tr.AccessToken,
+			RefreshToken: tr.RefreshToken,
+			TokenType:    tokenType,
+		},
+	}
+	_, _, err = jwt.NewParser().ParseUnverified(lr.Token, &lr.Claims)
+	return lr, err
+}
+
 // LoginWithUserPassword will login with the given email and password.
 func (c *Client) LoginWithUserPassword(
 	ctx context.Context,
 	username, password string,
 ) (Credentials, error) {
-	log.Info().Str("username", username).Msg("logging in")
+	logger().Info().Str("username", username).Msg("logging in")
 	buf := new(bytes.Buffer)
 	if err := json.NewEncoder(buf).Encode(map[string]string{
 		"email":    username, // email can also be the username
@@ -407,17 +875,18 @@ func (c *Client) LoginWithUserPassword(
 	req, err := http.NewRequestWithContext(
 		ctx,
 		http.MethodPost,
-		loginURL,
+		c.loginURL,
 		buf,
 	)
 	if err != nil {
 		panic(err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	c.setUserAgent(req)
 
-	log := log.With().
+	log := logger().With().
 		Str("method", "POST").
-		Str("url", loginURL).
+		Str("url", c.loginURL).
 		Logger()
 
 	res, err := c.Do(req)
@@ -427,19 +896,7 @@ func (c *Client) LoginWithUserPassword(
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(res.Body)
-		err := fmt.Errorf("unexpected status code: %d", res.StatusCode)
-		log.Err(err).
-			Str("response", string(body)).
-			Int("status", res.StatusCode).
-			Msg("unexpected status code")
-		if res.StatusCode >= http.StatusInternalServerError {
-			return Credentials{}, ServerError{
-				Status: res.StatusCode,
-				Body:   string(body),
-			}
-		}
+	if err := c.handleHTTPError(res, &log, nil); err != nil {
 		return Credentials{}, err
 	}
 
@@ -451,9 +908,50 @@ func (c *Client) LoginWithUserPassword(
 	return lr, err
 }
 
+// GetStreamByUUID will fetch the stream with the given UUID.
+//
+// The API has no endpoint returning a single stream, so the stream is looked
+// up in all the streams. It returns ErrStreamNotFound if no stream matches.
+func (c *Client) GetStreamByUUID(ctx context.Context, uuid string) (GetStreamsResponseElement, error) {
+	streams, err := c.GetStreams(ctx, "")
+	if err != nil {
+		return GetStreamsResponseElement{}, err
+	}
+	for _, stream := range streams {
+		if stream.UUID == uuid {
+			return stream, nil
+		}
+	}
+	return GetStreamsResponseElement{}, ErrStreamNotFound
+}
+
+// playbackURLTimeout bounds the shared playback URL request, which does not
+// depend on the context of any caller.
+const playbackURLTimeout = time.Minute
+
 // GetStreamPlaybackURL will fetch the playback URL for the given streamID.
+//
+// Concurrent calls for the same stream share a single request. The request is
+// not canceled by the callers, each caller stops waiting when its ctx is done.
 func (c *Client) GetStreamPlaybackURL(ctx context.Context, streamID string) (string, error) {
-	u, err := url.Parse(fmt.Sprintf(streamPlaybackURL, streamID))
+	ch := c.playbackURLGroup.DoChan(streamID, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), playbackURLTimeout)
+		defer cancel()
+		return c.getStreamPlaybackURL(ctx, streamID)
+	})
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	}
+}
+
+func (c *Client) getStreamPlaybackURL(ctx context.Context, streamID string) (string, error) {
+	u, err := url.Parse(fmt.Sprintf(c.streamPlaybackURL, streamID))
 	if err != nil {
 		panic(err)
 	}
@@ -464,12 +962,12 @@ func (c *Client) GetStreamPlaybackURL(ctx context.Context, streamID string) (str
 		nil,
 	)
 	if err != nil {
-		log.Err(err).Msg("failed to create request")
+		logger().Err(err).Msg("failed to create request")
 		return "", err
 	}
 	req.Header.Set("Accept", "application/json")
 
-	log := log.With().
+	log := logger().With().
 		Str("method", "GET").
 		Stringer("url", u).
 		Str("streamID", streamID).
@@ -482,32 +980,26 @@ func (c *Client) GetStreamPlaybackURL(ctx context.Context, streamID string) (str
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(res.Body)
-		if res.StatusCode == http.StatusUnauthorized {
-			return "", GetPlaybackURLError{
+	if err := c.handleHTTPError(res, &log, func(status int, body []byte) error {
+		switch status {
+		case http.StatusUnauthorized:
+			return GetPlaybackURLError{
 				Err:      UnauthorizedError{Body: string(body)},
 				StreamID: streamID,
 			}
-		} else if res.StatusCode == http.StatusInternalServerError {
+		case http.StatusInternalServerError:
 			var errMsg ErrorResponse
 			_ = json.Unmarshal(body, &errMsg)
 			if errMsg.Message == "Stream not found" {
 				// Is a json message.
-				return "", GetPlaybackURLError{
+				return GetPlaybackURLError{
 					Err:      ErrStreamNotFound,
 					StreamID: streamID,
 				}
 			}
 		}
-		err := fmt.Errorf("unexpected status code: %d", res.StatusCode)
-		log.Err(err).
-			Str("response", string(body)).
-			Int("status", res.StatusCode).
-			Msg("unexpected status code")
-		if res.StatusCode >= http.StatusInternalServerError {
-			return "", ServerError{Status: res.StatusCode, Body: string(body)}
-		}
+		return nil
+	}); err != nil {
 		return "", err
 	}
 
@@ -521,6 +1013,68 @@ func (c *Client) GetStreamPlaybackURL(ctx context.Context, streamID string) (str
 	return parsed, nil
 }
 
+// GetStreamStatus will fetch the status of the given streamID.
+//
+// Unlike GetStreamPlaybackURL, it does not fetch the playback URL. An unknown
+// stream is reported as not live.
+func (c *Client) GetStreamStatus(ctx context.Context, streamID string) (StreamStatus, error) {
+	u, err := url.Parse(fmt.Sprintf(c.streamURL, streamID))
+	if err != nil {
+		panic(err)
+	}
+	req, err := c.NewAuthRequestWithContext(
+		ctx,
+		http.MethodGet,
+		u.String(),
+		nil,
+	)
+	if err != nil {
+		logger().Err(err).Msg("failed to create request")
+		return StreamStatus{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	log := logger().With().
+		Str("method", "GET").
+		Stringer("url", u).
+		Str("streamID", streamID).
+		Logger()
+
+	res, err := c.Do(req)
+	if err != nil {
+		log.Err(err).Msg("failed to get stream status")
+		return StreamStatus{}, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return StreamStatus{}, nil
+	case http.StatusInternalServerError:
+		body, _ := io.ReadAll(res.Body)
+		var errMsg ErrorResponse
+		_ = json.Unmarshal(body, &errMsg)
+		if errMsg.Message == "Stream not found" {
+			return StreamStatus{}, nil
+		}
+		log.Error().
+			Str("response", string(body)).
+			Int("status", res.StatusCode).
+			Msg("unexpected status code")
+		return StreamStatus{}, ServerError{Status: res.StatusCode, Body: string(body)}
+	}
+
+	if err := c.handleHTTPError(res, &log, nil); err != nil {
+		return StreamStatus{}, err
+	}
+
+	var parsed GetStreamResponse
+	if err := utils.JSONDecodeAndPrintOnError(res.Body, &parsed); err != nil {
+		return StreamStatus{}, err
+	}
+	return parsed.Status(), nil
+}
+
 // GetPlaylists will fetch the playlists from the given playbackURL.
 func (c *Client) GetPlaylists(ctx context.Context, playbackURL string) ([]Playlist, error) {
 	req, err := http.NewRequestWithContext(
@@ -530,7 +1084,7 @@ func (c *Client) GetPlaylists(ctx context.Context, playbackURL string) ([]Playli
 		nil,
 	)
 	if err != nil {
-		log.Err(err).Msg("failed to create request")
+		logger().Err(err).Msg("failed to create request")
 		return nil, err
 	}
 	req.Header.Set(
@@ -539,8 +1093,9 @@ func (c *Client) GetPlaylists(ctx context.Context, playbackURL string) ([]Playli
 	)
 	req.Header.Set("Referer", "https://www.withny.fun/")
 	req.Header.Set("Origin", "https://www.withny.fun")
+	c.setUserAgent(req)
 
-	log := log.With().
+	log := logger().With().
 		Str("method", "GET").
 		Str("url", playbackURL).
 		Logger()
@@ -552,72 +1107,97 @@ func (c *Client) GetPlaylists(ctx context.Context, playbackURL string) ([]Playli
 	}
 	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(res.Body)
-		err := fmt.Errorf("unexpected status code: %d", res.StatusCode)
-		log.Err(err).
-			Str("response", string(body)).
-			Int("status", res.StatusCode).
-			Msg("unexpected status code")
-		if res.StatusCode >= http.StatusInternalServerError {
-			return nil, ServerError{
-				Status: res.StatusCode,
-				Body:   string(body),
-			}
-		}
+	if err := c.handleHTTPError(res, &log, nil); err != nil {
+		return nil, err
+	}
+
+	playlists, err := ParseM3U8(res.Body)
+	if err != nil {
+		log.Err(err).Msg("failed to parse playlists")
+		return nil, err
+	}
+	return playlists, nil
+}
+
+// GetChannelPlaylists will fetch the playlists of the live stream of the given channelID.
+//
+// It returns ErrStreamNotFound if the channel is not streaming.
+func (c *Client) GetChannelPlaylists(ctx context.Context, channelID string) ([]Playlist, error) {
+	streams, err := c.GetStreams(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, ErrStreamNotFound
+	}
+
+	playbackURL, err := c.GetStreamPlaybackURL(ctx, streams[0].UUID)
+	if err != nil {
 		return nil, err
 	}
+	return c.GetPlaylists(ctx, playbackURL)
+}
+
+// minRefreshDelay is the minimum delay between two token refreshes.
+const minRefreshDelay = time.Second
 
-	return ParseM3U8(res.Body), nil
+// refreshDelay returns the delay before refreshing a token expiring at expiresAt.
+func (c *Client) refreshDelay(expiresAt time.Time) time.Duration {
+	return max(time.Until(expiresAt.Add(-c.tokenRefreshMargin)), minRefreshDelay)
 }
 
 // LoginLoop will login to withny and refresh the token when needed.
+//
+// The token is refreshed before its expiration, see WithTokenRefreshMargin.
+//
+// It returns ErrCircuitOpen when the login circuit breaker opens.
 func (c *Client) LoginLoop(ctx context.Context) error {
 	if err := c.Login(ctx); err != nil {
-		log.Err(err).Msg("failed to login to withny")
+		logger().Err(err).Msg("failed to login to withny")
 		return err
 	}
 
 	creds, err := c.credentialsCache.Get()
 	if err != nil {
-		log.Err(err).Msg("failed to get credentials")
+		logger().Err(err).Msg("failed to get credentials")
 	}
 	date, err := creds.GetExpirationTime()
 	if err != nil {
 		panic(err)
 	}
 
-	// Refresh token 5 minutes before it expires
-	refreshTime := date.Add(-5 * time.Minute)
-
-	ticker := time.NewTicker(time.Until(refreshTime))
+	ticker := time.NewTicker(c.refreshDelay(date.Time))
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Err(ctx.Err()).Msg("context canceled, stopping login loop")
+			logger().Err(ctx.Err()).Msg("context canceled, stopping login loop")
 			return ctx.Err()
 		case <-ticker.C:
 			if err := c.Login(ctx); err != nil {
+				metrics.Auth.LoginFailures.Add(ctx, 1)
+				if errors.Is(err, ErrCircuitOpen) {
+					logger().Err(err).Msg("stopping login loop")
+					return err
+				}
 				if err := notifier.NotifyLoginFailed(ctx, err); err != nil {
-					log.Err(err).Msg("notify failed")
+					logger().Err(err).Msg("notify failed")
 				}
-				log.Err(err).
+				logger().Err(err).
 					Msg("failed to login to withny, we will try again in 5 minutes")
 				ticker.Reset(5 * time.Minute)
 				continue
 			}
 			creds, err := c.credentialsCache.Get()
 			if err != nil {
-				log.Err(err).Msg("failed to get credentials")
+				logger().Err(err).Msg("failed to get credentials")
 			}
 			date, err := creds.GetExpirationTime()
 			if err != nil {
 				panic(err)
 			}
-			refreshTime = date.Add(-5 * time.Minute)
-			ticker.Reset(time.Until(refreshTime))
+			ticker.Reset(c.refreshDelay(date.Time))
 		}
 	}
 }
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// ClientPool distributes requests over multiple clients in a round-robin fashion.
+//
+// Each client should use a different credentials pair so that the requests
+// are not serialized through the same account.
+type ClientPool struct {
+	clients []*Client
+	next    atomic.Uint64
+}
+
+// NewClientPool creates a new client pool.
+func NewClientPool(clients ...*Client) *ClientPool {
+	if len(clients) == 0 {
+		panic("client pool must contain at least one client")
+	}
+	return &ClientPool{
+		clients: clients,
+	}
+}
+
+// Next returns the next client of the pool.
+func (p *ClientPool) Next() *Client {
+	i := p.next.Add(1) - 1
+	return p.clients[i%uint64(len(p.clients))]
+}
+
+// Clients returns the clients of the pool.
+func (p *ClientPool) Clients() []*Client {
+	return p.clients
+}
+
+// Len returns the number of clients in the pool.
+func (p *ClientPool) Len() int {
+	return len(p.clients)
+}
+
+// GetUser will fetch the user for the given channelID using the next client.
+func (p *ClientPool) GetUser(ctx context.Context, channelID string) (GetUserResponse, error) {
+	return p.Next().GetUser(ctx, channelID)
+}
+
+// GetStreams will fetch the streams for the given channelID using the next client.
+func (p *ClientPool) GetStreams(ctx context.Context, channelID string) (GetStreamsResponse, error) {
+	return p.Next().GetStreams(ctx, channelID)
+}
+
+// GetStreamByUUID will fetch the stream with the given UUID using the next client.
+func (p *ClientPool) GetStreamByUUID(ctx context.Context, uuid string) (GetStreamsResponseElement, error) {
+	return p.Next().GetStreamByUUID(ctx, uuid)
+}
+
+// GetStreamPlaybackURL will fetch the playback URL for the given streamID using the next client.
+func (p *ClientPool) GetStreamPlaybackURL(ctx context.Context, streamID string) (string, error) {
+	return p.Next().GetStreamPlaybackURL(ctx, streamID)
+}
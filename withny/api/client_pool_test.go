@@ -0,0 +1,21 @@
+package api_test
+
+import (
+	"testing"
+
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPoolNext(t *testing.T) {
+	// Arrange
+	a := api.NewClient(nil, nil, &memoryCache{})
+	b := api.NewClient(nil, nil, &memoryCache{})
+	pool := api.NewClientPool(a, b)
+
+	// Act
+	got := []*api.Client{pool.Next(), pool.Next(), pool.Next()}
+
+	// Assert
+	require.Equal(t, []*api.Client{a, b, a}, got)
+}
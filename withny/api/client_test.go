@@ -0,0 +1,931 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/utils/try"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryCache struct {
+	creds *api.Credentials
+}
+
+func (c *memoryCache) Set(creds api.Credentials) error {
+	c.creds = &creds
+	return nil
+}
+
+func (c *memoryCache) Get() (api.Credentials, error) {
+	if c.creds == nil {
+		return api.Credentials{}, errors.New("no credentials")
+	}
+	return *c.creds, nil
+}
+
+func (c *memoryCache) Invalidate() error {
+	c.creds = nil
+	return nil
+}
+
+func TestClientWithBaseURL(t *testing.T) {
+	// Arrange
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/user":
+			_, _ = w.Write([]byte(`{"username": "test"}`))
+		case "/api/streams/with-rooms":
+			_, _ = w.Write([]byte(`[{"uuid": "stream"}]`))
+		case "/api/streams/stream/playback-url":
+			_, _ = w.Write([]byte(`"https://example.com/playlist.m3u8"`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+
+	// Act
+	user, errUser := client.GetUser(context.Background(), "test")
+	streams, errStreams := client.GetStreams(context.Background(), "")
+	playbackURL, errPlayback := client.GetStreamPlaybackURL(context.Background(), "stream")
+
+	// Assert
+	require.NoError(t, errUser)
+	require.Equal(t, "test", user.Username)
+	require.NoError(t, errStreams)
+	require.Len(t, streams, 1)
+	require.Equal(t, "stream", streams[0].UUID)
+	require.NoError(t, errPlayback)
+	require.Equal(t, "https://example.com/playlist.m3u8", playbackURL)
+	require.Equal(
+		t,
+		[]string{"/api/user", "/api/streams/with-rooms", "/api/streams/stream/playback-url"},
+		paths,
+	)
+}
+
+func TestGetStreamPlaybackURLDeduplicated(t *testing.T) {
+	// Arrange
+	var requests atomic.Int64
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		received <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte(`"https://example.com/playlist.m3u8"`))
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL),
+	)
+
+	// Act
+	var wg sync.WaitGroup
+	urls := make([]string, 10)
+	errs := make([]error, 10)
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			urls[i], errs[i] = client.GetStreamPlaybackURL(context.Background(), "stream")
+		}()
+	}
+	<-received
+	// Let the other callers join the in-flight request.
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// Assert
+	require.EqualValues(t, 1, requests.Load())
+	for i := range 10 {
+		require.NoError(t, errs[i])
+		require.Equal(t, "https://example.com/playlist.m3u8", urls[i])
+	}
+}
+
+func TestGetStreamPlaybackURLFirstCallerCanceled(t *testing.T) {
+	// Arrange
+	received := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte(`"https://example.com/playlist.m3u8"`))
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL),
+	)
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := client.GetStreamPlaybackURL(firstCtx, "stream")
+		firstErr <- err
+	}()
+	<-received
+	type result struct {
+		url string
+		err error
+	}
+	second := make(chan result, 1)
+	go func() {
+		url, err := client.GetStreamPlaybackURL(context.Background(), "stream")
+		second <- result{url, err}
+	}()
+	// Let the second caller join the in-flight request.
+	time.Sleep(100 * time.Millisecond)
+
+	// Act
+	cancelFirst()
+	err := <-firstErr
+	close(release)
+	res := <-second
+
+	// Assert
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoError(t, res.err)
+	require.Equal(t, "https://example.com/playlist.m3u8", res.url)
+}
+
+func TestClientWithUserAgentList(t *testing.T) {
+	// Arrange
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		_, _ = w.Write([]byte(`{"username": "test"}`))
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL),
+		api.WithUserAgentList([]string{"custom-agent"}),
+		api.WithRandomUserAgent(),
+	)
+
+	// Act
+	_, err := client.GetUser(context.Background(), "test")
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, "custom-agent", client.UserAgent())
+	require.Equal(t, "custom-agent", userAgent)
+}
+
+func TestClientWithoutRandomUserAgent(t *testing.T) {
+	// Arrange
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.Header.Get("User-Agent")
+		_, _ = w.Write([]byte(`{"username": "test"}`))
+	}))
+	defer server.Close()
+	client := api.NewClient(server.Client(), nil, &memoryCache{}, api.WithBaseURL(server.URL))
+
+	// Act
+	_, err := client.GetUser(context.Background(), "test")
+
+	// Assert
+	require.NoError(t, err)
+	require.Empty(t, client.UserAgent())
+	require.Equal(t, "Go-http-client/1.1", userAgent, "the default user-agent must be kept")
+}
+
+func TestClientRandomUserAgentRotatesOnLogin(t *testing.T) {
+	// Arrange
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	userAgents := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth/token" {
+			_, _ = w.Write([]byte(`{"access_token": "` + token + `", "token_type": "bearer"}`))
+			return
+		}
+		userAgents <- r.Header.Get("User-Agent")
+		_, _ = w.Write([]byte(`{"username": "test"}`))
+	}))
+	defer server.Close()
+	uas := []string{"ua-0", "ua-1", "ua-2", "ua-3", "ua-4", "ua-5", "ua-6", "ua-7"}
+	client := api.NewClient(
+		server.Client(),
+		staticReader{ClientID: "id", ClientSecret: "secret"},
+		&memoryCache{},
+		api.WithBaseURL(server.URL+"/api"),
+		api.WithUserAgentList(uas),
+		api.WithRandomUserAgent(),
+	)
+	type login struct {
+		selected string
+		sent     []string
+	}
+	logins := make([]login, 0, 50)
+
+	// Act
+	for range 50 {
+		require.NoError(t, client.Login(context.Background()))
+		l := login{selected: client.UserAgent()}
+		for range 3 {
+			_, err := client.GetUser(context.Background(), "test")
+			require.NoError(t, err)
+			l.sent = append(l.sent, <-userAgents)
+		}
+		logins = append(logins, l)
+	}
+
+	// Assert
+	seen := make(map[string]bool)
+	for _, l := range logins {
+		require.Contains(t, uas, l.selected)
+		require.Equal(
+			t,
+			[]string{l.selected, l.selected, l.selected},
+			l.sent,
+			"the user-agent must not change between logins",
+		)
+		seen[l.selected] = true
+	}
+	require.Greater(t, len(seen), 1, "the user-agent must be drawn at random on login")
+}
+
+func TestClientThrottled(t *testing.T) {
+	// Arrange
+	retryAfter := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL),
+	)
+
+	// Act
+	_, errFallback1 := client.GetUser(context.Background(), "test")
+	_, errFallback2 := client.GetStreams(context.Background(), "test")
+	retryAfter = "12"
+	_, errHeader := client.GetUser(context.Background(), "test")
+
+	// Assert
+	var throttleErr api.ThrottleError
+	require.ErrorAs(t, errFallback1, &throttleErr)
+	require.Equal(t, api.DefaultThrottleRetryDelay, throttleErr.RetryAfter)
+	require.ErrorAs(t, errFallback2, &throttleErr)
+	require.Equal(t, 2*api.DefaultThrottleRetryDelay, throttleErr.RetryAfter)
+	require.ErrorAs(t, errHeader, &throttleErr)
+	require.Equal(t, 12*time.Second, throttleErr.RetryAfter)
+}
+
+func TestClientThrottledRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		expected   time.Duration
+	}{
+		{
+			name:       "seconds",
+			retryAfter: "42",
+			expected:   42 * time.Second,
+		},
+		{
+			name:       "capped",
+			retryAfter: "3600",
+			expected:   api.MaxRetryAfter,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", tt.retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+			}))
+			defer server.Close()
+			client := api.NewClient(
+				server.Client(),
+				nil,
+				&memoryCache{},
+				api.WithBaseURL(server.URL),
+			)
+
+			// Act
+			_, errUser := client.GetUser(context.Background(), "test")
+			_, errStreams := client.GetStreams(context.Background(), "test")
+
+			// Assert
+			var delayer try.RetryDelayer
+			require.ErrorAs(t, errUser, &delayer)
+			require.Equal(t, tt.expected, delayer.RetryDelay())
+			require.ErrorAs(t, errStreams, &delayer)
+			require.Equal(t, tt.expected, delayer.RetryDelay())
+		})
+	}
+}
+
+func TestClientWithExtraHeaders(t *testing.T) {
+	// Arrange
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get("X-Custom")
+		_, _ = w.Write([]byte(`{"username": "test"}`))
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL),
+		api.WithExtraHeaders(map[string]string{"X-Custom": "value"}),
+	)
+
+	// Act
+	_, err := client.GetUser(context.Background(), "test")
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, "value", header)
+}
+
+func TestClientWithRequestMiddleware(t *testing.T) {
+	// Arrange
+	var headers http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header.Clone()
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	var order []string
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL+"/api/"),
+		api.WithRequestMiddleware(func(req *http.Request) {
+			order = append(order, "first")
+			req.Header.Set("X-Correlation-ID", "abc")
+			req.Header.Add("X-Chain", "first")
+		}),
+		api.WithRequestMiddleware(func(req *http.Request) {
+			order = append(order, "second")
+			req.Header.Add("X-Chain", "second")
+			req.Header.Set("User-Agent", "middleware")
+		}),
+	)
+
+	// Act
+	_, err := client.GetStreams(context.Background(), "")
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, []string{"first", "second"}, order)
+	require.Equal(t, "abc", headers.Get("X-Correlation-ID"))
+	require.Equal(t, []string{"first", "second"}, headers.Values("X-Chain"))
+	// The middlewares are applied after the standard headers.
+	require.Equal(t, "middleware", headers.Get("User-Agent"))
+}
+
+func TestClientWithHTTPTransport(t *testing.T) {
+	// Arrange
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"username": "test"}`))
+	}))
+	defer server.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}
+	hc := &http.Client{}
+	client := api.NewClient(
+		hc,
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL),
+		api.WithHTTPTransport(transport),
+	)
+
+	// Act
+	user, err := client.GetUser(context.Background(), "test")
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, "test", user.Username)
+	require.Equal(t, transport, client.Transport)
+	require.Nil(t, hc.Transport, "the provided client must not be mutated")
+}
+
+func TestClientWithConnectionPool(t *testing.T) {
+	// Arrange
+	var accepted atomic.Int64
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"username": "test"}`))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			accepted.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	client := api.NewClient(
+		&http.Client{},
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL),
+		api.WithConnectionPool(10, 2),
+	)
+
+	// Act
+	for range 5 {
+		_, err := client.GetUser(context.Background(), "test")
+		require.NoError(t, err)
+	}
+	// The HLS downloader sends its requests through the embedded client.
+	res, err := client.Get(server.URL)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	// Assert
+	require.IsType(t, &http.Transport{}, client.Transport)
+	require.Equal(t, 2, client.Transport.(*http.Transport).MaxIdleConnsPerHost)
+	require.EqualValues(t, 1, accepted.Load(), "the connection must be reused")
+}
+
+func TestClientWithRequestLogging(t *testing.T) {
+	// Arrange
+	var buf bytes.Buffer
+	logger := log.Logger
+	level := zerolog.GlobalLevel()
+	log.Logger = zerolog.New(&buf)
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	defer func() {
+		log.Logger = logger
+		zerolog.SetGlobalLevel(level)
+	}()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"username": "test"}`))
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		&http.Client{},
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL),
+		api.WithRequestLogging(),
+	)
+
+	// Act
+	_, err := client.GetUser(context.Background(), "test")
+
+	// Assert
+	require.NoError(t, err)
+	var event map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		if e["message"] == "http response" {
+			event = e
+		}
+	}
+	require.NotNil(t, event, "missing http response event")
+	require.Equal(t, "trace", event["level"])
+	require.Equal(t, "GET", event["method"])
+	require.Equal(t, server.URL+"/user?username=test", event["url"])
+	require.EqualValues(t, http.StatusOK, event["status"])
+	require.EqualValues(t, len(`{"username": "test"}`), event["bodyLength"])
+	require.Contains(t, event, "duration")
+}
+
+func TestClientWithRequestLoggingDisabled(t *testing.T) {
+	// Arrange
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	defer zerolog.SetGlobalLevel(level)
+	hc := &http.Client{}
+
+	// Act
+	client := api.NewClient(hc, nil, &memoryCache{}, api.WithRequestLogging())
+
+	// Assert
+	require.Same(t, hc, client.Client, "the transport must not be wrapped")
+}
+
+func TestClientWithRequestLoggingAlreadyWrapped(t *testing.T) {
+	// Arrange
+	level := zerolog.GlobalLevel()
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	defer zerolog.SetGlobalLevel(level)
+	hc := &http.Client{Transport: api.NewLoggingRoundTripper(nil)}
+
+	// Act
+	client := api.NewClient(hc, nil, &memoryCache{}, api.WithRequestLogging())
+
+	// Assert
+	require.Same(t, hc, client.Client, "the requests must be logged once")
+}
+
+func TestCensorHeaders(t *testing.T) {
+	// Arrange
+	headers := http.Header{
+		"Authorization":   {"Bearer secret"},
+		"X-Api-Key":       {"secret"},
+		"X-Forwarded-For": {"203.0.113.1"},
+	}
+
+	// Act
+	censored := api.CensorHeaders(headers)
+
+	// Assert
+	require.Equal(t, "[REDACTED]", censored.Get("Authorization"))
+	require.Equal(t, "[REDACTED]", censored.Get("X-Api-Key"))
+	require.Equal(t, "203.0.113.1", censored.Get("X-Forwarded-For"))
+	require.Equal(t, "Bearer secret", headers.Get("Authorization"))
+}
+
+type staticReader api.SavedCredentials
+
+func (r staticReader) Read() (api.SavedCredentials, error) {
+	return api.SavedCredentials(r), nil
+}
+
+func TestClientLoginWithClientCredentials(t *testing.T) {
+	// Arrange
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/auth/token" ||
+			r.FormValue("grant_type") != "client_credentials" ||
+			r.FormValue("client_id") != "id" ||
+			r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token": "` + token + `", "token_type": "bearer"}`))
+	}))
+	defer server.Close()
+	cache := &memoryCache{}
+	client := api.NewClient(
+		server.Client(),
+		staticReader{ClientID: "id", ClientSecret: "secret"},
+		cache,
+		api.WithBaseURL(server.URL+"/api"),
+	)
+
+	// Act
+	err = client.Login(context.Background())
+
+	// Assert
+	require.NoError(t, err)
+	creds, err := cache.Get()
+	require.NoError(t, err)
+	require.Equal(t, token, creds.Token)
+	require.Equal(t, "Bearer", creds.TokenType)
+	require.NotNil(t, creds.ExpiresAt)
+}
+
+func TestClientLoginCircuitBreaker(t *testing.T) {
+	// Arrange
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	var attempts, healthy atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		attempts.Add(1)
+		if healthy.Load() == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token": "` + token + `", "token_type": "bearer"}`))
+	}))
+	defer server.Close()
+	openDuration := 50 * time.Millisecond
+	client := api.NewClient(
+		server.Client(),
+		staticReader{ClientID: "id", ClientSecret: "secret"},
+		&memoryCache{},
+		api.WithBaseURL(server.URL+"/api"),
+		api.WithLoginCircuitBreaker(2, openDuration),
+	)
+	ctx := context.Background()
+
+	// Act & Assert
+	err = client.Login(ctx)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, api.ErrCircuitOpen)
+
+	err = client.Login(ctx)
+	require.ErrorIs(t, err, api.ErrCircuitOpen, "threshold reached, the breaker opens")
+	require.EqualValues(t, 2, attempts.Load())
+
+	err = client.Login(ctx)
+	require.ErrorIs(t, err, api.ErrCircuitOpen)
+	require.EqualValues(t, 2, attempts.Load(), "the auth endpoint must not be called while open")
+
+	time.Sleep(openDuration)
+	err = client.Login(ctx)
+	require.ErrorIs(t, err, api.ErrCircuitOpen, "a failed probe reopens the breaker")
+	require.EqualValues(t, 3, attempts.Load())
+
+	time.Sleep(openDuration)
+	healthy.Store(1)
+	err = client.Login(ctx)
+	require.NoError(t, err, "a successful probe closes the breaker")
+	require.EqualValues(t, 4, attempts.Load())
+
+	healthy.Store(0)
+	err = client.Login(ctx)
+	require.NotErrorIs(t, err, api.ErrCircuitOpen, "the failures are counted again from zero")
+}
+
+func TestCheckStreamingMethod(t *testing.T) {
+	tt := []struct {
+		method   string
+		expected error
+	}{
+		{method: "", expected: nil},
+		{method: "hls", expected: nil},
+		{method: "HLS", expected: nil},
+		{method: "rtmp", expected: api.UnsupportedStreamingMethodError{Method: "rtmp"}},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.method, func(t *testing.T) {
+			// Act
+			err := api.CheckStreamingMethod(api.GetStreamsResponseElement{
+				StreamingMethod: tc.method,
+			})
+
+			// Assert
+			require.Equal(t, tc.expected, err)
+		})
+	}
+}
+
+func TestClientGetChannelPlaylists(t *testing.T) {
+	// Arrange
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/streams/with-rooms":
+			require.Equal(t, "channel", r.URL.Query().Get("username"))
+			_, _ = w.Write([]byte(`[{"uuid": "stream"}]`))
+		case "/api/streams/stream/playback-url":
+			_, _ = w.Write([]byte(`"` + server.URL + `/playlist.m3u8"`))
+		case "/playlist.m3u8":
+			_, _ = w.Write([]byte(fixture))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+	var out strings.Builder
+
+	// Act
+	playlists, err := client.GetChannelPlaylists(context.Background(), "channel")
+	require.NoError(t, err)
+	err = api.WritePlaylistTable(&out, playlists)
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, expectedStreams, playlists)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, len(expectedStreams)+1)
+	require.Regexp(t, `^VIDEO\s+RESOLUTION\s+FRAME RATE\s+BANDWIDTH\s+URL$`, lines[0])
+	require.Regexp(t, `^720p60\s+1280x720\s+60\s+3002999\s+https://`, lines[1])
+	require.Regexp(t, `^480p30\s+852x480\s+30\s+1323000\s+https://`, lines[2])
+	require.Regexp(t, `^audio_only\s+-\s+-\s+160000\s+https://`, lines[5])
+}
+
+func TestClientGetChannelPlaylistsOffline(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+
+	// Act
+	_, err := client.GetChannelPlaylists(context.Background(), "channel")
+
+	// Assert
+	require.ErrorIs(t, err, api.ErrStreamNotFound)
+}
+
+func TestClientGetStreamStatus(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/streams/live":
+			_, _ = w.Write(
+				[]byte(`{"uuid": "live", "startedAt": "2024-01-02T03:04:05Z", "closedAt": null, "viewerCount": 42}`),
+			)
+		case "/api/streams/closed":
+			_, _ = w.Write(
+				[]byte(`{"uuid": "closed", "startedAt": "2024-01-02T03:04:05Z", "closedAt": "2024-01-02T04:04:05Z"}`),
+			)
+		case "/api/streams/deleted":
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"message": "Stream not found", "status": 500}`))
+		case "/api/streams/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+
+	tt := []struct {
+		name     string
+		streamID string
+		expected api.StreamStatus
+		isErr    bool
+	}{
+		{
+			name:     "live",
+			streamID: "live",
+			expected: api.StreamStatus{
+				IsLive:      true,
+				StartedAt:   time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				ViewerCount: 42,
+			},
+		},
+		{
+			name:     "closed",
+			streamID: "closed",
+			expected: api.StreamStatus{
+				StartedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+		},
+		{
+			name:     "not found",
+			streamID: "unknown",
+		},
+		{
+			name:     "stream not found",
+			streamID: "deleted",
+		},
+		{
+			name:     "server error",
+			streamID: "broken",
+			isErr:    true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Act
+			status, err := client.GetStreamStatus(context.Background(), tc.streamID)
+
+			// Assert
+			if tc.isErr {
+				var serverErr api.ServerError
+				require.ErrorAs(t, err, &serverErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, status)
+		})
+	}
+}
+
+func TestClientLoginLoopTokenRefreshMargin(t *testing.T) {
+	tt := []struct {
+		name            string
+		margin          time.Duration
+		expectedRefresh bool
+	}{
+		{
+			name:            "refresh before expiry",
+			margin:          2*time.Minute - time.Second,
+			expectedRefresh: true,
+		},
+		{
+			name:   "token still valid",
+			margin: time.Minute,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			var logins atomic.Int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				logins.Add(1)
+				token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(2 * time.Minute)),
+				}).SignedString([]byte("secret"))
+				require.NoError(t, err)
+				_, _ = w.Write([]byte(`{"access_token": "` + token + `", "token": "` + token +
+					`", "refreshToken": "refresh", "token_type": "bearer"}`))
+			}))
+			defer server.Close()
+			client := api.NewClient(
+				server.Client(),
+				staticReader{ClientID: "id", ClientSecret: "secret"},
+				&memoryCache{},
+				api.WithBaseURL(server.URL+"/api"),
+				api.WithTokenRefreshMargin(tc.margin),
+			)
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+
+			// Act
+			err := client.LoginLoop(ctx)
+
+			// Assert
+			require.ErrorIs(t, err, context.DeadlineExceeded)
+			if tc.expectedRefresh {
+				require.Greater(t, logins.Load(), int64(1))
+			} else {
+				require.EqualValues(t, 1, logins.Load())
+			}
+		})
+	}
+}
+
+func TestClientGetStreamByUUID(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.URL.Query().Get("username"))
+		_, _ = w.Write([]byte(`[{"uuid": "first", "title": "First"}, {"uuid": "second", "title": "Second"}]`))
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		&memoryCache{},
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+
+	// Act
+	stream, err := client.GetStreamByUUID(context.Background(), "second")
+	_, errNotFound := client.GetStreamByUUID(context.Background(), "unknown")
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, "Second", stream.Title)
+	require.ErrorIs(t, errNotFound, api.ErrStreamNotFound)
+}
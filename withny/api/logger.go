@@ -0,0 +1,20 @@
+package api
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Logger overrides the level of the logs of the package.
+//
+// It is disabled by default, in which case the global logger is used.
+var Logger = zerolog.Nop()
+
+// logger returns the logger of the package.
+func logger() *zerolog.Logger {
+	if Logger.GetLevel() == zerolog.Disabled {
+		return &log.Logger
+	}
+	l := log.Logger.Level(Logger.GetLevel())
+	return &l
+}
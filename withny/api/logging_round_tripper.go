@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sensitiveHeaderKeywords are the keywords of the headers which values are censored.
+var sensitiveHeaderKeywords = []string{"auth", "cookie", "token", "secret", "key", "password"}
+
+// LoggingRoundTripper logs the requests and their responses at the trace level.
+//
+// Sensitive headers are censored. The response body is not read, its length is
+// the Content-Length of the response, which is -1 when unknown.
+type LoggingRoundTripper struct {
+	Next http.RoundTripper
+}
+
+// NewLoggingRoundTripper wraps the round tripper to log the requests.
+func NewLoggingRoundTripper(next http.RoundTripper) *LoggingRoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &LoggingRoundTripper{Next: next}
+}
+
+// RoundTrip logs the request, executes it and logs the response.
+func (t *LoggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	e := logger().Trace()
+	if !e.Enabled() {
+		return t.Next.RoundTrip(req)
+	}
+	e.Str("method", req.Method).
+		Stringer("url", req.URL).
+		Any("headers", CensorHeaders(req.Header)).
+		Msg("http request")
+	start := time.Now()
+	res, err := t.Next.RoundTrip(req)
+	e = logger().Trace().
+		Str("method", req.Method).
+		Stringer("url", req.URL).
+		Dur("duration", time.Since(start))
+	if err != nil {
+		e.Err(err).Msg("http request failed")
+		return res, err
+	}
+	e.Int("status", res.StatusCode).
+		Int64("bodyLength", res.ContentLength).
+		Msg("http response")
+	return res, nil
+}
+
+// CensorHeaders returns a copy of the headers with sensitive values censored.
+func CensorHeaders(headers http.Header) http.Header {
+	out := headers.Clone()
+	for k := range out {
+		if isSensitiveHeader(k) {
+			out[k] = []string{"[REDACTED]"}
+		}
+	}
+	return out
+}
+
+func isSensitiveHeader(key string) bool {
+	key = strings.ToLower(key)
+	for _, kw := range sensitiveHeaderKeywords {
+		if strings.Contains(key, kw) {
+			return true
+		}
+	}
+	return false
+}
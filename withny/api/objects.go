@@ -9,6 +9,18 @@ import (
 type MetaData struct {
 	User   GetUserResponse
 	Stream GetStreamsResponseElement
+	// ThumbnailFile is the path of the written thumbnail, if any.
+	ThumbnailFile string `json:"-"`
+}
+
+// ThumbnailURL returns the thumbnail of the stream.
+func (m MetaData) ThumbnailURL() string {
+	return m.Stream.ThumbnailURL
+}
+
+// ThumbnailPath returns the path of the written thumbnail.
+func (m MetaData) ThumbnailPath() string {
+	return m.ThumbnailFile
 }
 
 // LoginResponse is the response of the login request.
@@ -51,6 +63,36 @@ type GetStreamsResponseElement struct {
 	HasTicket       bool        `json:"hasTicket"`
 }
 
+// GetStreamResponse is the response of the get stream request.
+type GetStreamResponse struct {
+	UUID        string      `json:"uuid"`
+	StartedAt   *time.Time  `json:"startedAt"`
+	ClosedAt    *time.Time  `json:"closedAt"`
+	ViewerCount json.Number `json:"viewerCount"`
+}
+
+// Status returns the status of the stream.
+//
+// The stream is live if it has started and is not closed.
+func (r GetStreamResponse) Status() StreamStatus {
+	var status StreamStatus
+	if r.StartedAt != nil {
+		status.StartedAt = *r.StartedAt
+	}
+	status.IsLive = r.StartedAt != nil && r.ClosedAt == nil
+	if count, err := r.ViewerCount.Int64(); err == nil {
+		status.ViewerCount = int(count)
+	}
+	return status
+}
+
+// StreamStatus is the status of a stream.
+type StreamStatus struct {
+	IsLive      bool
+	StartedAt   time.Time
+	ViewerCount int
+}
+
 // Cast is the cast of the user.
 type Cast struct {
 	ID                      json.Number              `json:"id"`
@@ -105,6 +147,15 @@ type Comment struct {
 	DeletedAt    *string     `json:"deletedAt"`
 }
 
+// IsGift returns true if the comment is a gift or a tip.
+func (c *Comment) IsGift() bool {
+	if c.ContentType == "gift" {
+		return true
+	}
+	amount, err := c.TipAmount.Float64()
+	return err == nil && amount != 0
+}
+
 // ErrorResponse is the error response of the API.
 type ErrorResponse struct {
 	Message string      `json:"message"`
@@ -2,9 +2,14 @@ package api
 
 import (
 	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
 	"io"
+	"slices"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 )
 
 // Playlist represents a stream in an M3U8 playlist.
@@ -17,21 +22,86 @@ type Playlist struct {
 	URL        string
 }
 
+// Quality returns a human readable description of the quality of the playlist.
+func (p Playlist) Quality() string {
+	if p.Video == "audio_only" {
+		return "audio only"
+	}
+	var sb strings.Builder
+	if p.Resolution != "" {
+		sb.WriteString(p.Resolution)
+	}
+	if p.FrameRate > 0 {
+		sb.WriteString("@" + strconv.FormatFloat(p.FrameRate, 'f', -1, 64) + "fps")
+	}
+	if p.Bandwidth > 0 {
+		if sb.Len() > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(strconv.FormatInt(p.Bandwidth/1000, 10) + "kbps")
+	}
+	if sb.Len() == 0 {
+		return "unknown"
+	}
+	return sb.String()
+}
+
+// ErrMalformedM3U8 is returned when the M3U8 playlist cannot be parsed.
+var ErrMalformedM3U8 = errors.New("malformed m3u8")
+
 // ParseM3U8 parses an M3U8 playlist and returns a list of streams.
-func ParseM3U8(r io.Reader) (streams []Playlist) {
+//
+// It returns ErrMalformedM3U8 if the playlist does not start with #EXTM3U or
+// if a #EXT-X-STREAM-INF tag is not immediately followed by a URL.
+func ParseM3U8(r io.Reader) (streams []Playlist, err error) {
 	scanner := bufio.NewScanner(r)
 	var currentStream Playlist
+	expectURL := false
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: empty playlist", ErrMalformedM3U8)
+	}
+	if strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff")) != "#EXTM3U" {
+		return nil, fmt.Errorf("%w: missing #EXTM3U header", ErrMalformedM3U8)
+	}
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := strings.TrimSpace(scanner.Text())
+
+		if expectURL {
+			if line == "" || strings.HasPrefix(line, "#") {
+				return nil, fmt.Errorf(
+					"%w: #EXT-X-STREAM-INF is not followed by a URL",
+					ErrMalformedM3U8,
+				)
+			}
+			currentStream.URL = line
+			streams = append(streams, currentStream)
+			expectURL = false
+			continue
+		}
 
-		if strings.HasPrefix(line, "#EXT-X-STREAM-INF") {
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
 			currentStream = Playlist{}
+			expectURL = true
 
 			// Parse stream attributes
 			attributes := splitByCommaAvoidQuote(line[18:])
 			for _, attribute := range attributes {
+				if attribute == "" {
+					continue
+				}
 				keyValue := strings.SplitN(attribute, "=", 2)
+				if len(keyValue) != 2 {
+					return nil, fmt.Errorf(
+						"%w: invalid attribute '%s'",
+						ErrMalformedM3U8,
+						attribute,
+					)
+				}
 				key := keyValue[0]
 				value := strings.Trim(keyValue[1], "\"")
 
@@ -50,12 +120,18 @@ func ParseM3U8(r io.Reader) (streams []Playlist) {
 					currentStream.Video = value
 				}
 			}
-		} else if strings.HasPrefix(line, "https://") {
-			currentStream.URL = line
-			streams = append(streams, currentStream)
 		}
 	}
-	return streams
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if expectURL {
+		return nil, fmt.Errorf(
+			"%w: #EXT-X-STREAM-INF is not followed by a URL",
+			ErrMalformedM3U8,
+		)
+	}
+	return streams, nil
 }
 
 func splitByCommaAvoidQuote(s string) []string {
@@ -115,6 +191,44 @@ type PlaylistConstraint struct {
 	MaxFrameRate float64  `yaml:"maxFrameRate"`
 	AudioOnly    bool     `yaml:"audioOnly"`
 	Ignored      []string `yaml:"ignored"`
+	// PreferHighFrameRate ranks the streams of the same resolution by frame
+	// rate before bandwidth.
+	//
+	// This is also the default order, the option only makes it explicit.
+	PreferHighFrameRate bool `yaml:"preferHighFrameRate"`
+}
+
+// String returns a human readable description of the constraint.
+func (c PlaylistConstraint) String() string {
+	var parts []string
+	addInt := func(name string, v int64) {
+		if v > 0 {
+			parts = append(parts, name+"="+strconv.FormatInt(v, 10))
+		}
+	}
+	addFloat := func(name string, v float64) {
+		if v > 0 {
+			parts = append(parts, name+"="+strconv.FormatFloat(v, 'f', -1, 64))
+		}
+	}
+	addInt("minBandwidth", c.MinBandwidth)
+	addInt("maxBandwidth", c.MaxBandwidth)
+	addInt("minHeight", c.MinHeight)
+	addInt("maxHeight", c.MaxHeight)
+	addInt("minWidth", c.MinWidth)
+	addInt("maxWidth", c.MaxWidth)
+	addFloat("minFrameRate", c.MinFrameRate)
+	addFloat("maxFrameRate", c.MaxFrameRate)
+	if c.AudioOnly {
+		parts = append(parts, "audioOnly")
+	}
+	if c.PreferHighFrameRate {
+		parts = append(parts, "preferHighFrameRate")
+	}
+	if len(parts) == 0 {
+		return "best"
+	}
+	return strings.Join(parts, ", ")
 }
 
 // GetBestPlaylist returns the best playlist based on the constraints.
@@ -122,30 +236,10 @@ func GetBestPlaylist(
 	streams []Playlist,
 	constraints ...PlaylistConstraint,
 ) (best Playlist, found bool) {
-streamLoop:
 	for _, stream := range streams {
-		for _, constraint := range constraints {
-			width, height := parseResolution(stream.Resolution)
-			switch {
-			case constraint.MinBandwidth > 0 && stream.Bandwidth < constraint.MinBandwidth,
-				constraint.MaxBandwidth > 0 && stream.Bandwidth > constraint.MaxBandwidth,
-				constraint.MinHeight > 0 && int64(height) < constraint.MinHeight,
-				constraint.MaxHeight > 0 && int64(height) > constraint.MaxHeight,
-				constraint.MinWidth > 0 && int64(width) < constraint.MinWidth,
-				constraint.MaxWidth > 0 && int64(width) > constraint.MaxWidth,
-				constraint.MinFrameRate > 0 && stream.FrameRate < constraint.MinFrameRate,
-				constraint.MaxFrameRate > 0 && stream.FrameRate > constraint.MaxFrameRate,
-				constraint.AudioOnly && stream.Video != "audio_only":
-				continue streamLoop
-			}
-
-			for _, ignored := range constraint.Ignored {
-				if strings.Contains(stream.URL, ignored) {
-					continue streamLoop
-				}
-			}
+		if !MatchesConstraints(stream, constraints...) {
+			continue
 		}
-
 		if !found || compareStreams(stream, best) > 0 {
 			best = stream
 			found = true
@@ -154,6 +248,57 @@ streamLoop:
 	return best, found
 }
 
+// SortPlaylists returns the playlists matching the constraints, sorted from the best to the worst.
+func SortPlaylists(streams []Playlist, constraints ...PlaylistConstraint) []Playlist {
+	sorted := make([]Playlist, 0, len(streams))
+	for _, stream := range streams {
+		if MatchesConstraints(stream, constraints...) {
+			sorted = append(sorted, stream)
+		}
+	}
+	slices.SortStableFunc(sorted, func(a, b Playlist) int {
+		return cmp.Compare(compareStreams(b, a), 0)
+	})
+	return sorted
+}
+
+// GetTopPlaylists returns up to n playlists matching the constraints, sorted from the best to the worst.
+//
+// This is useful to fall back to the next best playlist when the best one fails.
+func GetTopPlaylists(streams []Playlist, n int, constraints ...PlaylistConstraint) []Playlist {
+	if n <= 0 {
+		return nil
+	}
+	sorted := SortPlaylists(streams, constraints...)
+	return sorted[:min(n, len(sorted))]
+}
+
+// MatchesConstraints returns true if the stream satisfies every constraint.
+func MatchesConstraints(stream Playlist, constraints ...PlaylistConstraint) bool {
+	for _, constraint := range constraints {
+		width, height := parseResolution(stream.Resolution)
+		switch {
+		case constraint.MinBandwidth > 0 && stream.Bandwidth < constraint.MinBandwidth,
+			constraint.MaxBandwidth > 0 && stream.Bandwidth > constraint.MaxBandwidth,
+			constraint.MinHeight > 0 && int64(height) < constraint.MinHeight,
+			constraint.MaxHeight > 0 && int64(height) > constraint.MaxHeight,
+			constraint.MinWidth > 0 && int64(width) < constraint.MinWidth,
+			constraint.MaxWidth > 0 && int64(width) > constraint.MaxWidth,
+			constraint.MinFrameRate > 0 && stream.FrameRate < constraint.MinFrameRate,
+			constraint.MaxFrameRate > 0 && stream.FrameRate > constraint.MaxFrameRate,
+			constraint.AudioOnly && stream.Video != "audio_only":
+			return false
+		}
+
+		for _, ignored := range constraint.Ignored {
+			if strings.Contains(stream.URL, ignored) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func parseResolution(resolution string) (width, height int) {
 	w, h, _ := strings.Cut(resolution, "x")
 	width, _ = strconv.Atoi(w)
@@ -171,13 +316,42 @@ func compareStreams(s1, s2 Playlist) int64 {
 	}
 
 	// Compare FrameRate
-	if s1.FrameRate != s2.FrameRate {
-		if s1.FrameRate > s2.FrameRate {
-			return 1
-		}
-		return -1
+	if c := compareFrameRate(s1, s2); c != 0 {
+		return c
 	}
 
 	// Compare Bandwidth
 	return s1.Bandwidth - s2.Bandwidth
 }
+
+func compareFrameRate(s1, s2 Playlist) int64 {
+	switch {
+	case s1.FrameRate > s2.FrameRate:
+		return 1
+	case s1.FrameRate < s2.FrameRate:
+		return -1
+	}
+	return 0
+}
+
+// WritePlaylistTable writes the playlists as a human readable table.
+func WritePlaylistTable(w io.Writer, playlists []Playlist) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VIDEO\tRESOLUTION\tFRAME RATE\tBANDWIDTH\tURL")
+	for _, p := range playlists {
+		frameRate := "-"
+		if p.FrameRate > 0 {
+			frameRate = strconv.FormatFloat(p.FrameRate, 'f', -1, 64)
+		}
+		fmt.Fprintf(
+			tw,
+			"%s\t%s\t%s\t%d\t%s\n",
+			cmp.Or(p.Video, "-"),
+			cmp.Or(p.Resolution, "-"),
+			frameRate,
+			p.Bandwidth,
+			p.URL,
+		)
+	}
+	return tw.Flush()
+}
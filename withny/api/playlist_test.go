@@ -1,6 +1,8 @@
 package api_test
 
 import (
+	"cmp"
+	"slices"
 	"strings"
 	"testing"
 
@@ -70,14 +72,69 @@ var expectedStreams = []api.Playlist{
 }
 
 func TestParseM3U8(t *testing.T) {
-	streams := api.ParseM3U8(strings.NewReader(fixture))
+	streams, err := api.ParseM3U8(strings.NewReader(fixture))
 
+	require.NoError(t, err)
 	require.Equal(t, expectedStreams, streams)
 }
 
+func TestParseM3U8NoStream(t *testing.T) {
+	streams, err := api.ParseM3U8(strings.NewReader("#EXTM3U\n#EXT-X-VERSION:3\n"))
+
+	require.NoError(t, err)
+	require.Empty(t, streams)
+}
+
+func TestParseM3U8Malformed(t *testing.T) {
+	tt := []struct {
+		name  string
+		input string
+	}{
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:  "missing header",
+			input: "#EXT-X-STREAM-INF:BANDWIDTH=1\nhttps://example.com/a.m3u8\n",
+		},
+		{
+			name:  "html",
+			input: "<html><body>Forbidden</body></html>",
+		},
+		{
+			name:  "stream-inf followed by a tag",
+			input: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n#EXT-X-MEDIA:TYPE=VIDEO\nhttps://example.com/a.m3u8\n",
+		},
+		{
+			name:  "stream-inf followed by an empty line",
+			input: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n\nhttps://example.com/a.m3u8\n",
+		},
+		{
+			name:  "stream-inf at the end",
+			input: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n",
+		},
+		{
+			name:  "invalid attribute",
+			input: "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH\nhttps://example.com/a.m3u8\n",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			streams, err := api.ParseM3U8(strings.NewReader(tc.input))
+
+			require.ErrorIs(t, err, api.ErrMalformedM3U8)
+			require.Nil(t, streams)
+		})
+	}
+}
+
 func BenchmarkParseM3U8(b *testing.B) {
 	for i := 0; i < b.N; i++ {
-		api.ParseM3U8(strings.NewReader(fixture))
+		if _, err := api.ParseM3U8(strings.NewReader(fixture)); err != nil {
+			b.Fatal(err)
+		}
 	}
 }
 
@@ -118,6 +175,15 @@ func TestGetBestPlaylist(t *testing.T) {
 			expected:   expectedStreams[2],
 			expectedOK: true,
 		},
+		{
+			name: "ignored best quality",
+			constraint: api.PlaylistConstraint{
+				Ignored: []string{expectedStreams[0].URL},
+			},
+			// Same resolution: the frame rate is compared before the bandwidth.
+			expected:   streams[1],
+			expectedOK: true,
+		},
 		{
 			name: "audio only",
 			constraint: api.PlaylistConstraint{
@@ -137,3 +203,215 @@ func TestGetBestPlaylist(t *testing.T) {
 		})
 	}
 }
+
+func TestGetBestPlaylistPreferHighFrameRate(t *testing.T) {
+	p720p30 := api.Playlist{
+		Bandwidth:  3500000,
+		Resolution: "1280x720",
+		Video:      "720p30",
+		FrameRate:  30.000,
+	}
+	p720p60 := api.Playlist{
+		Bandwidth:  3000000,
+		Resolution: "1280x720",
+		Video:      "720p60",
+		FrameRate:  60.000,
+	}
+	p1080p30 := api.Playlist{
+		Bandwidth:  6000000,
+		Resolution: "1920x1080",
+		Video:      "1080p30",
+		FrameRate:  30.000,
+	}
+
+	tt := []struct {
+		name       string
+		streams    []api.Playlist
+		constraint api.PlaylistConstraint
+		expected   api.Playlist
+	}{
+		{
+			name:       "frame rate first by default",
+			streams:    []api.Playlist{p720p30, p720p60, p1080p30},
+			constraint: api.PlaylistConstraint{MaxHeight: 720},
+			expected:   p720p60,
+		},
+		{
+			name:    "prefer high frame rate",
+			streams: []api.Playlist{p720p30, p720p60, p1080p30},
+			constraint: api.PlaylistConstraint{
+				MaxHeight:           720,
+				PreferHighFrameRate: true,
+			},
+			expected: p720p60,
+		},
+		{
+			name:    "prefer high frame rate, reversed order",
+			streams: []api.Playlist{p720p60, p720p30, p1080p30},
+			constraint: api.PlaylistConstraint{
+				MaxHeight:           720,
+				PreferHighFrameRate: true,
+			},
+			expected: p720p60,
+		},
+		{
+			name:    "resolution first",
+			streams: []api.Playlist{p720p60, p720p30, p1080p30},
+			constraint: api.PlaylistConstraint{
+				PreferHighFrameRate: true,
+			},
+			expected: p1080p30,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			bestStream, found := api.GetBestPlaylist(tc.streams, tc.constraint)
+
+			require.True(t, found)
+			require.Equal(t, tc.expected, bestStream)
+		})
+	}
+}
+
+func TestSortPlaylists(t *testing.T) {
+	// Arrange
+	streams := []api.Playlist{
+		expectedStreams[2],
+		expectedStreams[0],
+		expectedStreams[4],
+		expectedStreams[1],
+	}
+
+	// Act
+	sorted := api.SortPlaylists(streams, api.PlaylistConstraint{MinHeight: 360})
+
+	// Assert
+	require.Equal(t, []api.Playlist{
+		expectedStreams[0],
+		expectedStreams[1],
+		expectedStreams[2],
+	}, sorted)
+}
+
+func TestGetTopPlaylists(t *testing.T) {
+	streams := []api.Playlist{
+		expectedStreams[2],
+		expectedStreams[4],
+		expectedStreams[0],
+		expectedStreams[3],
+		expectedStreams[1],
+	}
+
+	tt := []struct {
+		name       string
+		n          int
+		constraint api.PlaylistConstraint
+		expected   []api.Playlist
+	}{
+		{
+			name:     "top 2",
+			n:        2,
+			expected: []api.Playlist{expectedStreams[0], expectedStreams[1]},
+		},
+		{
+			name: "more than available",
+			n:    10,
+			constraint: api.PlaylistConstraint{
+				MinHeight: 360,
+			},
+			expected: []api.Playlist{expectedStreams[0], expectedStreams[1], expectedStreams[2]},
+		},
+		{
+			name: "with constraints",
+			n:    2,
+			constraint: api.PlaylistConstraint{
+				MaxWidth: 640,
+			},
+			expected: []api.Playlist{expectedStreams[2], expectedStreams[3]},
+		},
+		{
+			name: "bandwidth",
+			n:    3,
+			constraint: api.PlaylistConstraint{
+				MinBandwidth: 200000,
+				MaxBandwidth: 2000000,
+			},
+			expected: []api.Playlist{expectedStreams[1], expectedStreams[2], expectedStreams[3]},
+		},
+		{
+			name: "height",
+			n:    3,
+			constraint: api.PlaylistConstraint{
+				MinHeight: 200,
+				MaxHeight: 480,
+			},
+			expected: []api.Playlist{expectedStreams[1], expectedStreams[2]},
+		},
+		{
+			name: "width",
+			n:    3,
+			constraint: api.PlaylistConstraint{
+				MinWidth: 800,
+			},
+			expected: []api.Playlist{expectedStreams[0], expectedStreams[1]},
+		},
+		{
+			name: "frame rate",
+			n:    3,
+			constraint: api.PlaylistConstraint{
+				MinFrameRate: 10,
+				MaxFrameRate: 30,
+			},
+			expected: []api.Playlist{expectedStreams[1], expectedStreams[2], expectedStreams[3]},
+		},
+		{
+			name: "ignored",
+			n:    2,
+			constraint: api.PlaylistConstraint{
+				Ignored: []string{expectedStreams[0].URL},
+			},
+			expected: []api.Playlist{expectedStreams[1], expectedStreams[2]},
+		},
+		{
+			name: "audio only",
+			n:    2,
+			constraint: api.PlaylistConstraint{
+				AudioOnly: true,
+			},
+			expected: []api.Playlist{expectedStreams[4]},
+		},
+		{
+			name:     "zero",
+			n:        0,
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Act
+			top := api.GetTopPlaylists(streams, tc.n, tc.constraint)
+
+			// Assert
+			require.Equal(t, tc.expected, top)
+			require.True(t, slices.IsSortedFunc(top, func(a, b api.Playlist) int {
+				return cmp.Compare(b.Bandwidth, a.Bandwidth)
+			}))
+		})
+	}
+}
+
+func TestPlaylistQuality(t *testing.T) {
+	require.Equal(t, "1280x720@60fps 3002kbps", expectedStreams[0].Quality())
+	require.Equal(t, "audio only", expectedStreams[4].Quality())
+}
+
+func TestPlaylistConstraintString(t *testing.T) {
+	require.Equal(t, "best", api.PlaylistConstraint{}.String())
+	require.Equal(
+		t,
+		"maxHeight=720, minFrameRate=30",
+		api.PlaylistConstraint{MaxHeight: 720, MinFrameRate: 30}.String(),
+	)
+}
@@ -3,11 +3,12 @@ package api
 import (
 	"context"
 	"fmt"
+	"html"
 	"io"
+	"net/http"
+	"net/url"
 	"regexp"
 	"strconv"
-
-	"github.com/rs/zerolog/log"
 )
 
 // Scraper is used to scrape the withny website.
@@ -43,33 +44,116 @@ func (s *Scraper) FindGraphQLAndStreamUUID(
 
 	resp, err := s.Do(req)
 	if err != nil {
-		log.Err(err).Msg("failed to fetch channel page")
+		logger().Err(err).Msg("failed to fetch channel page")
 		return "", "", err
 	}
 	defer resp.Body.Close()
 
 	endpoint, suuid, err = FindGraphQLEndpointAndStreamUUID(resp.Body)
 	if err != nil {
-		log.Err(err).Msg("failed to find graphql endpoint")
+		logger().Err(err).Msg("failed to find graphql endpoint")
 		return "", "", err
 	}
 	endpoint, err = strconv.Unquote(endpoint)
 	if err != nil {
-		log.Err(err).Msg("failed to unquote graphql endpoint")
+		logger().Err(err).Msg("failed to unquote graphql endpoint")
 		return "", "", err
 	}
 	// Hack from the website itself.
 	return endpoint, suuid, nil
 }
 
+// FetchStreamThumbnailURL finds the thumbnail URL of the stream on the channel page.
+//
+// This is useful when the stream is known, but its metadata are not available yet.
+// The passCode is only needed for private channels and can be empty.
+func (s *Scraper) FetchStreamThumbnailURL(
+	ctx context.Context,
+	channelID string,
+	passCode string,
+) (string, error) {
+	pageURL := fmt.Sprintf("https://www.withny.fun/channels/%s", channelID)
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		panic(err)
+	}
+	if passCode != "" {
+		q := u.Query()
+		q.Set("passCode", passCode)
+		u.RawQuery = q.Encode()
+	}
+	req, err := s.NewAuthRequestWithContext(
+		ctx,
+		http.MethodGet,
+		u.String(),
+		nil,
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	log := logger().With().
+		Str("method", "GET").
+		Str("url", pageURL).
+		Logger()
+
+	resp, err := s.Do(req)
+	if err != nil {
+		log.Err(err).Msg("failed to fetch channel page")
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if err := s.handleHTTPError(resp, &log, nil); err != nil {
+		return "", err
+	}
+
+	thumbnailURL, err := FindThumbnailURL(resp.Body)
+	if err != nil {
+		log.Err(err).Msg("failed to find thumbnail url")
+		return "", err
+	}
+	return thumbnailURL, nil
+}
+
 var graphqlURLRegex = regexp.MustCompile(`(?m)"https:\\u002F\\u002F[^"]*\\u002Fgraphql"`)
 var streamUUIDRegex = regexp.MustCompile(`(?m)uuid="([^"]*)"`)
+var thumbnailURLRegex = regexp.MustCompile(`(?m)<meta[^>]*property="og:image"[^>]*content="([^"]*)"`)
+var thumbnailURLJSONRegex = regexp.MustCompile(`(?m)"?thumbnailUrl"?:("(?:[^"\\]|\\.)*")`)
+
+// FindThumbnailURL finds the thumbnail URL in the channel page.
+//
+// The og:image meta tag is preferred. The thumbnailUrl field of the
+// server-rendered data is used as a fallback.
+func FindThumbnailURL(r io.Reader) (string, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		logger().Err(err).Msg("failed to read body")
+		return "", err
+	}
+
+	if matches := thumbnailURLRegex.FindSubmatch(buf); len(matches) >= 2 && len(matches[1]) > 0 {
+		return html.UnescapeString(string(matches[1])), nil
+	}
+
+	if matches := thumbnailURLJSONRegex.FindSubmatch(buf); len(matches) >= 2 {
+		thumbnailURL, err := strconv.Unquote(string(matches[1]))
+		if err != nil {
+			return "", err
+		}
+		if thumbnailURL != "" {
+			return thumbnailURL, nil
+		}
+	}
+
+	return "", fmt.Errorf("no match found")
+}
 
 // FindGraphQLEndpointAndStreamUUID finds the GraphQL endpoint and stream UUID.
 func FindGraphQLEndpointAndStreamUUID(r io.Reader) (endpoint, suuid string, err error) {
 	buf, err := io.ReadAll(r)
 	if err != nil {
-		log.Err(err).Msg("failed to read body")
+		logger().Err(err).Msg("failed to read body")
 		return "", "", err
 	}
 	gql := graphqlURLRegex.FindString(string(buf))
@@ -0,0 +1,58 @@
+package api_test
+
+import (
+	"strings"
+	"testing"
+
+	_ "embed"
+
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+//go:embed fixtures/channel.html
+var channelPageFixture string
+
+func TestFindThumbnailURL(t *testing.T) {
+	tt := []struct {
+		name     string
+		page     string
+		expected string
+		isErr    bool
+	}{
+		{
+			name:     "og:image",
+			page:     channelPageFixture,
+			expected: "https://assets.withny.fun/thumbnails/6a0c2d7e.jpg?w=1280&h=720",
+		},
+		{
+			name: "thumbnailUrl fallback",
+			page: strings.ReplaceAll(
+				channelPageFixture,
+				`<meta property="og:image"`,
+				`<meta property="og:description"`,
+			),
+			expected: "https://assets.withny.fun/thumbnails/6a0c2d7e.jpg",
+		},
+		{
+			name:  "no thumbnail",
+			page:  `<html><head><title>withny</title></head></html>`,
+			isErr: true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Act
+			thumbnailURL, err := api.FindThumbnailURL(strings.NewReader(tc.page))
+
+			// Assert
+			if tc.isErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, thumbnailURL)
+		})
+	}
+}
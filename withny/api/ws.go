@@ -9,11 +9,12 @@ import (
 	"io"
 	neturl "net/url"
 	"strings"
+	"time"
 
 	"github.com/Darkness4/withny-dl/graphql"
+	"github.com/Darkness4/withny-dl/utils/try"
 	"github.com/coder/websocket"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
 )
 
 const queryFormat = `subscription MySubscription {
@@ -44,6 +45,47 @@ type WebSocket struct {
 	url         *neturl.URL
 	realtimeURL *neturl.URL
 	log         *zerolog.Logger
+
+	reconnectMaxRetries int
+	reconnectDelay      time.Duration
+	reconnectMaxBackoff time.Duration
+}
+
+// WebSocketOption is an option for the WebSocket.
+type WebSocketOption func(*webSocketOptions)
+
+type webSocketOptions struct {
+	reconnectMaxRetries int
+	reconnectDelay      time.Duration
+	reconnectMaxBackoff time.Duration
+}
+
+// WithReconnectMaxRetries sets the number of dial attempts of a reconnection. (default: 10)
+func WithReconnectMaxRetries(n int) WebSocketOption {
+	return func(o *webSocketOptions) {
+		o.reconnectMaxRetries = n
+	}
+}
+
+// WithReconnectBackoff sets the initial and maximum delays between the dial
+// attempts of a reconnection. (default: 1s, 1m)
+func WithReconnectBackoff(delay, maxBackoff time.Duration) WebSocketOption {
+	return func(o *webSocketOptions) {
+		o.reconnectDelay = delay
+		o.reconnectMaxBackoff = maxBackoff
+	}
+}
+
+func applyWebSocketOptions(opts []WebSocketOption) *webSocketOptions {
+	o := &webSocketOptions{
+		reconnectMaxRetries: 10,
+		reconnectDelay:      time.Second,
+		reconnectMaxBackoff: time.Minute,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
 }
 
 // WSResponse is the response from the WebSocket.
@@ -57,8 +99,10 @@ type WSResponse struct {
 func NewWebSocket(
 	client *Client,
 	url string,
+	opts ...WebSocketOption,
 ) *WebSocket {
-	logger := log.With().Str("url", url).Logger()
+	o := applyWebSocketOptions(opts)
+	logger := logger().With().Str("url", url).Logger()
 	u, err := neturl.Parse(url)
 	if err != nil {
 		panic(err)
@@ -73,6 +117,10 @@ func NewWebSocket(
 		url:         u,
 		realtimeURL: rtURL,
 		log:         &logger,
+
+		reconnectMaxRetries: o.reconnectMaxRetries,
+		reconnectDelay:      o.reconnectDelay,
+		reconnectMaxBackoff: o.reconnectMaxBackoff,
 	}
 	return w
 }
@@ -100,12 +148,17 @@ func (w *WebSocket) Dial(ctx context.Context) (*websocket.Conn, error) {
 	q.Set("payload", "e30=")
 	w.realtimeURL.RawQuery = q.Encode()
 
+	header := map[string][]string{
+		"Origin": {"https://www.withny.fun"},
+	}
+	if ua := w.Client.UserAgent(); ua != "" {
+		header["User-Agent"] = []string{ua}
+	}
+
 	// Connect to the websocket server
 	conn, _, err := websocket.Dial(ctx, w.realtimeURL.String(), &websocket.DialOptions{
-		HTTPClient: w.Client.Client,
-		HTTPHeader: map[string][]string{
-			"Origin": {"https://www.withny.fun"},
-		},
+		HTTPClient:   w.Client.Client,
+		HTTPHeader:   header,
 		Subprotocols: []string{"graphql-ws"},
 	})
 	if err != nil {
@@ -122,6 +175,54 @@ func (w *WebSocket) WatchComments(
 	conn *websocket.Conn,
 	streamID string,
 	commentChan chan<- *Comment,
+) error {
+	return w.watch(ctx, conn, streamID, func(comment *Comment) {
+		commentChan <- comment
+	})
+}
+
+// WatchGifts listens for gifts and tips on the WebSocket.
+//
+// Only the comments for which Comment.IsGift is true are forwarded.
+func (w *WebSocket) WatchGifts(
+	ctx context.Context,
+	conn *websocket.Conn,
+	streamID string,
+	giftChan chan<- *Comment,
+) error {
+	return w.watch(ctx, conn, streamID, func(comment *Comment) {
+		if comment.IsGift() {
+			giftChan <- comment
+		}
+	})
+}
+
+// WatchBoth listens for comments and gifts on the same WebSocket.
+//
+// Every comment is forwarded to commentChan. Gifts and tips are also forwarded
+// to giftChan.
+func (w *WebSocket) WatchBoth(
+	ctx context.Context,
+	conn *websocket.Conn,
+	streamID string,
+	commentChan chan<- *Comment,
+	giftChan chan<- *Comment,
+) error {
+	return w.watch(ctx, conn, streamID, func(comment *Comment) {
+		commentChan <- comment
+		if comment.IsGift() {
+			giftChan <- comment
+		}
+	})
+}
+
+// watch initializes the connection, subscribes to the stream and calls
+// dispatch for each received comment.
+func (w *WebSocket) watch(
+	ctx context.Context,
+	conn *websocket.Conn,
+	streamID string,
+	dispatch func(*Comment),
 ) error {
 	// Connection init
 	go func() {
@@ -169,7 +270,7 @@ func (w *WebSocket) WatchComments(
 					w.log.Err(err).Msg("failed to decode comment")
 					continue
 				}
-				commentChan <- &resp.Data.OnPostComment
+				dispatch(&resp.Data.OnPostComment)
 			case "ka":
 				// It's a keep alive message!
 			default:
@@ -188,6 +289,48 @@ func (w *WebSocket) WatchComments(
 	}
 }
 
+// WatchCommentsWithReconnect listens for comments on the WebSocket and
+// reconnects when the connection drops.
+//
+// It returns when the connection is closed cleanly (io.EOF), when the context
+// is canceled or when the reconnection fails. onReconnect, if not nil, is
+// called after each reconnection. The connection is closed before returning.
+func (w *WebSocket) WatchCommentsWithReconnect(
+	ctx context.Context,
+	conn *websocket.Conn,
+	streamID string,
+	commentChan chan<- *Comment,
+	onReconnect func(disconnectedAt, reconnectedAt time.Time),
+) error {
+	for {
+		err := w.WatchComments(ctx, conn, streamID, commentChan)
+		_ = conn.CloseNow()
+		if errors.Is(err, io.EOF) || ctx.Err() != nil {
+			return err
+		}
+
+		disconnectedAt := time.Now()
+		w.log.Warn().Err(err).Msg("websocket disconnected, reconnecting")
+		conn, err = try.DoExponentialBackoffWithResult(
+			ctx,
+			w.reconnectMaxRetries,
+			w.reconnectDelay,
+			2,
+			w.reconnectMaxBackoff,
+			func() (*websocket.Conn, error) {
+				return w.Dial(ctx)
+			},
+		)
+		if err != nil {
+			w.log.Err(err).Msg("failed to reconnect websocket")
+			return err
+		}
+		if onReconnect != nil {
+			onReconnect(disconnectedAt, time.Now())
+		}
+	}
+}
+
 // ConnectionInit initializes the connection to the WebSocket.
 func (w *WebSocket) ConnectionInit(ctx context.Context, conn *websocket.Conn) error {
 	initMsgJSON, err := json.Marshal(graphql.ConnectionInit)
@@ -0,0 +1,187 @@
+package api_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketWatchCommentsWithReconnect(t *testing.T) {
+	// Arrange
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols:   []string{"graphql-ws"},
+			OriginPatterns: []string{"*"},
+		})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		ctx := conn.CloseRead(r.Context())
+		if connections.Add(1) == 1 {
+			// Drop the first connection.
+			_ = conn.Close(websocket.StatusInternalError, "unexpected error")
+			return
+		}
+		_ = conn.Write(
+			ctx,
+			websocket.MessageText,
+			[]byte(`{"type":"data","payload":{"data":{"onPostComment":{"commentUUID":"comment"}}}}`),
+		)
+		_ = conn.Close(websocket.StatusNormalClosure, "")
+	}))
+	defer server.Close()
+	client := api.NewClient(server.Client(), nil, &memoryCache{})
+	ws := api.NewWebSocket(
+		client,
+		server.URL,
+		api.WithReconnectMaxRetries(3),
+		api.WithReconnectBackoff(10*time.Millisecond, 100*time.Millisecond),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := ws.Dial(ctx)
+	require.NoError(t, err)
+	commentsCh := make(chan *api.Comment, 10)
+	reconnects := 0
+
+	// Act
+	err = ws.WatchCommentsWithReconnect(
+		ctx,
+		conn,
+		"stream",
+		commentsCh,
+		func(_, _ time.Time) { reconnects++ },
+	)
+
+	// Assert
+	require.ErrorIs(t, err, io.EOF)
+	require.Equal(t, 1, reconnects)
+	require.EqualValues(t, 2, connections.Load())
+	require.Len(t, commentsCh, 1)
+	require.Equal(t, "comment", (<-commentsCh).CommentUUID)
+}
+
+func TestWebSocketWatchCommentsWithReconnectFailure(t *testing.T) {
+	// Arrange
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if connections.Add(1) > 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols:   []string{"graphql-ws"},
+			OriginPatterns: []string{"*"},
+		})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		_ = conn.Close(websocket.StatusInternalError, "unexpected error")
+	}))
+	defer server.Close()
+	client := api.NewClient(server.Client(), nil, &memoryCache{})
+	ws := api.NewWebSocket(
+		client,
+		server.URL,
+		api.WithReconnectMaxRetries(2),
+		api.WithReconnectBackoff(10*time.Millisecond, 100*time.Millisecond),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := ws.Dial(ctx)
+	require.NoError(t, err)
+
+	// Act
+	err = ws.WatchCommentsWithReconnect(ctx, conn, "stream", make(chan *api.Comment, 10), nil)
+
+	// Assert
+	require.Error(t, err)
+	require.NotErrorIs(t, err, io.EOF)
+	require.EqualValues(t, 3, connections.Load())
+}
+
+func serveCommentFixtures(t *testing.T, fixtures ...string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols:   []string{"graphql-ws"},
+			OriginPatterns: []string{"*"},
+		})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		ctx := conn.CloseRead(r.Context())
+		for _, fixture := range fixtures {
+			_ = conn.Write(ctx, websocket.MessageText, []byte(fixture))
+		}
+		_ = conn.Close(websocket.StatusNormalClosure, "")
+	}))
+}
+
+var commentFixtures = []string{
+	`{"type":"ka"}`,
+	`{"type":"data","payload":{"data":{"onPostComment":{"commentUUID":"comment","contentType":"text","content":"hello","tipAmount":0}}}}`,
+	`{"type":"data","payload":{"data":{"onPostComment":{"commentUUID":"gift","contentType":"gift","itemName":"flower","tipAmount":null}}}}`,
+	`{"type":"data","payload":{"data":{"onPostComment":{"commentUUID":"tip","contentType":"text","content":"thanks","tipAmount":500}}}}`,
+}
+
+func TestWebSocketWatchGifts(t *testing.T) {
+	// Arrange
+	server := serveCommentFixtures(t, commentFixtures...)
+	defer server.Close()
+	client := api.NewClient(server.Client(), nil, &memoryCache{})
+	ws := api.NewWebSocket(client, server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := ws.Dial(ctx)
+	require.NoError(t, err)
+	giftsCh := make(chan *api.Comment, 10)
+
+	// Act
+	err = ws.WatchGifts(ctx, conn, "stream", giftsCh)
+
+	// Assert
+	require.ErrorIs(t, err, io.EOF)
+	require.Len(t, giftsCh, 2)
+	require.Equal(t, "gift", (<-giftsCh).CommentUUID)
+	require.Equal(t, "tip", (<-giftsCh).CommentUUID)
+}
+
+func TestWebSocketWatchBoth(t *testing.T) {
+	// Arrange
+	server := serveCommentFixtures(t, commentFixtures...)
+	defer server.Close()
+	client := api.NewClient(server.Client(), nil, &memoryCache{})
+	ws := api.NewWebSocket(client, server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := ws.Dial(ctx)
+	require.NoError(t, err)
+	commentsCh := make(chan *api.Comment, 10)
+	giftsCh := make(chan *api.Comment, 10)
+
+	// Act
+	err = ws.WatchBoth(ctx, conn, "stream", commentsCh, giftsCh)
+
+	// Assert
+	require.ErrorIs(t, err, io.EOF)
+	require.Len(t, commentsCh, 3)
+	require.Equal(t, "comment", (<-commentsCh).CommentUUID)
+	require.Equal(t, "gift", (<-commentsCh).CommentUUID)
+	require.Equal(t, "tip", (<-commentsCh).CommentUUID)
+	require.Len(t, giftsCh, 2)
+	require.Equal(t, "gift", (<-giftsCh).CommentUUID)
+	require.Equal(t, "tip", (<-giftsCh).CommentUUID)
+}
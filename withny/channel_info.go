@@ -0,0 +1,65 @@
+package withny
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Darkness4/withny-dl/utils"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/rs/zerolog/log"
+)
+
+// channelInfoRefreshInterval is the interval between two refreshes of the channel info file.
+const channelInfoRefreshInterval = 24 * time.Hour
+
+// writeChannelInfo writes the user profile into "<ChannelID>.channel.json" in the output directory.
+func (w *ChannelWatcher) writeChannelInfo(user api.GetUserResponse) error {
+	fname, err := PrepareFile(w.params.OutFormat, api.MetaData{User: user}, w.params.Labels, "channel.json")
+	if err != nil {
+		return err
+	}
+	fname = filepath.Join(filepath.Dir(fname), utils.SanitizeFilename(user.Username)+".channel.json")
+
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(user)
+}
+
+// refreshChannelInfo fetches the user profile of the channel and writes it.
+func (w *ChannelWatcher) refreshChannelInfo(ctx context.Context, channelID string) {
+	log := log.Ctx(ctx)
+	user, err := w.pool.GetUser(ctx, channelID)
+	if err != nil {
+		log.Err(err).Msg("failed to fetch channel info")
+		return
+	}
+	if err := w.writeChannelInfo(user); err != nil {
+		log.Err(err).Msg("failed to write channel info")
+		return
+	}
+	log.Info().Msg("channel info written")
+}
+
+// watchChannelInfo writes the channel info file and refreshes it periodically.
+func (w *ChannelWatcher) watchChannelInfo(ctx context.Context, channelID string) {
+	w.refreshChannelInfo(ctx, channelID)
+
+	ticker := time.NewTicker(channelInfoRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.refreshChannelInfo(ctx, channelID)
+		}
+	}
+}
@@ -3,22 +3,27 @@ package withny
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"math/rand/v2"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Darkness4/withny-dl/history"
+	"github.com/Darkness4/withny-dl/hls"
+	"github.com/Darkness4/withny-dl/notify"
 	"github.com/Darkness4/withny-dl/notify/notifier"
 	"github.com/Darkness4/withny-dl/state"
 	"github.com/Darkness4/withny-dl/telemetry/metrics"
+	syncutils "github.com/Darkness4/withny-dl/utils/sync"
 	"github.com/Darkness4/withny-dl/utils/try"
 	"github.com/Darkness4/withny-dl/video/concat"
 	"github.com/Darkness4/withny-dl/video/probe"
-	"github.com/Darkness4/withny-dl/video/remux"
 	"github.com/Darkness4/withny-dl/withny/api"
 	"github.com/rs/zerolog/log"
 	"go.opentelemetry.io/otel"
@@ -26,6 +31,7 @@ import (
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
 )
 
 const (
@@ -38,51 +44,85 @@ const (
 var (
 	// ErrLiveStreamNotOnline is returned when the live stream is not online.
 	ErrLiveStreamNotOnline = errors.New("live stream is not online")
+	// ErrStreamSkipped is returned by Process when the stream is not downloaded.
+	ErrStreamSkipped = errors.New("stream skipped")
+	// ErrRecordingDiscarded is returned by Process when the recording is
+	// shorter than the MinDuration and has been deleted.
+	//
+	// It wraps ErrStreamSkipped.
+	ErrRecordingDiscarded = fmt.Errorf("%w: recording is too short", ErrStreamSkipped)
+	// ErrCanceledByUser is returned by Process when the download has been
+	// canceled by the user. The recording is post-processed anyway.
+	ErrCanceledByUser = errors.New("download canceled by the user")
 )
 
 // ChannelWatcher is responsible to watch a withny channel.
 type ChannelWatcher struct {
-	*api.Client
+	pool   *api.ClientPool
 	params *Params
-	// filterChannelID is like a channelID, but an empty one will select all channels.
+	// filterChannelID is the channelID of the watched channel.
 	filterChannelID string
 	// processingStreams is a set of streamsIDs that are currently being processed.
-	processingStreams     map[string]struct{}
-	processingStreamsLock sync.Mutex
+	processingStreams syncutils.Set[string]
+	// rejectedStreams is a set of streamIDs rejected by the pre command.
+	rejectedStreams syncutils.Set[string]
+	// canceledStreams is a set of streamIDs whose download was canceled by the user.
+	canceledStreams syncutils.Set[string]
+	// channelStreams are the streamIDs being processed, indexed by channelID.
+	channelStreams sync.Map
+	// episodeCounters are the episode counters indexed by output directory.
+	episodeCounters     map[string]*EpisodeCounter
+	episodeCountersLock sync.Mutex
+
+	// Sleep waits before each poll for d, or until ctx is done, in which case
+	// it returns ctx.Err(). (default: a timer)
+	Sleep func(ctx context.Context, d time.Duration) error
+	// PostProcessingSemaphore limits the number of concatenations running at
+	// the same time. It can be shared by multiple watchers. (default: no limit)
+	PostProcessingSemaphore *semaphore.Weighted
+	// Concat concatenates the files sharing the prefix. (default: concat.WithPrefix)
+	Concat func(ctx context.Context, remuxFormat string, prefix string, opts ...concat.Option) error
 }
 
 // NewChannelWatcher creates a new withny channel watcher.
-func NewChannelWatcher(client *api.Client, params *Params, channelID string) *ChannelWatcher {
-	if client == nil {
-		log.Panic().Msg("client is nil")
+//
+// Requests are distributed over the clients of the pool.
+func NewChannelWatcher(pool *api.ClientPool, params *Params, channelID string) *ChannelWatcher {
+	if pool == nil {
+		log.Panic().Msg("client pool is nil")
 	}
 	return &ChannelWatcher{
-		Client:            client,
-		params:            params,
-		filterChannelID:   channelID,
-		processingStreams: make(map[string]struct{}),
+		pool:            pool,
+		params:          params,
+		filterChannelID: channelID,
+		episodeCounters: make(map[string]*EpisodeCounter),
 	}
 }
 
+// ErrWaitTimeout is returned by Watch when no stream went live within the WaitTimeout.
+var ErrWaitTimeout = errors.New("timeout waiting for a stream to go live")
+
 // Watch watches the channel for any new live stream.
-func (w *ChannelWatcher) Watch(ctx context.Context) {
+//
+// It returns the context error when the context is canceled, or
+// ErrWaitTimeout when no stream went live within the WaitTimeout.
+func (w *ChannelWatcher) Watch(ctx context.Context) error {
 	log := log.With().Str("filterChannelID", w.filterChannelID).Logger()
 	log.Info().Any("params", w.params).Msg("watching channel")
 	ctx = log.WithContext(ctx)
 
+	if w.params.WriteChannelInfo {
+		go w.watchChannelInfo(ctx, w.filterChannelID)
+	}
+
 	for {
-		// Only handle IDLE state for a channelID not empty.
-		// This is because an empty channelID means multiple channels are being watched.
-		// Therefore, it is impossible to predict the true channelID that will be used.
-		if w.filterChannelID != "" {
-			state.DefaultState.SetChannelState(
-				w.filterChannelID,
-				state.DownloadStateIdle,
-				state.WithLabels(w.params.Labels),
-			)
-			if err := notifier.NotifyIdle(ctx, w.filterChannelID, w.params.Labels); err != nil {
-				log.Err(err).Msg("notify failed")
-			}
+		state.DefaultState.SetChannelState(
+			w.filterChannelID,
+			state.DownloadStateIdle,
+			state.WithLabels(w.params.Labels),
+		)
+		if err := notifier.NotifyIdle(ctx, w.filterChannelID, w.params.Labels); err != nil {
+			log.Err(err).Msg("notify failed")
 		}
 
 		res, err := w.HasNewStream(ctx)
@@ -92,56 +132,107 @@ func (w *ChannelWatcher) Watch(ctx context.Context) {
 
 		if !res.HasNewStream {
 			res = func() HasNewStreamResponse {
-				ticker := time.NewTicker(w.params.WaitPollInterval)
-				defer ticker.Stop()
+				pollCtx := ctx
+				if w.params.WaitTimeout > 0 {
+					var cancel context.CancelFunc
+					pollCtx, cancel = context.WithTimeout(ctx, w.params.WaitTimeout)
+					defer cancel()
+				}
+
+				// Delay the first poll to avoid synchronized polling between watchers.
+				if err := w.sleep(pollCtx, randomDuration(w.params.WaitPollJitter)); err != nil {
+					log.Err(err).Msg("channel watcher context done")
+					return HasNewStreamResponse{}
+				}
+
+				// The poll interval is backed off on consecutive failures.
+				failures := 0
+				interval := w.nextPollInterval()
 				for {
-					select {
-					case <-ctx.Done():
-						log.Err(ctx.Err()).Msg("channel watcher context done")
+					if err := w.sleep(pollCtx, interval); err != nil {
+						log.Err(err).Msg("channel watcher context done")
 						return HasNewStreamResponse{}
-					case <-ticker.C:
-						res, err := w.HasNewStream(ctx)
-						if err != nil {
-							log.Err(err).Msg("failed to check if online")
-							if errors.Is(err, context.Canceled) {
-								return HasNewStreamResponse{}
-							}
-						} else if res.HasNewStream {
+					}
+					res, err := w.checkNewStream(ctx)
+					if err != nil {
+						if errors.Is(err, context.Canceled) {
+							return HasNewStreamResponse{}
+						}
+						failures++
+						log.Err(err).Int("failures", failures).Msg("failed to check if online")
+						metrics.Watcher.ConsecutiveFailures.Add(ctx, 1, metric.WithAttributes(
+							attribute.String("channel_id", w.filterChannelID),
+						))
+					} else {
+						w.resetConsecutiveFailures(ctx, failures)
+						failures = 0
+						if res.HasNewStream {
 							return res
 						}
 					}
+					interval = w.backoffPollInterval(failures)
 				}
 			}()
 
+			if !res.HasNewStream && ctx.Err() == nil {
+				log.Warn().
+					Stringer("waitTimeout", w.params.WaitTimeout).
+					Msg("no stream went live in time, waiting for processing to finish")
+				if err := w.waitProcessing(ctx); err != nil {
+					w.waitProcessingOrFatal(30 * time.Second)
+					return err
+				}
+				log.Warn().Msg("processing finished")
+				return ErrWaitTimeout
+			}
+
 			if !res.HasNewStream {
 				// Context has been canceled.
 				log.Warn().Msg("channel watcher context canceled, waiting for processing to finish")
 				w.waitProcessingOrFatal(30 * time.Second)
 				log.Warn().Msg("processing finished")
-				return
+				return ctx.Err()
 			}
 		}
 
-		w.processingStreamsLock.Lock()
-		w.processingStreams[res.Stream.UUID] = struct{}{}
-		w.processingStreamsLock.Unlock()
+		w.processingStreams.Set(res.Stream.UUID)
+		w.streamsOf(res.Stream.Cast.AgencySecret.ChannelName).Set(res.Stream.UUID)
 
 		go func() {
-			defer func() {
-				w.processingStreamsLock.Lock()
-				delete(w.processingStreams, res.Stream.UUID)
-				w.processingStreamsLock.Unlock()
-			}()
+			defer w.processingStreams.Release(res.Stream.UUID)
+			defer w.streamsOf(res.Stream.Cast.AgencySecret.ChannelName).Release(res.Stream.UUID)
 			log := log.With().Str("channelID", res.User.Username).Logger()
-			ctx = log.WithContext(ctx)
+			ctx := log.WithContext(ctx)
 
-			err := w.Process(ctx, api.MetaData{
+			recorded, err := w.Process(ctx, api.MetaData{
 				User:   res.User,
 				Stream: res.Stream,
 			}, res.PlaybackURL)
 
+			if errors.Is(err, ErrAlreadyDownloading) {
+				log.Info().
+					Str("streamID", res.Stream.UUID).
+					Msg("stream is already being downloaded by another instance, skipping")
+				return
+			}
+			if errors.Is(err, ErrStreamSkipped) {
+				log.Info().
+					Err(err).
+					Str("streamID", res.Stream.UUID).
+					Msg("nothing recorded for the stream")
+				state.DefaultState.SetChannelState(
+					res.User.Username,
+					state.DownloadStateIdle,
+					state.WithLabels(w.params.Labels),
+				)
+				return
+			}
+			if errors.Is(err, ErrCanceledByUser) {
+				// The stream is not downloaded again.
+				w.canceledStreams.Set(res.Stream.UUID)
+			}
 			if err != nil {
-				if errors.Is(err, context.Canceled) {
+				if errors.Is(err, ErrCanceledByUser) || errors.Is(err, context.Canceled) {
 					state.DefaultState.SetChannelState(
 						res.User.Username,
 						state.DownloadStateCanceled,
@@ -174,7 +265,7 @@ func (w *ChannelWatcher) Watch(ctx context.Context) {
 				if err := notifier.NotifyFinished(ctx, res.User.Username, w.params.Labels, api.MetaData{
 					User:   res.User,
 					Stream: res.Stream,
-				}); err != nil {
+				}, describeRecording(ctx, recorded)); err != nil {
 					log.Err(err).Msg("notify failed")
 				}
 			}
@@ -182,30 +273,163 @@ func (w *ChannelWatcher) Watch(ctx context.Context) {
 	}
 }
 
+// describeRecording returns the duration and the size of the recorded file.
+//
+// The fields are zero if they cannot be determined.
+func describeRecording(ctx context.Context, recorded string) notify.Recording {
+	var recording notify.Recording
+	if recorded == "" {
+		return recording
+	}
+	log := log.Ctx(ctx)
+	if finfo, err := os.Stat(recorded); err != nil {
+		log.Warn().Err(err).Str("file", recorded).Msg("failed to stat recording")
+	} else {
+		recording.FileSizeBytes = finfo.Size()
+	}
+	if duration, err := probe.Duration(recorded); err != nil {
+		log.Warn().Err(err).Str("file", recorded).Msg("failed to probe recording")
+	} else {
+		recording.Duration = duration
+	}
+	return recording
+}
+
+// streamsOf returns the set of streamIDs being processed for the channelID.
+func (w *ChannelWatcher) streamsOf(channelID string) *syncutils.Set[string] {
+	streams, _ := w.channelStreams.LoadOrStore(channelID, &syncutils.Set[string]{})
+	return streams.(*syncutils.Set[string])
+}
+
+// sleep waits for d or until ctx is done.
+func (w *ChannelWatcher) sleep(ctx context.Context, d time.Duration) error {
+	if w.Sleep != nil {
+		return w.Sleep(ctx, d)
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// resetConsecutiveFailures brings the consecutive failures metric back to
+// zero after a successful poll.
+func (w *ChannelWatcher) resetConsecutiveFailures(ctx context.Context, failures int) {
+	if failures == 0 {
+		return
+	}
+	metrics.Watcher.ConsecutiveFailures.Add(ctx, -int64(failures), metric.WithAttributes(
+		attribute.String("channel_id", w.filterChannelID),
+	))
+}
+
+// maxPollBackoff is the maximum factor applied to the WaitPollInterval on consecutive failures.
+const maxPollBackoff = 10
+
+// backoffPollInterval returns the poll interval doubled for each consecutive
+// failure, up to maxPollBackoff times the WaitPollInterval.
+func (w *ChannelWatcher) backoffPollInterval(failures int) time.Duration {
+	interval := w.nextPollInterval()
+	limit := maxPollBackoff * w.params.WaitPollInterval
+	for range failures {
+		interval *= 2
+		if interval >= limit {
+			return limit
+		}
+	}
+	return interval
+}
+
+// nextPollInterval returns the poll interval with a random jitter in [-jitter/2, jitter/2).
+func (w *ChannelWatcher) nextPollInterval() time.Duration {
+	interval := w.params.WaitPollInterval - w.params.WaitPollJitter/2 +
+		randomDuration(w.params.WaitPollJitter)
+	if interval <= 0 {
+		return w.params.WaitPollInterval
+	}
+	return interval
+}
+
+// randomDuration returns a random duration in [0, d).
+func randomDuration(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(d)))
+}
+
 // waitProcessingOrFatal waits for the all the processes to finish.
 func (w *ChannelWatcher) waitProcessingOrFatal(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := w.waitProcessing(ctx); err != nil {
+		log.Fatal().Msg("timeout waiting for processing to finish")
+	}
+}
+
+// waitProcessing waits for the all the processes to finish or for the context to be done.
+func (w *ChannelWatcher) waitProcessing(ctx context.Context) error {
 	// Periodically check if all the processes are done.
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
 	for {
+		streams := w.processingStreams.Items()
+		if len(streams) == 0 {
+			return nil
+		}
+		log.Debug().Strs("streams", streams).Msg("waiting for streams to finish processing")
+
 		select {
 		case <-ticker.C:
-			w.processingStreamsLock.Lock()
-			if len(w.processingStreams) == 0 {
-				w.processingStreamsLock.Unlock()
-				return
-			}
-			w.processingStreamsLock.Unlock()
 		case <-ctx.Done():
-			log.Fatal().Msg("timeout waiting for processing to finish")
+			return ctx.Err()
 		}
 	}
 }
 
+// nextEpisode increments the episode number of the channel.
+//
+// The counter is only used if the output format uses the EpisodeNumber.
+func (w *ChannelWatcher) nextEpisode(ctx context.Context, meta api.MetaData) int {
+	if !strings.Contains(w.params.OutFormat, "EpisodeNumber") {
+		return 0
+	}
+	log := log.Ctx(ctx)
+
+	fname, err := FormatOutput(w.params.OutFormat, meta, w.params.Labels, "episodes.json")
+	if err != nil {
+		log.Err(err).Msg("failed to format episode counter file")
+		return 0
+	}
+	dir := filepath.Dir(fname)
+
+	w.episodeCountersLock.Lock()
+	counter, ok := w.episodeCounters[dir]
+	if !ok {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Err(err).Msg("failed to create output directory")
+		}
+		counter, err = NewEpisodeCounter(filepath.Join(dir, "episodes.json"))
+		if err != nil {
+			log.Err(err).Msg("failed to load episode counter")
+		}
+		w.episodeCounters[dir] = counter
+	}
+	w.episodeCountersLock.Unlock()
+
+	n, err := counter.Next(meta.User.Username)
+	if err != nil {
+		log.Err(err).Msg("failed to persist episode counter")
+	}
+	return n
+}
+
 // HasNewStreamResponse is the response of HasNewStream.
 type HasNewStreamResponse struct {
 	HasNewStream bool
@@ -214,106 +438,169 @@ type HasNewStreamResponse struct {
 	PlaybackURL  string
 }
 
+// isThrottled returns true if the error is due to the server throttling the requests.
+func isThrottled(err error) bool {
+	var throttleErr api.ThrottleError
+	return errors.As(err, &throttleErr)
+}
+
 // HasNewStream checks if the live stream is online.
+//
+// It retries with exponential backoff until a check succeeds or the context
+// is done.
 func (w *ChannelWatcher) HasNewStream(
 	ctx context.Context,
 ) (res HasNewStreamResponse, err error) {
-	log := log.Ctx(ctx)
-	res, err = try.DoExponentialBackoffWithResult(
-		60,
+	err = try.DoExponentialBackoffUntilContextDone(
+		ctx,
 		30*time.Second,
-		2,
 		60*time.Minute,
-		func() (HasNewStreamResponse, error) {
-			streams, err := w.GetStreams(ctx, w.filterChannelID)
-			if err != nil {
-				if !errors.Is(err, api.ServerError{}) {
-					if err := notifier.NotifyError(ctx, w.filterChannelID, w.params.Labels, err); err != nil {
-						log.Err(err).Msg("notify failed")
-					}
-				}
-				return HasNewStreamResponse{}, err
-			}
-			if len(streams) == 0 {
-				return HasNewStreamResponse{
-					HasNewStream: false,
-				}, nil
+		2,
+		func() (err error) {
+			res, err = w.checkNewStream(ctx)
+			return err
+		},
+	)
+	return res, err
+}
+
+// checkNewStream checks once if the live stream is online.
+func (w *ChannelWatcher) checkNewStream(
+	ctx context.Context,
+) (HasNewStreamResponse, error) {
+	log := log.Ctx(ctx)
+	streams, err := w.pool.GetStreams(ctx, w.filterChannelID)
+	if err != nil {
+		if !errors.Is(err, api.ServerError{}) && !isThrottled(err) {
+			if err := notifier.NotifyError(ctx, w.filterChannelID, w.params.Labels, err); err != nil {
+				log.Err(err).Msg("notify failed")
 			}
+		}
+		return HasNewStreamResponse{}, err
+	}
+	if len(streams) == 0 {
+		return HasNewStreamResponse{
+			HasNewStream: false,
+		}, nil
+	}
 
-			// Find a stream that is online and not being processed.
-			var getUserResp api.GetUserResponse
-			var playbackURL string
-			var stream api.GetStreamsResponseElement
-			var lastErr error
-			for _, s := range streams {
-				if s.Cast.AgencySecret.ChannelName == "" {
-					// Stream is scheduled to be live, but not online yet.
-					log.Warn().Any("stream", s).Msg("stream is not ready")
-					continue
-				}
+	// Find a stream that is online and not being processed.
+	var getUserResp api.GetUserResponse
+	var playbackURL string
+	var stream api.GetStreamsResponseElement
+	var lastErr error
+	for _, s := range streams {
+		if s.Cast.AgencySecret.ChannelName == "" {
+			// Stream is scheduled to be live, but not online yet.
+			log.Warn().Any("stream", s).Msg("stream is not ready")
+			continue
+		}
 
-				// Check if stream is an ignored channel.
-				if slices.Contains(w.params.Ignore, s.Cast.AgencySecret.ChannelName) {
-					continue
-				}
+		if err := api.CheckStreamingMethod(s); err != nil {
+			log.Warn().Err(err).Any("stream", s).Msg("skipping stream")
+			continue
+		}
 
-				w.processingStreamsLock.Lock()
-				_, ok := w.processingStreams[s.UUID]
-				w.processingStreamsLock.Unlock()
-				if ok {
-					// Stream is being processed.
-					continue
-				}
+		// Check if stream is an ignored channel.
+		if slices.Contains(w.params.Ignore, s.Cast.AgencySecret.ChannelName) {
+			continue
+		}
 
-				// Stream is not being processed, check if it is online.
+		if !w.params.MatchesTitle(s.Title) {
+			log.Debug().
+				Str("title", s.Title).
+				Str("titleFilter", w.params.TitleFilter).
+				Str("titleExclude", w.params.TitleExclude).
+				Msg("skipping stream due to title filter")
+			continue
+		}
 
-				channelID := s.Cast.AgencySecret.ChannelName
-				log.Info().Str("channelID", channelID).Str("stream", s.Title).Msg("streams found")
-				getUserResp, lastErr = w.Client.GetUser(ctx, channelID)
-				if lastErr != nil {
-					if !errors.Is(lastErr, api.ServerError{}) {
-						if err := notifier.NotifyError(ctx, w.filterChannelID, w.params.Labels, lastErr); err != nil {
-							log.Err(err).Msg("notify failed")
-						}
-					}
-					continue
-				}
+		if w.params.SkipsStream(s) {
+			log.Debug().
+				Str("stream", s.Title).
+				Bool("hasTicket", s.HasTicket).
+				Str("price", s.Price.String()).
+				Msg("skipping paid stream")
+			continue
+		}
 
-				playbackURL, lastErr = w.GetStreamPlaybackURL(ctx, s.UUID)
-				if lastErr != nil {
-					if err := notifier.NotifyError(ctx, channelID, w.params.Labels, lastErr); err != nil {
-						log.Err(err).Msg("notify failed")
-					}
-					continue
-				}
+		if w.processingStreams.Contains(s.UUID) {
+			// Stream is being processed.
+			continue
+		}
 
-				stream = s
-			}
+		if w.rejectedStreams.Contains(s.UUID) {
+			// Stream was rejected by the pre command.
+			continue
+		}
 
-			if playbackURL == "" {
-				return HasNewStreamResponse{
-					HasNewStream: false,
-				}, lastErr
+		if w.canceledStreams.Contains(s.UUID) {
+			// Stream was canceled by the user.
+			continue
+		}
+
+		channelID := s.Cast.AgencySecret.ChannelName
+		if w.params.MaxConcurrentStreams > 0 &&
+			w.streamsOf(channelID).Len() >= w.params.MaxConcurrentStreams {
+			log.Debug().
+				Str("channelID", channelID).
+				Str("stream", s.Title).
+				Int("maxConcurrentStreams", w.params.MaxConcurrentStreams).
+				Msg("skipping stream, too many streams of the channel are being processed")
+			continue
+		}
+
+		// Stream is not being processed, check if it is online.
+
+		log.Info().Str("channelID", channelID).Str("stream", s.Title).Msg("streams found")
+		getUserResp, lastErr = w.pool.GetUser(ctx, channelID)
+		if lastErr != nil {
+			if !errors.Is(lastErr, api.ServerError{}) && !isThrottled(lastErr) {
+				if err := notifier.NotifyError(ctx, w.filterChannelID, w.params.Labels, lastErr); err != nil {
+					log.Err(err).Msg("notify failed")
+				}
 			}
+			continue
+		}
 
-			return HasNewStreamResponse{
-				HasNewStream: true,
-				PlaybackURL:  playbackURL,
-				User:         getUserResp,
-				Stream:       stream,
-			}, nil
-		},
-	)
-	if err != nil {
-		if err := notifier.NotifyError(ctx, w.filterChannelID, w.params.Labels, err); err != nil {
-			log.Err(err).Msg("notify failed")
+		playbackURL, lastErr = w.pool.GetStreamPlaybackURL(ctx, s.UUID)
+		if lastErr != nil {
+			if !isThrottled(lastErr) {
+				if err := notifier.NotifyError(ctx, channelID, w.params.Labels, lastErr); err != nil {
+					log.Err(err).Msg("notify failed")
+				}
+			}
+			continue
 		}
+
+		stream = s
 	}
-	return res, err
+
+	if playbackURL == "" {
+		return HasNewStreamResponse{
+			HasNewStream: false,
+		}, lastErr
+	}
+
+	return HasNewStreamResponse{
+		HasNewStream: true,
+		PlaybackURL:  playbackURL,
+		User:         getUserResp,
+		Stream:       stream,
+	}, nil
 }
 
 // Process runs the whole preparation, download and post-processing pipeline.
-func (w *ChannelWatcher) Process(ctx context.Context, meta api.MetaData, playbackURL string) error {
+//
+// It returns the recorded file, which is empty if nothing was recorded.
+// ErrStreamSkipped is returned if the pre command rejected the stream,
+// ErrRecordingDiscarded if the recording was too short, and ErrCanceledByUser
+// if the download was canceled by the user.
+func (w *ChannelWatcher) Process(
+	ctx context.Context,
+	meta api.MetaData,
+	playbackURL string,
+) (string, error) {
 	log := log.Ctx(ctx)
 	channelID := meta.User.Username
 	ctx, span := otel.Tracer(tracerName).
@@ -322,8 +609,46 @@ func (w *ChannelWatcher) Process(ctx context.Context, meta api.MetaData, playbac
 		))
 	defer span.End()
 
+	if w.params.PreCommand != "" {
+		ok, err := RunPreCommand(ctx, w.params.PreCommand, meta)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			log.Err(err).Msg("failed to run pre command")
+			return "", err
+		}
+		if !ok {
+			span.AddEvent("skipped by pre command")
+			// The pre command is not run again for this stream.
+			w.rejectedStreams.Set(meta.Stream.UUID)
+			return "", ErrStreamSkipped
+		}
+	}
+
 	metrics.TimeStartRecordingDeferred(channelID)
 
+	// Prevent another instance, possibly on another host, from downloading the same stream.
+	fnameLock, err := PrepareFile(w.params.OutFormat, meta, w.params.Labels, "lock")
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Err(err).Msg("failed to prepare lock file")
+		return "", err
+	}
+	fnameLock = filepath.Join(filepath.Dir(fnameLock), meta.Stream.UUID+".lock")
+	release, err := AcquireLock(fnameLock)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Err(err).Str("fnameLock", fnameLock).Msg("failed to lock the stream")
+		return "", err
+	}
+	defer release()
+
+	// Use the same client for the whole download session.
+	client := w.pool.Next()
+	episode := w.nextEpisode(ctx, meta)
+
 	span.AddEvent("preparing files")
 	state.DefaultState.SetChannelState(
 		channelID,
@@ -334,37 +659,53 @@ func (w *ChannelWatcher) Process(ctx context.Context, meta api.MetaData, playbac
 		log.Err(err).Msg("notify failed")
 	}
 
-	fnameInfo, err := PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "info.json")
+	fnameInfo, err := PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "info.json", WithEpisodeNumber(episode))
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("failed to prepare info file")
-		return err
+		return "", err
+	}
+	var fnameNFO string
+	if w.params.WriteNFO {
+		fnameNFO, err = PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "nfo", WithEpisodeNumber(episode))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			log.Err(err).Msg("failed to prepare nfo file")
+			return "", err
+		}
 	}
 	var fnameThumb string
 	if w.params.Concat {
-		fnameThumb, err = PrepareFile(w.params.OutFormat, meta, w.params.Labels, "avif")
+		fnameThumb, err = PrepareFile(w.params.OutFormat, meta, w.params.Labels, "avif", WithEpisodeNumber(episode))
 	} else {
-		fnameThumb, err = PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "avif")
+		fnameThumb, err = PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "avif", WithEpisodeNumber(episode))
 	}
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		return err
+		return "", err
 	}
-	fnameStream, err := PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "ts")
+	fnameStream, err := PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "ts", WithEpisodeNumber(episode))
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("failed to prepare stream file")
-		return err
+		return "", err
 	}
-	fnameChat, err := PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "chat.json")
+	fnameChat, err := PrepareFileAutoRename(
+		w.params.OutFormat,
+		meta,
+		w.params.Labels,
+		ChatExtension(w.params.ChatFormat),
+		WithEpisodeNumber(episode),
+	)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("failed to prepare chat file")
-		return err
+		return "", err
 	}
 	fnameMuxedExt := strings.ToLower(w.params.RemuxFormat)
 	fnameMuxed, err := PrepareFileAutoRename(
@@ -372,31 +713,33 @@ func (w *ChannelWatcher) Process(ctx context.Context, meta api.MetaData, playbac
 		meta,
 		w.params.Labels,
 		fnameMuxedExt,
+		WithEpisodeNumber(episode),
 	)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("failed to prepare muxed file")
-		return err
+		return "", err
 	}
-	fnameAudio, err := PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "m4a")
+	fnameAudio, err := PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "m4a", WithEpisodeNumber(episode))
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("failed to prepare audio file")
-		return err
+		return "", err
 	}
 	nameConcatenated, err := FormatOutput(
 		w.params.OutFormat,
 		meta,
 		w.params.Labels,
 		"combined."+fnameMuxedExt,
+		WithEpisodeNumber(episode),
 	)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("failed to prepare concatenated file")
-		return err
+		return "", err
 	}
 	nameConcatenatedPrefix := strings.TrimSuffix(
 		nameConcatenated,
@@ -407,12 +750,13 @@ func (w *ChannelWatcher) Process(ctx context.Context, meta api.MetaData, playbac
 		meta,
 		w.params.Labels,
 		"combined.m4a",
+		WithEpisodeNumber(episode),
 	)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("failed to prepare concatenated audio file")
-		return err
+		return "", err
 	}
 	nameAudioConcatenatedPrefix := strings.TrimSuffix(
 		nameAudioConcatenated,
@@ -421,27 +765,22 @@ func (w *ChannelWatcher) Process(ctx context.Context, meta api.MetaData, playbac
 
 	if w.params.WriteMetaDataJSON {
 		log.Info().Str("fnameInfo", fnameInfo).Msg("writing info json")
-		func() {
-			f, err := os.OpenFile(fnameInfo, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to open info json")
-				return
-			}
-			defer f.Close()
-			enc := json.NewEncoder(f)
-			enc.SetIndent("", "  ")
-			if err := enc.Encode(meta); err != nil {
-				log.Error().Err(err).Msg("failed to encode meta in info json")
-				return
-			}
-		}()
+		if err := WriteInfoJSON(fnameInfo, meta); err != nil {
+			log.Error().Err(err).Msg("failed to write info json")
+		}
+	}
+
+	if w.params.WriteChannelInfo {
+		if err := w.writeChannelInfo(meta.User); err != nil {
+			log.Err(err).Msg("failed to write channel info")
+		}
 	}
 
 	if w.params.WriteThumbnail {
 		log.Info().Str("fnameThumb", fnameThumb).Msg("writing thumbnail")
 		func() {
 			url := meta.Stream.ThumbnailURL
-			resp, err := w.Get(url)
+			resp, err := client.Get(url)
 			if err != nil {
 				log.Err(err).Msg("failed to fetch thumbnail")
 				return
@@ -458,6 +797,7 @@ func (w *ChannelWatcher) Process(ctx context.Context, meta api.MetaData, playbac
 				log.Err(err).Msg("failed to download thumbnail file")
 				return
 			}
+			meta.ThumbnailFile = fnameThumb
 		}()
 	}
 
@@ -479,31 +819,122 @@ func (w *ChannelWatcher) Process(ctx context.Context, meta api.MetaData, playbac
 		log.Err(err).Msg("notify failed")
 	}
 
-	chatDownloadCtx, chatDownloadCancel := context.WithCancel(ctx)
+	// The download can be canceled by the user, the recording is then post-processed.
+	downloadCtx, downloadCancel := context.WithCancelCause(ctx)
+	unregisterCancel := state.DefaultState.RegisterCancelFunc(channelID, func() {
+		downloadCancel(ErrCanceledByUser)
+	})
+
+	chatDownloadCtx, chatDownloadCancel := context.WithCancel(downloadCtx)
+	chatDone := make(chan struct{})
 	if w.params.WriteChat {
 		go func() {
-			if err := DownloadChat(chatDownloadCtx, w.Client, Chat{
+			defer close(chatDone)
+			if err := DownloadChat(chatDownloadCtx, client, Chat{
 				ChannelID:      channelID,
 				OutputFileName: fnameChat,
+				Reconnect:      w.params.ReconnectChat,
+				Format:         w.params.ChatFormat,
 			}); err != nil {
 				log.Err(err).Msg("chat download failed")
 			}
 		}()
+	} else {
+		close(chatDone)
 	}
 
-	dlErr := DownloadLiveStream(ctx, w.Client, LiveStream{
+	statsCtx, statsCancel := context.WithCancel(downloadCtx)
+	// The stats must not overwrite the state once the download is done.
+	var statsWg sync.WaitGroup
+	var splits []string
+	_, dlErr := DownloadLiveStream(downloadCtx, client, LiveStream{
 		MetaData:       meta,
 		Params:         w.params,
 		OutputFileName: fnameStream,
 		PlaybackURL:    playbackURL,
+		OnDownloadStart: func(downloader *hls.Downloader) {
+			statsWg.Add(1)
+			go func() {
+				defer statsWg.Done()
+				w.reportStats(statsCtx, channelID, meta, downloader)
+			}()
+		},
+		NextOutputFileName: func() (string, error) {
+			return PrepareFileAutoRename(w.params.OutFormat, meta, w.params.Labels, "ts", WithEpisodeNumber(episode))
+		},
+		OnSplit: func(fname string) {
+			splits = append(splits, fname)
+		},
+		OnQualityDowngrade: func(requestedQuality string, playlist api.Playlist) {
+			if err := notifier.NotifyQualityDowngrade(
+				ctx,
+				channelID,
+				requestedQuality,
+				playlist.Quality(),
+				w.params.Labels,
+			); err != nil {
+				log.Err(err).Msg("notify failed")
+			}
+		},
 	})
+	statsCancel()
+	statsWg.Wait()
 	chatDownloadCancel()
+	<-chatDone
+	unregisterCancel()
+	canceledByUser := errors.Is(context.Cause(downloadCtx), ErrCanceledByUser)
+	downloadCancel(nil)
 
 	if errors.Is(dlErr, api.GetPlaybackURLError{}) {
 		span.RecordError(dlErr)
 		span.SetStatus(codes.Error, dlErr.Error())
 		log.Err(dlErr).Msg("get playback url failed")
-		return dlErr
+		return "", dlErr
+	}
+	if errors.Is(dlErr, ErrInsufficientDisk) || errors.Is(dlErr, hls.ErrEncryptedStream) {
+		span.RecordError(dlErr)
+		span.SetStatus(codes.Error, dlErr.Error())
+		return "", dlErr
+	}
+
+	companions := []string{fnameChat, fnameInfo, fnameStream + ".frag.jsonl"}
+	if !w.params.Concat {
+		// The thumbnail is shared by the concatenated recordings.
+		companions = append(companions, fnameThumb)
+	}
+	if DiscardShortRecording(
+		ctx,
+		probe.Duration,
+		w.params.MinDuration,
+		fnameStream,
+		companions...,
+	) {
+		span.AddEvent("discarded short recording")
+		return "", ErrRecordingDiscarded
+	}
+
+	fnameSRT := strings.TrimSuffix(fnameStream, filepath.Ext(fnameStream)) + ".srt"
+	if w.params.WriteChat && w.params.ChatToSRT {
+		log.Info().Str("fnameSRT", fnameSRT).Msg("converting chat to srt")
+		if err := WriteChatSRT(fnameSRT, fnameChat, meta.Stream.StartedAt); err != nil {
+			log.Error().Err(err).Msg("failed to convert chat to srt")
+		}
+	}
+
+	if w.params.WriteNFO && dlErr == nil {
+		log.Info().Str("fnameNFO", fnameNFO).Msg("writing nfo")
+		func() {
+			f, err := os.OpenFile(fnameNFO, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to open nfo")
+				return
+			}
+			defer f.Close()
+			if err := WriteNFO(f, meta); err != nil {
+				log.Error().Err(err).Msg("failed to write nfo")
+				return
+			}
+		}()
 	}
 
 	span.AddEvent("post-processing")
@@ -537,95 +968,190 @@ func (w *ChannelWatcher) Process(ctx context.Context, meta api.MetaData, playbac
 	}
 	log.Info().Msg("post-processing...")
 
-	var remuxErr error
+	files := postProcessingFiles{
+		stream:                  fnameStream,
+		muxed:                   fnameMuxed,
+		audio:                   fnameAudio,
+		concatenated:            nameConcatenated,
+		concatenatedPrefix:      nameConcatenatedPrefix,
+		audioConcatenated:       nameAudioConcatenated,
+		audioConcatenatedPrefix: nameAudioConcatenatedPrefix,
+		thumbnail:               fnameThumb,
+		chat:                    fnameChat,
+		subtitles:               fnameSRT,
+		startedAt:               meta.Stream.StartedAt,
+	}
+	// The other files of a split stream are post-processed independently.
+	for _, split := range splits {
+		w.postProcessSplit(ctx, channelID, files, split)
+	}
 
-	probeErr := probe.Do([]string{fnameStream}, probe.WithQuiet())
-	if probeErr != nil {
-		log.Error().Err(probeErr).Msg("ts is unreadable by ffmpeg")
-		if w.params.DeleteCorrupted {
-			if err := os.Remove(fnameStream); err != nil {
-				log.Error().
-					Str("path", fnameStream).
-					Err(err).
-					Msg("failed to remove corrupted file")
-			}
-		}
+	steps := w.params.PostProcessingPipeline
+	if len(steps) == 0 {
+		steps = w.legacyPostProcessingSteps()
 	}
-	if w.params.Remux && probeErr == nil {
-		log.Info().Str("output", fnameMuxed).Str("input", fnameStream).Msg(
-			"remuxing stream...",
-		)
-		remuxErr = remux.Do(ctx, fnameMuxed, fnameStream)
-		if remuxErr != nil {
-			log.Error().Err(remuxErr).Msg("ffmpeg remux finished with error")
-			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("channel_id", channelID),
-			))
-		}
+	ok := w.runPostProcessingPipeline(ctx, channelID, files, steps)
+	recorded := files.output()
+	w.completePostProcessing(ctx, meta, files, fnameInfo, recorded, ok,
+		fnameChat, fnameSRT, fnameInfo, fnameNFO)
+
+	span.AddEvent("done")
+	log.Info().Msg("done")
+
+	if canceledByUser {
+		return recorded, ErrCanceledByUser
 	}
-	var extractAudioErr error
-	// Extract audio if remux on, or when concat is ofw.
-	if w.params.ExtractAudio && (!w.params.Concat || w.params.Remux) && probeErr == nil {
-		log.Info().Str("output", fnameAudio).Str("input", fnameStream).Msg(
-			"extrating audio...",
-		)
-		extractAudioErr = remux.Do(ctx, fnameAudio, fnameStream, remux.WithAudioOnly())
-		if extractAudioErr != nil {
-			log.Error().Err(extractAudioErr).Msg("ffmpeg audio extract finished with error")
-			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("channel_id", channelID),
-			))
-		}
+	return recorded, dlErr
+}
+
+// completePostProcessing writes the checksum of the recorded file, records
+// the download history and copies the files to the secondary output
+// directory. The post command only runs if the post-processing succeeded.
+func (w *ChannelWatcher) completePostProcessing(
+	ctx context.Context,
+	meta api.MetaData,
+	files postProcessingFiles,
+	fnameInfo string,
+	recorded string,
+	ok bool,
+	companions ...string,
+) {
+	if w.params.WriteMetaDataJSON {
+		w.writeChecksum(ctx, fnameInfo, meta, recorded)
+	}
+	w.recordHistory(ctx, meta, files)
+	w.copyToSecondaryOutDir(ctx, files, companions...)
+	if ok {
+		w.runPostCommand(ctx, meta, files)
 	}
+}
 
-	// Concat
-	if w.params.Concat {
-		log.Info().Str("output", nameConcatenated).Str("prefix", nameConcatenatedPrefix).Msg(
-			"concatenating stream...",
-		)
-		concatOpts := []concat.Option{
-			concat.IgnoreExtension(),
-		}
-		if concatErr := concat.WithPrefix(ctx, w.params.RemuxFormat, nameConcatenatedPrefix, concatOpts...); concatErr != nil {
-			log.Error().Err(concatErr).Msg("ffmpeg concat finished with error")
-			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("channel_id", channelID),
-			))
-		}
+// writeChecksum rewrites the info json with the SHA-256 of the recorded file.
+//
+// Errors are logged and ignored.
+func (w *ChannelWatcher) writeChecksum(
+	ctx context.Context,
+	fnameInfo string,
+	meta api.MetaData,
+	recorded string,
+) {
+	log := log.Ctx(ctx)
+	digest, err := FileSHA256(recorded)
+	if err != nil {
+		log.Error().Err(err).Str("file", recorded).Msg("failed to compute sha256")
+		return
+	}
+	log.Info().Str("file", recorded).Str("sha256", digest).Msg("computed sha256")
+	if err := WriteInfoJSON(fnameInfo, RecordingMetaData{
+		MetaData: meta,
+		SHA256:   digest,
+	}); err != nil {
+		log.Error().Err(err).Msg("failed to write info json")
+	}
+}
 
-		if w.params.ExtractAudio {
-			log.Info().
-				Str("output", nameAudioConcatenated).
-				Str("prefix", nameAudioConcatenatedPrefix).
-				Msg(
-					"concatenating audio stream...",
-				)
-			concatOpts = append(concatOpts, concat.WithAudioOnly())
-			if concatErr := concat.WithPrefix(ctx, "m4a", nameAudioConcatenatedPrefix, concatOpts...); concatErr != nil {
-				log.Error().Err(concatErr).Msg("ffmpeg concat finished with error")
-				metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-					attribute.String("channel_id", channelID),
-				))
-			}
-		}
+// runPostCommand executes the PostCommand, if set.
+//
+// Errors are logged and ignored.
+func (w *ChannelWatcher) runPostCommand(
+	ctx context.Context,
+	meta api.MetaData,
+	files postProcessingFiles,
+) {
+	if w.params.PostCommand == "" {
+		return
 	}
+	if err := RunPostCommand(ctx, w.params.PostCommand, meta, files.output()); err != nil {
+		log.Ctx(ctx).Err(err).Msg("post command failed")
+	}
+}
 
-	// Delete intermediates
-	if !w.params.KeepIntermediates && w.params.Remux &&
-		probeErr == nil &&
-		remuxErr == nil &&
-		extractAudioErr == nil {
-		log.Info().Str("file", fnameStream).Msg("delete intermediate files")
-		if err := os.Remove(fnameStream); err != nil {
-			log.Err(err).Msg("couldn't delete intermediate file")
-			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
-				attribute.String("channel_id", channelID),
-			))
-		}
+// copyToSecondaryOutDir copies the output files and the companions into the
+// SecondaryOutDir, if set.
+//
+// Errors are logged and ignored.
+func (w *ChannelWatcher) copyToSecondaryOutDir(
+	ctx context.Context,
+	files postProcessingFiles,
+	companions ...string,
+) {
+	if w.params.SecondaryOutDir == "" {
+		return
 	}
+	log := log.Ctx(ctx)
+	candidates := append([]string{
+		files.output(),
+		files.audio,
+		files.concatenated,
+		files.audioConcatenated,
+		files.thumbnail,
+	}, companions...)
+	log.Info().Str("dir", w.params.SecondaryOutDir).Msg("copying files to the secondary output directory")
+	if err := CopyToSecondaryOutDir(
+		w.params.OutFormat,
+		w.params.SecondaryOutDir,
+		w.params.SecondaryOutDirFiles,
+		candidates...,
+	); err != nil {
+		log.Err(err).Msg("failed to copy files to the secondary output directory")
+	}
+}
 
-	span.AddEvent("done")
-	log.Info().Msg("done")
+// recordHistory appends the downloaded file to the download history.
+func (w *ChannelWatcher) recordHistory(
+	ctx context.Context,
+	meta api.MetaData,
+	files postProcessingFiles,
+) {
+	if !history.DefaultHistory.Enabled() {
+		return
+	}
+	log := log.Ctx(ctx)
+	file := files.output()
+	stat, err := os.Stat(file)
+	if err != nil {
+		return
+	}
+	if err := history.DefaultHistory.Append(history.Entry{
+		StreamID:    meta.Stream.UUID,
+		ChannelID:   meta.User.Username,
+		ChannelName: meta.User.Name,
+		Title:       meta.Stream.Title,
+		Description: meta.Stream.About,
+		StartedAt:   meta.Stream.StartedAt,
+		FinishedAt:  time.Now(),
+		File:        file,
+		Size:        stat.Size(),
+		Labels:      w.params.Labels,
+	}); err != nil {
+		log.Err(err).Msg("failed to write download history")
+	}
+}
 
-	return dlErr
+// reportStats periodically publishes the download statistics in the channel
+// state until the context is canceled.
+func (w *ChannelWatcher) reportStats(
+	ctx context.Context,
+	channelID string,
+	meta api.MetaData,
+	downloader *hls.Downloader,
+) {
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			state.DefaultState.SetChannelState(
+				channelID,
+				state.DownloadStateDownloading,
+				state.WithLabels(w.params.Labels),
+				state.WithExtra(map[string]interface{}{
+					"metadata": meta,
+					"stats":    downloader.Stats(),
+				}),
+			)
+		}
+	}
 }
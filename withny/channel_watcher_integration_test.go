@@ -32,7 +32,7 @@ func (suite *ChannelWatcherIntegrationTestSuite) BeforeTest(suiteName, testName
 		Jar: jar,
 	}, secret.UserPasswordFromEnv{}, secret.NewTmpCache())
 	suite.ctx = context.Background()
-	suite.impl = withny.NewChannelWatcher(suite.client, &withny.Params{
+	suite.impl = withny.NewChannelWatcher(api.NewClientPool(suite.client), &withny.Params{
 		PacketLossMax:          20,
 		OutFormat:              "{{ .Date }} {{ .Title }} ({{ .ChannelName }}).{{ .Ext }}",
 		WaitPollInterval:       10 * time.Second,
@@ -0,0 +1,322 @@
+package withny_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/utils/secret"
+	"github.com/Darkness4/withny-dl/video/concat"
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestChannelWatcherWaitTimeout(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/streams/with-rooms":
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		secret.NewFileCache(filepath.Join(t.TempDir(), "credentials")),
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+	params := withny.DefaultParams.Clone()
+	params.WaitTimeout = 100 * time.Millisecond
+	params.WaitPollInterval = 10 * time.Millisecond
+	params.WaitPollJitter = 0
+	impl := withny.NewChannelWatcher(api.NewClientPool(client), params, "channel")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Act
+	err := impl.Watch(ctx)
+
+	// Assert
+	require.ErrorIs(t, err, withny.ErrWaitTimeout)
+	require.NoError(t, ctx.Err())
+}
+
+func TestChannelWatcherHasNewStreamSkipsPaidStreams(t *testing.T) {
+	stream := func(uuid string, hasTicket bool, price string) api.GetStreamsResponseElement {
+		s := api.GetStreamsResponseElement{
+			UUID:            uuid,
+			Title:           uuid,
+			Price:           json.Number(price),
+			StreamingMethod: "HLS",
+			HasTicket:       hasTicket,
+		}
+		s.Cast.AgencySecret.ChannelName = "channel"
+		return s
+	}
+	streams := api.GetStreamsResponse{
+		stream("ticket", true, "0"),
+		stream("paid", false, "1500"),
+		stream("free", false, "0"),
+	}
+
+	tt := []struct {
+		name               string
+		skipTicketRequired bool
+		skipPaidStreams    bool
+		expectedRequested  []string
+	}{
+		{
+			name:              "no filter",
+			expectedRequested: []string{"ticket", "paid", "free"},
+		},
+		{
+			name:               "skip ticket required",
+			skipTicketRequired: true,
+			expectedRequested:  []string{"paid", "free"},
+		},
+		{
+			name:              "skip paid streams",
+			skipPaidStreams:   true,
+			expectedRequested: []string{"free"},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			var mu sync.Mutex
+			var requested []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/api/streams/with-rooms":
+					_ = json.NewEncoder(w).Encode(streams)
+				case r.URL.Path == "/api/user":
+					_, _ = w.Write([]byte(`{"username":"channel"}`))
+				case strings.HasSuffix(r.URL.Path, "/playback-url"):
+					uuid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/streams/"), "/playback-url")
+					mu.Lock()
+					requested = append(requested, uuid)
+					mu.Unlock()
+					_ = json.NewEncoder(w).Encode("https://example.com/" + uuid + ".m3u8")
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+			client := api.NewClient(
+				server.Client(),
+				nil,
+				secret.NewFileCache(filepath.Join(t.TempDir(), "credentials")),
+				api.WithBaseURL(server.URL+"/api/"),
+			)
+			params := withny.DefaultParams.Clone()
+			params.SkipTicketRequired = tc.skipTicketRequired
+			params.SkipPaidStreams = tc.skipPaidStreams
+			impl := withny.NewChannelWatcher(api.NewClientPool(client), params, "channel")
+
+			// Act
+			res, err := impl.HasNewStream(context.Background())
+
+			// Assert
+			require.NoError(t, err)
+			require.True(t, res.HasNewStream)
+			require.Equal(t, "free", res.Stream.UUID)
+			require.Equal(t, tc.expectedRequested, requested)
+		})
+	}
+}
+
+func TestChannelWatcherMaxConcurrentStreams(t *testing.T) {
+	// Arrange
+	stream := func(uuid string) api.GetStreamsResponseElement {
+		s := api.GetStreamsResponseElement{
+			UUID:            uuid,
+			Title:           uuid,
+			StreamingMethod: "HLS",
+		}
+		s.Cast.AgencySecret.ChannelName = "channel"
+		return s
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var mu sync.Mutex
+	var requested []string
+	var polls atomic.Int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/streams/with-rooms":
+			if polls.Add(1) == 1 {
+				_ = json.NewEncoder(w).Encode(api.GetStreamsResponse{stream("first")})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(api.GetStreamsResponse{stream("first"), stream("second")})
+		case r.URL.Path == "/api/user":
+			_, _ = w.Write([]byte(`{"username":"channel"}`))
+		case strings.HasSuffix(r.URL.Path, "/playback-url"):
+			uuid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/streams/"), "/playback-url")
+			mu.Lock()
+			requested = append(requested, uuid)
+			mu.Unlock()
+			_ = json.NewEncoder(w).Encode(server.URL + "/" + uuid + ".m3u8")
+		default:
+			// Keep the first stream processing until the end of the test.
+			<-ctx.Done()
+		}
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		secret.NewFileCache(filepath.Join(t.TempDir(), "credentials")),
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+	params := withny.DefaultParams.Clone()
+	params.OutFormat = filepath.Join(t.TempDir(), "{{ .Title }}.{{ .Ext }}")
+	params.WaitPollInterval = 10 * time.Millisecond
+	params.WaitPollJitter = 0
+	params.MaxConcurrentStreams = 1
+	// Avoid the default post-processing, which requires FFmpeg.
+	params.PostProcessingPipeline = []string{withny.PostProcessingStepExtractSubtitles}
+	impl := withny.NewChannelWatcher(api.NewClientPool(client), params, "channel")
+	done := make(chan error, 1)
+
+	// Act
+	go func() {
+		done <- impl.Watch(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		return polls.Load() >= 5
+	}, 4*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	// Assert
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []string{"first"}, requested)
+}
+
+func TestChannelWatcherPollBackoff(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// The first poll succeeds, then 4 polls fail, then the polls succeed again.
+	failing := map[int]bool{2: true, 3: true, 4: true, 5: true}
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/streams/with-rooms" {
+			http.NotFound(w, r)
+			return
+		}
+		if failing[int(polls.Add(1))] {
+			http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(api.GetStreamsResponse{})
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		secret.NewFileCache(filepath.Join(t.TempDir(), "credentials")),
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+	params := withny.DefaultParams.Clone()
+	params.WaitPollInterval = 50 * time.Millisecond
+	params.WaitPollJitter = 0
+	impl := withny.NewChannelWatcher(api.NewClientPool(client), params, "channel")
+	var sleeps []time.Duration
+	impl.Sleep = func(ctx context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		if len(sleeps) > 8 {
+			cancel()
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	// Act
+	err := impl.Watch(ctx)
+
+	// Assert
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, []time.Duration{
+		0, // No jitter before the first poll.
+		50 * time.Millisecond,
+		// The 4 failures back off the interval, up to 10 times the interval.
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		500 * time.Millisecond,
+		// A success resets the interval.
+		50 * time.Millisecond,
+		50 * time.Millisecond,
+		50 * time.Millisecond,
+	}, sleeps)
+}
+
+func TestChannelWatcherConcatSemaphore(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		secret.NewFileCache(filepath.Join(t.TempDir(), "credentials")),
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+	const limit = 2
+	params := withny.DefaultParams.Clone()
+	params.OutFormat = filepath.Join(t.TempDir(), "{{ .ChannelID }}.{{ .Ext }}")
+	// Avoid the other post-processing steps, which require FFmpeg.
+	params.PostProcessingPipeline = []string{withny.PostProcessingStepConcat}
+	var running, maxRunning, calls atomic.Int32
+	impl := withny.NewChannelWatcher(api.NewClientPool(client), params, "")
+	impl.PostProcessingSemaphore = semaphore.NewWeighted(limit)
+	impl.Concat = func(context.Context, string, string, ...concat.Option) error {
+		calls.Add(1)
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}
+	channels := []string{"a", "b", "c", "d", "e"}
+
+	// Act
+	var wg sync.WaitGroup
+	for _, channel := range channels {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var meta api.MetaData
+			meta.User.Username = channel
+			meta.Stream.UUID = channel
+			meta.Stream.StreamingMethod = "HLS"
+			_, _ = impl.Process(context.Background(), meta, server.URL+"/"+channel+".m3u8")
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	require.Equal(t, int32(len(channels)), calls.Load())
+	require.Equal(t, int32(limit), maxRunning.Load())
+}
@@ -3,7 +3,10 @@ package withny
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"github.com/Darkness4/withny-dl/withny/api"
 	"github.com/rs/zerolog/log"
@@ -13,10 +16,129 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// ChatFormatJSON writes the chat as a JSON array.
+	ChatFormatJSON = "json"
+	// ChatFormatJSONL writes the chat as newline-delimited JSON.
+	ChatFormatJSONL = "jsonl"
+)
+
+// ValidateChatFormat checks that the chat format is supported.
+//
+// An empty format is valid and defaults to ChatFormatJSON.
+func ValidateChatFormat(format string) error {
+	switch format {
+	case "", ChatFormatJSON, ChatFormatJSONL:
+		return nil
+	default:
+		return fmt.Errorf("unknown chat format '%s', expected '%s' or '%s'", format, ChatFormatJSON, ChatFormatJSONL)
+	}
+}
+
+// ChatExtension returns the extension of the chat file for the format.
+func ChatExtension(format string) string {
+	if format == ChatFormatJSONL {
+		return "chat.jsonl"
+	}
+	return "chat.json"
+}
+
 // Chat encapsulates the withny chat.
 type Chat struct {
 	ChannelID      string
 	OutputFileName string
+	// Reconnect retries the WebSocket connection when it disconnects.
+	Reconnect bool
+	// Format is the format of the chat file. (default: ChatFormatJSON)
+	Format string
+}
+
+// ChatGapEvent is written to the chat file when the WebSocket has been
+// reconnected, to indicate that comments may be missing.
+type ChatGapEvent struct {
+	Event          string    `json:"event"`
+	DisconnectedAt time.Time `json:"disconnectedAt"`
+	ReconnectedAt  time.Time `json:"reconnectedAt"`
+}
+
+// ChatWriter writes the chat entries as a JSON array.
+type ChatWriter struct {
+	w     io.Writer
+	count int
+}
+
+// NewChatWriter creates a new ChatWriter.
+func NewChatWriter(w io.Writer) *ChatWriter {
+	return &ChatWriter{w: w}
+}
+
+// Write appends an entry to the array.
+func (cw *ChatWriter) Write(v any) error {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if cw.count == 0 {
+		sep = "[\n"
+	}
+	if _, err := io.WriteString(cw.w, sep); err != nil {
+		return err
+	}
+	if _, err := cw.w.Write(jsonData); err != nil {
+		return err
+	}
+	cw.count++
+	return nil
+}
+
+// Close terminates the array.
+func (cw *ChatWriter) Close() error {
+	end := "\n]\n"
+	if cw.count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(cw.w, end)
+	return err
+}
+
+// ChatEntryWriter writes the chat entries.
+type ChatEntryWriter interface {
+	Write(v any) error
+	Close() error
+}
+
+// NewChatEntryWriter creates the ChatEntryWriter for the format.
+func NewChatEntryWriter(w io.Writer, format string) ChatEntryWriter {
+	if format == ChatFormatJSONL {
+		return NewChatJSONLWriter(w)
+	}
+	return NewChatWriter(w)
+}
+
+// ChatJSONLWriter writes the chat entries as newline-delimited JSON.
+type ChatJSONLWriter struct {
+	w io.Writer
+}
+
+// NewChatJSONLWriter creates a new ChatJSONLWriter.
+func NewChatJSONLWriter(w io.Writer) *ChatJSONLWriter {
+	return &ChatJSONLWriter{w: w}
+}
+
+// Write appends an entry on a new line.
+func (cw *ChatJSONLWriter) Write(v any) error {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = cw.w.Write(append(jsonData, '\n'))
+	return err
+}
+
+// Close does nothing, as each entry is already terminated.
+func (cw *ChatJSONLWriter) Close() error {
+	return nil
 }
 
 // DownloadChat downloads a withny chat.
@@ -42,8 +164,17 @@ func DownloadChat(ctx context.Context, client *api.Client, chat Chat) error {
 	}
 
 	commentsCh := make(chan *api.Comment, commentBufMax)
+	// A gap is acknowledged once written, so that no comment is received
+	// meanwhile and the comments stay in order around the gap.
+	gapsCh := make(chan ChatGapEvent)
+	gapWritten := make(chan struct{})
+	written := make(chan struct{})
+	// Return once the chat file is complete.
+	defer func() { <-written }()
 	defer close(commentsCh)
+	defer close(gapsCh)
 	go func() {
+		defer close(written)
 		file, err := os.Create(chat.OutputFileName)
 		if err != nil {
 			log.Err(err).Msg("failed to create file, cannot write comments")
@@ -51,33 +182,63 @@ func DownloadChat(ctx context.Context, client *api.Client, chat Chat) error {
 		}
 		defer file.Close()
 
-		if _, err := file.WriteString("[\n"); err != nil {
-			log.Err(err).Msg("failed to write comment")
-			return
-		}
-
-		for comment := range commentsCh {
-			jsonData, err := json.Marshal(comment)
-			if err != nil {
-				log.Err(err).Msg("failed to marshal comment")
-				continue
-			}
-			if _, err := file.Write(jsonData); err != nil {
+		w := NewChatEntryWriter(file, chat.Format)
+		writeEntry := func(v any) {
+			if err := w.Write(v); err != nil {
 				log.Err(err).Msg("failed to write comment")
 			}
-			if _, err := file.WriteString(",\n"); err != nil {
-				log.Err(err).Msg("failed to write comment")
+		}
+
+		comments, gaps := commentsCh, gapsCh
+		for comments != nil || gaps != nil {
+			select {
+			case comment, ok := <-comments:
+				if !ok {
+					comments = nil
+					continue
+				}
+				writeEntry(comment)
+			case gap, ok := <-gaps:
+				if !ok {
+					gaps = nil
+					continue
+				}
+				// The comments received before the disconnection are buffered.
+				for len(comments) > 0 {
+					writeEntry(<-comments)
+				}
+				writeEntry(gap)
+				gapWritten <- struct{}{}
 			}
 		}
 
-		if _, err := file.WriteString("]\n"); err != nil {
+		if err := w.Close(); err != nil {
 			span.RecordError(err)
 			span.SetStatus(codes.Error, err.Error())
 			log.Err(err).Msg("failed to write comment")
 			return
 		}
 	}()
-	err = ws.WatchComments(ctx, conn, suuid, commentsCh)
+
+	if chat.Reconnect {
+		err = ws.WatchCommentsWithReconnect(
+			ctx,
+			conn,
+			suuid,
+			commentsCh,
+			func(disconnectedAt, reconnectedAt time.Time) {
+				gapsCh <- ChatGapEvent{
+					Event:          "gap",
+					DisconnectedAt: disconnectedAt,
+					ReconnectedAt:  reconnectedAt,
+				}
+				<-gapWritten
+			},
+		)
+	} else {
+		err = ws.WatchComments(ctx, conn, suuid, commentsCh)
+		_ = conn.CloseNow()
+	}
 	if err != nil {
 		log.Err(err).Msg("failed to watch comments")
 		return err
@@ -0,0 +1,100 @@
+package withny_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatWriter(t *testing.T) {
+	tt := []struct {
+		name     string
+		comments []*api.Comment
+	}{
+		{
+			name:     "no comment",
+			comments: []*api.Comment{},
+		},
+		{
+			name: "one comment",
+			comments: []*api.Comment{
+				{CommentUUID: "1", Content: "hello"},
+			},
+		},
+		{
+			name: "many comments",
+			comments: []*api.Comment{
+				{CommentUUID: "1", Content: "hello"},
+				{CommentUUID: "2", Content: "world"},
+				{CommentUUID: "3", Content: "!"},
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			var buf bytes.Buffer
+			w := withny.NewChatWriter(&buf)
+
+			// Act
+			for _, comment := range tc.comments {
+				require.NoError(t, w.Write(comment))
+			}
+			require.NoError(t, w.Close())
+
+			// Assert
+			var actual []*api.Comment
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &actual))
+			require.Len(t, actual, len(tc.comments))
+			for i, comment := range tc.comments {
+				require.Equal(t, comment.CommentUUID, actual[i].CommentUUID)
+				require.Equal(t, comment.Content, actual[i].Content)
+			}
+		})
+	}
+}
+
+func TestChatJSONLWriter(t *testing.T) {
+	// Arrange
+	var buf bytes.Buffer
+	w := withny.NewChatEntryWriter(&buf, withny.ChatFormatJSONL)
+	comments := []*api.Comment{
+		{CommentUUID: "1", Content: "hello"},
+		{CommentUUID: "2", Content: "multi\nline"},
+		{CommentUUID: "3", Content: "!"},
+	}
+
+	// Act
+	for _, comment := range comments {
+		require.NoError(t, w.Write(comment))
+	}
+	require.NoError(t, w.Close())
+
+	// Assert
+	require.NotEqual(t, byte('['), buf.Bytes()[0])
+	scanner := bufio.NewScanner(&buf)
+	var actual []*api.Comment
+	for scanner.Scan() {
+		var comment api.Comment
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &comment))
+		actual = append(actual, &comment)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, actual, len(comments))
+	for i, comment := range comments {
+		require.Equal(t, comment.CommentUUID, actual[i].CommentUUID)
+		require.Equal(t, comment.Content, actual[i].Content)
+	}
+}
+
+func TestChatExtension(t *testing.T) {
+	require.Equal(t, "chat.json", withny.ChatExtension(""))
+	require.Equal(t, "chat.json", withny.ChatExtension(withny.ChatFormatJSON))
+	require.Equal(t, "chat.jsonl", withny.ChatExtension(withny.ChatFormatJSONL))
+}
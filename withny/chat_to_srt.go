@@ -0,0 +1,136 @@
+package withny
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Darkness4/withny-dl/withny/api"
+)
+
+// srtCommentDuration is how long a comment stays on screen.
+const srtCommentDuration = 5 * time.Second
+
+// ChatToSRT converts the chat entries read from r into SRT subtitles.
+//
+// Both ChatFormatJSON and ChatFormatJSONL are accepted. Each comment is shown
+// for srtCommentDuration, starting at its creation time relative to
+// startedAt. Entries that are not comments, like ChatGapEvent, are skipped.
+func ChatToSRT(w io.Writer, r io.Reader, startedAt time.Time) error {
+	br := bufio.NewReader(r)
+	dec := json.NewDecoder(br)
+	isArray, err := startsWithArray(br)
+	if err != nil {
+		return err
+	}
+	if isArray {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+
+	n := 0
+	for !isArray || dec.More() {
+		var comment api.Comment
+		if err := dec.Decode(&comment); err != nil {
+			if !isArray && errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+		if comment.CommentUUID == "" || comment.CreatedAt == nil {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339Nano, *comment.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("invalid createdAt for comment %s: %w", comment.CommentUUID, err)
+		}
+
+		start := max(createdAt.Sub(startedAt), 0)
+		n++
+		if _, err := fmt.Fprintf(
+			w,
+			"%d\n%s --> %s\n%s: %s\n\n",
+			n,
+			formatSRTTimestamp(start),
+			formatSRTTimestamp(start+srtCommentDuration),
+			comment.Username,
+			srtText(comment.Content),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteChatSRT converts the chat file input into the SRT file output.
+func WriteChatSRT(output, input string, startedAt time.Time) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	bw := bufio.NewWriter(out)
+	if err := ChatToSRT(bw, in, startedAt); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// startsWithArray reports whether the first non-space byte is '['.
+func startsWithArray(br *bufio.Reader) (bool, error) {
+	for {
+		b, err := br.Peek(1)
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = br.ReadByte()
+		default:
+			return b[0] == '[', nil
+		}
+	}
+}
+
+// formatSRTTimestamp formats d as HH:MM:SS,mmm.
+func formatSRTTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf(
+		"%02d:%02d:%02d,%03d",
+		ms/3_600_000,
+		ms/60_000%60,
+		ms/1000%60,
+		ms%1000,
+	)
+}
+
+// srtText removes the blank lines of s, as they terminate a subtitle entry.
+func srtText(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
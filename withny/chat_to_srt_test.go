@@ -0,0 +1,79 @@
+package withny_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/stretchr/testify/require"
+)
+
+const fixtureChat = `[
+{"commentUUID":"1","username":"alice","content":"hello","createdAt":"2024-01-02T03:04:07Z"},
+{"event":"gap","disconnectedAt":"2024-01-02T03:05:00Z","reconnectedAt":"2024-01-02T03:05:10Z"},
+{"commentUUID":"2","username":"bob","content":"first line\n\nsecond line","createdAt":"2024-01-02T04:05:06.789Z"},
+{"commentUUID":"3","username":"carol","content":"early","createdAt":"2024-01-02T03:04:00Z"}
+]
+`
+
+const expectedSRT = `1
+00:00:02,000 --> 00:00:07,000
+alice: hello
+
+2
+01:01:01,789 --> 01:01:06,789
+bob: first line
+second line
+
+3
+00:00:00,000 --> 00:00:05,000
+carol: early
+
+`
+
+func TestChatToSRT(t *testing.T) {
+	startedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tt := []struct {
+		name  string
+		input string
+	}{
+		{name: "json", input: fixtureChat},
+		{
+			name: "jsonl",
+			input: strings.ReplaceAll(
+				strings.TrimSuffix(strings.TrimPrefix(fixtureChat, "[\n"), "]\n"),
+				"},\n",
+				"}\n",
+			),
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			var buf bytes.Buffer
+
+			// Act
+			err := withny.ChatToSRT(&buf, strings.NewReader(tc.input), startedAt)
+
+			// Assert
+			require.NoError(t, err)
+			require.Equal(t, expectedSRT, buf.String())
+		})
+	}
+}
+
+func TestChatToSRTEmpty(t *testing.T) {
+	// Arrange
+	var buf bytes.Buffer
+
+	// Act
+	err := withny.ChatToSRT(&buf, strings.NewReader("[]\n"), time.Now())
+
+	// Assert
+	require.NoError(t, err)
+	require.Empty(t, buf.String())
+}
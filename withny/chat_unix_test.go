@@ -0,0 +1,147 @@
+//go:build !windows
+
+package withny_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/utils/secret"
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// redirectTransport sends every request to the test server.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestDownloadChatGapOrder(t *testing.T) {
+	// Arrange
+	const commentsPerConnection = 100
+	// Fill the pipe, so that the comments are still buffered on disconnection.
+	content := strings.Repeat("a", 1024)
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/channels/") {
+			_, _ = w.Write(
+				[]byte(`<script>"https:\u002F\u002Fexample.appsync-api.test\u002Fgraphql"</script>` +
+					`<div uuid="stream"></div>`),
+			)
+			return
+		}
+		conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
+			Subprotocols:   []string{"graphql-ws"},
+			OriginPatterns: []string{"*"},
+		})
+		if err != nil {
+			return
+		}
+		defer conn.CloseNow()
+		// Discard the connection init and the subscription.
+		ctx := r.Context()
+		go func() {
+			for {
+				if _, _, err := conn.Read(ctx); err != nil {
+					return
+				}
+			}
+		}()
+		n := connections.Add(1)
+		for i := range commentsPerConnection {
+			_ = conn.Write(ctx, websocket.MessageText, []byte(fmt.Sprintf(
+				`{"type":"data","payload":{"data":{"onPostComment":{"commentUUID":"%d-%d","content":"%s"}}}}`,
+				n,
+				i,
+				content,
+			)))
+		}
+		if n == 1 {
+			// Drop the first connection.
+			_ = conn.Close(websocket.StatusInternalError, "unexpected error")
+			return
+		}
+		_ = conn.Close(websocket.StatusNormalClosure, "")
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	client := api.NewClient(
+		&http.Client{Transport: redirectTransport{target: target}},
+		nil,
+		secret.NewFileCache(filepath.Join(t.TempDir(), "credentials")),
+	)
+	// The chat is read slowly through a named pipe, so that the comments are
+	// written after the disconnection.
+	output := filepath.Join(t.TempDir(), "chat.jsonl")
+	require.NoError(t, syscall.Mkfifo(output, 0o600))
+	entriesCh := make(chan []string, 1)
+	go func() {
+		var entries []string
+		f, err := os.Open(output)
+		if err != nil {
+			entriesCh <- nil
+			return
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry struct {
+				CommentUUID string `json:"commentUUID"`
+				Event       string `json:"event"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				entries = append(entries, err.Error())
+				continue
+			}
+			entries = append(entries, entry.CommentUUID+entry.Event)
+			time.Sleep(time.Millisecond)
+		}
+		entriesCh <- entries
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Act
+	err = withny.DownloadChat(ctx, client, withny.Chat{
+		ChannelID:      "channel",
+		OutputFileName: output,
+		Reconnect:      true,
+		Format:         withny.ChatFormatJSONL,
+	})
+
+	// Assert
+	require.ErrorIs(t, err, io.EOF)
+	require.EqualValues(t, 2, connections.Load())
+	expected := make([]string, 0, 2*commentsPerConnection+1)
+	for i := range commentsPerConnection {
+		expected = append(expected, fmt.Sprintf("1-%d", i))
+	}
+	expected = append(expected, "gap")
+	for i := range commentsPerConnection {
+		expected = append(expected, fmt.Sprintf("2-%d", i))
+	}
+	require.Equal(t, expected, <-entriesCh)
+}
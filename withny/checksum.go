@@ -0,0 +1,46 @@
+package withny
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/Darkness4/withny-dl/withny/api"
+)
+
+// RecordingMetaData is the metadata of a recording, written in the info json.
+type RecordingMetaData struct {
+	api.MetaData
+	// SHA256 is the hex-encoded SHA-256 digest of the recorded file.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// FileSHA256 returns the hex-encoded SHA-256 digest of the file.
+//
+// The file is streamed and never loaded entirely in memory.
+func FileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WriteInfoJSON writes the metadata as indented json in the file.
+func WriteInfoJSON(path string, v any) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,58 @@
+package withny_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSHA256(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "fixture.ts")
+	require.NoError(t, os.WriteFile(path, []byte("hello world\n"), 0o644))
+
+	// Act
+	digest, err := withny.FileSHA256(path)
+
+	// Assert
+	require.NoError(t, err)
+	// Output of: printf 'hello world\n' | sha256sum
+	require.Equal(t, "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447", digest)
+}
+
+func TestFileSHA256NotExist(t *testing.T) {
+	// Act
+	_, err := withny.FileSHA256(filepath.Join(t.TempDir(), "missing.ts"))
+
+	// Assert
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestWriteInfoJSON(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "stream.info.json")
+	meta := withny.RecordingMetaData{
+		MetaData: api.MetaData{
+			User: api.GetUserResponse{Username: "channel"},
+		},
+		SHA256: "abc",
+	}
+
+	// Act
+	err := withny.WriteInfoJSON(path, meta)
+
+	// Assert
+	require.NoError(t, err)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(b, &got))
+	require.Equal(t, "abc", got["sha256"])
+	require.Contains(t, got, "User")
+	require.Contains(t, got, "Stream")
+}
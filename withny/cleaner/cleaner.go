@@ -1,4 +1,4 @@
-// Package cleaner provides functions to clean old .ts files.
+// Package cleaner provides functions to clean old .ts and .lock files.
 package cleaner
 
 import (
@@ -34,7 +34,9 @@ type Option func(*Options)
 type Options struct {
 	dryRun      bool
 	probe       bool
+	recursive   bool
 	eligibleAge time.Duration
+	olderThan   time.Duration
 }
 
 // WithDryRun sets the dryRun option.
@@ -65,9 +67,32 @@ func WithEligibleAge(d time.Duration) Option {
 	}
 }
 
+// WithRecursive sets whether the subdirectories are scanned. (default: true)
+func WithRecursive(recursive bool) Option {
+	return func(o *Options) {
+		o.recursive = recursive
+	}
+}
+
+// WithOlderThan sets the minimum time since the modtime of a .ts file to be deleted.
+//
+// Unlike WithEligibleAge, which applies to the .combined file, it applies to
+// each deleted file. A value <= 0 disables the check. (default: 0)
+func WithOlderThan(d time.Duration) Option {
+	return func(o *Options) {
+		o.olderThan = d
+	}
+}
+
+// isOldEnough returns true if the file is older than the olderThan option.
+func (o *Options) isOldEnough(modTime time.Time) bool {
+	return o.olderThan <= 0 || time.Since(modTime) > o.olderThan
+}
+
 func applyOptions(opts []Option) *Options {
 	o := &Options{
 		probe:       true,
+		recursive:   true,
 		eligibleAge: 48 * time.Hour,
 	}
 	for _, opt := range opts {
@@ -98,6 +123,24 @@ func Scan(
 			return err
 		}
 
+		if d.IsDir() && !o.recursive && path != scanDirectory {
+			return fs.SkipDir
+		}
+
+		if !d.IsDir() && filepath.Ext(d.Name()) == ".lock" {
+			// Lock files left by a crashed download.
+			finfo, err := d.Info()
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				return err
+			}
+			if time.Since(finfo.ModTime()) > o.eligibleAge && o.isOldEnough(finfo.ModTime()) {
+				set[path] = true
+			}
+			return nil
+		}
+
 		if !d.IsDir() {
 			name := strings.TrimSuffix(d.Name(), filepath.Ext(d.Name()))
 			if strings.HasSuffix(name, ".combined") {
@@ -154,6 +197,16 @@ func Scan(
 						!strings.Contains(entry.Name(), ".combined.") &&
 						!entry.IsDir() {
 
+						finfo, err := entry.Info()
+						if err != nil {
+							span.RecordError(err)
+							span.SetStatus(codes.Error, err.Error())
+							return err
+						}
+						if !o.isOldEnough(finfo.ModTime()) {
+							continue
+						}
+
 						fpath := filepath.Join(dir, entry.Name())
 						set[fpath] = true
 					}
@@ -190,6 +243,8 @@ func Clean(scanDirectory string, opts ...Option) error {
 		attribute.Bool("dry_run", o.dryRun),
 		attribute.Bool("probe", o.probe),
 		attribute.Float64("eligible_age", o.eligibleAge.Seconds()),
+		attribute.Bool("recursive", o.recursive),
+		attribute.Float64("older_than", o.olderThan.Seconds()),
 	}
 
 	_, span := otel.Tracer(tracerName).
@@ -213,13 +268,15 @@ func Clean(scanDirectory string, opts ...Option) error {
 	}
 
 	for _, path := range queueForDeletion {
+		if o.dryRun {
+			log.Info().Str("path", path).Msg("dry run: would delete old .ts file")
+			continue
+		}
 		log.Info().Str("path", path).Msg("deleting old .ts file")
-		if !o.dryRun {
-			if err := os.Remove(path); err != nil {
-				log.Err(err).Str("path", path).Msg("failed to delete old .ts file, skipping...")
-			} else {
-				metrics.Cleaner.FilesRemoved.Add(context.Background(), 1)
-			}
+		if err := os.Remove(path); err != nil {
+			log.Err(err).Str("path", path).Msg("failed to delete old .ts file, skipping...")
+		} else {
+			metrics.Cleaner.FilesRemoved.Add(context.Background(), 1)
 		}
 	}
 
@@ -210,3 +210,93 @@ func requireSlicesEqual(t *testing.T, expected, actual []string) {
 		return
 	}
 }
+
+func TestScanLockFiles(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "stale.lock")
+	fresh := filepath.Join(dir, "sub", "fresh.lock")
+	require.NoError(t, os.MkdirAll(filepath.Dir(fresh), 0o700))
+	require.NoError(t, os.WriteFile(stale, nil, 0o600))
+	require.NoError(t, os.WriteFile(fresh, nil, 0o600))
+	require.NoError(t, os.Chtimes(stale, time.Unix(0, 0), time.Unix(0, 0)))
+
+	// Act
+	queueForDeletion, queueForRenaming, err := cleaner.Scan(dir, cleaner.WithoutProbe())
+
+	// Assert
+	require.NoError(t, err)
+	require.Equal(t, []string{stale}, queueForDeletion)
+	require.Empty(t, queueForRenaming)
+}
+
+func TestScanRecursiveOlderThan(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	old := time.Now().Add(-72 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	files := map[string]time.Time{
+		"a.combined.mp4":         old,
+		"a.0.ts":                 old,
+		"a.1.ts":                 recent,
+		"channel/b.combined.mp4": old,
+		"channel/b.0.ts":         old,
+		"channel/b.1.ts":         recent,
+	}
+	for file, modTime := range files {
+		path := filepath.Join(dir, file)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(t, os.WriteFile(path, []byte("test"), 0o600))
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	tests := []struct {
+		name             string
+		opts             []cleaner.Option
+		expectedDeletion []string
+		expectedRenaming []string
+	}{
+		{
+			name: "recursive",
+			expectedDeletion: []string{
+				"a.0.ts", "a.1.ts", "channel/b.0.ts", "channel/b.1.ts",
+			},
+			expectedRenaming: []string{"a.combined.mp4", "channel/b.combined.mp4"},
+		},
+		{
+			name:             "not recursive",
+			opts:             []cleaner.Option{cleaner.WithRecursive(false)},
+			expectedDeletion: []string{"a.0.ts", "a.1.ts"},
+			expectedRenaming: []string{"a.combined.mp4"},
+		},
+		{
+			name:             "older than",
+			opts:             []cleaner.Option{cleaner.WithOlderThan(24 * time.Hour)},
+			expectedDeletion: []string{"a.0.ts", "channel/b.0.ts"},
+			expectedRenaming: []string{"a.combined.mp4", "channel/b.combined.mp4"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			queueForDeletion, queueForRenaming, err := cleaner.Scan(
+				dir,
+				append([]cleaner.Option{cleaner.WithoutProbe()}, tt.opts...)...,
+			)
+
+			// Assert
+			require.NoError(t, err)
+			expectedDeletion := make([]string, 0, len(tt.expectedDeletion))
+			for _, file := range tt.expectedDeletion {
+				expectedDeletion = append(expectedDeletion, filepath.Join(dir, file))
+			}
+			expectedRenaming := make([]string, 0, len(tt.expectedRenaming))
+			for _, file := range tt.expectedRenaming {
+				expectedRenaming = append(expectedRenaming, filepath.Join(dir, file))
+			}
+			requireSlicesEqual(t, expectedDeletion, queueForDeletion)
+			requireSlicesEqual(t, expectedRenaming, queueForRenaming)
+		})
+	}
+}
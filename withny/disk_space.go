@@ -0,0 +1,59 @@
+package withny
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Darkness4/withny-dl/telemetry/metrics"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ErrInsufficientDisk is returned when the output filesystem has not enough space available.
+var ErrInsufficientDisk = errors.New("insufficient disk space")
+
+// StatfsFunc returns the number of bytes available on the filesystem containing the path.
+type StatfsFunc func(path string) (uint64, error)
+
+// DefaultStatfs queries the filesystem for the available bytes.
+var DefaultStatfs StatfsFunc = availableDiskBytes
+
+// checkDiskSpace returns ErrInsufficientDisk if less than minFree bytes are available in dir.
+//
+// The check is skipped if minFree is not positive or if the filesystem cannot be queried.
+func checkDiskSpace(
+	ctx context.Context,
+	statfs StatfsFunc,
+	dir string,
+	channelID string,
+	minFree int64,
+) error {
+	if minFree <= 0 {
+		return nil
+	}
+	log := log.Ctx(ctx)
+	if statfs == nil {
+		statfs = DefaultStatfs
+	}
+	available, err := statfs(dir)
+	if err != nil {
+		log.Warn().Err(err).Str("dir", dir).Msg("failed to query disk space, skipping check")
+		return nil
+	}
+	metrics.Disk.Available.Record(ctx, int64(available))
+	if available < uint64(minFree) {
+		metrics.Downloads.InsufficientDisk.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("channel_id", channelID),
+		))
+		return fmt.Errorf(
+			"%w: %d bytes available in %s, %d required",
+			ErrInsufficientDisk,
+			available,
+			dir,
+			minFree,
+		)
+	}
+	return nil
+}
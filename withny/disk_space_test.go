@@ -0,0 +1,77 @@
+package withny_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadLiveStreamDiskSpace(t *testing.T) {
+	tests := []struct {
+		name      string
+		available uint64
+		statfsErr error
+		minFree   int64
+		expected  error
+	}{
+		{
+			name:      "insufficient disk space",
+			available: 1024,
+			minFree:   2048,
+			expected:  withny.ErrInsufficientDisk,
+		},
+		{
+			name:      "enough disk space",
+			available: 4096,
+			minFree:   2048,
+			expected:  api.UnsupportedStreamingMethodError{Method: "webrtc"},
+		},
+		{
+			name:      "check disabled",
+			available: 0,
+			minFree:   0,
+			expected:  api.UnsupportedStreamingMethodError{Method: "webrtc"},
+		},
+		{
+			name:      "statfs failure",
+			statfsErr: errors.New("statfs failed"),
+			minFree:   2048,
+			expected:  api.UnsupportedStreamingMethodError{Method: "webrtc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			fName := filepath.Join(t.TempDir(), "stream.ts")
+			params := withny.DefaultParams.Clone()
+			params.MinFreeDiskBytes = tt.minFree
+			var queried string
+
+			// Act
+			_, err := withny.DownloadLiveStream(context.Background(), nil, withny.LiveStream{
+				MetaData: api.MetaData{
+					Stream: api.GetStreamsResponseElement{StreamingMethod: "webrtc"},
+				},
+				Params:         params,
+				OutputFileName: fName,
+				Statfs: func(path string) (uint64, error) {
+					queried = path
+					return tt.available, tt.statfsErr
+				},
+			})
+
+			// Assert
+			require.ErrorIs(t, err, tt.expected)
+			if tt.minFree > 0 {
+				require.Equal(t, filepath.Dir(fName), queried)
+			}
+			require.NoFileExists(t, fName)
+		})
+	}
+}
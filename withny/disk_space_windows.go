@@ -0,0 +1,9 @@
+//go:build windows
+
+package withny
+
+import "errors"
+
+func availableDiskBytes(_ string) (uint64, error) {
+	return 0, errors.New("disk space check is not supported on windows")
+}
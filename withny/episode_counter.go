@@ -0,0 +1,64 @@
+package withny
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+)
+
+// EpisodeCounter counts the episodes per channel.
+//
+// The counts are persisted in a JSON file. If the path is empty, the counts are
+// kept in memory.
+type EpisodeCounter struct {
+	path   string
+	counts map[string]int
+	mu     sync.Mutex
+}
+
+// NewEpisodeCounter loads the episode counter from the JSON file at path.
+func NewEpisodeCounter(path string) (*EpisodeCounter, error) {
+	c := &EpisodeCounter{
+		path:   path,
+		counts: make(map[string]int),
+	}
+	if path == "" {
+		return c, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c.counts); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// Get returns the current episode number of the channel.
+func (c *EpisodeCounter) Get(channelID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[channelID]
+}
+
+// Next increments and returns the episode number of the channel.
+//
+// The new count is persisted. On error, the incremented count is still returned.
+func (c *EpisodeCounter) Next(channelID string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[channelID]++
+	n := c.counts[channelID]
+	if c.path == "" {
+		return n, nil
+	}
+	b, err := json.MarshalIndent(c.counts, "", "  ")
+	if err != nil {
+		return n, err
+	}
+	return n, os.WriteFile(c.path, b, 0o644)
+}
@@ -0,0 +1,33 @@
+package withny_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpisodeCounter(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "episodes.json")
+	counter, err := withny.NewEpisodeCounter(path)
+	require.NoError(t, err)
+
+	// Act
+	first, errFirst := counter.Next("a")
+	second, errSecond := counter.Next("a")
+	other, errOther := counter.Next("b")
+	reloaded, errReload := withny.NewEpisodeCounter(path)
+
+	// Assert
+	require.NoError(t, errFirst)
+	require.NoError(t, errSecond)
+	require.NoError(t, errOther)
+	require.NoError(t, errReload)
+	require.Equal(t, 1, first)
+	require.Equal(t, 2, second)
+	require.Equal(t, 1, other)
+	require.Equal(t, 2, reloaded.Get("a"))
+	require.Equal(t, 1, reloaded.Get("b"))
+}
@@ -16,6 +16,7 @@ func PrepareFileAutoRename(
 	meta api.MetaData,
 	labels map[string]string,
 	ext string,
+	opts ...FormatOption,
 ) (fName string, err error) {
 	n := 0
 	// Find unique name
@@ -26,7 +27,7 @@ func PrepareFileAutoRename(
 		} else {
 			extn = fmt.Sprintf("%d.%s", n, ext)
 		}
-		fName, err = FormatOutput(outFormat, meta, labels, extn)
+		fName, err = FormatOutput(outFormat, meta, labels, extn, opts...)
 		if err != nil {
 			log.Error().Err(err).Msg("failed to format output")
 			return "", err
@@ -50,8 +51,9 @@ func PrepareFile(
 	meta api.MetaData,
 	labels map[string]string,
 	ext string,
+	opts ...FormatOption,
 ) (fName string, err error) {
-	fName, err = FormatOutput(outFormat, meta, labels, ext)
+	fName, err = FormatOutput(outFormat, meta, labels, ext, opts...)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to format output")
 		return "", err
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/Darkness4/withny-dl/withny"
 	"github.com/Darkness4/withny-dl/withny/api"
@@ -35,4 +36,45 @@ func TestPrepareFile(t *testing.T) {
 	}, withny.DefaultParams.Labels, "mp4")
 	require.NoError(t, err)
 	require.Equal(t, fmt.Sprintf("%s/test.1.mp4", dir), fName)
+
+	format = fmt.Sprintf("%s/{{ .ChannelProfileText }}/{{ .StreamAbout }}.{{ .Ext }}", dir)
+	fName, err = withny.PrepareFileAutoRename(format, api.MetaData{
+		User: api.GetUserResponse{
+			ProfileText: "Hello/World",
+		},
+		Stream: api.GetStreamsResponseElement{
+			Title: "test",
+			About: "Event #3: Karaoke?\n",
+		},
+	}, withny.DefaultParams.Labels, "mp4")
+	require.NoError(t, err)
+	require.Equal(t, fmt.Sprintf("%s/Hello_World/Event #3_ Karaoke_.mp4", dir), fName)
+}
+
+func TestPrepareFileStartedAt(t *testing.T) {
+	dir, err := os.MkdirTemp("", "test")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	startedAt := time.Date(2024, 12, 31, 21, 0, 0, 0, time.UTC)
+
+	format := fmt.Sprintf("%s/{{ .StartedAtDate }} {{ .StartedAtTime }} {{ .Title }}.{{ .Ext }}", dir)
+	fName, err := withny.PrepareFileAutoRename(format, api.MetaData{
+		Stream: api.GetStreamsResponseElement{
+			Title:     "test",
+			StartedAt: startedAt,
+		},
+	}, withny.DefaultParams.Labels, "mp4")
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		fmt.Sprintf(
+			"%s/%s %s test.mp4",
+			dir,
+			startedAt.Local().Format("2006-01-02"),
+			startedAt.Local().Format("150405"),
+		),
+		fName,
+	)
 }
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/Darkness4/withny-dl/hls"
@@ -25,10 +26,28 @@ type LiveStream struct {
 	Params         *Params
 	OutputFileName string
 	PlaybackURL    string
+	// OnDownloadStart is called with the selected downloader right before
+	// the download starts.
+	OnDownloadStart func(downloader *hls.Downloader)
+	// Statfs queries the available disk space. (default: DefaultStatfs)
+	Statfs StatfsFunc
+	// NextOutputFileName returns the name of the next file when
+	// Params.SplitDuration is set.
+	NextOutputFileName func() (string, error)
+	// OnSplit is called with the name of every new file created when
+	// Params.SplitDuration is set.
+	OnSplit func(fname string)
+	// OnQualityDowngrade is called right before the download starts if the
+	// selected playlist is not the best one requested, either because no
+	// playlist matches the QualityConstraint, or because the better
+	// playlists are unreachable.
+	OnQualityDowngrade func(requestedQuality string, playlist api.Playlist)
 }
 
 // DownloadLiveStream downloads a withny live stream.
-func DownloadLiveStream(ctx context.Context, client *api.Client, ls LiveStream) error {
+//
+// It returns the playlist which has been downloaded.
+func DownloadLiveStream(ctx context.Context, client *api.Client, ls LiveStream) (api.Playlist, error) {
 	log := log.Ctx(ctx)
 	ctx, span := otel.Tracer(tracerName).Start(ctx, "withny.downloadStream", trace.WithAttributes(
 		attribute.String("channel_id", ls.MetaData.User.Username),
@@ -36,58 +55,133 @@ func DownloadLiveStream(ctx context.Context, client *api.Client, ls LiveStream)
 	))
 	defer span.End()
 
+	if err := checkDiskSpace(
+		ctx,
+		ls.Statfs,
+		filepath.Dir(ls.OutputFileName),
+		ls.MetaData.User.Username,
+		ls.Params.MinFreeDiskBytes,
+	); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Error().Err(err).Msg("not enough disk space to start the download")
+		return api.Playlist{}, err
+	}
+
+	if err := api.CheckStreamingMethod(ls.MetaData.Stream); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Warn().Err(err).Msg("stream cannot be downloaded")
+		return api.Playlist{}, err
+	}
+
 	// Fetch playlist
 	playlists, err := client.GetPlaylists(ctx, ls.PlaybackURL)
 	if err != nil {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("failed to fetch playlists")
-		return err
+		return api.Playlist{}, err
 	}
 	if len(playlists) == 0 {
 		err := errors.New("no playlists found")
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("no playlists found")
-		return err
+		return api.Playlist{}, err
 	}
 
-	var downloader *hls.Downloader
-	constraint := ls.Params.QualityConstraint
-	for {
-		playlist, ok := api.GetBestPlaylist(playlists, constraint)
-		if !ok {
-			log.Warn().
-				Any("playlists", playlists).
-				Any("fallback", playlists[0]).
-				Any("constraint", constraint).
-				Msg("no playlist found with current constraint")
-			playlist = playlists[0]
-		}
+	candidates := api.SortPlaylists(playlists, ls.Params.QualityConstraint)
+	matched := len(candidates) > 0
+	if !matched {
+		log.Warn().
+			Any("playlists", playlists).
+			Any("fallback", playlists[0]).
+			Any("constraint", ls.Params.QualityConstraint).
+			Msg("no playlist found with current constraint")
+		candidates = playlists[:1]
+	}
 
-		downloader = hls.NewDownloader(
-			client,
-			log,
-			ls.Params.PacketLossMax,
-			playlist.URL,
-		)
+	var opts []hls.Option
+	if ls.Params.BandwidthLimit > 0 {
+		opts = append(opts, hls.WithBandwidthLimit(ls.Params.BandwidthLimit))
+	}
+	if ls.Params.MaxFragmentSize > 0 {
+		opts = append(opts, hls.WithMaxFragmentSize(ls.Params.MaxFragmentSize))
+	}
+	if ls.Params.FragmentConcurrency > 1 {
+		opts = append(opts, hls.WithFragmentConcurrency(ls.Params.FragmentConcurrency))
+	}
+	if ls.Params.IdleTimeout > 0 {
+		opts = append(opts, hls.WithIdleTimeout(ls.Params.IdleTimeout))
+	}
+	if ls.Params.WriteFragmentIndex {
+		indexFile, err := os.Create(ls.OutputFileName + ".frag.jsonl")
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			log.Err(err).Msg("failed to create fragment index file")
+			return api.Playlist{}, err
+		}
+		defer indexFile.Close()
+		opts = append(opts, hls.WithFragmentIndex(indexFile))
+	}
 
-		if ok, err := try.DoWithResult(5, 5*time.Second, func() (bool, error) {
-			return downloader.Probe(ctx)
-		}); !ok || err != nil {
-			log.Warn().Err(err).Msg("failed to fetch playlist, switching to next playlist")
-			constraint.Ignored = append(constraint.Ignored, playlist.URL)
+	var splitWriter *SplitWriter
+	if ls.Params.SplitDuration > 0 {
+		splitWriter = &SplitWriter{
+			FileName:      ls.OutputFileName,
+			SplitDuration: ls.Params.SplitDuration,
+			NextFileName:  ls.NextOutputFileName,
+			OnSplit: func(fname string) {
+				log.Info().Str("fname", fname).Msg("splitting stream into a new file")
+				if ls.OnSplit != nil {
+					ls.OnSplit(fname)
+				}
+			},
 		}
+		defer splitWriter.Close()
+		opts = append(opts, hls.WithFragmentWriter(splitWriter))
+	}
+
+	opts = append(opts, hls.WithFirstFragmentCallback(func(d time.Duration) {
+		log.Info().Dur("elapsed", d).Msg("first fragment written")
+		metrics.Downloads.TimeToFirstFragment.Record(
+			ctx,
+			d.Seconds(),
+			metric.WithAttributes(
+				attribute.String("channel_id", ls.MetaData.User.Username),
+			),
+		)
+	}))
 
-		if ok {
-			log.Info().Any("playlist", playlist).Msg("received new HLS info")
-			span.AddEvent("playlist received", trace.WithAttributes(
-				attribute.String("url", playlist.URL),
-				attribute.String("format", playlist.Video),
-			))
-			break
+	downloader, playlist, err := probeBestPlaylist(
+		ctx,
+		client,
+		ls.Params.PacketLossMax,
+		candidates,
+		opts...,
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Err(err).Msg("failed to probe playlists")
+		return api.Playlist{}, err
+	}
+	log.Info().Any("playlist", playlist).Msg("received new HLS info")
+	if requested, ok := qualityDowngrade(candidates[0], playlist, matched, ls.Params.QualityConstraint); ok {
+		log.Warn().
+			Str("requested", requested).
+			Str("actual", playlist.Quality()).
+			Msg("downloading a lower quality than requested")
+		if ls.OnQualityDowngrade != nil {
+			ls.OnQualityDowngrade(requested, playlist)
 		}
 	}
+	span.AddEvent("playlist received", trace.WithAttributes(
+		attribute.String("url", playlist.URL),
+		attribute.String("format", playlist.Video),
+	))
 
 	metrics.TimeEndRecording(
 		ctx,
@@ -113,24 +207,132 @@ func DownloadLiveStream(ctx context.Context, client *api.Client, ls LiveStream)
 	))
 
 	// Actually download. It will block until the download is finished.
-	file, err := os.Create(ls.OutputFileName)
-	if err != nil {
+	// The split writer creates its files on the first fragment.
+	var file *os.File
+	var out io.Writer = io.Discard
+	if splitWriter == nil {
+		file, err = os.Create(ls.OutputFileName)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			log.Err(err).Msg("failed to create file")
+			return api.Playlist{}, err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if ls.OnDownloadStart != nil {
+		ls.OnDownloadStart(downloader)
+	}
+
+	err = downloader.Read(ctx, out)
+	if errors.Is(err, hls.ErrEncryptedStream) {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
-		log.Err(err).Msg("failed to create file")
-		return err
+		log.Error().Err(err).Msg("stream is encrypted and cannot be downloaded, skipping")
+		// Nothing has been written.
+		if file != nil {
+			_ = file.Close()
+			if err := os.Remove(ls.OutputFileName); err != nil {
+				log.Warn().Err(err).Msg("failed to remove empty stream file")
+			}
+		}
+		return playlist, err
 	}
-	defer file.Close()
-
-	if err = downloader.Read(ctx, file); err != nil && !errors.Is(err, io.EOF) &&
-		!errors.Is(err, context.Canceled) {
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, context.Canceled) {
 		span.RecordError(err)
 		span.SetStatus(codes.Error, err.Error())
 		log.Err(err).Msg("failed to download")
-		return err
+		return playlist, err
 	}
 
 	span.AddEvent("done")
 	log.Info().Msg("done")
-	return nil
+	return playlist, nil
+}
+
+// qualityDowngrade returns the requested quality if the selected playlist
+// is worse than the best advertised candidate, or does not match the
+// constraint.
+func qualityDowngrade(
+	best api.Playlist,
+	selected api.Playlist,
+	matched bool,
+	constraint api.PlaylistConstraint,
+) (string, bool) {
+	if selected.URL != best.URL {
+		return best.Quality(), true
+	}
+	if !matched {
+		return constraint.String(), true
+	}
+	return "", false
+}
+
+// probeBestPlaylist probes the candidates concurrently and returns the
+// downloader of the best reachable playlist.
+//
+// The candidates must be sorted from the best to the worst. The remaining
+// probes are canceled as soon as the best reachable playlist is known.
+func probeBestPlaylist(
+	ctx context.Context,
+	client *api.Client,
+	packetLossMax int,
+	candidates []api.Playlist,
+	opts ...hls.Option,
+) (*hls.Downloader, api.Playlist, error) {
+	log := log.Ctx(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type probeResult struct {
+		idx int
+		ok  bool
+		err error
+	}
+
+	downloaders := make([]*hls.Downloader, len(candidates))
+	results := make(chan probeResult, len(candidates))
+	for i, playlist := range candidates {
+		downloaders[i] = hls.NewDownloader(client, log, packetLossMax, playlist.URL, opts...)
+		go func(i int, downloader *hls.Downloader) {
+			ok, err := try.DoWithResult(ctx, 5, 5*time.Second, func() (bool, error) {
+				return downloader.Probe(ctx)
+			})
+			results <- probeResult{idx: i, ok: ok, err: err}
+		}(i, downloaders[i])
+	}
+
+	// statuses: 0 = pending, 1 = reachable, -1 = unreachable.
+	statuses := make([]int, len(candidates))
+	var lastErr error
+	for range candidates {
+		res := <-results
+		if res.ok && res.err == nil {
+			statuses[res.idx] = 1
+		} else {
+			statuses[res.idx] = -1
+			lastErr = res.err
+			log.Warn().
+				Err(res.err).
+				Str("url", candidates[res.idx].URL).
+				Msg("failed to fetch playlist, switching to next playlist")
+		}
+
+		// Select the best playlist once every better playlist has failed.
+		for i, status := range statuses {
+			if status == 0 {
+				break
+			}
+			if status == 1 {
+				return downloaders[i], candidates[i], nil
+			}
+		}
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("no reachable playlist")
+	}
+	return nil, api.Playlist{}, lastErr
 }
@@ -0,0 +1,93 @@
+package withny_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/hls"
+	"github.com/Darkness4/withny-dl/utils/secret"
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadLiveStreamQualityDowngrade(t *testing.T) {
+	tt := []struct {
+		name              string
+		bestReachable     bool
+		expectedRequested string
+		expectedQuality   string
+	}{
+		{
+			name:          "best playlist reachable",
+			bestReachable: true,
+		},
+		{
+			name:              "best playlist unreachable",
+			bestReachable:     false,
+			expectedRequested: "1920x1080@60fps 6000kbps",
+			expectedQuality:   "1280x720@30fps 3000kbps",
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/master.m3u8":
+					fmt.Fprintf(w, `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,VIDEO="1080p60",FRAME-RATE=60.000
+%[1]s/1080.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,VIDEO="720p30",FRAME-RATE=30.000
+%[1]s/720.m3u8
+`, server.URL)
+				case "/1080.m3u8":
+					if !tc.bestReachable {
+						http.NotFound(w, r)
+						return
+					}
+					fallthrough
+				case "/720.m3u8":
+					fmt.Fprintf(w, "#EXTM3U\n#EXT-X-TARGETDURATION:1\n#EXTINF:1.0,\n%s/0.ts\n", server.URL)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer server.Close()
+			client := api.NewClient(server.Client(), secret.UserPasswordFromEnv{}, secret.NewTmpCache())
+			params := withny.DefaultParams.Clone()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var requested, quality string
+
+			// Act
+			_, err := withny.DownloadLiveStream(ctx, client, withny.LiveStream{
+				MetaData: api.MetaData{
+					Stream: api.GetStreamsResponseElement{StreamingMethod: "HLS"},
+				},
+				Params:         params,
+				OutputFileName: filepath.Join(t.TempDir(), "stream.ts"),
+				PlaybackURL:    server.URL + "/master.m3u8",
+				OnQualityDowngrade: func(requestedQuality string, playlist api.Playlist) {
+					requested = requestedQuality
+					quality = playlist.Quality()
+				},
+				// Stop right after the playlist selection.
+				OnDownloadStart: func(*hls.Downloader) {
+					cancel()
+				},
+			})
+
+			// Assert
+			require.NoError(t, err)
+			require.Equal(t, tc.expectedRequested, requested)
+			require.Equal(t, tc.expectedQuality, quality)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package withny
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrAlreadyDownloading is returned when another process is downloading the same stream.
+var ErrAlreadyDownloading = errors.New("stream is already being downloaded")
+
+const (
+	// LockStaleAfter is the age after which a lock file is considered abandoned.
+	LockStaleAfter = 5 * time.Minute
+	// lockRefreshInterval is the interval at which a held lock file is touched.
+	lockRefreshInterval = time.Minute
+)
+
+// AcquireLock creates the lock file exclusively.
+//
+// It returns ErrAlreadyDownloading if the lock is held by another process.
+// The lock file is touched periodically until released, so that a lock left
+// by a crashed process is taken over once it is older than LockStaleAfter.
+// This also works across hosts sharing the output directory.
+func AcquireLock(path string) (release func(), err error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		stat, statErr := os.Stat(path)
+		if statErr != nil || time.Since(stat.ModTime()) <= LockStaleAfter {
+			return nil, ErrAlreadyDownloading
+		}
+		log.Warn().Str("path", path).Time("modTime", stat.ModTime()).Msg("taking over stale lock")
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			return nil, ErrAlreadyDownloading
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	_, err = fmt.Fprintf(file, "%s %d\n", hostname, os.Getpid())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				now := time.Now()
+				if err := os.Chtimes(path, now, now); err != nil {
+					log.Err(err).Str("path", path).Msg("failed to refresh lock")
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		if err := os.Remove(path); err != nil {
+			log.Err(err).Str("path", path).Msg("failed to remove lock")
+		}
+	}, nil
+}
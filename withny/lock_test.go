@@ -0,0 +1,73 @@
+package withny_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLockConcurrent(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "stream.lock")
+	const n = 8
+	var acquired, rejected atomic.Int32
+	releases := make(chan func(), n)
+	var wg sync.WaitGroup
+
+	// Act
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := withny.AcquireLock(path)
+			switch {
+			case err == nil:
+				acquired.Add(1)
+				releases <- release
+			case errors.Is(err, withny.ErrAlreadyDownloading):
+				rejected.Add(1)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(releases)
+
+	// Assert
+	require.Equal(t, int32(1), acquired.Load())
+	require.Equal(t, int32(n-1), rejected.Load())
+	for release := range releases {
+		release()
+	}
+	_, err := os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	release, err := withny.AcquireLock(path)
+	require.NoError(t, err, "the lock must be acquirable once released")
+	release()
+}
+
+func TestAcquireLockStale(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "stream.lock")
+	require.NoError(t, os.WriteFile(path, []byte("crashed 1\n"), 0o644))
+	old := time.Now().Add(-2 * withny.LockStaleAfter)
+	require.NoError(t, os.Chtimes(path, old, old))
+
+	// Act
+	release, err := withny.AcquireLock(path)
+
+	// Assert
+	require.NoError(t, err)
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), stat.ModTime(), time.Minute)
+	release()
+}
@@ -0,0 +1,54 @@
+package withny
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DurationFunc returns the duration of a recording.
+type DurationFunc func(path string) (time.Duration, error)
+
+// DiscardShortRecording deletes the recording and its companion files if the
+// recording is shorter than minDuration.
+//
+// It returns true if the files were deleted. Nothing is deleted if minDuration
+// is not positive or if the duration cannot be probed.
+func DiscardShortRecording(
+	ctx context.Context,
+	duration DurationFunc,
+	minDuration time.Duration,
+	recording string,
+	companions ...string,
+) bool {
+	if minDuration <= 0 {
+		return false
+	}
+	log := log.Ctx(ctx)
+	d, err := duration(recording)
+	if err != nil {
+		log.Warn().Err(err).Str("file", recording).Msg("failed to probe duration, keeping recording")
+		return false
+	}
+	if d >= minDuration {
+		return false
+	}
+
+	log.Info().
+		Str("file", recording).
+		Stringer("duration", d).
+		Stringer("minDuration", minDuration).
+		Msg("recording is too short, discarding")
+	for _, file := range append([]string{recording}, companions...) {
+		if file == "" {
+			continue
+		}
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Err(err).Str("file", file).Msg("failed to delete short recording file")
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package withny_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRecordingFiles(t *testing.T) (recording string, companions []string) {
+	dir := t.TempDir()
+	recording = filepath.Join(dir, "stream.ts")
+	companions = []string{
+		filepath.Join(dir, "stream.chat.json"),
+		filepath.Join(dir, "stream.info.json"),
+		filepath.Join(dir, "stream.avif"),
+	}
+	for _, f := range append([]string{recording}, companions...) {
+		require.NoError(t, os.WriteFile(f, []byte("data"), 0o644))
+	}
+	return recording, append(companions, filepath.Join(dir, "stream.ts.frag.jsonl"))
+}
+
+func TestDiscardShortRecording(t *testing.T) {
+	tt := []struct {
+		name        string
+		duration    time.Duration
+		durationErr error
+		minDuration time.Duration
+		discarded   bool
+	}{
+		{
+			name:        "too short",
+			duration:    5 * time.Second,
+			minDuration: time.Minute,
+			discarded:   true,
+		},
+		{
+			name:        "long enough",
+			duration:    time.Hour,
+			minDuration: time.Minute,
+		},
+		{
+			name:        "disabled",
+			duration:    time.Second,
+			minDuration: 0,
+		},
+		{
+			name:        "probe failure",
+			durationErr: errors.New("corrupted"),
+			minDuration: time.Minute,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			recording, companions := writeRecordingFiles(t)
+			probed := ""
+			duration := func(path string) (time.Duration, error) {
+				probed = path
+				return tc.duration, tc.durationErr
+			}
+
+			// Act
+			discarded := withny.DiscardShortRecording(
+				context.Background(),
+				duration,
+				tc.minDuration,
+				recording,
+				companions...,
+			)
+
+			// Assert
+			require.Equal(t, tc.discarded, discarded)
+			if tc.minDuration > 0 {
+				require.Equal(t, recording, probed)
+			}
+			for _, f := range append([]string{recording}, companions[:3]...) {
+				if tc.discarded {
+					require.NoFileExists(t, f)
+				} else {
+					require.FileExists(t, f)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package withny
+
+import (
+	"encoding/xml"
+	"io"
+
+	"github.com/Darkness4/withny-dl/withny/api"
+)
+
+// NFOEpisode is the Kodi/Jellyfin '.nfo' metadata of a recording.
+type NFOEpisode struct {
+	XMLName xml.Name `xml:"episodedetails"`
+	Title   string   `xml:"title"`
+	Plot    string   `xml:"plot,omitempty"`
+	// Aired is the start date of the stream, formatted as YYYY-MM-DD.
+	Aired  string `xml:"aired,omitempty"`
+	Studio string `xml:"studio,omitempty"`
+	Thumb  string `xml:"thumb,omitempty"`
+}
+
+// NewNFOEpisode converts the metadata of a stream into a NFOEpisode.
+func NewNFOEpisode(meta api.MetaData) NFOEpisode {
+	nfo := NFOEpisode{
+		Title:  meta.Stream.Title,
+		Plot:   meta.Stream.About,
+		Studio: meta.User.Name,
+		Thumb:  meta.Stream.ThumbnailURL,
+	}
+	if !meta.Stream.StartedAt.IsZero() {
+		nfo.Aired = meta.Stream.StartedAt.Local().Format("2006-01-02")
+	}
+	return nfo
+}
+
+// WriteNFO writes the '.nfo' metadata of the stream.
+func WriteNFO(w io.Writer, meta api.MetaData) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(NewNFOEpisode(meta)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
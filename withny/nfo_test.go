@@ -0,0 +1,57 @@
+package withny_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteNFO(t *testing.T) {
+	// Arrange
+	startedAt := time.Date(2024, 12, 31, 12, 0, 0, 0, time.Local)
+	meta := api.MetaData{
+		User: api.GetUserResponse{
+			Name: "Channel & Co",
+		},
+		Stream: api.GetStreamsResponseElement{
+			Title:        "<my title>",
+			About:        "about the stream",
+			ThumbnailURL: "https://example.com/thumb.jpg",
+			StartedAt:    startedAt,
+		},
+	}
+	var buf bytes.Buffer
+
+	// Act
+	err := withny.WriteNFO(&buf, meta)
+
+	// Assert
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(buf.String(), xml.Header))
+	var got withny.NFOEpisode
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &got))
+	require.Equal(t, "episodedetails", got.XMLName.Local)
+	require.Equal(t, "<my title>", got.Title)
+	require.Equal(t, "about the stream", got.Plot)
+	require.Equal(t, "2024-12-31", got.Aired)
+	require.Equal(t, "Channel & Co", got.Studio)
+	require.Equal(t, "https://example.com/thumb.jpg", got.Thumb)
+}
+
+func TestWriteNFOUnknownStart(t *testing.T) {
+	// Arrange
+	var buf bytes.Buffer
+
+	// Act
+	err := withny.WriteNFO(&buf, api.MetaData{})
+
+	// Assert
+	require.NoError(t, err)
+	require.NotContains(t, buf.String(), "<aired>")
+}
@@ -2,6 +2,7 @@ package withny
 
 import (
 	"bytes"
+	"sync"
 	"text/template"
 	"time"
 
@@ -10,31 +11,88 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// FormatOption is an option for FormatOutput.
+type FormatOption func(*formatOptions)
+
+type formatOptions struct {
+	episodeNumber int
+}
+
+// WithEpisodeNumber sets the EpisodeNumber template variable.
+func WithEpisodeNumber(n int) FormatOption {
+	return func(fo *formatOptions) {
+		fo.episodeNumber = n
+	}
+}
+
+func applyFormatOptions(opts []FormatOption) *formatOptions {
+	o := &formatOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// templates caches the compiled output formats, keyed by the format string.
+var templates sync.Map
+
+// parseOutFormat returns the compiled template of the output format.
+//
+// A template can be executed concurrently, so it is shared between the calls.
+func parseOutFormat(outFormat string) (*template.Template, error) {
+	if tmpl, ok := templates.Load(outFormat); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New("gotpl").Parse(outFormat)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := templates.LoadOrStore(outFormat, tmpl)
+	return actual.(*template.Template), nil
+}
+
 // FormatOutput formats the output file name.
 func FormatOutput(
 	outFormat string,
 	meta api.MetaData,
 	labels map[string]string,
 	ext string,
+	opts ...FormatOption,
 ) (string, error) {
+	o := applyFormatOptions(opts)
 	timeNow := time.Now()
+	// Fallback to the current time if the stream start is unknown.
+	startedAt := timeNow
+	if !meta.Stream.StartedAt.IsZero() {
+		startedAt = meta.Stream.StartedAt.Local()
+	}
 	formatInfo := struct {
-		ChannelID   string
-		ChannelName string
-		Date        string
-		Time        string
-		Title       string
-		Ext         string
-		MetaData    api.MetaData
-		Labels      map[string]string
+		ChannelID          string
+		ChannelName        string
+		ChannelProfileText string
+		Date               string
+		Time               string
+		StartedAt          time.Time
+		StartedAtDate      string
+		StartedAtTime      string
+		Title              string
+		StreamAbout        string
+		Ext                string
+		EpisodeNumber      int
+		MetaData           api.MetaData
+		Labels             map[string]string
 	}{
-		Date:   timeNow.Format("2006-01-02"),
-		Time:   timeNow.Format("150405"),
-		Ext:    ext,
-		Labels: labels,
+		Date:          timeNow.Format("2006-01-02"),
+		Time:          timeNow.Format("150405"),
+		StartedAt:     startedAt,
+		StartedAtDate: startedAt.Format("2006-01-02"),
+		StartedAtTime: startedAt.Format("150405"),
+		Ext:           ext,
+		EpisodeNumber: o.episodeNumber,
+		Labels:        labels,
 	}
 
-	tmpl, err := template.New("gotpl").Parse(outFormat)
+	tmpl, err := parseOutFormat(outFormat)
 	if err != nil {
 		log.Err(err).Msg("failed to parse output format")
 		return "", err
@@ -42,7 +100,9 @@ func FormatOutput(
 
 	formatInfo.ChannelID = utils.SanitizeFilename(meta.User.Username)
 	formatInfo.ChannelName = utils.SanitizeFilename(meta.User.Name)
+	formatInfo.ChannelProfileText = utils.SanitizeFilename(meta.User.ProfileText)
 	formatInfo.Title = utils.SanitizeFilename(meta.Stream.Title)
+	formatInfo.StreamAbout = utils.SanitizeFilename(meta.Stream.About)
 	formatInfo.MetaData = meta
 
 	var formatted bytes.Buffer
@@ -0,0 +1,65 @@
+package withny_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatOutputConcurrent(t *testing.T) {
+	// Arrange
+	const n = 16
+	format := "{{ .ChannelID }}/{{ .Title }}.{{ .Ext }}"
+	results := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+
+	// Act
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = withny.FormatOutput(format, api.MetaData{
+				User: api.GetUserResponse{
+					Username: "channel",
+				},
+				Stream: api.GetStreamsResponseElement{
+					Title: fmt.Sprintf("title %d", i),
+				},
+			}, nil, "ts")
+		}()
+	}
+	wg.Wait()
+
+	// Assert
+	for i := range n {
+		require.NoError(t, errs[i])
+		require.Equal(t, fmt.Sprintf("channel/title %d.ts", i), results[i])
+	}
+}
+
+func TestFormatOutputInvalidFormat(t *testing.T) {
+	// Act
+	_, err := withny.FormatOutput("{{ .Title", api.MetaData{}, nil, "ts")
+
+	// Assert
+	require.Error(t, err)
+}
+
+func BenchmarkFormatOutput(b *testing.B) {
+	meta := api.MetaData{
+		User: api.GetUserResponse{
+			Username: "channel",
+		},
+		Stream: api.GetStreamsResponseElement{
+			Title: "title",
+		},
+	}
+	for i := 0; i < b.N; i++ {
+		_, _ = withny.FormatOutput(withny.DefaultParams.OutFormat, meta, nil, "ts")
+	}
+}
@@ -2,6 +2,9 @@ package withny
 
 import (
 	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
 	"time"
 
 	"github.com/Darkness4/withny-dl/withny/api"
@@ -11,21 +14,52 @@ import (
 type Params struct {
 	QualityConstraint      api.PlaylistConstraint `yaml:"quality,omitempty"`
 	PacketLossMax          int                    `yaml:"packetLossMax,omitempty"`
+	WriteFragmentIndex     bool                   `yaml:"writeFragmentIndex,omitempty"`
+	MinFreeDiskBytes       int64                  `yaml:"minFreeDiskBytes,omitempty"`
+	BandwidthLimit         int64                  `yaml:"bandwidthLimit,omitempty"`
+	MaxFragmentSize        int64                  `yaml:"maxFragmentSize,omitempty"`
+	FragmentConcurrency    int                    `yaml:"fragmentConcurrency,omitempty"`
+	IdleTimeout            time.Duration          `yaml:"idleTimeout,omitempty"`
 	OutFormat              string                 `yaml:"outFormat,omitempty"`
+	SecondaryOutDir        string                 `yaml:"secondaryOutDir,omitempty"`
+	SecondaryOutDirFiles   []string               `yaml:"secondaryOutDirFiles,omitempty"`
 	WriteChat              bool                   `yaml:"writeChat,omitempty"`
+	ReconnectChat          bool                   `yaml:"reconnectChat,omitempty"`
+	ChatFormat             string                 `yaml:"chatFormat,omitempty"`
+	ChatToSRT              bool                   `yaml:"chatToSrt,omitempty"`
 	WriteMetaDataJSON      bool                   `yaml:"writeMetaDataJson,omitempty"`
+	WriteNFO               bool                   `yaml:"writeNfo,omitempty"`
+	WriteChannelInfo       bool                   `yaml:"writeChannelInfo,omitempty"`
 	WriteThumbnail         bool                   `yaml:"writeThumbnail,omitempty"`
+	EmbedThumbnail         bool                   `yaml:"embedThumbnail,omitempty"`
 	WaitPollInterval       time.Duration          `yaml:"waitPollInterval,omitempty"`
+	WaitPollJitter         time.Duration          `yaml:"waitPollJitter,omitempty"`
+	WaitTimeout            time.Duration          `yaml:"waitTimeout,omitempty"`
+	MaxConcurrentStreams   int                    `yaml:"maxConcurrentStreams,omitempty"`
 	Remux                  bool                   `yaml:"remux,omitempty"`
 	RemuxFormat            string                 `yaml:"remuxFormat,omitempty"`
+	VideoCodec             string                 `yaml:"videoCodec,omitempty"`
+	AudioCodec             string                 `yaml:"audioCodec,omitempty"`
 	Concat                 bool                   `yaml:"concat,omitempty"`
 	KeepIntermediates      bool                   `yaml:"keepIntermediates,omitempty"`
 	ScanDirectory          string                 `yaml:"scanDirectory,omitempty"`
 	EligibleForCleaningAge time.Duration          `yaml:"eligibleForCleaningAge,omitempty"`
 	DeleteCorrupted        bool                   `yaml:"deleteCorrupted,omitempty"`
+	MinDuration            time.Duration          `yaml:"minDuration,omitempty"`
+	SplitDuration          time.Duration          `yaml:"splitDuration,omitempty"`
 	ExtractAudio           bool                   `yaml:"extractAudio,omitempty"`
+	PostProcessingPipeline []string               `yaml:"postProcessingPipeline,omitempty"`
+	TitleFilter            string                 `yaml:"titleFilter,omitempty"`
+	TitleExclude           string                 `yaml:"titleExclude,omitempty"`
+	SkipTicketRequired     bool                   `yaml:"skipTicketRequired,omitempty"`
+	SkipPaidStreams        bool                   `yaml:"skipPaidStreams,omitempty"`
+	PostCommand            string                 `yaml:"postCommand,omitempty"`
+	PreCommand             string                 `yaml:"preCommand,omitempty"`
 	Labels                 map[string]string      `yaml:"labels,omitempty"`
 	Ignore                 []string               `yaml:"ignore,omitempty"`
+
+	titleFilterRegexp  *regexp.Regexp
+	titleExcludeRegexp *regexp.Regexp
 }
 
 func (p *Params) String() string {
@@ -33,23 +67,97 @@ func (p *Params) String() string {
 	return string(out)
 }
 
+// Compile compiles the regular expressions of the parameters.
+func (p *Params) Compile() (err error) {
+	p.titleFilterRegexp, p.titleExcludeRegexp = nil, nil
+	if p.TitleFilter != "" {
+		if p.titleFilterRegexp, err = regexp.Compile(p.TitleFilter); err != nil {
+			return fmt.Errorf("invalid titleFilter: %w", err)
+		}
+	}
+	if p.TitleExclude != "" {
+		if p.titleExcludeRegexp, err = regexp.Compile(p.TitleExclude); err != nil {
+			return fmt.Errorf("invalid titleExclude: %w", err)
+		}
+	}
+	return nil
+}
+
+// MatchesTitle returns true if the stream title passes the title filters.
+//
+// Compile must be called beforehand, otherwise the filters are ignored.
+func (p *Params) MatchesTitle(title string) bool {
+	if p.titleFilterRegexp != nil && !p.titleFilterRegexp.MatchString(title) {
+		return false
+	}
+	if p.titleExcludeRegexp != nil && p.titleExcludeRegexp.MatchString(title) {
+		return false
+	}
+	return true
+}
+
+// SkipsStream returns true if the stream is excluded by SkipTicketRequired or SkipPaidStreams.
+func (p *Params) SkipsStream(stream api.GetStreamsResponseElement) bool {
+	if (p.SkipTicketRequired || p.SkipPaidStreams) && stream.HasTicket {
+		return true
+	}
+	return p.SkipPaidStreams && isPaid(stream.Price)
+}
+
+func isPaid(price json.Number) bool {
+	if price == "" {
+		return false
+	}
+	v, err := price.Float64()
+	// An unparsable price is considered paid.
+	return err != nil || v != 0
+}
+
 // OptionalParams represents the optional parameters for the download.
 type OptionalParams struct {
 	QualityConstraint      *api.PlaylistConstraint `yaml:"quality,omitempty"`
 	PacketLossMax          *int                    `yaml:"packetLossMax,omitempty"`
+	WriteFragmentIndex     *bool                   `yaml:"writeFragmentIndex,omitempty"`
+	MinFreeDiskBytes       *int64                  `yaml:"minFreeDiskBytes,omitempty"`
+	BandwidthLimit         *int64                  `yaml:"bandwidthLimit,omitempty"`
+	MaxFragmentSize        *int64                  `yaml:"maxFragmentSize,omitempty"`
+	FragmentConcurrency    *int                    `yaml:"fragmentConcurrency,omitempty"`
+	IdleTimeout            *time.Duration          `yaml:"idleTimeout,omitempty"`
 	OutFormat              *string                 `yaml:"outFormat,omitempty"`
+	SecondaryOutDir        *string                 `yaml:"secondaryOutDir,omitempty"`
+	SecondaryOutDirFiles   []string                `yaml:"secondaryOutDirFiles,omitempty"`
 	WriteChat              *bool                   `yaml:"writeChat,omitempty"`
+	ReconnectChat          *bool                   `yaml:"reconnectChat,omitempty"`
+	ChatFormat             *string                 `yaml:"chatFormat,omitempty"`
+	ChatToSRT              *bool                   `yaml:"chatToSrt,omitempty"`
 	WriteMetaDataJSON      *bool                   `yaml:"writeMetaDataJson,omitempty"`
+	WriteNFO               *bool                   `yaml:"writeNfo,omitempty"`
+	WriteChannelInfo       *bool                   `yaml:"writeChannelInfo,omitempty"`
 	WriteThumbnail         *bool                   `yaml:"writeThumbnail,omitempty"`
+	EmbedThumbnail         *bool                   `yaml:"embedThumbnail,omitempty"`
 	WaitPollInterval       *time.Duration          `yaml:"waitPollInterval,omitempty"`
+	WaitPollJitter         *time.Duration          `yaml:"waitPollJitter,omitempty"`
+	WaitTimeout            *time.Duration          `yaml:"waitTimeout,omitempty"`
+	MaxConcurrentStreams   *int                    `yaml:"maxConcurrentStreams,omitempty"`
 	Remux                  *bool                   `yaml:"remux,omitempty"`
 	RemuxFormat            *string                 `yaml:"remuxFormat,omitempty"`
+	VideoCodec             *string                 `yaml:"videoCodec,omitempty"`
+	AudioCodec             *string                 `yaml:"audioCodec,omitempty"`
 	Concat                 *bool                   `yaml:"concat,omitempty"`
 	KeepIntermediates      *bool                   `yaml:"keepIntermediates,omitempty"`
 	ScanDirectory          *string                 `yaml:"scanDirectory,omitempty"`
 	EligibleForCleaningAge *time.Duration          `yaml:"eligibleForCleaningAge,omitempty"`
 	DeleteCorrupted        *bool                   `yaml:"deleteCorrupted,omitempty"`
+	MinDuration            *time.Duration          `yaml:"minDuration,omitempty"`
+	SplitDuration          *time.Duration          `yaml:"splitDuration,omitempty"`
 	ExtractAudio           *bool                   `yaml:"extractAudio,omitempty"`
+	PostProcessingPipeline []string                `yaml:"postProcessingPipeline,omitempty"`
+	TitleFilter            *string                 `yaml:"titleFilter,omitempty"`
+	TitleExclude           *string                 `yaml:"titleExclude,omitempty"`
+	SkipTicketRequired     *bool                   `yaml:"skipTicketRequired,omitempty"`
+	SkipPaidStreams        *bool                   `yaml:"skipPaidStreams,omitempty"`
+	PostCommand            *string                 `yaml:"postCommand,omitempty"`
+	PreCommand             *string                 `yaml:"preCommand,omitempty"`
 	Labels                 map[string]string       `yaml:"labels,omitempty"`
 	Ignore                 []string                `yaml:"ignore,omitempty"`
 }
@@ -58,19 +166,47 @@ type OptionalParams struct {
 var DefaultParams = Params{
 	QualityConstraint:      api.PlaylistConstraint{},
 	PacketLossMax:          20,
+	WriteFragmentIndex:     false,
+	MinFreeDiskBytes:       0,
+	BandwidthLimit:         0,
+	MaxFragmentSize:        0,
+	FragmentConcurrency:    1,
+	IdleTimeout:            5 * time.Minute,
 	OutFormat:              "{{ .Date }} {{ .Title }} ({{ .ChannelName }}).{{ .Ext }}",
+	SecondaryOutDir:        "",
+	SecondaryOutDirFiles:   []string{"mp4", "m4a", "info.json"},
 	WriteChat:              false,
+	ReconnectChat:          true,
+	ChatFormat:             "json",
+	ChatToSRT:              false,
 	WriteMetaDataJSON:      false,
+	WriteNFO:               false,
+	WriteChannelInfo:       false,
 	WriteThumbnail:         false,
+	EmbedThumbnail:         false,
 	WaitPollInterval:       10 * time.Second,
+	WaitPollJitter:         2500 * time.Millisecond,
+	WaitTimeout:            0,
+	MaxConcurrentStreams:   1,
 	Remux:                  true,
 	RemuxFormat:            "mp4",
+	VideoCodec:             "copy",
+	AudioCodec:             "copy",
 	Concat:                 true,
 	KeepIntermediates:      false,
 	ScanDirectory:          "",
 	EligibleForCleaningAge: 48 * time.Hour,
 	DeleteCorrupted:        true,
+	MinDuration:            0,
+	SplitDuration:          0,
 	ExtractAudio:           false,
+	PostProcessingPipeline: nil,
+	TitleFilter:            "",
+	TitleExclude:           "",
+	SkipTicketRequired:     false,
+	SkipPaidStreams:        false,
+	PostCommand:            "",
+	PreCommand:             "",
 	Labels:                 nil,
 	Ignore:                 []string{},
 }
@@ -83,20 +219,75 @@ func (override *OptionalParams) Override(params *Params) {
 	if override.PacketLossMax != nil {
 		params.PacketLossMax = *override.PacketLossMax
 	}
+	if override.WriteFragmentIndex != nil {
+		params.WriteFragmentIndex = *override.WriteFragmentIndex
+	}
+	if override.MinFreeDiskBytes != nil {
+		params.MinFreeDiskBytes = *override.MinFreeDiskBytes
+	}
+	if override.BandwidthLimit != nil {
+		params.BandwidthLimit = *override.BandwidthLimit
+	}
+	if override.MaxFragmentSize != nil {
+		params.MaxFragmentSize = *override.MaxFragmentSize
+	}
+	if override.FragmentConcurrency != nil {
+		params.FragmentConcurrency = *override.FragmentConcurrency
+	}
+	if override.IdleTimeout != nil {
+		params.IdleTimeout = *override.IdleTimeout
+	}
 	if override.OutFormat != nil {
 		params.OutFormat = *override.OutFormat
 	}
+	if override.SecondaryOutDir != nil {
+		params.SecondaryOutDir = *override.SecondaryOutDir
+	}
+	if override.SecondaryOutDirFiles != nil {
+		params.SecondaryOutDirFiles = override.SecondaryOutDirFiles
+	}
 	if override.WriteChat != nil {
 		params.WriteChat = *override.WriteChat
 	}
+	if override.ReconnectChat != nil {
+		params.ReconnectChat = *override.ReconnectChat
+	}
+	if override.ChatFormat != nil {
+		params.ChatFormat = *override.ChatFormat
+	}
+	if override.ChatToSRT != nil {
+		params.ChatToSRT = *override.ChatToSRT
+	}
 	if override.WriteMetaDataJSON != nil {
 		params.WriteMetaDataJSON = *override.WriteMetaDataJSON
 	}
+	if override.WriteNFO != nil {
+		params.WriteNFO = *override.WriteNFO
+	}
+	if override.WriteChannelInfo != nil {
+		params.WriteChannelInfo = *override.WriteChannelInfo
+	}
 	if override.WriteThumbnail != nil {
 		params.WriteThumbnail = *override.WriteThumbnail
 	}
+	if override.EmbedThumbnail != nil {
+		params.EmbedThumbnail = *override.EmbedThumbnail
+	}
 	if override.WaitPollInterval != nil {
 		params.WaitPollInterval = *override.WaitPollInterval
+		// The jitter follows the interval unless it is explicitly set.
+		if override.WaitPollJitter == nil {
+			params.WaitPollJitter = params.WaitPollInterval / 4
+		}
+	}
+	if override.WaitPollJitter != nil {
+		params.WaitPollJitter = *override.WaitPollJitter
+	}
+	if override.WaitTimeout != nil {
+		params.WaitTimeout = *override.WaitTimeout
+	}
+	if override.MaxConcurrentStreams != nil {
+		params.MaxConcurrentStreams = *override.MaxConcurrentStreams
 	}
 	if override.Remux != nil {
 		params.Remux = *override.Remux
@@ -104,6 +295,12 @@ func (override *OptionalParams) Override(params *Params) {
 	if override.RemuxFormat != nil {
 		params.RemuxFormat = *override.RemuxFormat
 	}
+	if override.VideoCodec != nil {
+		params.VideoCodec = *override.VideoCodec
+	}
+	if override.AudioCodec != nil {
+		params.AudioCodec = *override.AudioCodec
+	}
 	if override.Concat != nil {
 		params.Concat = *override.Concat
 	}
@@ -119,9 +316,36 @@ func (override *OptionalParams) Override(params *Params) {
 	if override.DeleteCorrupted != nil {
 		params.DeleteCorrupted = *override.DeleteCorrupted
 	}
+	if override.MinDuration != nil {
+		params.MinDuration = *override.MinDuration
+	}
+	if override.SplitDuration != nil {
+		params.SplitDuration = *override.SplitDuration
+	}
 	if override.ExtractAudio != nil {
 		params.ExtractAudio = *override.ExtractAudio
 	}
+	if override.PostProcessingPipeline != nil {
+		params.PostProcessingPipeline = override.PostProcessingPipeline
+	}
+	if override.TitleFilter != nil {
+		params.TitleFilter = *override.TitleFilter
+	}
+	if override.TitleExclude != nil {
+		params.TitleExclude = *override.TitleExclude
+	}
+	if override.SkipTicketRequired != nil {
+		params.SkipTicketRequired = *override.SkipTicketRequired
+	}
+	if override.SkipPaidStreams != nil {
+		params.SkipPaidStreams = *override.SkipPaidStreams
+	}
+	if override.PostCommand != nil {
+		params.PostCommand = *override.PostCommand
+	}
+	if override.PreCommand != nil {
+		params.PreCommand = *override.PreCommand
+	}
 	if override.Labels != nil {
 		if params.Labels == nil {
 			params.Labels = make(map[string]string)
@@ -141,19 +365,49 @@ func (p *Params) Clone() *Params {
 	clone := Params{
 		QualityConstraint:      p.QualityConstraint,
 		PacketLossMax:          p.PacketLossMax,
+		WriteFragmentIndex:     p.WriteFragmentIndex,
+		MinFreeDiskBytes:       p.MinFreeDiskBytes,
+		BandwidthLimit:         p.BandwidthLimit,
+		MaxFragmentSize:        p.MaxFragmentSize,
+		FragmentConcurrency:    p.FragmentConcurrency,
+		IdleTimeout:            p.IdleTimeout,
 		OutFormat:              p.OutFormat,
+		SecondaryOutDir:        p.SecondaryOutDir,
+		SecondaryOutDirFiles:   slices.Clone(p.SecondaryOutDirFiles),
 		WriteChat:              p.WriteChat,
+		ReconnectChat:          p.ReconnectChat,
+		ChatFormat:             p.ChatFormat,
+		ChatToSRT:              p.ChatToSRT,
 		WriteMetaDataJSON:      p.WriteMetaDataJSON,
+		WriteNFO:               p.WriteNFO,
+		WriteChannelInfo:       p.WriteChannelInfo,
 		WriteThumbnail:         p.WriteThumbnail,
+		EmbedThumbnail:         p.EmbedThumbnail,
 		WaitPollInterval:       p.WaitPollInterval,
+		WaitPollJitter:         p.WaitPollJitter,
+		WaitTimeout:            p.WaitTimeout,
+		MaxConcurrentStreams:   p.MaxConcurrentStreams,
 		Remux:                  p.Remux,
 		RemuxFormat:            p.RemuxFormat,
+		VideoCodec:             p.VideoCodec,
+		AudioCodec:             p.AudioCodec,
 		Concat:                 p.Concat,
 		KeepIntermediates:      p.KeepIntermediates,
 		ScanDirectory:          p.ScanDirectory,
 		EligibleForCleaningAge: p.EligibleForCleaningAge,
 		DeleteCorrupted:        p.DeleteCorrupted,
+		MinDuration:            p.MinDuration,
+		SplitDuration:          p.SplitDuration,
 		ExtractAudio:           p.ExtractAudio,
+		PostProcessingPipeline: slices.Clone(p.PostProcessingPipeline),
+		TitleFilter:            p.TitleFilter,
+		TitleExclude:           p.TitleExclude,
+		SkipTicketRequired:     p.SkipTicketRequired,
+		SkipPaidStreams:        p.SkipPaidStreams,
+		PostCommand:            p.PostCommand,
+		PreCommand:             p.PreCommand,
+		titleFilterRegexp:      p.titleFilterRegexp,
+		titleExcludeRegexp:     p.titleExcludeRegexp,
 		Ignore:                 make([]string, len(p.Ignore)),
 	}
 
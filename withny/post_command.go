@@ -0,0 +1,47 @@
+package withny
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/rs/zerolog/log"
+)
+
+// PostCommandEnv returns the environment variables passed to the post command.
+func PostCommandEnv(meta api.MetaData, outputFile string) []string {
+	var startTime string
+	if !meta.Stream.StartedAt.IsZero() {
+		startTime = meta.Stream.StartedAt.Format(time.RFC3339)
+	}
+	return []string{
+		"WITHNY_CHANNEL_ID=" + meta.User.Username,
+		"WITHNY_TITLE=" + meta.Stream.Title,
+		"WITHNY_OUTPUT_FILE=" + outputFile,
+		"WITHNY_START_TIME=" + startTime,
+	}
+}
+
+// RunPostCommand executes the command with 'sh -c' after a download.
+//
+// The metadata of the stream is passed through the environment, see PostCommandEnv.
+func RunPostCommand(
+	ctx context.Context,
+	command string,
+	meta api.MetaData,
+	outputFile string,
+) error {
+	log := log.Ctx(ctx)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), PostCommandEnv(meta, outputFile)...)
+	log.Info().Str("command", command).Str("file", outputFile).Msg("running post command...")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("post command failed: %w, output: %s", err, out)
+	}
+	log.Debug().Str("output", string(out)).Msg("post command finished")
+	return nil
+}
@@ -0,0 +1,50 @@
+package withny_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPostCommand(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	out := filepath.Join(dir, "env.txt")
+	meta := api.MetaData{
+		User: api.GetUserResponse{
+			Username: "channel",
+		},
+		Stream: api.GetStreamsResponseElement{
+			Title:     "my title",
+			StartedAt: time.Date(2024, 12, 31, 21, 0, 0, 0, time.UTC),
+		},
+	}
+	command := `printf '%s\n%s\n%s\n%s\n' "$WITHNY_CHANNEL_ID" "$WITHNY_TITLE" "$WITHNY_OUTPUT_FILE" "$WITHNY_START_TIME" > "` + out + `"`
+
+	// Act
+	err := withny.RunPostCommand(context.Background(), command, meta, "/tmp/video.mp4")
+
+	// Assert
+	require.NoError(t, err)
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(
+		t,
+		"channel\nmy title\n/tmp/video.mp4\n2024-12-31T21:00:00Z\n",
+		string(content),
+	)
+}
+
+func TestRunPostCommandFailure(t *testing.T) {
+	// Act
+	err := withny.RunPostCommand(context.Background(), "exit 3", api.MetaData{}, "")
+
+	// Assert
+	require.Error(t, err)
+}
@@ -0,0 +1,319 @@
+package withny
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Darkness4/withny-dl/telemetry/metrics"
+	"github.com/Darkness4/withny-dl/video/concat"
+	"github.com/Darkness4/withny-dl/video/probe"
+	"github.com/Darkness4/withny-dl/video/remux"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Post-processing steps.
+const (
+	PostProcessingStepRemux            = "remux"
+	PostProcessingStepExtractAudio     = "extract-audio"
+	PostProcessingStepConcat           = "concat"
+	PostProcessingStepVerify           = "verify"
+	PostProcessingStepEmbedThumbnail   = "embed-thumbnail"
+	PostProcessingStepExtractSubtitles = "extract-subtitles"
+)
+
+// PostProcessingSteps is the list of available post-processing steps.
+var PostProcessingSteps = []string{
+	PostProcessingStepRemux,
+	PostProcessingStepExtractAudio,
+	PostProcessingStepConcat,
+	PostProcessingStepVerify,
+	PostProcessingStepEmbedThumbnail,
+	PostProcessingStepExtractSubtitles,
+}
+
+// ValidatePostProcessingPipeline checks that every step of the pipeline is known.
+func ValidatePostProcessingPipeline(pipeline []string) error {
+	var errs []error
+	for _, step := range pipeline {
+		if !slices.Contains(PostProcessingSteps, step) {
+			errs = append(errs, fmt.Errorf("unknown post-processing step '%s'", step))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// postProcessingFiles are the files handled by the post-processing.
+type postProcessingFiles struct {
+	stream                  string
+	muxed                   string
+	audio                   string
+	concatenated            string
+	concatenatedPrefix      string
+	audioConcatenated       string
+	audioConcatenatedPrefix string
+	thumbnail               string
+	chat                    string
+	subtitles               string
+	startedAt               time.Time
+}
+
+// remuxOptions returns the options of the remux of the stream.
+func (w *ChannelWatcher) remuxOptions(files postProcessingFiles) []remux.Option {
+	opts := []remux.Option{
+		remux.WithVideoCodec(w.params.VideoCodec),
+		remux.WithAudioCodec(w.params.AudioCodec),
+	}
+	embed := w.params.EmbedThumbnail ||
+		slices.Contains(w.params.PostProcessingPipeline, PostProcessingStepEmbedThumbnail)
+	if !embed || !w.params.WriteThumbnail || files.thumbnail == "" {
+		return opts
+	}
+	return append(opts, remux.WithCoverArt(files.thumbnail))
+}
+
+// output returns the remuxed file if it exists, the stream file otherwise.
+func (f postProcessingFiles) output() string {
+	if _, err := os.Stat(f.muxed); err == nil {
+		return f.muxed
+	}
+	return f.stream
+}
+
+// logRemuxStderr logs the libav diagnostics of a failed remux at debug level.
+func logRemuxStderr(log *zerolog.Logger, err error) {
+	var remuxErr remux.RemuxError
+	if errors.As(err, &remuxErr) {
+		log.Debug().Str("stderr", remuxErr.Stderr).Msg("ffmpeg output")
+	}
+}
+
+// runPostProcessingPipeline executes the steps in order.
+//
+// It returns false if a step has failed.
+func (w *ChannelWatcher) runPostProcessingPipeline(
+	ctx context.Context,
+	channelID string,
+	files postProcessingFiles,
+	steps []string,
+) bool {
+	log := log.Ctx(ctx)
+	recordError := func() {
+		metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("channel_id", channelID),
+		))
+	}
+
+	var corrupted, remuxed, failed bool
+	var concatWg sync.WaitGroup
+	for _, step := range steps {
+		log := log.With().Str("step", step).Logger()
+		switch step {
+		case PostProcessingStepVerify:
+			if err := probe.Do([]string{files.stream}, probe.WithQuiet()); err != nil {
+				log.Error().Err(err).Msg("ts is unreadable by ffmpeg")
+				corrupted = true
+				if w.params.DeleteCorrupted {
+					if err := os.Remove(files.stream); err != nil {
+						log.Error().
+							Str("path", files.stream).
+							Err(err).
+							Msg("failed to remove corrupted file")
+					}
+				}
+			}
+
+		case PostProcessingStepRemux:
+			if corrupted {
+				log.Warn().Msg("stream is corrupted, skipping step")
+				continue
+			}
+			log.Info().Str("output", files.muxed).Str("input", files.stream).Msg(
+				"remuxing stream...",
+			)
+			if err := remux.Do(ctx, files.muxed, files.stream, w.remuxOptions(files)...); err != nil {
+				log.Error().Err(err).Msg("ffmpeg remux finished with error")
+				logRemuxStderr(&log, err)
+				recordError()
+				failed = true
+				continue
+			}
+			remuxed = true
+
+		case PostProcessingStepExtractAudio:
+			if corrupted {
+				log.Warn().Msg("stream is corrupted, skipping step")
+				continue
+			}
+			log.Info().Str("output", files.audio).Str("input", files.stream).Msg(
+				"extrating audio...",
+			)
+			if err := remux.Do(ctx, files.audio, files.stream, remux.WithAudioOnly()); err != nil {
+				log.Error().Err(err).Msg("ffmpeg audio extract finished with error")
+				logRemuxStderr(&log, err)
+				recordError()
+				failed = true
+			}
+
+		case PostProcessingStepConcat:
+			// Without remux, the legacy post-processing concatenates the audio
+			// from the streams, without extracting it first.
+			withAudio := slices.Contains(steps, PostProcessingStepExtractAudio) ||
+				(len(w.params.PostProcessingPipeline) == 0 && w.params.ExtractAudio)
+			// The next steps do not depend on the concatenation.
+			concatWg.Add(1)
+			go func() {
+				defer concatWg.Done()
+				w.concatenate(ctx, channelID, files, withAudio)
+			}()
+
+		case PostProcessingStepEmbedThumbnail:
+			if !slices.Contains(steps, PostProcessingStepRemux) {
+				log.Warn().Msg("the thumbnail is embedded by the remux step, which is missing")
+			}
+
+		case PostProcessingStepExtractSubtitles:
+			if _, err := os.Stat(files.subtitles); err == nil {
+				log.Debug().Str("output", files.subtitles).Msg("subtitles already extracted")
+				continue
+			}
+			if _, err := os.Stat(files.chat); err != nil {
+				log.Warn().Str("input", files.chat).Msg("no chat file, skipping step")
+				continue
+			}
+			log.Info().Str("output", files.subtitles).Str("input", files.chat).Msg(
+				"extracting subtitles...",
+			)
+			if err := WriteChatSRT(files.subtitles, files.chat, files.startedAt); err != nil {
+				log.Error().Err(err).Msg("failed to convert chat to srt")
+				recordError()
+				failed = true
+			}
+
+		default:
+			log.Error().Msg("unknown post-processing step, skipping")
+		}
+	}
+
+	concatWg.Wait()
+
+	// Delete intermediates
+	if !w.params.KeepIntermediates && remuxed && !corrupted && !failed {
+		log.Info().Str("file", files.stream).Msg("delete intermediate files")
+		if err := os.Remove(files.stream); err != nil {
+			log.Err(err).Msg("couldn't delete intermediate file")
+			recordError()
+		}
+	}
+	return !corrupted && !failed
+}
+
+// postProcessSplit post-processes a file of a split stream like the main
+// file, without concatenation nor subtitles extraction.
+func (w *ChannelWatcher) postProcessSplit(
+	ctx context.Context,
+	channelID string,
+	files postProcessingFiles,
+	split string,
+) {
+	base := strings.TrimSuffix(split, filepath.Ext(split))
+	files.stream = split
+	files.muxed = base + filepath.Ext(files.muxed)
+	files.audio = base + filepath.Ext(files.audio)
+
+	steps := w.params.PostProcessingPipeline
+	if len(steps) == 0 {
+		steps = w.legacyPostProcessingSteps()
+	}
+	// The chat covers the whole stream, its subtitles are extracted once.
+	steps = slices.DeleteFunc(slices.Clone(steps), func(step string) bool {
+		return step == PostProcessingStepConcat || step == PostProcessingStepExtractSubtitles
+	})
+	log.Ctx(ctx).Info().Str("file", split).Msg("post-processing split file...")
+	w.runPostProcessingPipeline(ctx, channelID, files, steps)
+}
+
+// legacyPostProcessingSteps returns the steps equivalent to the post-processing
+// used when the PostProcessingPipeline is empty.
+func (w *ChannelWatcher) legacyPostProcessingSteps() []string {
+	steps := []string{PostProcessingStepVerify}
+	if w.params.Remux {
+		steps = append(steps, PostProcessingStepRemux)
+	}
+	if w.params.ExtractAudio && (!w.params.Concat || w.params.Remux) {
+		steps = append(steps, PostProcessingStepExtractAudio)
+	}
+	if w.params.Concat {
+		steps = append(steps, PostProcessingStepConcat)
+	}
+	return steps
+}
+
+// concatenate concatenates the files sharing the same prefix.
+//
+// Each concatenation waits for the PostProcessingSemaphore.
+func (w *ChannelWatcher) concatenate(
+	ctx context.Context,
+	channelID string,
+	files postProcessingFiles,
+	withAudio bool,
+) {
+	log := log.Ctx(ctx)
+
+	concatWithPrefix := w.Concat
+	if concatWithPrefix == nil {
+		concatWithPrefix = concat.WithPrefix
+	}
+	run := func(remuxFormat string, prefix string, opts ...concat.Option) {
+		if w.PostProcessingSemaphore != nil {
+			if err := w.PostProcessingSemaphore.Acquire(ctx, 1); err != nil {
+				log.Err(err).Str("prefix", prefix).Msg("concatenation canceled")
+				return
+			}
+			defer w.PostProcessingSemaphore.Release(1)
+		}
+		if concatErr := concatWithPrefix(ctx, remuxFormat, prefix, opts...); concatErr != nil {
+			log.Error().Err(concatErr).Msg("ffmpeg concat finished with error")
+			metrics.PostProcessing.Errors.Add(ctx, 1, metric.WithAttributes(
+				attribute.String("channel_id", channelID),
+			))
+		}
+	}
+
+	// Concatenations are independent from each other, run them in parallel.
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		log.Info().Str("output", files.concatenated).Str("prefix", files.concatenatedPrefix).Msg(
+			"concatenating stream...",
+		)
+		run(w.params.RemuxFormat, files.concatenatedPrefix, concat.IgnoreExtension())
+	}()
+
+	if withAudio {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			log.Info().
+				Str("output", files.audioConcatenated).
+				Str("prefix", files.audioConcatenatedPrefix).
+				Msg(
+					"concatenating audio stream...",
+				)
+			run("m4a", files.audioConcatenatedPrefix, concat.IgnoreExtension(), concat.WithAudioOnly())
+		}()
+	}
+
+	wg.Wait()
+}
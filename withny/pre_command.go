@@ -0,0 +1,58 @@
+package withny
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/rs/zerolog/log"
+)
+
+// PreCommandEnv returns the environment variables passed to the pre command.
+func PreCommandEnv(meta api.MetaData) []string {
+	var startedAt string
+	if !meta.Stream.StartedAt.IsZero() {
+		startedAt = meta.Stream.StartedAt.Format(time.RFC3339)
+	}
+	return []string{
+		"WITHNY_CHANNEL_ID=" + meta.User.Username,
+		"WITHNY_STREAM_UUID=" + meta.Stream.UUID,
+		"WITHNY_TITLE=" + meta.Stream.Title,
+		"WITHNY_STARTED_AT=" + startedAt,
+	}
+}
+
+// RunPreCommand executes the command with 'sh -c' before a download.
+//
+// It reports whether the stream should be downloaded, which is false if the
+// command exits with a non-zero code. An error is returned if the command
+// could not be run. The metadata of the stream is passed through the
+// environment, see PreCommandEnv.
+func RunPreCommand(
+	ctx context.Context,
+	command string,
+	meta api.MetaData,
+) (bool, error) {
+	log := log.Ctx(ctx)
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), PreCommandEnv(meta)...)
+	log.Info().Str("command", command).Msg("running pre command...")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		log.Info().
+			Int("exitCode", exitErr.ExitCode()).
+			Str("output", string(out)).
+			Msg("pre command rejected the stream")
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("pre command failed: %w, output: %s", err, out)
+	}
+	log.Debug().Str("output", string(out)).Msg("pre command finished")
+	return true, nil
+}
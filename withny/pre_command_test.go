@@ -0,0 +1,172 @@
+package withny_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/utils/secret"
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/Darkness4/withny-dl/withny/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunPreCommand(t *testing.T) {
+	// Arrange
+	out := filepath.Join(t.TempDir(), "env.txt")
+	meta := api.MetaData{
+		User: api.GetUserResponse{
+			Username: "channel",
+		},
+		Stream: api.GetStreamsResponseElement{
+			UUID:      "uuid",
+			Title:     "my title",
+			StartedAt: time.Date(2024, 12, 31, 21, 0, 0, 0, time.UTC),
+		},
+	}
+	command := `printf '%s\n%s\n%s\n%s\n' "$WITHNY_CHANNEL_ID" "$WITHNY_STREAM_UUID" "$WITHNY_TITLE" "$WITHNY_STARTED_AT" > "` + out + `"`
+
+	// Act
+	ok, err := withny.RunPreCommand(context.Background(), command, meta)
+
+	// Assert
+	require.NoError(t, err)
+	require.True(t, ok)
+	content, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "channel\nuuid\nmy title\n2024-12-31T21:00:00Z\n", string(content))
+}
+
+func TestRunPreCommandRejects(t *testing.T) {
+	// Act
+	ok, err := withny.RunPreCommand(context.Background(), "exit 1", api.MetaData{})
+
+	// Assert
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestChannelWatcherProcessPreCommand(t *testing.T) {
+	tt := []struct {
+		name        string
+		preCommand  string
+		expectedErr error
+	}{
+		{
+			name:        "exit 1 skips the stream",
+			preCommand:  "exit 1",
+			expectedErr: withny.ErrStreamSkipped,
+		},
+		{
+			// The stream is locked by another instance, which stops the
+			// download right after the pre command.
+			name:        "exit 0 downloads the stream",
+			preCommand:  "exit 0",
+			expectedErr: withny.ErrAlreadyDownloading,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			// Arrange
+			server := httptest.NewServer(http.NotFoundHandler())
+			defer server.Close()
+			client := api.NewClient(
+				server.Client(),
+				nil,
+				secret.NewFileCache(filepath.Join(t.TempDir(), "credentials")),
+				api.WithBaseURL(server.URL+"/api/"),
+			)
+			dir := t.TempDir()
+			params := withny.DefaultParams.Clone()
+			params.OutFormat = filepath.Join(dir, "{{ .Title }}")
+			params.PreCommand = tc.preCommand
+			impl := withny.NewChannelWatcher(api.NewClientPool(client), params, "channel")
+			meta := api.MetaData{
+				User:   api.GetUserResponse{Username: "channel"},
+				Stream: api.GetStreamsResponseElement{UUID: "uuid", Title: "title"},
+			}
+			if tc.expectedErr == withny.ErrAlreadyDownloading {
+				release, err := withny.AcquireLock(filepath.Join(dir, "uuid.lock"))
+				require.NoError(t, err)
+				defer release()
+			}
+
+			// Act
+			recorded, err := impl.Process(context.Background(), meta, server.URL+"/playlist.m3u8")
+
+			// Assert
+			require.Empty(t, recorded)
+			require.ErrorIs(t, err, tc.expectedErr)
+			if tc.expectedErr == withny.ErrStreamSkipped {
+				entries, err := os.ReadDir(dir)
+				require.NoError(t, err)
+				require.Empty(t, entries, "no file must be created")
+			}
+		})
+	}
+}
+
+func TestChannelWatcherPreCommandRejectsOnce(t *testing.T) {
+	// Arrange
+	stream := api.GetStreamsResponseElement{
+		UUID:            "uuid",
+		Title:           "title",
+		StreamingMethod: "HLS",
+	}
+	stream.Cast.AgencySecret.ChannelName = "channel"
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/streams/with-rooms":
+			polls.Add(1)
+			_ = json.NewEncoder(w).Encode(api.GetStreamsResponse{stream})
+		case r.URL.Path == "/api/user":
+			_, _ = w.Write([]byte(`{"username":"channel"}`))
+		case strings.HasSuffix(r.URL.Path, "/playback-url"):
+			_ = json.NewEncoder(w).Encode("https://example.com/uuid.m3u8")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	client := api.NewClient(
+		server.Client(),
+		nil,
+		secret.NewFileCache(filepath.Join(t.TempDir(), "credentials")),
+		api.WithBaseURL(server.URL+"/api/"),
+	)
+	dir := t.TempDir()
+	runs := filepath.Join(dir, "runs.txt")
+	params := withny.DefaultParams.Clone()
+	params.OutFormat = filepath.Join(dir, "{{ .Title }}.{{ .Ext }}")
+	params.WaitPollInterval = 10 * time.Millisecond
+	params.WaitPollJitter = 0
+	params.PreCommand = `echo run >> "` + runs + `"; exit 1`
+	impl := withny.NewChannelWatcher(api.NewClientPool(client), params, "channel")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+
+	// Act
+	go func() {
+		done <- impl.Watch(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		return polls.Load() >= 10
+	}, 4*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	// Assert
+	content, err := os.ReadFile(runs)
+	require.NoError(t, err)
+	require.Equal(t, "run\n", string(content))
+}
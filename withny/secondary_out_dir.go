@@ -0,0 +1,90 @@
+package withny
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// outFormatRoot returns the directory of the output format without any
+// template field, from which the output subdirectories are created.
+func outFormatRoot(outFormat string) string {
+	static, _, _ := strings.Cut(outFormat, "{{")
+	if static == outFormat {
+		return filepath.Dir(outFormat)
+	}
+	i := strings.LastIndexAny(static, `/\`)
+	if i < 0 {
+		return "."
+	}
+	if i == 0 {
+		return static[:1]
+	}
+	return static[:i]
+}
+
+// CopyToSecondaryOutDir copies the files ending with one of the suffixes into
+// the secondary output directory.
+//
+// The path of the files relative to the root of the output format is
+// preserved. Missing files are ignored.
+func CopyToSecondaryOutDir(
+	outFormat string,
+	secondaryOutDir string,
+	suffixes []string,
+	files ...string,
+) error {
+	root := outFormatRoot(outFormat)
+	var errs []error
+	for _, file := range files {
+		if file == "" || !hasAnySuffix(file, suffixes) {
+			continue
+		}
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(file)
+		}
+		if err := copyFile(filepath.Join(secondaryOutDir, rel), file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func hasAnySuffix(file string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(file, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFile copies src into dst, creating the parent directories.
+//
+// The content is copied instead of renamed, as dst can be on another
+// filesystem.
+func copyFile(dst, src string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
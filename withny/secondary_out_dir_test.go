@@ -0,0 +1,58 @@
+package withny_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyToSecondaryOutDir(t *testing.T) {
+	// Arrange
+	primary := t.TempDir()
+	secondary := t.TempDir()
+	outFormat := filepath.Join(primary, "{{ .ChannelID }}/{{ .Date }} {{ .Title }}.{{ .Ext }}")
+	dir := filepath.Join(primary, "channel")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	files := map[string]string{
+		"stream.mp4":       "video",
+		"stream.m4a":       "audio",
+		"stream.info.json": "{}",
+		"stream.chat.json": "[]",
+	}
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		paths = append(paths, path)
+	}
+	paths = append(paths, filepath.Join(dir, "missing.mp4"), "")
+
+	// Act
+	err := withny.CopyToSecondaryOutDir(
+		outFormat,
+		secondary,
+		[]string{"mp4", "m4a", "info.json"},
+		paths...,
+	)
+
+	// Assert
+	require.NoError(t, err)
+	for name, content := range files {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err, "the primary file must be kept")
+		require.Equal(t, content, string(got))
+
+		got, err = os.ReadFile(filepath.Join(secondary, "channel", name))
+		if name == "stream.chat.json" {
+			require.ErrorIs(t, err, os.ErrNotExist)
+			continue
+		}
+		require.NoError(t, err)
+		require.Equal(t, content, string(got))
+	}
+	_, err = os.Stat(filepath.Join(secondary, "channel", "missing.mp4"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,93 @@
+package withny
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/Darkness4/withny-dl/hls"
+)
+
+// SplitWriter appends the fragments to a file, and switches to a new file
+// every SplitDuration, like a log rotation.
+//
+// The files are only switched between two fragments, so that each file is a
+// valid MPEG-TS. The first file is created on the first fragment.
+type SplitWriter struct {
+	// FileName is the name of the first file.
+	FileName string
+	// SplitDuration is the wall-clock duration after which a new file is started.
+	SplitDuration time.Duration
+	// NextFileName returns the name of the next file.
+	NextFileName func() (string, error)
+	// OnSplit is called with the name of every new file after the first one.
+	OnSplit func(fname string)
+	// Now returns the current time. (default: time.Now)
+	Now func() time.Time
+
+	file     *os.File
+	openedAt time.Time
+	files    []string
+}
+
+// WriteFragment appends the fragment to the current file.
+func (sw *SplitWriter) WriteFragment(_ hls.Fragment, r io.Reader) error {
+	now := sw.now()
+	if sw.file == nil {
+		if len(sw.files) > 0 {
+			return os.ErrClosed
+		}
+		if err := sw.open(sw.FileName, now); err != nil {
+			return err
+		}
+	} else if sw.SplitDuration > 0 && now.Sub(sw.openedAt) >= sw.SplitDuration {
+		fname, err := sw.NextFileName()
+		if err != nil {
+			return err
+		}
+		if err := sw.file.Close(); err != nil {
+			return err
+		}
+		if err := sw.open(fname, now); err != nil {
+			return err
+		}
+		if sw.OnSplit != nil {
+			sw.OnSplit(fname)
+		}
+	}
+	_, err := io.Copy(sw.file, r)
+	return err
+}
+
+// Files returns the names of the files created so far.
+func (sw *SplitWriter) Files() []string {
+	return sw.files
+}
+
+// Close closes the current file.
+func (sw *SplitWriter) Close() error {
+	if sw.file == nil {
+		return nil
+	}
+	err := sw.file.Close()
+	sw.file = nil
+	return err
+}
+
+func (sw *SplitWriter) open(fname string, now time.Time) error {
+	file, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	sw.file = file
+	sw.openedAt = now
+	sw.files = append(sw.files, fname)
+	return nil
+}
+
+func (sw *SplitWriter) now() time.Time {
+	if sw.Now != nil {
+		return sw.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,71 @@
+package withny_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Darkness4/withny-dl/hls"
+	"github.com/Darkness4/withny-dl/withny"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitWriter(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := start
+	n := 0
+	var splits []string
+	sw := &withny.SplitWriter{
+		FileName:      filepath.Join(dir, "stream.ts"),
+		SplitDuration: 10 * time.Second,
+		NextFileName: func() (string, error) {
+			n++
+			return filepath.Join(dir, fmt.Sprintf("stream.%d.ts", n)), nil
+		},
+		OnSplit: func(fname string) {
+			splits = append(splits, fname)
+		},
+		Now: func() time.Time { return now },
+	}
+
+	// Act
+	// A fragment every 5 seconds, for 30 seconds.
+	for i := range 6 {
+		now = start.Add(time.Duration(i) * 5 * time.Second)
+		err := sw.WriteFragment(hls.Fragment{}, strings.NewReader(fmt.Sprintf("%d", i)))
+		require.NoError(t, err)
+	}
+	require.NoError(t, sw.Close())
+
+	// Assert
+	want := []string{
+		filepath.Join(dir, "stream.ts"),
+		filepath.Join(dir, "stream.1.ts"),
+		filepath.Join(dir, "stream.2.ts"),
+	}
+	require.Equal(t, want, sw.Files())
+	require.Equal(t, want[1:], splits)
+	for i, fname := range want {
+		content, err := os.ReadFile(fname)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("%d%d", 2*i, 2*i+1), string(content))
+	}
+}
+
+func TestSplitWriterClosed(t *testing.T) {
+	// Arrange
+	sw := &withny.SplitWriter{FileName: filepath.Join(t.TempDir(), "stream.ts")}
+	require.NoError(t, sw.WriteFragment(hls.Fragment{}, strings.NewReader("data")))
+	require.NoError(t, sw.Close())
+
+	// Act
+	err := sw.WriteFragment(hls.Fragment{}, strings.NewReader("data"))
+
+	// Assert
+	require.ErrorIs(t, err, os.ErrClosed)
+}